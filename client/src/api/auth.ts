@@ -9,6 +9,7 @@ export interface LoginResponse extends ApiResponse {
     pictureUrl: string;
   };
   token: string;
+  refreshToken: string;
 }
 
 export const loginApi = (
@@ -33,6 +34,7 @@ export const loginApi = (
           message: "Login successfully",
           status: "success",
           token: "token123",
+          refreshToken: "refresh123",
         },
         status: 200,
         statusText: "OK",
@@ -64,6 +66,7 @@ export const googleLoginApi = (
           message: "Login successfully",
           status: "success",
           token: "token123",
+          refreshToken: "refresh123",
         },
         status: 200,
         statusText: "OK",
@@ -115,10 +118,11 @@ export const verifyOtpApi = (
   api: AxiosInstance,
   email: string,
   otp: string,
+  purpose: "reset-password" | "verify-email",
   mock: boolean = false,
 ): Promise<AxiosResponse<ApiResponse>> => {
   if (!mock) {
-    return api.post<ApiResponse>("/auth/verify", { email, otp });
+    return api.post<ApiResponse>("/auth/verify", { email, otp, purpose });
   }
 
   return new Promise<AxiosResponse<ApiResponse>>((resolve) => {
@@ -191,3 +195,10 @@ export const resetPasswordApi = (
     }, 1500);
   });
 };
+
+export const logoutApi = (
+  api: AxiosInstance,
+  refreshToken: string,
+): Promise<AxiosResponse<ApiResponse>> => {
+  return api.post<ApiResponse>("/auth/logout", { refreshToken });
+};
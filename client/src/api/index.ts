@@ -1,29 +1,118 @@
-import axios from "axios";
+import axios, { AxiosError, InternalAxiosRequestConfig } from "axios";
+
+export const ACCESS_TOKEN_KEY = "accessToken";
+export const REFRESH_TOKEN_KEY = "refreshToken";
 
 export const api = axios.create({
   baseURL: import.meta.env.VITE_API_URL,
 });
 
+// CF headers for staging & production
+const cfHeaders = (): Record<string, string> => {
+  const env = import.meta.env.VITE_ENV;
+  if (env === "dev") return {};
+
+  return {
+    "CF-Access-Client-Id": import.meta.env.VITE_CF_ACCESS_CLIENT_ID,
+    "CF-Access-Client-Secret": import.meta.env.VITE_CF_ACCESS_CLIENT_SECRET,
+  };
+};
+
 api.interceptors.request.use((req) => {
-  const token = localStorage.getItem("accessToken");
+  const token = localStorage.getItem(ACCESS_TOKEN_KEY);
   if (token !== null) {
     req.headers.Authorization = `Bearer ${token}`;
   }
 
-  // Add CF headers for staging & production
-  const env = import.meta.env.VITE_ENV;
-  if (env !== "dev") {
-    req.headers["CF-Access-Client-Id"] =
-      import.meta.env.VITE_CF_ACCESS_CLIENT_ID;
-    req.headers["CF-Access-Client-Secret"] =
-      import.meta.env.VITE_CF_ACCESS_CLIENT_SECRET;
+  for (const [name, value] of Object.entries(cfHeaders())) {
+    req.headers[name] = value;
   }
 
   return req;
 });
 
+export const storeTokens = (accessToken: string, refreshToken?: string) => {
+  localStorage.setItem(ACCESS_TOKEN_KEY, accessToken);
+  if (refreshToken) {
+    localStorage.setItem(REFRESH_TOKEN_KEY, refreshToken);
+  }
+};
+
+export const clearTokens = () => {
+  localStorage.removeItem(ACCESS_TOKEN_KEY);
+  localStorage.removeItem(REFRESH_TOKEN_KEY);
+};
+
+// Requests failing at the same time share one refresh, since each refresh token can only be used once
+let refreshing: Promise<string> | null = null;
+
+const refreshAccessToken = (): Promise<string> => {
+  if (refreshing) return refreshing;
+
+  const refreshToken = localStorage.getItem(REFRESH_TOKEN_KEY);
+  if (!refreshToken) {
+    return Promise.reject(new Error("No refresh token"));
+  }
+
+  // Plain axios so a failed refresh doesn't go through the interceptors again
+  refreshing = axios
+    .post<RefreshResponse>(
+      "/auth/refresh",
+      { refreshToken },
+      { baseURL: import.meta.env.VITE_API_URL, headers: cfHeaders() },
+    )
+    .then(({ data }) => {
+      storeTokens(data.token, data.refreshToken);
+      return data.token;
+    })
+    .catch((error) => {
+      // The session is gone, the user has to log in again
+      clearTokens();
+      throw error;
+    })
+    .finally(() => {
+      refreshing = null;
+    });
+
+  return refreshing;
+};
+
+// Access tokens are short-lived, so rotate them with the refresh token and retry once
+api.interceptors.response.use(
+  (res) => res,
+  async (error: AxiosError) => {
+    const req = error.config as
+      | (InternalAxiosRequestConfig & { _retried?: boolean })
+      | undefined;
+    if (
+      error.response?.status !== 401 ||
+      !req ||
+      req._retried ||
+      req.url?.startsWith("/auth")
+    ) {
+      return Promise.reject(error);
+    }
+
+    req._retried = true;
+    let token: string;
+    try {
+      token = await refreshAccessToken();
+    } catch {
+      return Promise.reject(error);
+    }
+
+    req.headers.Authorization = `Bearer ${token}`;
+    return api(req);
+  },
+);
+
 export interface ApiResponse {
   data: object;
   message: string;
   status: string;
 }
+
+interface RefreshResponse extends ApiResponse {
+  token: string;
+  refreshToken: string;
+}
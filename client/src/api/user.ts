@@ -1,11 +1,11 @@
 import { AxiosInstance, AxiosResponse } from "axios";
 import { ApiResponse } from ".";
-import { IFriendRequests, IUser } from "../types/user";
+import { IFriendRequests, IUser, IUserProfile } from "../types/user";
 
-interface UpdateUserRequest {
-  field: string;
-  value: string;
-}
+// JSON Merge Patch: null removes a field, missing fields are left as they are
+export type UpdateUserRequest = {
+  [K in keyof IUserProfile]?: IUserProfile[K] | null;
+};
 
 interface GetNumFriendsResponse extends ApiResponse {
   data: {
@@ -28,7 +28,7 @@ interface CountPendingFriendRequestsResponse extends ApiResponse {
 }
 
 interface UpdateUserResponse extends ApiResponse {
-  data: UpdateUserRequest;
+  data: IUser;
 }
 
 export const getNumFriendsApi = (
@@ -62,14 +62,12 @@ export const getNumFriendsApi = (
 export const updateUserApi = (
   api: AxiosInstance,
   userId: number,
-  field: string,
-  value: string,
+  patch: UpdateUserRequest,
   mock: boolean = false,
 ): Promise<AxiosResponse<UpdateUserResponse>> => {
   if (!mock) {
-    return api.patch<UpdateUserResponse>(`/users/${userId}`, {
-      field,
-      value,
+    return api.patch<UpdateUserResponse>(`/users/${userId}`, patch, {
+      headers: { "Content-Type": "application/merge-patch+json" },
     });
   }
 
@@ -77,10 +75,7 @@ export const updateUserApi = (
     setTimeout(() => {
       resolve({
         data: {
-          data: {
-            field,
-            value,
-          },
+          data: { id: userId, ...patch } as IUser,
           message: "User successfully updated",
           status: "success",
         },
@@ -1,7 +1,18 @@
 import React, { createContext, useState } from "react";
 import { AuthContextType, AuthState, BaseContextResponse } from "../types";
-import { googleLoginApi, loginApi, LoginResponse } from "../api/auth";
-import { api } from "../api";
+import {
+  googleLoginApi,
+  loginApi,
+  LoginResponse,
+  logoutApi,
+} from "../api/auth";
+import {
+  ACCESS_TOKEN_KEY,
+  api,
+  clearTokens,
+  REFRESH_TOKEN_KEY,
+  storeTokens,
+} from "../api";
 import { useUserCtx } from "./user";
 import useContextWrapper from "../hooks/useContextWrapper";
 import { AxiosError } from "axios";
@@ -21,13 +32,16 @@ const AuthProvider: React.FC<{ children: React.ReactNode }> = ({
   const { setUser } = useUserCtx();
 
   const checkAuth = (): boolean => {
-    const accessToken = localStorage.getItem("accessToken");
+    const accessToken = localStorage.getItem(ACCESS_TOKEN_KEY);
     if (!accessToken) return false;
 
     // Decode the token to get the user's info
     const decodedToken = jwtDecode<DecodedJWTToken>(accessToken);
-    // Check if token is expired
-    if (decodedToken.exp * 1000 < Date.now()) {
+    // Expired access tokens are rotated on the next request, as long as there is a refresh token
+    if (
+      decodedToken.exp * 1000 < Date.now() &&
+      !localStorage.getItem(REFRESH_TOKEN_KEY)
+    ) {
       // Clear state and log user out
       logout();
       return false;
@@ -49,8 +63,8 @@ const AuthProvider: React.FC<{ children: React.ReactNode }> = ({
   };
 
   const handleLoginResponse = (res: LoginResponse) => {
-    const { data, token } = res;
-    localStorage.setItem("accessToken", token);
+    const { data, token, refreshToken } = res;
+    storeTokens(token, refreshToken);
     setAuthState({
       accessToken: token,
       authenticated: true,
@@ -96,13 +110,21 @@ const AuthProvider: React.FC<{ children: React.ReactNode }> = ({
   };
 
   const logout = async () => {
+    // Revoke the session on the server, the user is logged out locally either way
+    const refreshToken = localStorage.getItem(REFRESH_TOKEN_KEY);
+    if (refreshToken) {
+      logoutApi(api, refreshToken).catch((error) =>
+        console.error("Error revoking session: ", error),
+      );
+    }
+
     return new Promise<boolean>((resolve) => {
       setTimeout(() => {
         setAuthState({
           accessToken: undefined,
           authenticated: false,
         });
-        localStorage.removeItem("accessToken");
+        clearTokens();
         setUser({
           id: -1,
           email: "",
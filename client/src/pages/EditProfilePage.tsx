@@ -25,8 +25,10 @@ const EditProfilePage = () => {
   const onSubmit: SubmitHandler<{ username: string }> = async (data) => {
     startLoading();
     try {
-      await updateUserApi(api, user.id, "username", data.username);
-      setUser({ ...user, username: data.username });
+      const res = await updateUserApi(api, user.id, {
+        username: data.username,
+      });
+      setUser({ ...user, username: res.data.data.username });
       showToast(`Updated username successfully!`, false);
       stopLoading();
       setTimeout(() => navigate(-1), 1000);
@@ -39,6 +41,9 @@ const EditProfilePage = () => {
         case 404:
           setErrorMsg("User not found.");
           break;
+        case 409:
+          setErrorMsg("Username is already taken.");
+          break;
         case 500:
         default:
           setErrorMsg("An error occurred. Please try again later.");
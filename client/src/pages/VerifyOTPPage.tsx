@@ -46,7 +46,11 @@ const VerifyOTPPage = () => {
     setCountdown(30);
 
     try {
-      await sendOtpEmailApi(api, email, "verify-email");
+      await sendOtpEmailApi(
+        api,
+        email,
+        from === "/forgotPassword" ? "reset-password" : "verify-email",
+      );
       showToast("OTP sent successfully!", false);
     } catch (error) {
       console.error(error);
@@ -80,7 +84,12 @@ const VerifyOTPPage = () => {
     startLoading(0);
     try {
       console.log("[VerifyOTPPage] Verifying OTP:", otp, email);
-      await verifyOtpApi(api, email, otp);
+      await verifyOtpApi(
+        api,
+        email,
+        otp,
+        from === "/forgotPassword" ? "reset-password" : "verify-email",
+      );
       showToast("Email verified successfully!", false);
       setTimeout(() => {
         if (from === "/forgotPassword")
@@ -7,15 +7,25 @@ export interface BaseUserInfo {
   pictureUrl: string;
 }
 
-export interface IUser {
-  id: number;
+// Fields the user can edit through updateUserApi
+export interface IUserProfile {
   username: string;
+  displayName: string;
+  bio: string;
+  phoneNum: string;
+  timeZone: string;
+  locale: string;
+}
+
+export interface IUser extends IUserProfile {
+  id: number;
   email: string;
   password: string;
   pictureUrl: string;
   isEmailValid: boolean;
   isOnline: boolean;
   lastSeen: string;
+  hidePresence: boolean;
   registeredAt: string;
   updatedAt: string;
 }
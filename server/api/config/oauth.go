@@ -1,6 +1,8 @@
 package config
 
 import (
+	"strings"
+
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
@@ -17,3 +19,68 @@ func SetupGoogleOAuthConfig() *oauth2.Config {
 		Endpoint: google.Endpoint,
 	}
 }
+
+const (
+	OIDC_PROVIDER_TYPE_OIDC   = "oidc"
+	OIDC_PROVIDER_TYPE_GITHUB = "github"
+)
+
+type OIDCProviderConfig struct {
+	Name         string
+	Type         string // OIDC_PROVIDER_TYPE_OIDC or OIDC_PROVIDER_TYPE_GITHUB
+	IssuerURL    string // discovery document is served at <issuer>/.well-known/openid-configuration
+	APIURL       string // only for GitHub, which has no ID tokens and serves the profile from its API
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// SetupOIDCProviderConfigs reads the providers listed in OIDC_PROVIDERS (e.g. "keycloak,okta,github").
+// Each provider is configured with OIDC_<NAME>_ISSUER_URL, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL and optionally OIDC_<NAME>_SCOPES.
+// Setting OIDC_<NAME>_TYPE=github uses GitHub's OAuth2 flow instead, where the issuer URL
+// defaults to https://github.com and OIDC_<NAME>_API_URL to https://api.github.com.
+func SetupOIDCProviderConfigs() map[string]OIDCProviderConfig {
+	providers := make(map[string]OIDCProviderConfig)
+
+	for _, name := range strings.Split(Config("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := OIDCProviderConfig{
+			Name:         name,
+			Type:         strings.ToLower(Config(prefix + "TYPE")),
+			IssuerURL:    Config(prefix + "ISSUER_URL"),
+			APIURL:       Config(prefix + "API_URL"),
+			ClientID:     Config(prefix + "CLIENT_ID"),
+			ClientSecret: Config(prefix + "CLIENT_SECRET"),
+			RedirectURL:  Config(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(Config(prefix + "SCOPES")),
+		}
+
+		if cfg.Type == OIDC_PROVIDER_TYPE_GITHUB {
+			if cfg.IssuerURL == "" {
+				cfg.IssuerURL = "https://github.com"
+			}
+			if cfg.APIURL == "" {
+				cfg.APIURL = "https://api.github.com"
+			}
+			if len(cfg.Scopes) == 0 {
+				cfg.Scopes = []string{"read:user", "user:email"}
+			}
+		} else {
+			cfg.Type = OIDC_PROVIDER_TYPE_OIDC
+			if len(cfg.Scopes) == 0 {
+				cfg.Scopes = []string{"openid", "email", "profile"}
+			}
+		}
+
+		providers[name] = cfg
+	}
+
+	return providers
+}
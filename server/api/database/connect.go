@@ -5,6 +5,7 @@ import (
 
 	config "github.com/RowenTey/JustJio/server/api/config"
 	model "github.com/RowenTey/JustJio/server/api/model"
+	utils "github.com/RowenTey/JustJio/server/api/utils"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -38,6 +39,14 @@ func ConnectDB() {
 }
 
 func Migrate(db *gorm.DB) error {
+	// Needed for the trigram indexes used by user search
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		return err
+	}
+
+	// Decided before AutoMigrate adds the column, see below
+	backfillHasPassword := !db.Migrator().HasColumn(&model.User{}, "HasPassword")
+
 	if err := db.AutoMigrate(
 		&model.User{},
 		&model.FriendRequest{},
@@ -49,9 +58,90 @@ func Migrate(db *gorm.DB) error {
 		&model.Message{},
 		&model.Notification{},
 		&model.Subscription{},
+		&model.RefreshToken{},
+		&model.RevokedToken{},
+		&model.OTP{},
+		&model.UserTOTP{},
+		&model.RecoveryCode{},
+		&model.TwoFactorChallenge{},
+		&model.UserIdentity{},
+		&model.SigningKey{},
+		&model.MagicLink{},
+		&model.AuthThrottle{},
+		&model.AuditLog{},
+		&model.PersonalAccessToken{},
+		&model.Passkey{},
+		&model.WebAuthnSession{},
+		&model.UserBlock{},
+		&model.DataExport{},
+		&model.AccountDeletion{},
+		&model.FriendCircle{},
 	); err != nil {
 		return err
 	}
+
+	// Social logins used to store a random bcrypt password, which can't be told apart from a real one.
+	// Only argon2id hashes are known to come from a password the user typed, the others
+	// are marked once the user logs in with them.
+	if backfillHasPassword {
+		if err := db.Exec(`UPDATE users SET has_password = true WHERE password LIKE '$argon2id$%'`).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := encryptTOTPSecrets(db); err != nil {
+		return err
+	}
+
+	if err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON users USING gin (username gin_trgm_ops);
+		CREATE INDEX IF NOT EXISTS users_display_name_trgm_idx ON users USING gin (display_name gin_trgm_ops);
+		CREATE INDEX IF NOT EXISTS users_email_prefix_idx ON users (lower(email) text_pattern_ops);
+		CREATE UNIQUE INDEX IF NOT EXISTS users_phone_num_idx ON users (phone_num) WHERE phone_num <> '';
+	`).Error; err != nil {
+		return err
+	}
+
+	// Reject updates and deletes so the audit log can only be appended to
+	return db.Exec(`
+		CREATE OR REPLACE FUNCTION reject_audit_log_changes() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_logs is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs;
+		CREATE TRIGGER audit_logs_append_only
+			BEFORE UPDATE OR DELETE ON audit_logs
+			FOR EACH ROW EXECUTE FUNCTION reject_audit_log_changes();
+	`).Error
+}
+
+// TOTP secrets used to be stored in plaintext, encrypt any that can't be decrypted yet
+func encryptTOTPSecrets(db *gorm.DB) error {
+	key := config.Config("JWT_SECRET")
+
+	var totps []model.UserTOTP
+	if err := db.Find(&totps).Error; err != nil {
+		return err
+	}
+
+	for _, totp := range totps {
+		if _, err := utils.Decrypt(totp.Secret, key); err == nil {
+			continue
+		}
+
+		encryptedSecret, err := utils.Encrypt([]byte(totp.Secret), key)
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&model.UserTOTP{}).
+			Where("user_id = ?", totp.UserID).
+			Update("secret", encryptedSecret).Error; err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// GetAccountDeletion returns when the account is scheduled to be deleted
+func GetAccountDeletion(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	deletion, err := services.NewAccountDeletionService(database.DB).GetScheduledDeletion(userId)
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "Account is not scheduled for deletion")
+	}
+
+	return utils.HandleSuccess(c, "Retrieved account deletion successfully", deletion)
+}
+
+// CancelAccountDeletion keeps the account if it's still in the grace period
+func CancelAccountDeletion(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := services.NewAccountDeletionService(database.DB).CancelDeletion(userId); err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "Account is not scheduled for deletion")
+	}
+
+	recordAuditEvent(c, userId, services.AUDIT_EVENT_ACCOUNT_DELETION_CANCELLED, true,
+		map[string]any{"reason": "user"})
+	return utils.HandleSuccess(c, "Account deletion cancelled", nil)
+}
+
+// GetSettlementPlan lists the bills and transactions to settle before the account can be deleted
+func GetSettlementPlan(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	plan, err := services.NewAccountDeletionService(database.DB).GetSettlementPlan(userId)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Retrieved settlement plan successfully", plan)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var auditLogger = log.WithFields(log.Fields{"service": "AuditHandler"})
+
+// GetAccountActivity lists the logged in user's recent security events
+func GetAccountActivity(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	auditLogs, err := services.NewAuditService(database.DB).
+		GetAuditLogs(services.AuditLogFilter{UserID: &userId}, c.QueryInt("page", 1))
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Retrieved account activity successfully", auditLogs)
+}
+
+// GetAuditLogs lets admins query the audit log, optionally by user and event
+func GetAuditLogs(c *fiber.Ctx) error {
+	filter := services.AuditLogFilter{Event: c.Query("event")}
+	if c.Query("userId") != "" {
+		userId := uint(c.QueryInt("userId"))
+		filter.UserID = &userId
+	}
+
+	auditLogs, err := services.NewAuditService(database.DB).GetAuditLogs(filter, c.QueryInt("page", 1))
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Retrieved audit logs successfully", auditLogs)
+}
+
+// recordAuditEvent appends a security event for the current request. userId is 0 when
+// the request didn't match an account. Errors are only logged so they never fail the request.
+func recordAuditEvent(c *fiber.Ctx, userId uint, event string, success bool, details map[string]any) {
+	entry := &model.AuditLog{
+		Event:     event,
+		Success:   success,
+		Details:   details,
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+	if userId != 0 {
+		entry.UserID = &userId
+	}
+
+	if err := services.NewAuditService(database.DB).Record(entry); err != nil {
+		auditLogger.Error("Error recording audit event ", event, ": ", err)
+	}
+}
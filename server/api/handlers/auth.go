@@ -3,7 +3,7 @@ package handlers
 import (
 	"errors"
 	"fmt"
-	"sync"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
@@ -19,23 +19,25 @@ import (
 	"gorm.io/gorm"
 )
 
-// Global variable to access the ClientOTP map
-// Store OTP with email as key
-var ClientOTP sync.Map
-
 var authLogger = log.WithFields(log.Fields{"service": "AuthHandler"})
 
 func SignUp(c *fiber.Ctx) error {
-	var user model.User
-	if err := c.BodyParser(&user); err != nil {
+	var input request.SignUpRequest
+	if err := c.BodyParser(&input); err != nil {
 		return utils.HandleInvalidInputError(c, err)
 	}
-	authLogger.Info("Received sign up request for user: ", user.Username)
+	authLogger.Info("Received sign up request for user: ", input.Username)
+
+	user := model.User{
+		Username: input.Username,
+		Email:    input.Email,
+		Password: input.Password,
+	}
 
 	authService := services.NewAuthService(
 		utils.HashPassword,
 		config.Config("JWT_SECRET"),
-		utils.SendSMTPEmail,
+		utils.NewMailer(),
 		config.SetupGoogleOAuthConfig(),
 	)
 	userService := services.NewUserService(database.DB)
@@ -54,15 +56,25 @@ func SignUp(c *fiber.Ctx) error {
 		return utils.HandleInternalServerError(c, err)
 	}
 
+	// The context is reused once the handler returns, so copy what the goroutine needs
+	acceptLanguage := strings.Clone(c.Get(fiber.HeaderAcceptLanguage))
+
 	// Send OTP email
 	go func() {
-		otp := authService.GenerateOTP()
-		ClientOTP.Store(user.Email, otp)
+		otpService := services.NewOTPService(database.DB)
+		otp, err := otpService.CreateOTP(user.Email, "verify-email")
+		if err != nil {
+			authLogger.Error("Error generating OTP:", err)
+			return
+		}
 		authLogger.Info("Generated OTP for user: ", user.Username)
 
-		if err := authService.SendOTPEmail(otp, user.Username, user.Email, "verify-email"); err != nil {
+		if err := authService.SendOTPEmail(otp, user.Username, user.Email, "verify-email", acceptLanguage); err != nil {
 			authLogger.Error("Error sending OTP email:", err)
-			ClientOTP.Delete(user.Email)
+			if err := otpService.DeleteOTP(user.Email, "verify-email"); err != nil {
+				authLogger.Error("Error deleting OTP:", err)
+			}
+			return
 		}
 		authLogger.Info("Sent OTP email to user: ", user.Username)
 	}()
@@ -85,33 +97,78 @@ func Login(c *fiber.Ctx, kafkaSvc *services.KafkaService) error {
 	}
 
 	username := input.Username
+
+	// Failures are counted per account as well as per IP, so spraying passwords
+	// at one account from many IPs still gets it locked
+	throttleService := services.NewThrottleService(database.DB)
+	ipKey := services.ThrottleKey("login", "ip", c.IP())
+	if retryAfter, err := throttleService.Check(ipKey); err != nil {
+		recordAuditEvent(c, 0, services.AUDIT_EVENT_LOGIN, false,
+			map[string]any{"method": "password", "username": username, "reason": "throttled"})
+		return handleThrottleError(c, retryAfter, err)
+	}
+
 	user, err := services.NewUserService(database.DB).GetUserByUsername(username)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			recordAuditEvent(c, 0, services.AUDIT_EVENT_LOGIN, false,
+				map[string]any{"method": "password", "username": username, "reason": "user not found"})
+			recordLoginFailure(c, throttleService, nil, ipKey)
+		}
 		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
 	}
 
+	accountKey := loginThrottleKey(user.ID)
+	if retryAfter, err := throttleService.Check(accountKey); err != nil {
+		recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, false,
+			map[string]any{"method": "password", "reason": "throttled"})
+		return handleThrottleError(c, retryAfter, err)
+	}
+
 	if !utils.CheckPasswordHash(input.Password, user.Password) {
+		recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, false,
+			map[string]any{"method": "password", "reason": "invalid password"})
+		recordLoginFailure(c, throttleService, user, ipKey)
 		return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid password", errors.New("password does not match the user's password"))
 	}
 
+	if err := throttleService.Reset(accountKey); err != nil {
+		authLogger.Error("Error resetting login throttle: ", err)
+	}
+	rehashPassword(user, input.Password)
+
 	authService := services.NewAuthService(
 		utils.HashPassword,
 		config.Config("JWT_SECRET"),
-		utils.SendSMTPEmail,
+		utils.NewMailer(),
 		config.SetupGoogleOAuthConfig(),
 	)
-	token, err := authService.CreateToken(user)
+
+	// Users with 2FA enabled have to exchange a challenge token for the session
+	twoFactorEnabled, err := services.NewTwoFactorService(database.DB).IsEnabled(user.ID)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+	if twoFactorEnabled {
+		challengeToken, err := createTwoFactorChallenge(authService, user)
+		if err != nil {
+			return utils.HandleInternalServerError(c, err)
+		}
+
+		authLogger.Info("User " + user.Username + " requires 2FA to log in.")
+		return utils.HandleSuccess(c, "Two-factor authentication required", response.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+	}
+
+	token, refreshToken, err := createSession(c, authService, user, "")
 	if err != nil {
 		return utils.HandleInternalServerError(c, err)
 	}
 
 	// create user channel when login
-	go func() {
-		channel := fmt.Sprintf("user-%d", user.ID)
-		if err := kafkaSvc.CreateTopic(channel); err != nil {
-			authLogger.Error("Error creating topic", err)
-		}
-	}()
+	go createUserChannel(kafkaSvc, user.ID)
 
 	response := response.AuthResponse{
 		Username:   user.Username,
@@ -120,8 +177,9 @@ func Login(c *fiber.Ctx, kafkaSvc *services.KafkaService) error {
 		UID:        user.ID,
 	}
 
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, true, map[string]any{"method": "password"})
 	authLogger.Info("User " + response.Username + " logged in successfully.")
-	return utils.HandleLoginSuccess(c, "Login successfully", token, response)
+	return utils.HandleLoginSuccess(c, "Login successfully", token, refreshToken, response)
 }
 
 func SendOTPEmail(c *fiber.Ctx) error {
@@ -130,20 +188,29 @@ func SendOTPEmail(c *fiber.Ctx) error {
 		return utils.HandleInvalidInputError(c, err)
 	}
 
-	if request.Purpose != "verify-email" && request.Purpose != "reset-password" {
+	if !services.IsValidOTPPurpose(request.Purpose) {
 		return utils.HandleError(c, fiber.StatusBadRequest, "Invalid purpose", errors.New("invalid purpose"))
 	}
 
 	authService := services.NewAuthService(
 		utils.HashPassword,
 		config.Config("JWT_SECRET"),
-		utils.SendSMTPEmail,
+		utils.NewMailer(),
 		config.SetupGoogleOAuthConfig(),
 	)
 	userService := services.NewUserService(database.DB)
+	otpService := services.NewOTPService(database.DB)
+
+	throttleService := services.NewThrottleService(database.DB)
+	emailKey := services.ThrottleKey("otp", "email", request.Email)
+	ipKey := services.ThrottleKey("otp", "ip", c.IP())
+	if retryAfter, err := throttleService.Check(emailKey, ipKey); err != nil {
+		return handleThrottleError(c, retryAfter, err)
+	}
 
 	user, err := userService.GetUserByEmail(request.Email)
 	if err != nil {
+		recordFailure(throttleService, ipKey, services.IP_THROTTLE_POLICY)
 		return utils.HandleError(c, fiber.StatusNotFound, "Invalid email address", err)
 	}
 
@@ -151,13 +218,25 @@ func SendOTPEmail(c *fiber.Ctx) error {
 		return utils.HandleError(c, fiber.StatusConflict, "Email already verified", errors.New("email already verified"))
 	}
 
-	otp := authService.GenerateOTP()
-	ClientOTP.Store(user.Email, otp)
-	if err := authService.SendOTPEmail(otp, user.Username, user.Email, request.Purpose); err != nil {
+	otp, err := otpService.CreateOTP(user.Email, request.Purpose)
+	if err != nil {
+		if err.Error() == "otp recently sent" {
+			recordFailure(throttleService, emailKey, services.EMAIL_THROTTLE_POLICY)
+			return utils.HandleError(
+				c, fiber.StatusTooManyRequests, "Please wait before requesting another OTP", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := authService.SendOTPEmail(otp, user.Username, user.Email, request.Purpose, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
 		authLogger.Error("Error sending OTP email:", err)
-		ClientOTP.Delete(user.Email)
+		if err := otpService.DeleteOTP(user.Email, request.Purpose); err != nil {
+			authLogger.Error("Error deleting OTP:", err)
+		}
+		return utils.HandleInternalServerError(c, err)
 	}
 
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_OTP_SENT, true, map[string]any{"purpose": request.Purpose})
 	authLogger.Info("OTP sent to " + request.Email + " successfully.")
 	return utils.HandleSuccess(c, "OTP sent successfully", nil)
 }
@@ -168,38 +247,65 @@ func VerifyOTP(c *fiber.Ctx) error {
 		return utils.HandleInvalidInputError(c, err)
 	}
 
-	authService := services.NewAuthService(
-		utils.HashPassword,
-		config.Config("JWT_SECRET"),
-		utils.SendSMTPEmail,
-		config.SetupGoogleOAuthConfig(),
-	)
+	// Older clients only verify emails and don't send a purpose
+	if request.Purpose == "" {
+		request.Purpose = "verify-email"
+	}
+	if !services.IsValidOTPPurpose(request.Purpose) {
+		return utils.HandleError(c, fiber.StatusBadRequest, "Invalid purpose", errors.New("invalid purpose"))
+	}
+
 	userService := services.NewUserService(database.DB)
+	otpService := services.NewOTPService(database.DB)
+
+	throttleService := services.NewThrottleService(database.DB)
+	emailKey := services.ThrottleKey("verify", "email", request.Email)
+	ipKey := services.ThrottleKey("verify", "ip", c.IP())
+	if retryAfter, err := throttleService.Check(emailKey, ipKey); err != nil {
+		return handleThrottleError(c, retryAfter, err)
+	}
 
 	user, err := userService.GetUserByEmail(request.Email)
 	if err != nil {
+		recordFailure(throttleService, ipKey, services.IP_THROTTLE_POLICY)
 		return utils.HandleError(c, fiber.StatusNotFound, "Invalid email address", err)
 	}
 
-	user.IsEmailValid = true
-	_, err = userService.CreateOrUpdateUser(user, false)
-	if err != nil {
+	if err := otpService.VerifyOTP(user.Email, request.Purpose, request.OTP); err != nil {
+		recordAuditEvent(c, user.ID, services.AUDIT_EVENT_OTP_VERIFIED, false,
+			map[string]any{"purpose": request.Purpose, "reason": err.Error()})
+
+		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "invalid otp" {
+			recordFailure(throttleService, emailKey, services.EMAIL_THROTTLE_POLICY)
+			recordFailure(throttleService, ipKey, services.IP_THROTTLE_POLICY)
+		}
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return utils.HandleError(c, fiber.StatusBadRequest, "OTP not found", errors.New("OTP not found"))
+		case err.Error() == "invalid otp":
+			return utils.HandleError(c, fiber.StatusBadRequest, "Invalid OTP", err)
+		case err.Error() == "otp expired":
+			return utils.HandleError(c, fiber.StatusBadRequest, "OTP expired", err)
+		case err.Error() == "too many attempts":
+			return utils.HandleError(c, fiber.StatusTooManyRequests, "Too many attempts, please request a new OTP", err)
+		}
 		return utils.HandleInternalServerError(c, err)
 	}
 
-	otpValue, exists := ClientOTP.Load(user.Email)
-	if !exists {
-		return utils.HandleError(c, fiber.StatusBadRequest, "OTP not found", errors.New("OTP not found"))
-	}
+	// Reset password OTPs are consumed by ResetPassword instead
+	if request.Purpose == "verify-email" {
+		if err := otpService.ConsumeVerifiedOTP(user.Email, request.Purpose); err != nil {
+			return utils.HandleInternalServerError(c, err)
+		}
 
-	isVerified := authService.VerifyOTP(otpValue.(string), request.Email, request.OTP)
-	if !isVerified {
-		return utils.HandleError(c, fiber.StatusBadRequest, "Invalid OTP", errors.New("invalid OTP"))
+		user.IsEmailValid = true
+		if _, err := userService.CreateOrUpdateUser(user, false); err != nil {
+			return utils.HandleInternalServerError(c, err)
+		}
 	}
 
-	// Delete OTP after verification
-	ClientOTP.Delete(user.Email)
-
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_OTP_VERIFIED, true, map[string]any{"purpose": request.Purpose})
 	authLogger.Println("OTP verified successfully for email", request.Email)
 	return utils.HandleSuccess(c, "OTP verified successfully", nil)
 }
@@ -213,7 +319,7 @@ func ResetPassword(c *fiber.Ctx) error {
 	authService := services.NewAuthService(
 		utils.HashPassword,
 		config.Config("JWT_SECRET"),
-		utils.SendSMTPEmail,
+		utils.NewMailer(),
 		config.SetupGoogleOAuthConfig(),
 	)
 	userService := services.NewUserService(database.DB)
@@ -228,12 +334,39 @@ func ResetPassword(c *fiber.Ctx) error {
 		return utils.HandleInternalServerError(c, err)
 	}
 
+	tx := database.DB.Begin()
+
+	if err := services.NewOTPService(tx).ConsumeVerifiedOTP(user.Email, "reset-password"); err != nil {
+		tx.Rollback()
+		if err.Error() == "otp not verified" {
+			recordAuditEvent(c, user.ID, services.AUDIT_EVENT_PASSWORD_RESET, false, map[string]any{"reason": err.Error()})
+			return utils.HandleError(c, fiber.StatusForbidden, "Please verify the OTP sent to your email first", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
 	user.Password = hashedPassword
-	_, err = userService.CreateOrUpdateUser(user, false)
-	if err != nil {
+	user.HasPassword = true
+	if _, err := services.NewUserService(tx).CreateOrUpdateUser(user, false); err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	// Whoever knew the old password may already be logged in, so every session is logged out
+	if err := services.NewTokenService(tx).RevokeOtherSessions(user.ID, ""); err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
 		return utils.HandleInternalServerError(c, err)
 	}
 
+	// The user proved they own the account, so a lockout shouldn't keep them out
+	resetLoginThrottle(user.ID)
+
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_PASSWORD_RESET, true, nil)
 	authLogger.Info("Password reset successfully for email ", request.Email)
 	return utils.HandleSuccess(c, "Password reset successfully", nil)
 }
@@ -247,62 +380,153 @@ func GoogleLogin(c *fiber.Ctx, kafkaSvc *services.KafkaService) error {
 	authService := services.NewAuthService(
 		utils.HashPassword,
 		config.Config("JWT_SECRET"),
-		utils.SendSMTPEmail,
+		utils.NewMailer(),
 		config.SetupGoogleOAuthConfig(),
 	)
-	userService := services.NewUserService(database.DB)
 
-	googleUser, err := authService.GetGoogleUser(request.Code)
+	profile, err := fetchSocialProfile(c, authService, GOOGLE_PROVIDER, request.Code, "")
 	if err != nil {
-		return utils.HandleInternalServerError(c, err)
+		recordAuditEvent(c, 0, services.AUDIT_EVENT_LOGIN, false, map[string]any{"method": GOOGLE_PROVIDER, "reason": err.Error()})
+		return handleSocialProfileError(c, err)
 	}
 
-	user, err := userService.GetUserByEmail(googleUser.Email)
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return utils.HandleInternalServerError(c, err)
+	return completeSocialLogin(c, kafkaSvc, authService, GOOGLE_PROVIDER, profile)
+}
+
+func RefreshToken(c *fiber.Ctx) error {
+	var request request.RefreshTokenRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
 	}
 
-	// Create new user if not found
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		// Random password for OAuth user
-		hashedPassword, err := utils.HashPassword(utils.GenerateRandomString(32))
-		if err != nil {
-			return utils.HandleInternalServerError(c, err)
-		}
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+	tokenService := services.NewTokenService(database.DB)
+	userService := services.NewUserService(database.DB)
 
-		newUser := &model.User{
-			Username:     utils.FormatUsername(googleUser.Name),
-			Email:        googleUser.Email,
-			PictureUrl:   googleUser.Picture,
-			Password:     hashedPassword,
-			IsEmailValid: true,
+	refreshToken, err := tokenService.ConsumeRefreshToken(request.RefreshToken)
+	if err != nil {
+		if err.Error() == "refresh token reused" {
+			// The whole session was revoked, record it against the account it belonged to
+			if reused, err := tokenService.GetRefreshToken(request.RefreshToken); err == nil {
+				recordAuditEvent(c, reused.UserID, services.AUDIT_EVENT_TOKEN_REVOKED, true, map[string]any{"reason": "reuse"})
+			}
 		}
-		user, err = userService.CreateOrUpdateUser(newUser, true)
-		if err != nil {
-			return utils.HandleInternalServerError(c, err)
+		if errors.Is(err, gorm.ErrRecordNotFound) ||
+			err.Error() == "refresh token reused" ||
+			err.Error() == "refresh token expired" {
+			return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid or expired refresh token", err)
 		}
+		return utils.HandleInternalServerError(c, err)
 	}
 
-	token, err := authService.CreateToken(user)
+	user, err := userService.GetUserByID(fmt.Sprint(refreshToken.UserID))
 	if err != nil {
-		return utils.HandleInternalServerError(c, err)
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
 	}
 
-	// create user channel when login
-	go func() {
-		channel := fmt.Sprintf("user-%d", user.ID)
-		if err := kafkaSvc.CreateTopic(channel); err != nil {
-			authLogger.Error("Error creating topic", err)
-		}
-	}()
+	token, newRefreshToken, err := createSession(c, authService, user, refreshToken.FamilyID)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
 
 	response := response.AuthResponse{
-		Email:      user.Email,
 		Username:   user.Username,
+		Email:      user.Email,
 		PictureUrl: user.PictureUrl,
 		UID:        user.ID,
 	}
 
-	authLogger.Println("User " + response.Username + " authenticated via Google OAuth")
-	return utils.HandleLoginSuccess(c, "Authenticated via Google successfully", token, response)
+	authLogger.Info("Refreshed token for user " + user.Username)
+	return utils.HandleLoginSuccess(c, "Token refreshed successfully", token, newRefreshToken, response)
+}
+
+func Logout(c *fiber.Ctx) error {
+	var request request.RefreshTokenRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	refreshToken, err := services.NewTokenService(database.DB).RevokeRefreshToken(request.RefreshToken)
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "Refresh token not found")
+	}
+
+	recordAuditEvent(c, refreshToken.UserID, services.AUDIT_EVENT_TOKEN_REVOKED, true, map[string]any{"reason": "logout"})
+
+	return utils.HandleSuccess(c, "Logged out successfully", nil)
+}
+
+// rehashPassword upgrades a bcrypt hash, or an argon2id hash with outdated parameters,
+// once the user has logged in with the plaintext password. It also records that the password is usable.
+func rehashPassword(user *model.User, password string) {
+	if !user.HasPassword {
+		if err := services.NewUserService(database.DB).
+			UpdateUserField(fmt.Sprint(user.ID), "hasPassword", true); err != nil {
+			authLogger.Error("Error marking password as set: ", err)
+		} else {
+			user.HasPassword = true
+		}
+	}
+
+	if !utils.PasswordNeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		authLogger.Error("Error rehashing password: ", err)
+		return
+	}
+
+	// Not worth failing the login over, it will be retried on the next one
+	if err := services.NewUserService(database.DB).
+		UpdateUserField(fmt.Sprint(user.ID), "password", hashedPassword); err != nil {
+		authLogger.Error("Error saving rehashed password: ", err)
+		return
+	}
+	user.Password = hashedPassword
+}
+
+// createSession issues an access token and a refresh token for the user.
+// An empty familyId starts a new session, otherwise the refresh token is rotated within the family.
+func createSession(
+	c *fiber.Ctx,
+	authService *services.AuthService,
+	user *model.User,
+	familyId string,
+) (string, string, error) {
+	tokenService := services.NewTokenService(database.DB)
+	if familyId == "" {
+		familyId = tokenService.NewFamilyID()
+	}
+
+	signingKey, err := services.NewSigningKeyService(database.DB).GetSigningKey()
+	if err != nil {
+		return "", "", err
+	}
+
+	token, tokenId, err := authService.CreateToken(user, familyId, signingKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := tokenService.CreateRefreshToken(
+		user.ID, familyId, tokenId, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, refreshToken, nil
+}
+
+func createUserChannel(kafkaSvc *services.KafkaService, userId uint) {
+	channel := fmt.Sprintf("user-%d", userId)
+	if err := kafkaSvc.CreateTopic(channel); err != nil {
+		authLogger.Error("Error creating topic", err)
+	}
 }
@@ -7,17 +7,26 @@ import (
 	"errors"
 	"fmt"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/RowenTey/JustJio/server/api/config"
 	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/middleware"
 	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/model/request"
 	"github.com/RowenTey/JustJio/server/api/services"
 	"github.com/RowenTey/JustJio/server/api/tests"
 	"github.com/RowenTey/JustJio/server/api/utils"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/oauth2"
 	"gorm.io/gorm"
 )
@@ -30,12 +39,16 @@ type AuthHandlerTestSuite struct {
 	dependencies *tests.TestDependencies
 	kafkaService *services.KafkaService
 
+	// Emails are written here instead of being sent
+	mailDir string
+
 	originalNewAuthService func(
 		hashFunc func(string) (string, error),
 		jwtSecret string,
-		sendEmail func(string, string, string, string) error,
+		mailer utils.Mailer,
 		googleConfig *oauth2.Config,
 	) *services.AuthService
+	originalNewPasskeyService func(db *gorm.DB) *services.PasskeyService
 }
 
 func (suite *AuthHandlerTestSuite) SetupSuite() {
@@ -78,6 +91,32 @@ func (suite *AuthHandlerTestSuite) SetupSuite() {
 	suite.app.Post("/google", func(c *fiber.Ctx) error {
 		return GoogleLogin(c, suite.kafkaService)
 	})
+	suite.app.Post("/refresh", RefreshToken)
+	suite.app.Post("/logout", Logout)
+	suite.app.Post("/2fa", func(c *fiber.Ctx) error {
+		return VerifyTwoFactorLogin(c, suite.kafkaService)
+	})
+	suite.app.Get("/oidc/:provider", GetOIDCAuthURL)
+	suite.app.Post("/oidc/:provider", func(c *fiber.Ctx) error {
+		return OIDCLogin(c, suite.kafkaService)
+	})
+	suite.app.Post("/link", func(c *fiber.Ctx) error {
+		return ConfirmLink(c, suite.kafkaService)
+	})
+	suite.app.Post("/unlock", UnlockAccount)
+	suite.app.Post("/magic-link", SendMagicLink)
+	suite.app.Post("/magic-link/verify", func(c *fiber.Ctx) error {
+		return MagicLinkLogin(c, suite.kafkaService)
+	})
+	account := suite.app.Group("/account", middleware.Authenticated())
+	account.Post("/password", SetPassword)
+	account.Patch("/password", ChangePassword)
+	account.Get("/sessions", GetSessions)
+	account.Delete("/sessions/:sessionId", RevokeSession)
+	suite.app.Post("/passkey", BeginPasskeyLogin)
+	suite.app.Post("/passkey/verify", func(c *fiber.Ctx) error {
+		return PasskeyLogin(c, suite.kafkaService)
+	})
 }
 
 func (suite *AuthHandlerTestSuite) TearDownSuite() {
@@ -88,9 +127,8 @@ func (suite *AuthHandlerTestSuite) TearDownSuite() {
 func (suite *AuthHandlerTestSuite) SetupTest() {
 	// Mock external dependencies
 	mockJWTSecret := "test-secret" // Same as in test config
-	mockSendEmail := func(otp, username, email, purpose string) error {
-		return nil // Always succeed
-	}
+	suite.mailDir = suite.T().TempDir()
+	mockMailer := &utils.FileMailer{Dir: suite.mailDir}
 	mockGoogleConfig := &oauth2.Config{} // Empty config for tests
 
 	// Replace the auth service creation in your handler
@@ -98,15 +136,25 @@ func (suite *AuthHandlerTestSuite) SetupTest() {
 	services.NewAuthService = func(
 		hashFunc func(string) (string, error),
 		jwtSecret string,
-		sendEmail func(string, string, string, string) error,
+		mailer utils.Mailer,
 		googleConfig *oauth2.Config,
 	) *services.AuthService {
 		return &services.AuthService{
-			HashFunc:      utils.HashPassword,
-			JwtSecret:     mockJWTSecret,
-			SendSMTPEmail: mockSendEmail,
-			OAuthConfig:   mockGoogleConfig,
-			Logger:        log.WithFields(log.Fields{"service": "AuthService"}),
+			HashFunc:    utils.HashPassword,
+			JwtSecret:   mockJWTSecret,
+			Mailer:      mockMailer,
+			OAuthConfig: mockGoogleConfig,
+			Logger:      log.WithFields(log.Fields{"service": "AuthService"}),
+		}
+	}
+
+	suite.originalNewPasskeyService = services.NewPasskeyService
+	services.NewPasskeyService = func(db *gorm.DB) *services.PasskeyService {
+		return &services.PasskeyService{
+			DB:        db,
+			RPID:      "justjio.test",
+			RPOrigins: []string{"https://justjio.test"},
+			Logger:    log.WithFields(log.Fields{"service": "PasskeyService"}),
 		}
 	}
 
@@ -116,9 +164,14 @@ func (suite *AuthHandlerTestSuite) SetupTest() {
 func (suite *AuthHandlerTestSuite) TearDownTest() {
 	// Clear database after each test
 	suite.db.Exec("TRUNCATE TABLE users CASCADE")
+	suite.db.Exec("TRUNCATE TABLE otps")
+	suite.db.Exec("TRUNCATE TABLE auth_throttles")
+	suite.db.Exec("TRUNCATE TABLE audit_logs")
+	suite.db.Exec("TRUNCATE TABLE web_authn_sessions")
 
 	database.DB = nil                                      // Reset the database connection
 	services.NewAuthService = suite.originalNewAuthService // Restore original auth service creation
+	services.NewPasskeyService = suite.originalNewPasskeyService
 }
 
 func TestAuthHandlerSuite(t *testing.T) {
@@ -127,7 +180,7 @@ func TestAuthHandlerSuite(t *testing.T) {
 
 func (suite *AuthHandlerTestSuite) TestSignUp_Success() {
 	// Prepare request
-	newUser := model.User{
+	newUser := request.SignUpRequest{
 		Username: "testuser",
 		Email:    "test@example.com",
 		Password: "password123",
@@ -170,7 +223,7 @@ func (suite *AuthHandlerTestSuite) TestSignUp_DuplicateEmail() {
 	assert.NoError(suite.T(), err)
 
 	// Prepare request with duplicate email
-	newUser := model.User{
+	newUser := request.SignUpRequest{
 		Username: "testuser",
 		Email:    "existing@example.com", // duplicate email
 		Password: "password123",
@@ -195,6 +248,29 @@ func (suite *AuthHandlerTestSuite) TestSignUp_DuplicateEmail() {
 	assert.Equal(suite.T(), "Username or email already exists", response["message"])
 }
 
+func (suite *AuthHandlerTestSuite) TestSignUp_IgnoresServerManagedFields() {
+	existingUser := model.User{Username: "existinguser", Email: "existing@example.com", Password: "password123"}
+	err := suite.db.Create(&existingUser).Error
+	assert.NoError(suite.T(), err)
+
+	// Fields outside the sign up form can't be set, e.g. to overwrite another user's row
+	reqBody := fmt.Sprintf(
+		`{"id": %d, "username": "testuser", "email": "test@example.com", "password": "password123", "isEmailValid": true}`,
+		existingUser.ID)
+	status, _ := suite.postJSON("/signup", reqBody)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	var dbUser model.User
+	err = suite.db.Where("username = ?", "testuser").First(&dbUser).Error
+	assert.NoError(suite.T(), err)
+	assert.NotEqual(suite.T(), existingUser.ID, dbUser.ID)
+	assert.False(suite.T(), dbUser.IsEmailValid)
+
+	err = suite.db.First(&dbUser, existingUser.ID).Error
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "existinguser", dbUser.Username)
+}
+
 func (suite *AuthHandlerTestSuite) TestSignUp_InvalidInput() {
 	// Prepare request with invalid data
 	reqBody := bytes.NewBuffer([]byte(`{"random", "password": "password123"}`))
@@ -226,21 +302,21 @@ func (suite *AuthHandlerTestSuite) TestSignUp_InternalServerError() {
 	services.NewAuthService = func(
 		hashFunc func(string) (string, error),
 		jwtSecret string,
-		sendEmail func(string, string, string, string) error,
+		mailer utils.Mailer,
 		googleConfig *oauth2.Config,
 	) *services.AuthService {
 		return &services.AuthService{
-			HashFunc:      mockHash,
-			JwtSecret:     "test-secret",
-			SendSMTPEmail: func(string, string, string, string) error { return nil },
-			OAuthConfig:   &oauth2.Config{},
-			Logger:        log.WithFields(log.Fields{"service": "AuthService"}),
+			HashFunc:    mockHash,
+			JwtSecret:   "test-secret",
+			Mailer:      &utils.FileMailer{Dir: suite.T().TempDir()},
+			OAuthConfig: &oauth2.Config{},
+			Logger:      log.WithFields(log.Fields{"service": "AuthService"}),
 		}
 	}
 	defer func() { services.NewAuthService = originalNewAuthService }()
 
 	// Prepare request
-	newUser := model.User{
+	newUser := request.SignUpRequest{
 		Username: "testuser",
 		Email:    "test@example.com",
 		Password: "password123",
@@ -297,6 +373,27 @@ func (suite *AuthHandlerTestSuite) TestLogin_Success() {
 	assert.Equal(suite.T(), "Login successfully", response["message"])
 }
 
+func (suite *AuthHandlerTestSuite) TestLogin_RehashesBcryptPassword() {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	assert.NoError(suite.T(), err)
+
+	user := model.User{Username: "testuser", Email: "test@example.com", Password: string(hashedPassword)}
+	err = suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	status, _ := suite.postJSON("/login", `{"username": "testuser", "password": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	var updatedUser model.User
+	suite.db.First(&updatedUser, user.ID)
+	assert.True(suite.T(), strings.HasPrefix(updatedUser.Password, "$argon2id$"))
+	assert.True(suite.T(), utils.CheckPasswordHash("password123", updatedUser.Password))
+
+	// The upgraded hash still logs in
+	status, _ = suite.postJSON("/login", `{"username": "testuser", "password": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+}
+
 func (suite *AuthHandlerTestSuite) TestLogin_InvalidInput() {
 	// Prepare request with invalid data
 	reqBody := bytes.NewBuffer([]byte(`{"random", "password": "password123"}`))
@@ -516,11 +613,15 @@ func (suite *AuthHandlerTestSuite) TestVerifyOTP_InvalidOTP() {
 	assert.NoError(suite.T(), err)
 
 	// Store a valid OTP
-	ClientOTP.Store("test@example.com", "123456")
-	defer ClientOTP.Delete("test@example.com")
+	otp, err := services.NewOTPService(suite.db).CreateOTP("test@example.com", "verify-email")
+	assert.NoError(suite.T(), err)
 
 	// Prepare request with invalid OTP
-	reqBody := bytes.NewBuffer([]byte(`{"email": "test@example.com", "otp": "654321"}`))
+	wrongOtp := "000000"
+	if otp == wrongOtp {
+		wrongOtp = "111111"
+	}
+	reqBody := bytes.NewBuffer([]byte(fmt.Sprintf(`{"email": "test@example.com", "otp": "%s"}`, wrongOtp)))
 
 	req := httptest.NewRequest("POST", "/verify", reqBody)
 	req.Header.Set("Content-Type", "application/json")
@@ -538,6 +639,168 @@ func (suite *AuthHandlerTestSuite) TestVerifyOTP_InvalidOTP() {
 	assert.Equal(suite.T(), "Invalid OTP", response["message"])
 }
 
+func (suite *AuthHandlerTestSuite) TestVerifyOTP_Success() {
+	// Create a user
+	user := model.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: utils.GenerateRandomString(32),
+	}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	otp, err := services.NewOTPService(suite.db).CreateOTP("test@example.com", "verify-email")
+	assert.NoError(suite.T(), err)
+
+	reqBody := bytes.NewBuffer([]byte(fmt.Sprintf(`{"email": "test@example.com", "otp": "%s"}`, otp)))
+
+	req := httptest.NewRequest("POST", "/verify", reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Execute request
+	resp, err := suite.app.Test(req)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	// Verify database
+	var dbUser model.User
+	err = suite.db.First(&dbUser, user.ID).Error
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), dbUser.IsEmailValid)
+
+	var count int64
+	suite.db.Model(&model.OTP{}).Where("email = ?", "test@example.com").Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+}
+
+func (suite *AuthHandlerTestSuite) TestVerifyOTP_InvalidOTPDoesNotVerifyEmail() {
+	// Create a user
+	user := model.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: utils.GenerateRandomString(32),
+	}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	_, err = services.NewOTPService(suite.db).CreateOTP("test@example.com", "verify-email")
+	assert.NoError(suite.T(), err)
+
+	reqBody := bytes.NewBuffer([]byte(`{"email": "test@example.com", "otp": "abcdef"}`))
+
+	req := httptest.NewRequest("POST", "/verify", reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Execute request
+	resp, err := suite.app.Test(req)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusBadRequest, resp.StatusCode)
+
+	// Verify database
+	var dbUser model.User
+	err = suite.db.First(&dbUser, user.ID).Error
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), dbUser.IsEmailValid)
+}
+
+func (suite *AuthHandlerTestSuite) TestSendOTPEmail_Cooldown() {
+	// Create a user
+	user := model.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: utils.GenerateRandomString(32),
+	}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	for _, expectedStatus := range []int{fiber.StatusOK, fiber.StatusTooManyRequests} {
+		reqBody := bytes.NewBuffer([]byte(`{"email": "test@example.com", "purpose": "reset-password"}`))
+
+		req := httptest.NewRequest("POST", "/otp", reqBody)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := suite.app.Test(req)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), expectedStatus, resp.StatusCode)
+	}
+}
+
+func (suite *AuthHandlerTestSuite) TestResetPassword_OTPNotVerified() {
+	// Create a user
+	user := model.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: utils.GenerateRandomString(32),
+	}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	reqBody := bytes.NewBuffer([]byte(`{"email": "test@example.com", "password": "newpassword123"}`))
+
+	req := httptest.NewRequest("PATCH", "/reset", reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Execute request
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+}
+
+func (suite *AuthHandlerTestSuite) TestResetPassword_Success() {
+	// Create a user
+	user := model.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: utils.GenerateRandomString(32),
+	}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	otpService := services.NewOTPService(suite.db)
+	otp, err := otpService.CreateOTP("test@example.com", "reset-password")
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), otpService.VerifyOTP("test@example.com", "reset-password", otp))
+
+	reqBody := bytes.NewBuffer([]byte(`{"email": "test@example.com", "password": "newpassword123"}`))
+
+	req := httptest.NewRequest("PATCH", "/reset", reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Execute request
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	// Verify database
+	var dbUser model.User
+	err = suite.db.First(&dbUser, user.ID).Error
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), utils.CheckPasswordHash("newpassword123", dbUser.Password))
+
+	// The OTP can't be reused
+	assert.Error(suite.T(), otpService.ConsumeVerifiedOTP("test@example.com", "reset-password"))
+}
+
+func (suite *AuthHandlerTestSuite) TestResetPassword_RevokesSessions() {
+	loginResponse := suite.loginTestUser()
+
+	otpService := services.NewOTPService(suite.db)
+	otp, err := otpService.CreateOTP("test@example.com", "reset-password")
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), otpService.VerifyOTP("test@example.com", "reset-password", otp))
+
+	req := httptest.NewRequest("PATCH", "/reset",
+		bytes.NewBuffer([]byte(`{"email": "test@example.com", "password": "newpassword123"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	// Sessions from before the reset can't be refreshed
+	status, _ := suite.postRefreshToken("/refresh", loginResponse["refreshToken"].(string))
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+}
+
 func (suite *AuthHandlerTestSuite) TestResetPassword_InvalidInput() {
 	// Prepare request with invalid data
 	reqBody := bytes.NewBuffer([]byte(`{"random", "password": "password123"}`))
@@ -597,3 +860,835 @@ func (suite *AuthHandlerTestSuite) TestGoogleLogin_InvalidInput() {
 
 	assert.Equal(suite.T(), "Review your input", response["message"])
 }
+
+func (suite *AuthHandlerTestSuite) loginTestUser() map[string]any {
+	hashedPassword, err := utils.HashPassword("password123")
+	assert.NoError(suite.T(), err)
+
+	user := model.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: hashedPassword,
+	}
+	err = suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	reqBody := bytes.NewBuffer([]byte(`{"username": "testuser", "password": "password123"}`))
+	req := httptest.NewRequest("POST", "/login", reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var response map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(suite.T(), err)
+	return response
+}
+
+func (suite *AuthHandlerTestSuite) postRefreshToken(path, refreshToken string) (int, map[string]any) {
+	reqBody := bytes.NewBuffer([]byte(fmt.Sprintf(`{"refreshToken": "%s"}`, refreshToken)))
+	req := httptest.NewRequest("POST", path, reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+
+	var response map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(suite.T(), err)
+	return resp.StatusCode, response
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_ReturnsRefreshToken() {
+	response := suite.loginTestUser()
+
+	assert.NotEmpty(suite.T(), response["token"])
+	assert.NotEmpty(suite.T(), response["refreshToken"])
+}
+
+func (suite *AuthHandlerTestSuite) accountRequest(method, path, token, body string) (int, map[string]any) {
+	req := httptest.NewRequest(method, path, bytes.NewBuffer([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+
+	var response map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(suite.T(), err)
+	return resp.StatusCode, response
+}
+
+func (suite *AuthHandlerTestSuite) TestGetSessions_MarksCurrent() {
+	first := suite.loginTestUser()
+	status, _ := suite.postJSON("/login", `{"username": "testuser", "password": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	status, response := suite.accountRequest("GET", "/account/sessions", first["token"].(string), "")
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	sessions := response["data"].([]any)
+	assert.Len(suite.T(), sessions, 2)
+	current := 0
+	for _, session := range sessions {
+		if session.(map[string]any)["current"].(bool) {
+			current++
+		}
+	}
+	assert.Equal(suite.T(), 1, current)
+}
+
+func (suite *AuthHandlerTestSuite) TestRevokeSession_LogsOutSession() {
+	first := suite.loginTestUser()
+	_, second := suite.postJSON("/login", `{"username": "testuser", "password": "password123"}`)
+
+	_, response := suite.accountRequest("GET", "/account/sessions", first["token"].(string), "")
+	var otherSessionId string
+	for _, session := range response["data"].([]any) {
+		if !session.(map[string]any)["current"].(bool) {
+			otherSessionId = session.(map[string]any)["id"].(string)
+		}
+	}
+
+	status, _ := suite.accountRequest("DELETE", "/account/sessions/"+otherSessionId, first["token"].(string), "")
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	status, _ = suite.postRefreshToken("/refresh", second["refreshToken"].(string))
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+	status, _ = suite.accountRequest("GET", "/account/sessions", second["token"].(string), "")
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestChangePassword_EndsOtherSessions() {
+	first := suite.loginTestUser()
+	_, second := suite.postJSON("/login", `{"username": "testuser", "password": "password123"}`)
+
+	status, _ := suite.accountRequest("PATCH", "/account/password", first["token"].(string),
+		`{"currentPassword": "wrongpassword", "newPassword": "newpassword123"}`)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+
+	status, _ = suite.accountRequest("PATCH", "/account/password", first["token"].(string),
+		`{"currentPassword": "password123", "newPassword": "newpassword123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	// The other session is logged out, the current one is kept
+	status, _ = suite.postRefreshToken("/refresh", second["refreshToken"].(string))
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+	status, _ = suite.postRefreshToken("/refresh", first["refreshToken"].(string))
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	status, _ = suite.postJSON("/login", `{"username": "testuser", "password": "newpassword123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestRefreshToken_Success() {
+	loginResponse := suite.loginTestUser()
+
+	status, response := suite.postRefreshToken("/refresh", loginResponse["refreshToken"].(string))
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.Equal(suite.T(), "Token refreshed successfully", response["message"])
+	assert.NotEmpty(suite.T(), response["token"])
+	assert.NotEqual(suite.T(), loginResponse["refreshToken"], response["refreshToken"])
+}
+
+func (suite *AuthHandlerTestSuite) TestRefreshToken_ReuseRevokesFamily() {
+	loginResponse := suite.loginTestUser()
+	originalRefreshToken := loginResponse["refreshToken"].(string)
+
+	status, rotated := suite.postRefreshToken("/refresh", originalRefreshToken)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	// Replaying the original token is treated as theft
+	status, response := suite.postRefreshToken("/refresh", originalRefreshToken)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+	assert.Equal(suite.T(), "Invalid or expired refresh token", response["message"])
+
+	// The legitimately rotated token is revoked as well
+	status, _ = suite.postRefreshToken("/refresh", rotated["refreshToken"].(string))
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestRefreshToken_Invalid() {
+	status, response := suite.postRefreshToken("/refresh", "not-a-real-token")
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+	assert.Equal(suite.T(), "Invalid or expired refresh token", response["message"])
+}
+
+func (suite *AuthHandlerTestSuite) TestLogout_Success() {
+	loginResponse := suite.loginTestUser()
+	refreshToken := loginResponse["refreshToken"].(string)
+
+	status, response := suite.postRefreshToken("/logout", refreshToken)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.Equal(suite.T(), "Logged out successfully", response["message"])
+
+	// The session can no longer be refreshed
+	status, _ = suite.postRefreshToken("/refresh", refreshToken)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+
+	// The access token issued at login is on the deny list
+	userId := loginResponse["data"].(map[string]any)["id"]
+	var count int64
+	err := suite.db.Model(&model.RevokedToken{}).Where("user_id = ?", userId).Count(&count).Error
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1), count)
+}
+
+func (suite *AuthHandlerTestSuite) enableTwoFactor(userId uint) string {
+	secret, err := utils.GenerateTOTPSecret()
+	assert.NoError(suite.T(), err)
+
+	encryptedSecret, err := utils.Encrypt([]byte(secret), config.Config("JWT_SECRET"))
+	assert.NoError(suite.T(), err)
+
+	now := time.Now()
+	err = suite.db.Create(&model.UserTOTP{UserID: userId, Secret: encryptedSecret, ConfirmedAt: &now}).Error
+	assert.NoError(suite.T(), err)
+	return secret
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_TwoFactorRequired() {
+	hashedPassword, err := utils.HashPassword("password123")
+	assert.NoError(suite.T(), err)
+
+	user := model.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: hashedPassword,
+	}
+	err = suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+	secret := suite.enableTwoFactor(user.ID)
+
+	// Password login only returns a challenge token
+	reqBody := bytes.NewBuffer([]byte(`{"username": "testuser", "password": "password123"}`))
+	req := httptest.NewRequest("POST", "/login", reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var response map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(suite.T(), err)
+
+	assert.Equal(suite.T(), "Two-factor authentication required", response["message"])
+	assert.Nil(suite.T(), response["token"])
+	data := response["data"].(map[string]any)
+	assert.Equal(suite.T(), true, data["twoFactorRequired"])
+
+	// Exchange the challenge token and a valid code for a session
+	code, err := utils.GenerateTOTPCode(secret, utils.TOTPStep(time.Now()))
+	assert.NoError(suite.T(), err)
+
+	reqBody = bytes.NewBuffer([]byte(fmt.Sprintf(
+		`{"challengeToken": "%s", "code": "%s"}`, data["challengeToken"], code)))
+	req = httptest.NewRequest("POST", "/2fa", reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err = suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	response = map[string]any{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(suite.T(), err)
+
+	assert.Equal(suite.T(), "Login successfully", response["message"])
+	assert.NotEmpty(suite.T(), response["token"])
+	assert.NotEmpty(suite.T(), response["refreshToken"])
+}
+
+func (suite *AuthHandlerTestSuite) TestVerifyTwoFactorLogin_InvalidChallenge() {
+	reqBody := bytes.NewBuffer([]byte(`{"challengeToken": "invalid", "code": "123456"}`))
+	req := httptest.NewRequest("POST", "/2fa", reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, resp.StatusCode)
+}
+
+// twoFactorChallenge logs in a user with 2FA enabled and returns the TOTP secret and challenge token
+func (suite *AuthHandlerTestSuite) twoFactorChallenge() (string, string) {
+	hashedPassword, err := utils.HashPassword("password123")
+	assert.NoError(suite.T(), err)
+
+	user := model.User{Username: "testuser", Email: "test@example.com", Password: hashedPassword}
+	assert.NoError(suite.T(), suite.db.Create(&user).Error)
+	secret := suite.enableTwoFactor(user.ID)
+
+	status, response := suite.postJSON("/login", `{"username": "testuser", "password": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	return secret, response["data"].(map[string]any)["challengeToken"].(string)
+}
+
+func (suite *AuthHandlerTestSuite) TestVerifyTwoFactorLogin_ChallengeIsSingleUse() {
+	secret, challengeToken := suite.twoFactorChallenge()
+	code, err := utils.GenerateTOTPCode(secret, utils.TOTPStep(time.Now()))
+	assert.NoError(suite.T(), err)
+
+	status, _ := suite.postJSON("/2fa", fmt.Sprintf(`{"challengeToken": "%s", "code": "%s"}`, challengeToken, code))
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	// The challenge is gone, so a replay is rejected before the code is checked
+	status, response := suite.postJSON("/2fa", fmt.Sprintf(`{"challengeToken": "%s", "code": "%s"}`, challengeToken, code))
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+	assert.Equal(suite.T(), "Invalid or expired challenge token", response["message"])
+}
+
+func (suite *AuthHandlerTestSuite) TestVerifyTwoFactorLogin_LockedAfterFailedCodes() {
+	secret, challengeToken := suite.twoFactorChallenge()
+
+	for i := 0; i < services.TWO_FACTOR_CHALLENGE_MAX_ATTEMPTS; i++ {
+		status, response := suite.postJSON("/2fa", fmt.Sprintf(`{"challengeToken": "%s", "code": "000000"}`, challengeToken))
+		assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+		assert.Equal(suite.T(), "Invalid code", response["message"])
+	}
+
+	// Clear the failures counted towards the account lockout, so only the challenge is locked
+	assert.NoError(suite.T(), suite.db.Where("1 = 1").Delete(&model.AuthThrottle{}).Error)
+
+	// The correct code is rejected once the challenge is locked
+	code, err := utils.GenerateTOTPCode(secret, utils.TOTPStep(time.Now()))
+	assert.NoError(suite.T(), err)
+	status, response := suite.postJSON("/2fa", fmt.Sprintf(`{"challengeToken": "%s", "code": "%s"}`, challengeToken, code))
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+	assert.Equal(suite.T(), "Invalid or expired challenge token", response["message"])
+}
+
+func (suite *AuthHandlerTestSuite) setupMockOIDCProvider() *tests.MockOIDCServer {
+	mockServer, err := tests.NewMockOIDCServer("justjio")
+	assert.NoError(suite.T(), err)
+	suite.T().Cleanup(mockServer.Close)
+
+	suite.T().Setenv("OIDC_PROVIDERS", "mock")
+	suite.T().Setenv("OIDC_MOCK_ISSUER_URL", mockServer.URL)
+	suite.T().Setenv("OIDC_MOCK_CLIENT_ID", "justjio")
+	suite.T().Setenv("OIDC_MOCK_CLIENT_SECRET", "secret")
+	suite.T().Setenv("OIDC_MOCK_REDIRECT_URL", "http://localhost:5173/oidc/callback")
+	return mockServer
+}
+
+// oidcLogin walks through the authorization code flow against the mock provider
+func (suite *AuthHandlerTestSuite) oidcLogin(mockServer *tests.MockOIDCServer, claims jwt.MapClaims) (int, map[string]any) {
+	req := httptest.NewRequest("GET", "/oidc/mock", nil)
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var response map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(suite.T(), err)
+
+	data := response["data"].(map[string]any)
+	authURL, err := url.Parse(data["authUrl"].(string))
+	assert.NoError(suite.T(), err)
+
+	claims["nonce"] = authURL.Query().Get("nonce")
+	mockServer.IssueCode("code", claims)
+
+	reqBody := bytes.NewBuffer([]byte(fmt.Sprintf(`{"code": "code", "state": "%s"}`, data["state"])))
+	req = httptest.NewRequest("POST", "/oidc/mock", reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err = suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+
+	response = map[string]any{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(suite.T(), err)
+	return resp.StatusCode, response
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_CreatesUserAndIdentity() {
+	mockServer := suite.setupMockOIDCProvider()
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "subject-1", "email": "oidc@example.com", "email_verified": true, "name": "OIDC User"}
+	}
+
+	status, response := suite.oidcLogin(mockServer, claims())
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.Equal(suite.T(), "Authenticated via mock successfully", response["message"])
+	assert.NotEmpty(suite.T(), response["token"])
+
+	var identity model.UserIdentity
+	err := suite.db.Where("provider = ? AND subject = ?", "mock", "subject-1").First(&identity).Error
+	assert.NoError(suite.T(), err)
+
+	// Logging in again resolves the same user through the identity
+	status, response = suite.oidcLogin(mockServer, claims())
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	data := response["data"].(map[string]any)
+	assert.Equal(suite.T(), float64(identity.UserID), data["id"])
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_EmailCollisionRequiresLink() {
+	mockServer := suite.setupMockOIDCProvider()
+
+	hashedPassword, err := utils.HashPassword("password123")
+	assert.NoError(suite.T(), err)
+	user := model.User{Username: "testuser", Email: "test@example.com", Password: hashedPassword}
+	err = suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	// Matching email alone must not log into the existing account
+	status, response := suite.oidcLogin(mockServer,
+		jwt.MapClaims{"sub": "subject-1", "email": "test@example.com", "email_verified": true})
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.Equal(suite.T(), "Account linking required", response["message"])
+	assert.Nil(suite.T(), response["token"])
+
+	data := response["data"].(map[string]any)
+	assert.Equal(suite.T(), true, data["linkRequired"])
+
+	// Owner confirms with their password
+	status, response = suite.postConfirmLink(fmt.Sprintf(
+		`{"linkToken": "%s", "password": "password123"}`, data["linkToken"]))
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.Equal(suite.T(), "Account linked successfully", response["message"])
+	assert.NotEmpty(suite.T(), response["token"])
+
+	// The identity now logs in directly
+	status, response = suite.oidcLogin(mockServer, jwt.MapClaims{"sub": "subject-1", "email": "test@example.com"})
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.NotEmpty(suite.T(), response["token"])
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_UnverifiedEmailCollisionIsRejected() {
+	mockServer := suite.setupMockOIDCProvider()
+
+	hashedPassword, err := utils.HashPassword("password123")
+	assert.NoError(suite.T(), err)
+	user := model.User{Username: "testuser", Email: "test@example.com", Password: hashedPassword, HasPassword: true}
+	err = suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	status, response := suite.oidcLogin(mockServer,
+		jwt.MapClaims{"sub": "subject-1", "email": "test@example.com", "email_verified": false})
+	assert.Equal(suite.T(), fiber.StatusForbidden, status)
+	assert.Equal(suite.T(), "email not verified", response["data"])
+
+	var count int64
+	suite.db.Model(&model.UserIdentity{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_TwoFactorRequired() {
+	mockServer := suite.setupMockOIDCProvider()
+
+	user := model.User{Username: "socialuser", Email: "social@example.com"}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+	err = suite.db.Create(&model.UserIdentity{
+		UserID: user.ID, Provider: "mock", Subject: "subject-1", Email: user.Email}).Error
+	assert.NoError(suite.T(), err)
+	suite.enableTwoFactor(user.ID)
+
+	// A linked identity still needs the second factor
+	status, response := suite.oidcLogin(mockServer, jwt.MapClaims{"sub": "subject-1", "email": user.Email})
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.Nil(suite.T(), response["token"])
+
+	data := response["data"].(map[string]any)
+	assert.Equal(suite.T(), true, data["twoFactorRequired"])
+	assert.NotEmpty(suite.T(), data["challengeToken"])
+}
+
+func (suite *AuthHandlerTestSuite) TestSetPassword_LegacySocialAccount() {
+	mockServer := suite.setupMockOIDCProvider()
+
+	// Social logins used to store a random bcrypt password the user never knew
+	randomPassword, err := bcrypt.GenerateFromPassword([]byte("random"), bcrypt.MinCost)
+	assert.NoError(suite.T(), err)
+	user := model.User{Username: "socialuser", Email: "social@example.com", Password: string(randomPassword)}
+	err = suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+	err = suite.db.Create(&model.UserIdentity{
+		UserID: user.ID, Provider: "mock", Subject: "subject-1", Email: user.Email}).Error
+	assert.NoError(suite.T(), err)
+
+	status, response := suite.oidcLogin(mockServer, jwt.MapClaims{"sub": "subject-1", "email": user.Email})
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	token := response["token"].(string)
+
+	status, _ = suite.accountRequest("PATCH", "/account/password", token,
+		`{"currentPassword": "random", "newPassword": "newpassword123"}`)
+	assert.Equal(suite.T(), fiber.StatusBadRequest, status)
+
+	status, _ = suite.accountRequest("POST", "/account/password", token, `{"password": "newpassword123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	status, _ = suite.postJSON("/login", `{"username": "socialuser", "password": "newpassword123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+}
+
+func (suite *AuthHandlerTestSuite) postConfirmLink(body string) (int, map[string]any) {
+	req := httptest.NewRequest("POST", "/link", bytes.NewBuffer([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+
+	var response map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(suite.T(), err)
+	return resp.StatusCode, response
+}
+
+func (suite *AuthHandlerTestSuite) TestVerifyTwoFactorLogin_FailedCodesLockAccount() {
+	secret, challengeToken := suite.twoFactorChallenge()
+
+	var user model.User
+	assert.NoError(suite.T(), suite.db.First(&user, "username = ?", "testuser").Error)
+
+	// One failure away from a lockout
+	err := suite.db.Create(&model.AuthThrottle{
+		ID:            loginThrottleKey(user.ID),
+		Failures:      services.ACCOUNT_THROTTLE_POLICY.LockoutThreshold - 1,
+		LastFailureAt: time.Now(),
+	}).Error
+	assert.NoError(suite.T(), err)
+
+	status, _ := suite.postJSON("/2fa", fmt.Sprintf(`{"challengeToken": "%s", "code": "000000"}`, challengeToken))
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+
+	// Even the right code is rejected while locked
+	code, err := utils.GenerateTOTPCode(secret, utils.TOTPStep(time.Now()))
+	assert.NoError(suite.T(), err)
+	status, _ = suite.postJSON("/2fa", fmt.Sprintf(`{"challengeToken": "%s", "code": "%s"}`, challengeToken, code))
+	assert.Equal(suite.T(), fiber.StatusLocked, status)
+
+	subject, _, err := tests.ReadLastEmail(suite.mailDir)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "JustJio Account Locked", subject)
+}
+
+func (suite *AuthHandlerTestSuite) TestConfirmLink_InvalidPassword() {
+	hashedPassword, err := utils.HashPassword("password123")
+	assert.NoError(suite.T(), err)
+	user := model.User{Username: "testuser", Email: "test@example.com", Password: hashedPassword}
+	err = suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	linkToken, err := services.NewAuthService(nil, "", nil, nil).CreateLinkToken(&services.PendingLink{
+		UserID:   user.ID,
+		Provider: "mock",
+		Subject:  "subject-1",
+		Email:    user.Email,
+	})
+	assert.NoError(suite.T(), err)
+
+	status, _ := suite.postConfirmLink(fmt.Sprintf(`{"linkToken": "%s", "password": "wrong"}`, linkToken))
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+
+	var count int64
+	suite.db.Model(&model.UserIdentity{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+
+	// The failure counts towards the same lockout as Login
+	var throttle model.AuthThrottle
+	err = suite.db.First(&throttle, "id = ?", loginThrottleKey(user.ID)).Error
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, throttle.Failures)
+}
+
+func (suite *AuthHandlerTestSuite) TestConfirmLink_LockedAccount() {
+	hashedPassword, err := utils.HashPassword("password123")
+	assert.NoError(suite.T(), err)
+	user := model.User{Username: "testuser", Email: "test@example.com", Password: hashedPassword}
+	err = suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	lockedUntil := time.Now().Add(time.Hour)
+	err = suite.db.Create(&model.AuthThrottle{
+		ID:            loginThrottleKey(user.ID),
+		Failures:      services.ACCOUNT_THROTTLE_POLICY.LockoutThreshold,
+		BlockedUntil:  &lockedUntil,
+		LockedUntil:   &lockedUntil,
+		LastFailureAt: time.Now(),
+	}).Error
+	assert.NoError(suite.T(), err)
+
+	linkToken, err := services.NewAuthService(nil, "", nil, nil).CreateLinkToken(&services.PendingLink{
+		UserID:   user.ID,
+		Provider: "mock",
+		Subject:  "subject-1",
+		Email:    user.Email,
+	})
+	assert.NoError(suite.T(), err)
+
+	// The right password can't be used to get around the lockout
+	status, _ := suite.postConfirmLink(fmt.Sprintf(`{"linkToken": "%s", "password": "password123"}`, linkToken))
+	assert.Equal(suite.T(), fiber.StatusLocked, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestConfirmLink_InvalidLinkToken() {
+	status, _ := suite.postConfirmLink(`{"linkToken": "invalid", "password": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+}
+
+func (suite *AuthHandlerTestSuite) postJSON(path, body string) (int, map[string]any) {
+	req := httptest.NewRequest("POST", path, bytes.NewBuffer([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+
+	var response map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.NoError(suite.T(), err)
+	return resp.StatusCode, response
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLinkLogin_Success() {
+	user := model.User{Username: "testuser", Email: "test@example.com"}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	status, _ := suite.postJSON("/magic-link", `{"email": "test@example.com"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	// Only a hash of the token is stored, so read it back from the email
+	subject, body, err := tests.ReadLastEmail(suite.mailDir)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "JustJio Login Link", subject)
+
+	matches := regexp.MustCompile(`token=([\w-]+)`).FindStringSubmatch(body)
+	assert.Len(suite.T(), matches, 2)
+	token := matches[1]
+
+	status, response := suite.postJSON("/magic-link/verify", fmt.Sprintf(`{"token": "%s"}`, token))
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.Equal(suite.T(), "Login successfully", response["message"])
+	assert.NotEmpty(suite.T(), response["refreshToken"])
+
+	var updatedUser model.User
+	suite.db.First(&updatedUser, user.ID)
+	assert.True(suite.T(), updatedUser.IsEmailValid)
+
+	// Links are single-use
+	status, _ = suite.postJSON("/magic-link/verify", fmt.Sprintf(`{"token": "%s"}`, token))
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLinkLogin_TwoFactorRequired() {
+	user := model.User{Username: "testuser", Email: "test@example.com"}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+	suite.enableTwoFactor(user.ID)
+
+	token, err := services.NewMagicLinkService(suite.db).CreateMagicLink(user.ID)
+	assert.NoError(suite.T(), err)
+
+	status, response := suite.postJSON("/magic-link/verify", fmt.Sprintf(`{"token": "%s"}`, token))
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.Nil(suite.T(), response["token"])
+
+	data := response["data"].(map[string]any)
+	assert.Equal(suite.T(), true, data["twoFactorRequired"])
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLinkLogin_InvalidToken() {
+	status, _ := suite.postJSON("/magic-link/verify", `{"token": "invalid"}`)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestSendMagicLink_Cooldown() {
+	user := model.User{Username: "testuser", Email: "test@example.com"}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	status, _ := suite.postJSON("/magic-link", `{"email": "test@example.com"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	status, _ = suite.postJSON("/magic-link", `{"email": "test@example.com"}`)
+	assert.Equal(suite.T(), fiber.StatusTooManyRequests, status)
+}
+
+// beginPasskeyLogin starts a passkey login and returns the session ID and base64url challenge
+func (suite *AuthHandlerTestSuite) beginPasskeyLogin() (string, string) {
+	status, response := suite.postJSON("/passkey", `{}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	data := response["data"].(map[string]any)
+	options := data["options"].(map[string]any)["publicKey"].(map[string]any)
+	return data["sessionId"].(string), options["challenge"].(string)
+}
+
+func (suite *AuthHandlerTestSuite) TestPasskeyLogin_Success() {
+	user := model.User{Username: "testuser", Email: "test@example.com"}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	authenticator, err := tests.NewSoftwareAuthenticator("justjio.test", "https://justjio.test")
+	assert.NoError(suite.T(), err)
+	authenticator.UserHandle = []byte(fmt.Sprint(user.ID))
+	publicKey, err := authenticator.PublicKey()
+	assert.NoError(suite.T(), err)
+
+	err = suite.db.Create(&model.Passkey{
+		UserID:       user.ID,
+		Name:         "Laptop",
+		CredentialID: authenticator.CredentialID,
+		PublicKey:    publicKey,
+		Flags:        0x05,
+	}).Error
+	assert.NoError(suite.T(), err)
+
+	sessionId, challenge := suite.beginPasskeyLogin()
+	credential, err := authenticator.Login(challenge)
+	assert.NoError(suite.T(), err)
+
+	body := fmt.Sprintf(`{"sessionId": "%s", "credential": %s}`, sessionId, credential)
+	status, response := suite.postJSON("/passkey/verify", body)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.Equal(suite.T(), "Login successfully", response["message"])
+	assert.NotEmpty(suite.T(), response["refreshToken"])
+
+	// Each challenge can only be answered once
+	status, _ = suite.postJSON("/passkey/verify", body)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestPasskeyLogin_UnknownPasskey() {
+	authenticator, err := tests.NewSoftwareAuthenticator("justjio.test", "https://justjio.test")
+	assert.NoError(suite.T(), err)
+	authenticator.UserHandle = []byte("1")
+
+	sessionId, challenge := suite.beginPasskeyLogin()
+	credential, err := authenticator.Login(challenge)
+	assert.NoError(suite.T(), err)
+
+	status, _ := suite.postJSON("/passkey/verify", fmt.Sprintf(`{"sessionId": "%s", "credential": %s}`, sessionId, credential))
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_LockoutAndUnlock() {
+	hashedPassword, err := utils.HashPassword("password123")
+	assert.NoError(suite.T(), err)
+	user := model.User{Username: "testuser", Email: "test@example.com", Password: hashedPassword}
+	err = suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	// One failure away from a lockout
+	err = suite.db.Create(&model.AuthThrottle{
+		ID:            loginThrottleKey(user.ID),
+		Failures:      services.ACCOUNT_THROTTLE_POLICY.LockoutThreshold - 1,
+		LastFailureAt: time.Now(),
+	}).Error
+	assert.NoError(suite.T(), err)
+
+	status, _ := suite.postJSON("/login", `{"username": "testuser", "password": "wrong"}`)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+
+	// Even the right password is rejected while locked
+	status, _ = suite.postJSON("/login", `{"username": "testuser", "password": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusLocked, status)
+
+	// The user is emailed a link to unlock their account
+	subject, body, err := tests.ReadLastEmail(suite.mailDir)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "JustJio Account Locked", subject)
+
+	matches := regexp.MustCompile(`token=([\w.%-]+)`).FindStringSubmatch(body)
+	assert.Len(suite.T(), matches, 2)
+	token, err := url.QueryUnescape(matches[1])
+	assert.NoError(suite.T(), err)
+
+	status, _ = suite.postJSON("/unlock", fmt.Sprintf(`{"token": "%s"}`, token))
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	status, _ = suite.postJSON("/login", `{"username": "testuser", "password": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	// Every attempt and the lockout is in the audit log
+	var events []string
+	err = suite.db.Model(&model.AuditLog{}).Where("user_id = ?", user.ID).Order("id").Pluck("event", &events).Error
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{
+		services.AUDIT_EVENT_LOGIN,
+		services.AUDIT_EVENT_ACCOUNT_LOCKED,
+		services.AUDIT_EVENT_LOGIN,
+		services.AUDIT_EVENT_LOGIN,
+	}, events)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_LockoutSurvivesRename() {
+	hashedPassword, err := utils.HashPassword("password123")
+	assert.NoError(suite.T(), err)
+	user := model.User{Username: "testuser", Email: "test@example.com", Password: hashedPassword}
+	err = suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	// One failure away from a lockout
+	err = suite.db.Create(&model.AuthThrottle{
+		ID:            loginThrottleKey(user.ID),
+		Failures:      services.ACCOUNT_THROTTLE_POLICY.LockoutThreshold - 1,
+		LastFailureAt: time.Now(),
+	}).Error
+	assert.NoError(suite.T(), err)
+
+	status, _ := suite.postJSON("/login", `{"username": "testuser", "password": "wrong"}`)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+
+	// Renaming the account doesn't give it a fresh set of attempts
+	err = suite.db.Model(&user).Update("username", "renameduser").Error
+	assert.NoError(suite.T(), err)
+
+	status, _ = suite.postJSON("/login", `{"username": "renameduser", "password": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusLocked, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestAuditLog_IsAppendOnly() {
+	err := suite.db.Create(&model.AuditLog{Event: services.AUDIT_EVENT_LOGIN}).Error
+	assert.NoError(suite.T(), err)
+
+	err = suite.db.Model(&model.AuditLog{}).Where("1 = 1").Update("success", true).Error
+	assert.Error(suite.T(), err)
+
+	err = suite.db.Where("1 = 1").Delete(&model.AuditLog{}).Error
+	assert.Error(suite.T(), err)
+}
+
+func (suite *AuthHandlerTestSuite) TestUnlockAccount_InvalidToken() {
+	status, _ := suite.postJSON("/unlock", `{"token": "invalid"}`)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestVerifyOTP_BacksOffAfterFailures() {
+	user := model.User{Username: "testuser", Email: "test@example.com"}
+	err := suite.db.Create(&user).Error
+	assert.NoError(suite.T(), err)
+
+	for i := 0; i < services.EMAIL_THROTTLE_POLICY.FreeAttempts+1; i++ {
+		status, _ := suite.postJSON("/verify", `{"email": "test@example.com", "otp": "000000"}`)
+		assert.Equal(suite.T(), fiber.StatusBadRequest, status)
+	}
+
+	status, _ := suite.postJSON("/verify", `{"email": "test@example.com", "otp": "000000"}`)
+	assert.Equal(suite.T(), fiber.StatusTooManyRequests, status)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_InvalidState() {
+	suite.setupMockOIDCProvider()
+
+	reqBody := bytes.NewBuffer([]byte(`{"code": "code", "state": "invalid"}`))
+	req := httptest.NewRequest("POST", "/oidc/mock", reqBody)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, resp.StatusCode)
+}
+
+func (suite *AuthHandlerTestSuite) TestGetOIDCAuthURL_UnknownProvider() {
+	req := httptest.NewRequest("GET", "/oidc/unknown", nil)
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusNotFound, resp.StatusCode)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/RowenTey/JustJio/server/api/middleware"
 	"github.com/RowenTey/JustJio/server/api/model"
 	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/services"
 	"github.com/RowenTey/JustJio/server/api/tests"
 	"github.com/RowenTey/JustJio/server/api/utils"
 	"github.com/gofiber/fiber/v2"
@@ -25,9 +26,6 @@ import (
 	"gorm.io/gorm"
 )
 
-// Shared test secret for JWT generation
-const mockJWTSecret = "test-secret"
-
 type BillHandlerTestSuite struct {
 	suite.Suite
 	app          *fiber.App
@@ -47,13 +45,20 @@ type BillHandlerTestSuite struct {
 func generateTestToken(userID uint, username, email string) (string, error) {
 	claims := jwt.MapClaims{
 		// Ensure user_id is string in claim like in likely real scenario
+		"jti":      utils.CreateULID().String(),
 		"user_id":  userID,
 		"username": username,
 		"email":    email,
 		"exp":      time.Now().Add(time.Hour * 72).Unix(),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := token.SignedString([]byte(mockJWTSecret))
+	signingKey, err := services.NewSigningKeyService(database.DB).GetSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = signingKey.ID
+	t, err := token.SignedString(signingKey.PrivateKey)
 	if err != nil {
 		return "", err
 	}
@@ -84,16 +89,11 @@ func (suite *BillHandlerTestSuite) SetupSuite() {
 	// Setup Fiber app
 	suite.app = fiber.New()
 
-	suite.app.Use(middleware.Authenticated(mockJWTSecret))
-
-	// IMPORTANT: In a real app, JWT middleware would be added here
-	// e.g., suite.app.Use(jwtware.New(jwtware.Config{SigningKey: []byte(mockJWTSecret)}))
-	// For these tests, we manually add the Auth header, assuming the middleware correctly
-	// populates c.Locals("user") based on the token.
+	suite.app.Use(middleware.Authenticated())
 
 	// Register Bill routes
 	billRoutes := suite.app.Group("/bills") // Group routes for clarity
-	billRoutes.Post("/", CreateBill)
+	billRoutes.Post("/", middleware.RequireScope(services.SCOPE_BILLS_WRITE), middleware.RequireVerifiedEmail, CreateBill)
 	billRoutes.Get("/", GetBillsByRoom) // Query param: ?roomId=...
 	billRoutes.Post("/consolidate", ConsolidateBills)
 	billRoutes.Get("/consolidated/:roomId", IsRoomBillConsolidated) // Path param
@@ -115,9 +115,10 @@ func (suite *BillHandlerTestSuite) SetupTest() {
 	// Create User 1 (Host)
 	hashedPassword1, _ := utils.HashPassword("password123")
 	user1 := model.User{
-		Username: "hostuser",
-		Email:    "host@example.com",
-		Password: hashedPassword1,
+		Username:     "hostuser",
+		Email:        "host@example.com",
+		Password:     hashedPassword1,
+		IsEmailValid: true,
 	}
 	result := suite.db.Create(&user1)
 	assert.NoError(suite.T(), result.Error)
@@ -251,6 +252,62 @@ func (suite *BillHandlerTestSuite) TestCreateBill_Success_WithoutOwner() {
 	assert.Equal(suite.T(), suite.testUser2ID, bill.Payers[0].ID) // Only User2 should be a payer
 }
 
+func (suite *BillHandlerTestSuite) TestCreateBill_PersonalAccessTokenScopes() {
+	patService := services.NewPersonalAccessTokenService(suite.db)
+	readToken, _, err := patService.CreateToken(suite.testUser1ID, "reader", []string{services.SCOPE_BILLS_READ}, nil)
+	assert.NoError(suite.T(), err)
+	writeToken, _, err := patService.CreateToken(suite.testUser1ID, "writer", []string{services.SCOPE_BILLS_WRITE}, nil)
+	assert.NoError(suite.T(), err)
+
+	createReq := request.CreateBillRequest{
+		RoomID:       suite.testRoomID,
+		Name:         "Groceries",
+		Amount:       20.00,
+		IncludeOwner: true,
+		Payers:       []uint{suite.testUser2ID},
+	}
+	reqBody, _ := json.Marshal(createReq)
+
+	for token, status := range map[string]int{
+		readToken:    fiber.StatusForbidden,
+		writeToken:   fiber.StatusOK,
+		"jjpat_fake": fiber.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/bills", bytes.NewBuffer(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := suite.app.Test(req, -1)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), status, resp.StatusCode)
+	}
+
+	// Both real tokens record their last use, even when the scope check failed
+	var pats []model.PersonalAccessToken
+	err = suite.db.Where("user_id = ? AND last_used_at IS NOT NULL", suite.testUser1ID).Find(&pats).Error
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), pats, 2)
+}
+
+func (suite *BillHandlerTestSuite) TestCreateBill_EmailNotVerified() {
+	createReq := request.CreateBillRequest{
+		RoomID:       suite.testRoomID,
+		Name:         "Groceries",
+		Amount:       20.00,
+		IncludeOwner: true,
+		Payers:       []uint{suite.testUser1ID},
+	}
+	reqBody, _ := json.Marshal(createReq)
+
+	req := httptest.NewRequest(http.MethodPost, "/bills", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.testUser2Token) // payeruser hasn't verified their email
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+}
+
 func (suite *BillHandlerTestSuite) TestCreateBill_InvalidInput_BadJSON() {
 	reqBody := bytes.NewBuffer([]byte(`{"name": "test", "amount": "not-a-number"}`)) // Invalid JSON structure/type
 	req := httptest.NewRequest(http.MethodPost, "/bills", reqBody)
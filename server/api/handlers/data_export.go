@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var dataExportLogger = log.WithFields(log.Fields{"service": "DataExportHandler"})
+
+// RequestDataExport queues an archive of the user's data, they are notified once it's ready
+func RequestDataExport(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	export, err := services.NewDataExportService(database.DB).RequestExport(userId)
+	if err != nil {
+		if errors.Is(err, services.ErrDataExportInProgress) {
+			return utils.HandleError(c, fiber.StatusConflict, "A data export is already being prepared", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	dataExportLogger.Infof("User %d requested a data export", userId)
+	return utils.HandleSuccess(c, "Data export requested successfully", export)
+}
+
+func GetDataExports(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	exports, err := services.NewDataExportService(database.DB).GetExports(userId)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Retrieved data exports successfully", exports)
+}
+
+// DownloadDataExport sends the archive of a ready export as a file
+func DownloadDataExport(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	exportId, err := strconv.ParseUint(c.Params("exportId"), 10, 32)
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	export, err := services.NewDataExportService(database.DB).GetExport(userId, uint(exportId))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "Data export not found")
+	}
+	if export.Status != services.DATA_EXPORT_STATUS_READY {
+		return utils.HandleError(c, fiber.StatusConflict, "Data export is not ready", nil)
+	}
+	if export.ExpiresAt != nil && export.ExpiresAt.Before(time.Now()) {
+		return utils.HandleError(c, fiber.StatusGone, "Data export has expired", nil)
+	}
+
+	store, err := utils.NewBlobStore()
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+	archive, err := store.Get(c.Context(), export.BlobKey)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	recordAuditEvent(c, userId, services.AUDIT_EVENT_DATA_EXPORTED, true, map[string]any{"exportId": export.ID})
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(
+		`attachment; filename="justjio-export-%s.zip"`, export.RequestedAt.Format("2006-01-02")))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(archive)
+}
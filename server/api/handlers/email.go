@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+var emailLogger = log.WithFields(log.Fields{"service": "EmailHandler"})
+
+// ChangeEmail sends an OTP to the new address once the user re-authenticates. The email is only
+// changed once the OTP is confirmed, which proves the user owns the new address.
+func ChangeEmail(c *fiber.Ctx) error {
+	var request request.ChangeEmailRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	newEmail := strings.TrimSpace(request.Email)
+	if _, err := mail.ParseAddress(newEmail); err != nil {
+		return utils.HandleInvalidInputError(c, errors.New("invalid email address"))
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userService := services.NewUserService(database.DB)
+	user, err := userService.GetUserByID(utils.GetUserInfoFromToken(token, "user_id"))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	// A stolen session alone must not be enough to take over the account's email
+	throttleService := services.NewThrottleService(database.DB)
+	throttleKey := services.ThrottleKey("change-email", "user", fmt.Sprint(user.ID))
+	if retryAfter, err := throttleService.Check(throttleKey); err != nil {
+		return handleThrottleError(c, retryAfter, err)
+	}
+	if err := verifyEmailChangeOwner(user, request.CurrentPassword, request.Code); err != nil {
+		recordAuditEvent(c, user.ID, services.AUDIT_EVENT_EMAIL_CHANGED, false, map[string]any{"reason": err.Error()})
+
+		switch err.Error() {
+		case "invalid password":
+			recordFailure(throttleService, throttleKey, services.EMAIL_THROTTLE_POLICY)
+			return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid password", err)
+		case "invalid code":
+			recordFailure(throttleService, throttleKey, services.EMAIL_THROTTLE_POLICY)
+			return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid code", err)
+		case "no sign-in secret":
+			return utils.HandleError(c, fiber.StatusForbidden,
+				"Set a password or enable two-factor authentication before changing your email", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+	if err := throttleService.Reset(throttleKey); err != nil {
+		emailLogger.Error("Error resetting change email throttle: ", err)
+	}
+
+	if newEmail == user.Email {
+		return utils.HandleError(c, fiber.StatusBadRequest, "This is already your email address", errors.New("email unchanged"))
+	}
+	if _, err := userService.GetUserByEmail(newEmail); err == nil {
+		return utils.HandleError(c, fiber.StatusConflict, "Email already in use", errors.New("email already in use"))
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	otpService := services.NewOTPService(database.DB)
+	purpose := services.ChangeEmailOTPPurpose(user.ID)
+	otp, err := otpService.CreateOTP(newEmail, purpose)
+	if err != nil {
+		if err.Error() == "otp recently sent" {
+			return utils.HandleError(
+				c, fiber.StatusTooManyRequests, "Please wait before requesting another OTP", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+	if err := authService.SendOTPEmail(otp, user.Username, newEmail,
+		services.CHANGE_EMAIL_OTP_PURPOSE, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		emailLogger.Error("Error sending OTP email:", err)
+		if err := otpService.DeleteOTP(newEmail, purpose); err != nil {
+			emailLogger.Error("Error deleting OTP:", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_OTP_SENT, true,
+		map[string]any{"purpose": services.CHANGE_EMAIL_OTP_PURPOSE})
+	return utils.HandleSuccess(c, "OTP sent to the new email address", nil)
+}
+
+// verifyEmailChangeOwner checks the current password, or the 2FA code for accounts
+// created through a social login that never set one
+func verifyEmailChangeOwner(user *model.User, currentPassword, code string) error {
+	if user.HasPassword {
+		if !utils.CheckPasswordHash(currentPassword, user.Password) {
+			return errors.New("invalid password")
+		}
+		return nil
+	}
+
+	twoFactorService := services.NewTwoFactorService(database.DB)
+	twoFactorEnabled, err := twoFactorService.IsEnabled(user.ID)
+	if err != nil {
+		return err
+	}
+	if !twoFactorEnabled {
+		return errors.New("no sign-in secret")
+	}
+	return twoFactorService.VerifyCode(user.ID, code)
+}
+
+// ConfirmEmailChange swaps in the new address once its OTP is confirmed and notifies the old address
+func ConfirmEmailChange(c *fiber.Ctx) error {
+	var request request.ConfirmEmailChangeRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+	newEmail := strings.TrimSpace(request.Email)
+
+	token := c.Locals("user").(*jwt.Token)
+	user, err := services.NewUserService(database.DB).GetUserByID(utils.GetUserInfoFromToken(token, "user_id"))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	// Only the OTP sent when this user asked for the change is accepted.
+	// NOTE: not run in a transaction so failed attempts are always counted
+	purpose := services.ChangeEmailOTPPurpose(user.ID)
+	if err := services.NewOTPService(database.DB).VerifyOTP(newEmail, purpose, request.OTP); err != nil {
+		recordAuditEvent(c, user.ID, services.AUDIT_EVENT_EMAIL_CHANGED, false, map[string]any{"reason": err.Error()})
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound), err.Error() == "invalid otp", err.Error() == "otp expired":
+			return utils.HandleError(c, fiber.StatusBadRequest, "Invalid or expired OTP", err)
+		case err.Error() == "too many attempts":
+			return utils.HandleError(c, fiber.StatusTooManyRequests, "Too many attempts, please request a new OTP", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	tx := database.DB.Begin()
+
+	if err := services.NewOTPService(tx).ConsumeVerifiedOTP(newEmail, purpose); err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	oldEmail := user.Email
+	user.Email = newEmail
+	user.IsEmailValid = true
+	if _, err := services.NewUserService(tx).CreateOrUpdateUser(user, false); err != nil {
+		tx.Rollback()
+		// Someone else took the address since the OTP was sent
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return utils.HandleError(c, fiber.StatusConflict, "Email already in use", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+	// The change already happened, so a failed notice is only logged
+	if err := authService.SendEmailChangedEmail(
+		user.Username, oldEmail, newEmail, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		emailLogger.Error("Error sending email changed notice: ", err)
+	}
+
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_EMAIL_CHANGED, true,
+		map[string]any{"from": oldEmail, "to": newEmail})
+	emailLogger.Info(fmt.Sprintf("User %s changed their email", user.Username))
+	return utils.HandleSuccess(c, "Email changed successfully", nil)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// handleFriendCircleError maps the errors of the friend circle service to responses
+func handleFriendCircleError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidCircleName):
+		return utils.HandleError(c, fiber.StatusBadRequest, err.Error(), err)
+	case errors.Is(err, services.ErrNotFriends):
+		return utils.HandleError(c, fiber.StatusBadRequest, "Circles can only contain your friends", err)
+	case errors.Is(err, services.ErrCircleNameTaken):
+		return utils.HandleError(c, fiber.StatusConflict, "You already have a circle with this name", err)
+	case errors.Is(err, services.ErrTooManyCircles):
+		return utils.HandleError(c, fiber.StatusConflict, "Delete a circle before creating another", err)
+	}
+	return utils.HandleNotFoundOrInternalError(c, err, "Circle not found")
+}
+
+func GetFriendCircles(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	circles, err := services.NewFriendCircleService(database.DB).GetCircles(userId)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Retrieved friend circles successfully", circles)
+}
+
+func GetFriendCircle(c *fiber.Ctx) error {
+	circleId, err := c.ParamsInt("circleId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	circle, err := services.NewFriendCircleService(database.DB).GetCircle(userId, uint(circleId))
+	if err != nil {
+		return handleFriendCircleError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Retrieved friend circle successfully", circle)
+}
+
+func CreateFriendCircle(c *fiber.Ctx) error {
+	var request request.CreateFriendCircleRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	circle, err := services.NewFriendCircleService(database.DB).CreateCircle(userId, request.Name, request.Members)
+	if err != nil {
+		return handleFriendCircleError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Created friend circle successfully", circle)
+}
+
+func RenameFriendCircle(c *fiber.Ctx) error {
+	circleId, err := c.ParamsInt("circleId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	var request request.RenameFriendCircleRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	circle, err := services.NewFriendCircleService(database.DB).RenameCircle(userId, uint(circleId), request.Name)
+	if err != nil {
+		return handleFriendCircleError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Renamed friend circle successfully", circle)
+}
+
+func DeleteFriendCircle(c *fiber.Ctx) error {
+	circleId, err := c.ParamsInt("circleId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := services.NewFriendCircleService(database.DB).DeleteCircle(userId, uint(circleId)); err != nil {
+		return handleFriendCircleError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Deleted friend circle successfully", nil)
+}
+
+func AddFriendCircleMembers(c *fiber.Ctx) error {
+	circleId, err := c.ParamsInt("circleId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	var request request.AddFriendCircleMembersRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	circle, err := services.NewFriendCircleService(database.DB).AddMembers(userId, uint(circleId), request.Members)
+	if err != nil {
+		return handleFriendCircleError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Added friend circle members successfully", circle)
+}
+
+func RemoveFriendCircleMember(c *fiber.Ctx) error {
+	circleId, err := c.ParamsInt("circleId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+	memberId, err := c.ParamsInt("memberId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := services.NewFriendCircleService(database.DB).
+		RemoveMember(userId, uint(circleId), uint(memberId)); err != nil {
+		return handleFriendCircleError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Removed friend circle member successfully", nil)
+}
@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/model/response"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+var identityLogger = log.WithFields(log.Fields{"service": "IdentityHandler"})
+
+// GOOGLE_PROVIDER is the built-in Google login, which uses the Google userinfo API
+// rather than a provider from OIDC_PROVIDERS
+const GOOGLE_PROVIDER = "google"
+
+// ConfirmLink links a pending external identity to the existing account with the same email.
+// The owner has to prove they control the account with its password or an emailed OTP.
+func ConfirmLink(c *fiber.Ctx, kafkaSvc *services.KafkaService) error {
+	var request request.ConfirmLinkRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+
+	link, err := authService.ParseLinkToken(request.LinkToken)
+	if err != nil {
+		return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid or expired link token", err)
+	}
+
+	user, err := services.NewUserService(database.DB).GetUserByID(fmt.Sprint(link.UserID))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	// Linking logs the user in, so failures count towards the same lockout as Login
+	throttleService := services.NewThrottleService(database.DB)
+	accountKey := loginThrottleKey(user.ID)
+	ipKey := services.ThrottleKey("login", "ip", c.IP())
+	if retryAfter, err := throttleService.Check(accountKey, ipKey); err != nil {
+		recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, false,
+			map[string]any{"method": "link", "provider": link.Provider, "reason": "throttled"})
+		return handleThrottleError(c, retryAfter, err)
+	}
+
+	// NOTE: not run in a transaction so failed attempts are always counted
+	switch {
+	case request.Password != "":
+		if !utils.CheckPasswordHash(request.Password, user.Password) {
+			recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, false,
+				map[string]any{"method": "link", "provider": link.Provider, "reason": "invalid password"})
+			recordLoginFailure(c, throttleService, user, ipKey)
+			return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid password", errors.New("password does not match the user's password"))
+		}
+		rehashPassword(user, request.Password)
+	case request.OTP != "":
+		otpService := services.NewOTPService(database.DB)
+		if err := otpService.VerifyOTP(user.Email, "link-account", request.OTP); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "invalid otp" || err.Error() == "otp expired" {
+				return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid or expired OTP", err)
+			}
+			if err.Error() == "too many attempts" {
+				return utils.HandleError(c, fiber.StatusTooManyRequests, "Too many attempts, please request a new OTP", err)
+			}
+			return utils.HandleInternalServerError(c, err)
+		}
+		if err := otpService.ConsumeVerifiedOTP(user.Email, "link-account"); err != nil {
+			return utils.HandleInternalServerError(c, err)
+		}
+	default:
+		return utils.HandleError(c, fiber.StatusBadRequest, "Password or OTP is required", errors.New("missing proof of ownership"))
+	}
+
+	// Linking logs the user in, so it must not bypass 2FA
+	twoFactorService := services.NewTwoFactorService(database.DB)
+	twoFactorEnabled, err := twoFactorService.IsEnabled(user.ID)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+	if twoFactorEnabled {
+		if err := twoFactorService.VerifyCode(user.ID, request.Code); err != nil {
+			if err.Error() == "invalid code" {
+				recordLoginFailure(c, throttleService, user, ipKey)
+			}
+			return handleTwoFactorCodeError(c, err)
+		}
+	}
+	if err := throttleService.Reset(accountKey); err != nil {
+		identityLogger.Error("Error resetting login throttle: ", err)
+	}
+
+	if _, err := services.NewIdentityService(database.DB).
+		CreateIdentity(user.ID, link.Provider, link.Subject, link.Email); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return utils.HandleError(c, fiber.StatusConflict, "Identity is already linked to an account", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	token, refreshToken, err := createSession(c, authService, user, "")
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	// create user channel when login
+	go createUserChannel(kafkaSvc, user.ID)
+
+	response := response.AuthResponse{
+		Email:      user.Email,
+		Username:   user.Username,
+		PictureUrl: user.PictureUrl,
+		UID:        user.ID,
+	}
+
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, true, map[string]any{"method": "link", "provider": link.Provider})
+	identityLogger.Info("User " + user.Username + " linked " + link.Provider + " after confirming ownership")
+	return utils.HandleLoginSuccess(c, "Account linked successfully", token, refreshToken, response)
+}
+
+func GetIdentities(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	identities, err := services.NewIdentityService(database.DB).GetIdentitiesByUser(userId)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Retrieved identities successfully", identities)
+}
+
+// LinkIdentity links an external identity to the logged in user
+func LinkIdentity(c *fiber.Ctx) error {
+	var request request.OIDCLoginRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	providerName := c.Params("provider")
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+
+	profile, err := fetchSocialProfile(c, authService, providerName, request.Code, request.State)
+	if err != nil {
+		return handleSocialProfileError(c, err)
+	}
+
+	identity, err := services.NewIdentityService(database.DB).
+		CreateIdentity(userId, providerName, profile.Subject, profile.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return utils.HandleError(c, fiber.StatusConflict, "Identity is already linked to an account", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	identityLogger.Infof("User %d linked %s", userId, providerName)
+	return utils.HandleSuccess(c, "Identity linked successfully", identity)
+}
+
+// UnlinkIdentity removes an external identity, as long as the user can still sign in afterwards
+func UnlinkIdentity(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	user, err := services.NewUserService(database.DB).GetUserByID(fmt.Sprint(userId))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	tx := database.DB.Begin()
+	identityService := services.NewIdentityService(tx)
+
+	if err := identityService.DeleteIdentity(userId, c.Params("identityId")); err != nil {
+		tx.Rollback()
+		return utils.HandleNotFoundOrInternalError(c, err, "Identity not found")
+	}
+
+	remaining, err := identityService.CountIdentities(userId)
+	if err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+	passkeys, err := services.NewPasskeyService(tx).CountPasskeys(userId)
+	if err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+	if remaining == 0 && passkeys == 0 && !user.HasPassword {
+		tx.Rollback()
+		return utils.HandleError(c, fiber.StatusBadRequest,
+			"Set a password before unlinking your last sign-in method", errors.New("no sign-in method left"))
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Identity unlinked successfully", nil)
+}
+
+// SetPassword lets accounts created through a social login set their first password.
+// This includes old social accounts, which were given a random password the user never knew.
+func SetPassword(c *fiber.Ctx) error {
+	var request request.SetPasswordRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+	if request.Password == "" {
+		return utils.HandleInvalidInputError(c, errors.New("password is required"))
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userService := services.NewUserService(database.DB)
+
+	user, err := userService.GetUserByID(utils.GetUserInfoFromToken(token, "user_id"))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	if user.HasPassword {
+		return utils.HandleError(c, fiber.StatusConflict, "Password already set", errors.New("password already set"))
+	}
+
+	user.Password, err = utils.HashPassword(request.Password)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+	user.HasPassword = true
+
+	if _, err := userService.CreateOrUpdateUser(user, false); err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	identityLogger.Info("User " + user.Username + " set a password")
+	return utils.HandleSuccess(c, "Password set successfully", nil)
+}
+
+// fetchSocialProfile completes the provider's authorization code flow and returns the verified profile
+func fetchSocialProfile(
+	c *fiber.Ctx,
+	authService *services.AuthService,
+	providerName, code, state string,
+) (*services.OIDCUser, error) {
+	if providerName == GOOGLE_PROVIDER {
+		googleUser, err := authService.GetGoogleUser(code)
+		if err != nil {
+			identityLogger.Error("Error fetching Google user: ", err)
+			return nil, errors.New("verification failed")
+		}
+
+		return &services.OIDCUser{
+			Subject:       googleUser.Id,
+			Email:         googleUser.Email,
+			EmailVerified: googleUser.VerifiedEmail != nil && *googleUser.VerifiedEmail,
+			Name:          googleUser.Name,
+			Picture:       googleUser.Picture,
+		}, nil
+	}
+
+	nonce, err := authService.ParseOIDCState(state, providerName)
+	if err != nil {
+		return nil, errors.New("invalid state")
+	}
+
+	provider, err := services.NewOIDCService(config.SetupOIDCProviderConfigs()).
+		GetProvider(c.Context(), providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := provider.Exchange(c.Context(), code, nonce)
+	if err != nil {
+		identityLogger.Error("Error verifying identity with "+providerName+": ", err)
+		return nil, errors.New("verification failed")
+	}
+
+	return profile, nil
+}
+
+func handleSocialProfileError(c *fiber.Ctx, err error) error {
+	switch err.Error() {
+	case "invalid state":
+		return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid or expired state", err)
+	case "verification failed":
+		return utils.HandleError(c, fiber.StatusUnauthorized, "Failed to verify identity with provider", err)
+	}
+	return handleOIDCProviderError(c, err)
+}
+
+// completeSocialLogin logs in the user linked to the external identity. When an account with
+// the same email already exists, the owner has to confirm the link before it can be used.
+func completeSocialLogin(
+	c *fiber.Ctx,
+	kafkaSvc *services.KafkaService,
+	authService *services.AuthService,
+	providerName string,
+	profile *services.OIDCUser,
+) error {
+	user, err := getOrCreateSocialUser(providerName, profile)
+	if err != nil {
+		if err.Error() == "email already registered" {
+			linkToken, err := authService.CreateLinkToken(&services.PendingLink{
+				UserID:   user.ID,
+				Provider: providerName,
+				Subject:  profile.Subject,
+				Email:    profile.Email,
+			})
+			if err != nil {
+				return utils.HandleInternalServerError(c, err)
+			}
+
+			identityLogger.Info("Linking " + providerName + " to existing user " + user.Username + " requires confirmation")
+			return utils.HandleSuccess(c, "Account linking required", response.LinkRequiredResponse{
+				LinkRequired: true,
+				LinkToken:    linkToken,
+				Provider:     providerName,
+				Email:        user.Email,
+			})
+		}
+		if err.Error() == "email not provided" {
+			return utils.HandleError(c, fiber.StatusBadRequest, "Provider did not share an email address", err)
+		}
+		if err.Error() == "email not verified" {
+			return utils.HandleError(c, fiber.StatusForbidden,
+				"Email is already registered and was not verified by "+providerName, err)
+		}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return utils.HandleError(c, fiber.StatusConflict, "Username or email already exists", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	// The provider only replaces the password, users with 2FA still need their second factor
+	twoFactorEnabled, err := services.NewTwoFactorService(database.DB).IsEnabled(user.ID)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+	if twoFactorEnabled {
+		challengeToken, err := createTwoFactorChallenge(authService, user)
+		if err != nil {
+			return utils.HandleInternalServerError(c, err)
+		}
+
+		identityLogger.Info("User " + user.Username + " requires 2FA to log in via " + providerName)
+		return utils.HandleSuccess(c, "Two-factor authentication required", response.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+	}
+
+	token, refreshToken, err := createSession(c, authService, user, "")
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	// create user channel when login
+	go createUserChannel(kafkaSvc, user.ID)
+
+	response := response.AuthResponse{
+		Email:      user.Email,
+		Username:   user.Username,
+		PictureUrl: user.PictureUrl,
+		UID:        user.ID,
+	}
+
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, true, map[string]any{"method": providerName})
+	identityLogger.Info("User " + response.Username + " authenticated via " + providerName)
+	return utils.HandleLoginSuccess(c, "Authenticated via "+providerName+" successfully", token, refreshToken, response)
+}
+
+// getOrCreateSocialUser resolves the user by the provider's subject. Existing accounts are never
+// matched by email alone; on a collision the existing user is returned with an error, as long as
+// the provider verified the email.
+func getOrCreateSocialUser(providerName string, profile *services.OIDCUser) (*model.User, error) {
+	identity, err := services.NewIdentityService(database.DB).GetIdentity(providerName, profile.Subject)
+	if err == nil {
+		return services.NewUserService(database.DB).GetUserByID(fmt.Sprint(identity.UserID))
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if profile.Email == "" {
+		return nil, errors.New("email not provided")
+	}
+
+	existingUser, err := services.NewUserService(database.DB).GetUserByEmail(profile.Email)
+	if err == nil {
+		// An unverified email proves nothing about who owns the existing account
+		if !profile.EmailVerified {
+			return nil, errors.New("email not verified")
+		}
+		return existingUser, errors.New("email already registered")
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	name := profile.Name
+	if name == "" {
+		name = strings.Split(profile.Email, "@")[0]
+	}
+
+	// Social-only accounts have no password until the user sets one
+	newUser := &model.User{
+		Username:     utils.FormatUsername(name),
+		Email:        profile.Email,
+		PictureUrl:   profile.Picture,
+		IsEmailValid: profile.EmailVerified,
+	}
+
+	tx := database.DB.Begin()
+
+	user, err := services.NewUserService(tx).CreateOrUpdateUser(newUser, true)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if _, err := services.NewIdentityService(tx).
+		CreateIdentity(user.ID, providerName, profile.Subject, profile.Email); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetJWKS publishes the public keys access tokens are signed with (RFC 7517),
+// so other services can verify tokens without holding a secret
+func GetJWKS(c *fiber.Ctx) error {
+	keys, err := services.NewSigningKeyService(database.DB).GetJWKS()
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(fiber.Map{"keys": keys})
+}
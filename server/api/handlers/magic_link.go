@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/model/response"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var magicLinkLogger = log.WithFields(log.Fields{"service": "MagicLinkHandler"})
+
+// SendMagicLink emails a single-use login link to the user with the given email
+func SendMagicLink(c *fiber.Ctx) error {
+	var request request.SendMagicLinkRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+	if request.Email == "" {
+		return utils.HandleInvalidInputError(c, errors.New("email is required"))
+	}
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+	magicLinkService := services.NewMagicLinkService(database.DB)
+
+	user, err := services.NewUserService(database.DB).GetUserByEmail(request.Email)
+	if err != nil {
+		return utils.HandleError(c, fiber.StatusNotFound, "Invalid email address", err)
+	}
+
+	token, err := magicLinkService.CreateMagicLink(user.ID)
+	if err != nil {
+		if err.Error() == "magic link recently sent" {
+			return utils.HandleError(
+				c, fiber.StatusTooManyRequests, "Please wait before requesting another login link", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := authService.SendMagicLinkEmail(token, user.Username, user.Email, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		magicLinkLogger.Error("Error sending magic link email:", err)
+		if err := magicLinkService.DeleteMagicLinks(user.ID); err != nil {
+			magicLinkLogger.Error("Error deleting magic link:", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	magicLinkLogger.Info("Magic link sent to " + user.Email + " successfully.")
+	return utils.HandleSuccess(c, "Login link sent successfully", nil)
+}
+
+// MagicLinkLogin redeems a login link for a session, the same as a password login
+func MagicLinkLogin(c *fiber.Ctx, kafkaSvc *services.KafkaService) error {
+	var request request.MagicLinkLoginRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	magicLink, err := services.NewMagicLinkService(database.DB).ConsumeMagicLink(request.Token)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "magic link expired" {
+			recordAuditEvent(c, 0, services.AUDIT_EVENT_LOGIN, false, map[string]any{"method": "magic-link", "reason": "invalid link"})
+			return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid or expired login link", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	userService := services.NewUserService(database.DB)
+	user, err := userService.GetUserByID(fmt.Sprint(magicLink.UserID))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	// Opening the link proves the user owns the account, so a lockout shouldn't keep them out
+	resetLoginThrottle(user.ID)
+
+	// It also proves the user owns the email
+	if !user.IsEmailValid {
+		user.IsEmailValid = true
+		if _, err := userService.CreateOrUpdateUser(user, false); err != nil {
+			return utils.HandleInternalServerError(c, err)
+		}
+	}
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+
+	// The link only replaces the password, users with 2FA still need their second factor
+	twoFactorEnabled, err := services.NewTwoFactorService(database.DB).IsEnabled(user.ID)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+	if twoFactorEnabled {
+		challengeToken, err := createTwoFactorChallenge(authService, user)
+		if err != nil {
+			return utils.HandleInternalServerError(c, err)
+		}
+
+		magicLinkLogger.Info("User " + user.Username + " requires 2FA to log in.")
+		return utils.HandleSuccess(c, "Two-factor authentication required", response.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+	}
+
+	token, refreshToken, err := createSession(c, authService, user, "")
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	// create user channel when login
+	go createUserChannel(kafkaSvc, user.ID)
+
+	response := response.AuthResponse{
+		Username:   user.Username,
+		Email:      user.Email,
+		PictureUrl: user.PictureUrl,
+		UID:        user.ID,
+	}
+
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, true, map[string]any{"method": "magic-link"})
+	magicLinkLogger.Info("User " + response.Username + " logged in with a magic link.")
+	return utils.HandleLoginSuccess(c, "Login successfully", token, refreshToken, response)
+}
@@ -71,7 +71,7 @@ func (suite *MessageHandlerTestSuite) SetupSuite() {
 
 	// Setup Fiber app
 	suite.app = fiber.New()
-	suite.app.Use(middleware.Authenticated(mockJWTSecret))
+	suite.app.Use(middleware.Authenticated())
 
 	// Register Message routes
 	messageRoutes := suite.app.Group("/rooms/:roomId/messages")
@@ -58,7 +58,7 @@ func (suite *NotificationHandlerTestSuite) SetupSuite() {
 
 	// Setup Fiber app
 	suite.app = fiber.New()
-	suite.app.Use(middleware.Authenticated(mockJWTSecret))
+	suite.app.Use(middleware.Authenticated())
 
 	// Notification channel for testing
 	suite.testNotifChan = make(chan NotificationData, 100)
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/model/response"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var oidcLogger = log.WithFields(log.Fields{"service": "OIDCHandler"})
+
+// GetOIDCAuthURL returns the URL the client should redirect to for logging in with the provider
+func GetOIDCAuthURL(c *fiber.Ctx) error {
+	providerName := c.Params("provider")
+
+	provider, err := services.NewOIDCService(config.SetupOIDCProviderConfigs()).
+		GetProvider(c.Context(), providerName)
+	if err != nil {
+		return handleOIDCProviderError(c, err)
+	}
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+
+	nonce := utils.GenerateRandomString(32)
+	state, err := authService.CreateOIDCState(providerName, nonce)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	response := response.OIDCAuthURLResponse{
+		AuthURL: provider.AuthCodeURL(state, nonce),
+		State:   state,
+	}
+	return utils.HandleSuccess(c, "Retrieved authorization URL successfully", response)
+}
+
+// OIDCLogin completes the authorization code flow for a configured OIDC provider
+func OIDCLogin(c *fiber.Ctx, kafkaSvc *services.KafkaService) error {
+	var request request.OIDCLoginRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	providerName := c.Params("provider")
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+
+	profile, err := fetchSocialProfile(c, authService, providerName, request.Code, request.State)
+	if err != nil {
+		recordAuditEvent(c, 0, services.AUDIT_EVENT_LOGIN, false, map[string]any{"method": providerName, "reason": err.Error()})
+		return handleSocialProfileError(c, err)
+	}
+
+	return completeSocialLogin(c, kafkaSvc, authService, providerName, profile)
+}
+
+func handleOIDCProviderError(c *fiber.Ctx, err error) error {
+	if err.Error() == "unknown provider" {
+		return utils.HandleError(c, fiber.StatusNotFound, "Provider not found", err)
+	}
+	return utils.HandleError(c, fiber.StatusBadGateway, "Identity provider unavailable", err)
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/model/response"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+var passkeyLogger = log.WithFields(log.Fields{"service": "PasskeyHandler"})
+
+// BeginPasskeyRegistration returns the options the client passes to navigator.credentials.create()
+func BeginPasskeyRegistration(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	user, err := services.NewUserService(database.DB).GetUserByID(utils.GetUserInfoFromToken(token, "user_id"))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	options, sessionId, err := services.NewPasskeyService(database.DB).BeginRegistration(user)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Passkey registration started", response.PasskeyCeremonyResponse{
+		SessionID: sessionId,
+		Options:   options,
+	})
+}
+
+// FinishPasskeyRegistration verifies the new credential and saves it as a passkey
+func FinishPasskeyRegistration(c *fiber.Ctx) error {
+	var request request.FinishPasskeyRegistrationRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	user, err := services.NewUserService(database.DB).GetUserByID(utils.GetUserInfoFromToken(token, "user_id"))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	passkey, err := services.NewPasskeyService(database.DB).
+		FinishRegistration(user, request.SessionID, request.Name, request.Credential)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "passkey session expired" {
+			return utils.HandleError(c, fiber.StatusBadRequest, "Passkey registration expired, please try again", err)
+		}
+		if err.Error() == "invalid passkey response" {
+			return utils.HandleError(c, fiber.StatusBadRequest, "Passkey could not be verified", err)
+		}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return utils.HandleError(c, fiber.StatusConflict, "Passkey is already registered", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	passkeyLogger.Infof("User %s registered passkey %d", user.Username, passkey.ID)
+	return utils.HandleSuccess(c, "Passkey registered successfully", passkey)
+}
+
+func GetPasskeys(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	passkeys, err := services.NewPasskeyService(database.DB).GetPasskeysByUser(userId)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Retrieved passkeys successfully", passkeys)
+}
+
+func RenamePasskey(c *fiber.Ctx) error {
+	var request request.RenamePasskeyRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := services.NewPasskeyService(database.DB).
+		RenamePasskey(userId, c.Params("passkeyId"), request.Name); err != nil {
+		if err.Error() == "name is required" {
+			return utils.HandleInvalidInputError(c, err)
+		}
+		return utils.HandleNotFoundOrInternalError(c, err, "Passkey not found")
+	}
+
+	return utils.HandleSuccess(c, "Passkey renamed successfully", nil)
+}
+
+// DeletePasskey removes a passkey, as long as the user can still sign in afterwards
+func DeletePasskey(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	user, err := services.NewUserService(database.DB).GetUserByID(fmt.Sprint(userId))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	tx := database.DB.Begin()
+	passkeyService := services.NewPasskeyService(tx)
+
+	if err := passkeyService.DeletePasskey(userId, c.Params("passkeyId")); err != nil {
+		tx.Rollback()
+		return utils.HandleNotFoundOrInternalError(c, err, "Passkey not found")
+	}
+
+	passkeys, err := passkeyService.CountPasskeys(userId)
+	if err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+	identities, err := services.NewIdentityService(tx).CountIdentities(userId)
+	if err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+	if passkeys == 0 && identities == 0 && !user.HasPassword {
+		tx.Rollback()
+		return utils.HandleError(c, fiber.StatusBadRequest,
+			"Set a password before deleting your last sign-in method", errors.New("no sign-in method left"))
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Passkey deleted successfully", nil)
+}
+
+// BeginPasskeyLogin returns the options the client passes to navigator.credentials.get()
+func BeginPasskeyLogin(c *fiber.Ctx) error {
+	options, sessionId, err := services.NewPasskeyService(database.DB).BeginLogin()
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Passkey login started", response.PasskeyCeremonyResponse{
+		SessionID: sessionId,
+		Options:   options,
+	})
+}
+
+// PasskeyLogin verifies the passkey assertion and logs the user in, the same as a password login.
+// Passkeys require user verification, so they already count as two factors.
+func PasskeyLogin(c *fiber.Ctx, kafkaSvc *services.KafkaService) error {
+	var request request.PasskeyLoginRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	passkey, err := services.NewPasskeyService(database.DB).FinishLogin(request.SessionID, request.Credential)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) ||
+			err.Error() == "passkey session expired" ||
+			err.Error() == "invalid passkey response" ||
+			err.Error() == "passkey may be cloned" {
+			recordAuditEvent(c, 0, services.AUDIT_EVENT_LOGIN, false, map[string]any{"method": "passkey", "reason": err.Error()})
+			return utils.HandleError(c, fiber.StatusUnauthorized, "Passkey could not be verified", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+	user := &passkey.User
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+
+	token, refreshToken, err := createSession(c, authService, user, "")
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	// create user channel when login
+	go createUserChannel(kafkaSvc, user.ID)
+
+	response := response.AuthResponse{
+		Username:   user.Username,
+		Email:      user.Email,
+		PictureUrl: user.PictureUrl,
+		UID:        user.ID,
+	}
+
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, true, map[string]any{"method": "passkey", "passkeyId": passkey.ID})
+	passkeyLogger.Info("User " + response.Username + " logged in with a passkey.")
+	return utils.HandleLoginSuccess(c, "Login successfully", token, refreshToken, response)
+}
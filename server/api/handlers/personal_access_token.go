@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/model/response"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var patLogger = log.WithFields(log.Fields{"service": "PersonalAccessTokenHandler"})
+
+func GetPersonalAccessTokens(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	tokens, err := services.NewPersonalAccessTokenService(database.DB).GetTokensByUser(userId)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Retrieved personal access tokens successfully", tokens)
+}
+
+// CreatePersonalAccessToken issues a scoped token for scripts and bots. The token is only shown once.
+func CreatePersonalAccessToken(c *fiber.Ctx) error {
+	var request request.CreatePersonalAccessTokenRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	rawToken, pat, err := services.NewPersonalAccessTokenService(database.DB).
+		CreateToken(userId, request.Name, request.Scopes, expiresAt)
+	if err != nil {
+		switch err.Error() {
+		case "name is required", "invalid scope":
+			return utils.HandleError(c, fiber.StatusBadRequest, "Invalid token name or scopes", err)
+		case "too many tokens":
+			return utils.HandleError(c, fiber.StatusConflict, "Revoke an existing token before creating another", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	recordAuditEvent(c, userId, services.AUDIT_EVENT_PAT_CREATED, true,
+		map[string]any{"tokenId": pat.ID, "name": pat.Name, "scopes": request.Scopes})
+	patLogger.Infof("User %d created personal access token %d", userId, pat.ID)
+	return utils.HandleSuccess(c, "Personal access token created successfully", response.PersonalAccessTokenResponse{
+		Token:               rawToken,
+		PersonalAccessToken: pat,
+	})
+}
+
+func RevokePersonalAccessToken(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	tokenId := c.Params("tokenId")
+	if err := services.NewPersonalAccessTokenService(database.DB).DeleteToken(userId, tokenId); err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "Personal access token not found")
+	}
+
+	recordAuditEvent(c, userId, services.AUDIT_EVENT_PAT_REVOKED, true, map[string]any{"tokenId": tokenId})
+	patLogger.Infof("User %d revoked personal access token %s", userId, tokenId)
+	return utils.HandleSuccess(c, "Personal access token revoked successfully", nil)
+}
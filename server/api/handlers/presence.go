@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// GetFriendsPresence returns which of the user's friends are online
+func GetFriendsPresence(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+	if c.Params("userId") != strconv.FormatUint(uint64(userId), 10) {
+		return utils.HandleError(c, fiber.StatusForbidden, "Users can only see the presence of their own friends", nil)
+	}
+
+	presences, err := services.NewUserService(database.DB).GetFriendsPresence(userId)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Friends' presence retrieved successfully", presences)
+}
+
+// SetPresenceVisibility hides or shows whether the user is online, and tells their friends right away
+func SetPresenceVisibility(c *fiber.Ctx, kafkaSvc *services.KafkaService) error {
+	var request request.SetPresenceVisibilityRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	userService := services.NewUserService(database.DB)
+	user, err := userService.SetPresenceHidden(userId, request.Hidden)
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No user found with ID %d", userId))
+	}
+
+	if err := userService.BroadcastPresence(kafkaSvc, userId); err != nil {
+		userLogger.Error("Failed to broadcast presence: ", err)
+	}
+
+	return utils.HandleSuccess(c, "Presence visibility updated successfully", user)
+}
@@ -3,10 +3,12 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model"
 	"github.com/RowenTey/JustJio/server/api/model/request"
 	"github.com/RowenTey/JustJio/server/api/model/response"
 	"github.com/RowenTey/JustJio/server/api/services"
@@ -107,8 +109,16 @@ func GetUninvitedFriendsForRoom(c *fiber.Ctx) error {
 	userId := utils.GetUserInfoFromToken(token, "user_id")
 	roomId := c.Params("roomId")
 
+	var circleIds []uint
+	if circleId := c.QueryInt("circle", 0); circleId > 0 {
+		circleIds = []uint{uint(circleId)}
+		if err := validateCircles(database.DB, userId, circleIds); err != nil {
+			return utils.HandleNotFoundOrInternalError(c, err, "Circle not found")
+		}
+	}
+
 	roomService := services.NewRoomService(database.DB)
-	friends, err := roomService.GetUninvitedFriendsForRoom(roomId, userId)
+	friends, err := roomService.GetUninvitedFriendsForRoom(roomId, userId, circleIds)
 	if err != nil {
 		return utils.HandleNotFoundOrInternalError(c, err, "No uninvited friends found")
 	}
@@ -153,10 +163,19 @@ func CreateRoom(c *fiber.Ctx) error {
 		return utils.HandleInternalServerError(c, err)
 	}
 
+	invitees, err = withCircleMembers(tx, room.ID, userId, request.CircleIDs, invitees)
+	if err != nil {
+		tx.Rollback()
+		return utils.HandleNotFoundOrInternalError(c, err, "Circle not found")
+	}
+
 	invites, err := roomService.InviteUserToRoom(
 		room.ID, user, invitees, request.Message)
 	if err != nil {
 		tx.Rollback()
+		if err.Error() == "user cannot be invited" {
+			return utils.HandleError(c, fiber.StatusForbidden, "User cannot be invited", err)
+		}
 		return utils.HandleInternalServerError(c, err)
 	}
 
@@ -312,6 +331,12 @@ func InviteUser(c *fiber.Ctx) error {
 		return utils.HandleError(c, fiber.StatusNotFound, "User doesn't exist", err)
 	}
 
+	invitees, err = withCircleMembers(tx, roomId, userId, request.CircleIDs, invitees)
+	if err != nil {
+		tx.Rollback()
+		return utils.HandleNotFoundOrInternalError(c, err, "Circle not found")
+	}
+
 	roomInvites, err := services.NewRoomService(tx).InviteUserToRoom(
 		roomId, user, invitees, request.Message)
 	if err != nil {
@@ -322,6 +347,8 @@ func InviteUser(c *fiber.Ctx) error {
 			return utils.HandleError(c, fiber.StatusConflict, "User is already in the room", err)
 		} else if err.Error() == "user already has pending invite" {
 			return utils.HandleError(c, fiber.StatusConflict, "User already has pending invite", err)
+		} else if err.Error() == "user cannot be invited" {
+			return utils.HandleError(c, fiber.StatusForbidden, "User cannot be invited", err)
 		}
 		return utils.HandleNotFoundOrInternalError(c, err, "Room / User not found")
 	}
@@ -358,3 +385,43 @@ func LeaveRoom(c *fiber.Ctx) error {
 }
 
 // TODO: Implement endpoint for host to remove user from room
+
+// withCircleMembers adds the members of the user's circles who aren't in the room or invited yet to the invitees
+func withCircleMembers(
+	tx *gorm.DB,
+	roomId, userId string,
+	circleIds []uint,
+	invitees *[]model.User,
+) (*[]model.User, error) {
+	if len(circleIds) == 0 {
+		return invitees, nil
+	}
+
+	if err := validateCircles(tx, userId, circleIds); err != nil {
+		return nil, err
+	}
+	members, err := services.NewRoomService(tx).GetUninvitedFriendsForRoom(roomId, userId, circleIds)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := *invitees
+	invited := make(map[uint]bool, len(merged))
+	for _, invitee := range merged {
+		invited[invitee.ID] = true
+	}
+	for _, member := range *members {
+		if !invited[member.ID] {
+			merged = append(merged, member)
+		}
+	}
+	return &merged, nil
+}
+
+func validateCircles(db *gorm.DB, userId string, circleIds []uint) error {
+	ownerId, err := strconv.ParseUint(userId, 10, 32)
+	if err != nil {
+		return err
+	}
+	return services.NewFriendCircleService(db).ValidateCircles(uint(ownerId), circleIds)
+}
@@ -64,7 +64,7 @@ func (suite *RoomHandlerTestSuite) SetupSuite() {
 
 	// Setup Fiber app
 	suite.app = fiber.New()
-	suite.app.Use(middleware.Authenticated(mockJWTSecret))
+	suite.app.Use(middleware.Authenticated())
 
 	// Register Room routes
 	roomRoutes := suite.app.Group("/rooms")
@@ -75,7 +75,7 @@ func (suite *RoomHandlerTestSuite) SetupSuite() {
 	roomRoutes.Get("/:roomId", GetRoom)
 	roomRoutes.Get("/:roomId/attendees", GetRoomAttendees)
 	roomRoutes.Get("/:roomId/uninvited-friends", GetUninvitedFriendsForRoom)
-	roomRoutes.Post("/", CreateRoom)
+	roomRoutes.Post("/", middleware.RequireVerifiedEmail, CreateRoom)
 	roomRoutes.Post("/:roomId/invite", InviteUser)
 	roomRoutes.Patch("/:roomId/close", CloseRoom)
 	roomRoutes.Patch("/:roomId/join", JoinRoom)
@@ -99,9 +99,10 @@ func (suite *RoomHandlerTestSuite) SetupTest() {
 	// Create test host user
 	hashedPassword1, _ := utils.HashPassword("password123")
 	host := model.User{
-		Username: "hostuser",
-		Email:    "host@example.com",
-		Password: hashedPassword1,
+		Username:     "hostuser",
+		Email:        "host@example.com",
+		Password:     hashedPassword1,
+		IsEmailValid: true,
 	}
 	result := suite.db.Create(&host)
 	assert.NoError(suite.T(), result.Error)
@@ -318,6 +319,42 @@ func (suite *RoomHandlerTestSuite) TestCreateRoom_Success() {
 	assert.Len(suite.T(), invitesData, 1)
 }
 
+func (suite *RoomHandlerTestSuite) TestCreateRoom_EmailNotVerified() {
+	reqBody, _ := json.Marshal(request.CreateRoomRequest{Room: model.Room{Name: "New Test Room"}})
+
+	req := httptest.NewRequest(http.MethodPost, "/rooms", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken) // testuser hasn't verified their email
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+}
+
+func (suite *RoomHandlerTestSuite) TestCreateRoom_BlockedInvitee() {
+	err := suite.db.Create(&model.UserBlock{BlockerID: suite.testUserID, BlockedID: suite.testHostID}).Error
+	assert.NoError(suite.T(), err)
+
+	inviteesJSON, _ := json.Marshal([]string{fmt.Sprintf("%d", suite.testUserID)})
+	reqBody, _ := json.Marshal(request.CreateRoomRequest{
+		Room:       model.Room{Name: "New Test Room"},
+		InviteesId: datatypes.JSON(inviteesJSON),
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/rooms", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.testHostToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+
+	// The room isn't created either
+	var count int64
+	suite.db.Model(&model.Room{}).Where("name = ?", "New Test Room").Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+}
+
 func (suite *RoomHandlerTestSuite) TestInviteUser_Success() {
 	// Create a new user to invite
 	newUser := model.User{
@@ -353,6 +390,62 @@ func (suite *RoomHandlerTestSuite) TestInviteUser_Success() {
 	assert.Len(suite.T(), responseBody["data"].([]any), 1)
 }
 
+func (suite *RoomHandlerTestSuite) TestInviteUser_Circle() {
+	newUser := model.User{
+		Username: "newuser",
+		Email:    "newuser@test.com",
+		Password: "password789",
+	}
+	result := suite.db.Create(&newUser)
+	assert.NoError(suite.T(), result.Error)
+
+	suite.db.Exec("INSERT INTO user_friends (user_id, friend_id) VALUES (?, ?), (?, ?), (?, ?), (?, ?)",
+		suite.testHostID, suite.testUserID, suite.testUserID, suite.testHostID,
+		suite.testHostID, newUser.ID, newUser.ID, suite.testHostID)
+	circle, err := services.NewFriendCircleService(suite.db).
+		CreateCircle(suite.testHostID, "Badminton", []uint{suite.testUserID, newUser.ID})
+	assert.NoError(suite.T(), err)
+
+	inviteReq := request.InviteUserRequest{
+		InviteesId: datatypes.JSON("[]"),
+		CircleIDs:  []uint{circle.ID},
+	}
+	reqBody, _ := json.Marshal(inviteReq)
+
+	req := httptest.NewRequest(http.MethodPost,
+		"/rooms/"+suite.testRoomID+"/invite", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.testHostToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	// testuser already has a pending invite, so only newuser is invited
+	var responseBody map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&responseBody)
+	assert.NoError(suite.T(), err)
+	invites := responseBody["data"].([]any)
+	assert.Len(suite.T(), invites, 1)
+	assert.Equal(suite.T(), float64(newUser.ID), invites[0].(map[string]any)["userId"])
+}
+
+func (suite *RoomHandlerTestSuite) TestInviteUser_UnknownCircle() {
+	reqBody, _ := json.Marshal(request.InviteUserRequest{
+		InviteesId: datatypes.JSON("[]"),
+		CircleIDs:  []uint{999},
+	})
+
+	req := httptest.NewRequest(http.MethodPost,
+		"/rooms/"+suite.testRoomID+"/invite", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.testHostToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusNotFound, resp.StatusCode)
+}
+
 func (suite *RoomHandlerTestSuite) TestJoinRoom_Success() {
 	req := httptest.NewRequest(http.MethodPatch,
 		"/rooms/"+suite.testRoomID+"/join", nil)
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var sessionLogger = log.WithFields(log.Fields{"service": "SessionHandler"})
+
+// currentSessionId returns the session (refresh token family) the access token was issued for
+func currentSessionId(c *fiber.Ctx) string {
+	token := c.Locals("user").(*jwt.Token)
+	sessionId, _ := token.Claims.(jwt.MapClaims)["sid"].(string)
+	return sessionId
+}
+
+func GetSessions(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	sessions, err := services.NewTokenService(database.DB).GetSessions(userId, currentSessionId(c))
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Retrieved sessions successfully", sessions)
+}
+
+// RevokeSession logs out one session, including the current one
+func RevokeSession(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	sessionId := c.Params("sessionId")
+	if err := services.NewTokenService(database.DB).RevokeSession(userId, sessionId); err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "Session not found")
+	}
+
+	recordAuditEvent(c, userId, services.AUDIT_EVENT_TOKEN_REVOKED, true,
+		map[string]any{"reason": "session revoked", "sessionId": sessionId})
+	return utils.HandleSuccess(c, "Session revoked successfully", nil)
+}
+
+// RevokeOtherSessions logs out every session except the current one
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := services.NewTokenService(database.DB).RevokeOtherSessions(userId, currentSessionId(c)); err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	recordAuditEvent(c, userId, services.AUDIT_EVENT_TOKEN_REVOKED, true,
+		map[string]any{"reason": "other sessions revoked"})
+	return utils.HandleSuccess(c, "Other sessions revoked successfully", nil)
+}
+
+// ChangePassword replaces the password after checking the current one, then logs out every other session
+func ChangePassword(c *fiber.Ctx) error {
+	var request request.ChangePasswordRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+	if request.NewPassword == "" {
+		return utils.HandleInvalidInputError(c, errors.New("new password is required"))
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userService := services.NewUserService(database.DB)
+	user, err := userService.GetUserByID(utils.GetUserInfoFromToken(token, "user_id"))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	// Accounts created through a social login use SetPassword instead
+	if !user.HasPassword {
+		return utils.HandleError(c, fiber.StatusBadRequest, "No password set", errors.New("password not set"))
+	}
+
+	throttleService := services.NewThrottleService(database.DB)
+	throttleKey := services.ThrottleKey("change-password", "user", fmt.Sprint(user.ID))
+	if retryAfter, err := throttleService.Check(throttleKey); err != nil {
+		return handleThrottleError(c, retryAfter, err)
+	}
+
+	if !utils.CheckPasswordHash(request.CurrentPassword, user.Password) {
+		recordFailure(throttleService, throttleKey, services.EMAIL_THROTTLE_POLICY)
+		recordAuditEvent(c, user.ID, services.AUDIT_EVENT_PASSWORD_CHANGED, false,
+			map[string]any{"reason": "invalid password"})
+		return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid password", errors.New("password does not match the user's password"))
+	}
+	if err := throttleService.Reset(throttleKey); err != nil {
+		sessionLogger.Error("Error resetting change password throttle: ", err)
+	}
+
+	user.Password, err = utils.HashPassword(request.NewPassword)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+	user.HasPassword = true
+
+	tx := database.DB.Begin()
+
+	if _, err := services.NewUserService(tx).CreateOrUpdateUser(user, false); err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := services.NewTokenService(tx).RevokeOtherSessions(user.ID, currentSessionId(c)); err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_PASSWORD_CHANGED, true, nil)
+	sessionLogger.Info("User " + user.Username + " changed their password")
+	return utils.HandleSuccess(c, "Password changed successfully", nil)
+}
@@ -62,7 +62,7 @@ func (suite *SubscriptionHandlerTestSuite) SetupSuite() {
 
 	// Setup Fiber app
 	suite.app = fiber.New()
-	suite.app.Use(middleware.Authenticated(mockJWTSecret))
+	suite.app.Use(middleware.Authenticated())
 
 	// Notification channel for testing
 	suite.testNotifChan = make(chan model_push_notifications.NotificationData, 100)
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var throttleLogger = log.WithFields(log.Fields{"service": "ThrottleHandler"})
+
+// UnlockAccount clears a lockout with the token emailed when the account was locked
+func UnlockAccount(c *fiber.Ctx) error {
+	var request request.UnlockAccountRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+
+	userId, err := authService.ParseUnlockToken(request.Token)
+	if err != nil {
+		return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid or expired unlock token", err)
+	}
+
+	if err := services.NewThrottleService(database.DB).Reset(loginThrottleKey(userId)); err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	throttleLogger.Info("User ", userId, " unlocked their account")
+	return utils.HandleSuccess(c, "Account unlocked successfully", nil)
+}
+
+// handleThrottleError responds to an attempt rejected by ThrottleService.Check
+func handleThrottleError(c *fiber.Ctx, retryAfter time.Duration, err error) error {
+	c.Set(fiber.HeaderRetryAfter, fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+
+	switch err.Error() {
+	case "account locked":
+		return utils.HandleError(c, fiber.StatusLocked,
+			"Account temporarily locked, check your email to unlock it", err)
+	case "too many attempts":
+		return utils.HandleError(c, fiber.StatusTooManyRequests,
+			"Too many failed attempts, please try again later", err)
+	}
+	return utils.HandleInternalServerError(c, err)
+}
+
+// recordFailure counts a failed attempt against the key. Errors are only logged
+// so they don't hide the response for the attempt itself.
+func recordFailure(throttleService *services.ThrottleService, key string, policy services.ThrottlePolicy) bool {
+	locked, err := throttleService.RecordFailure(key, policy)
+	if err != nil {
+		throttleLogger.Error("Error recording failed attempt for ", key, ": ", err)
+	}
+	return locked
+}
+
+// loginThrottleKey is what failed logins are counted against for the account.
+// Keyed by ID rather than username so renaming the account doesn't clear its lockout.
+func loginThrottleKey(userId uint) string {
+	return services.ThrottleKey("login", "user", fmt.Sprint(userId))
+}
+
+// recordLoginFailure counts a failed password login, emailing the user if it locked their account.
+// Failures for unknown users are only counted against the IP.
+func recordLoginFailure(c *fiber.Ctx, throttleService *services.ThrottleService, user *model.User, ipKey string) {
+	recordFailure(throttleService, ipKey, services.IP_THROTTLE_POLICY)
+	if user == nil || !recordFailure(throttleService, loginThrottleKey(user.ID), services.ACCOUNT_THROTTLE_POLICY) {
+		return
+	}
+
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_ACCOUNT_LOCKED, true, nil)
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+
+	unlockToken, err := authService.CreateUnlockToken(user.ID)
+	if err != nil {
+		throttleLogger.Error("Error creating unlock token: ", err)
+		return
+	}
+
+	if err := authService.SendAccountLockedEmail(
+		unlockToken, user.Username, user.Email, c.Get(fiber.HeaderAcceptLanguage)); err != nil {
+		throttleLogger.Error("Error sending account locked email: ", err)
+	}
+}
+
+// resetLoginThrottle clears the user's failed password logins once they've proven ownership
+// of the account another way, e.g. by email
+func resetLoginThrottle(userId uint) {
+	if err := services.NewThrottleService(database.DB).Reset(loginThrottleKey(userId)); err != nil {
+		throttleLogger.Error("Error resetting login throttle for user ", userId, ": ", err)
+	}
+}
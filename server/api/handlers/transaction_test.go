@@ -61,7 +61,7 @@ func (suite *TransactionHandlerTestSuite) SetupSuite() {
 
 	// Setup Fiber app
 	suite.app = fiber.New()
-	suite.app.Use(middleware.Authenticated(mockJWTSecret))
+	suite.app.Use(middleware.Authenticated())
 
 	// Notification channel for testing
 	suite.testNotifChan = make(chan NotificationData, 100)
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/model/request"
+	"github.com/RowenTey/JustJio/server/api/model/response"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+var twoFactorLogger = log.WithFields(log.Fields{"service": "TwoFactorHandler"})
+
+// VerifyTwoFactorLogin exchanges the challenge token from Login and a TOTP / recovery code for a session
+func VerifyTwoFactorLogin(c *fiber.Ctx, kafkaSvc *services.KafkaService) error {
+	var request request.TwoFactorLoginRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	authService := services.NewAuthService(
+		utils.HashPassword,
+		config.Config("JWT_SECRET"),
+		utils.NewMailer(),
+		config.SetupGoogleOAuthConfig(),
+	)
+
+	userId, challengeId, err := authService.ParseChallengeToken(request.ChallengeToken)
+	if err != nil {
+		return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid or expired challenge token", err)
+	}
+
+	user, err := services.NewUserService(database.DB).GetUserByID(fmt.Sprint(userId))
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	// Failed codes count towards the same lockout as failed passwords, across challenges
+	throttleService := services.NewThrottleService(database.DB)
+	accountKey := loginThrottleKey(user.ID)
+	ipKey := services.ThrottleKey("login", "ip", c.IP())
+	if retryAfter, err := throttleService.Check(accountKey, ipKey); err != nil {
+		recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, false, map[string]any{"method": "2fa", "reason": "throttled"})
+		return handleThrottleError(c, retryAfter, err)
+	}
+
+	// Every code counts against the challenge, which is locked once it runs out of attempts
+	twoFactorService := services.NewTwoFactorService(database.DB)
+	if err := twoFactorService.BeginChallengeAttempt(challengeId, userId); err != nil {
+		if err.Error() == "invalid challenge" {
+			return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid or expired challenge token", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := twoFactorService.VerifyCode(user.ID, request.Code); err != nil {
+		recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, false, map[string]any{"method": "2fa", "reason": err.Error()})
+
+		if err.Error() == "invalid code" {
+			recordLoginFailure(c, throttleService, user, ipKey)
+			return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid code", err)
+		}
+		if err.Error() == "2fa not enabled" {
+			return utils.HandleError(c, fiber.StatusBadRequest, "Two-factor authentication is not enabled", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	// Only one of any concurrent redemptions of the same challenge gets a session
+	if err := twoFactorService.ConsumeChallenge(challengeId); err != nil {
+		if err.Error() == "invalid challenge" {
+			return utils.HandleError(c, fiber.StatusUnauthorized, "Invalid or expired challenge token", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+	if err := throttleService.Reset(accountKey); err != nil {
+		twoFactorLogger.Error("Error resetting login throttle: ", err)
+	}
+
+	token, refreshToken, err := createSession(c, authService, user, "")
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	// create user channel when login
+	go createUserChannel(kafkaSvc, user.ID)
+
+	response := response.AuthResponse{
+		Username:   user.Username,
+		Email:      user.Email,
+		PictureUrl: user.PictureUrl,
+		UID:        user.ID,
+	}
+
+	recordAuditEvent(c, user.ID, services.AUDIT_EVENT_LOGIN, true, map[string]any{"method": "2fa"})
+	twoFactorLogger.Info("User " + response.Username + " logged in with 2FA successfully.")
+	return utils.HandleLoginSuccess(c, "Login successfully", token, refreshToken, response)
+}
+
+// createTwoFactorChallenge issues the single-use challenge token for a user who passed the first factor
+func createTwoFactorChallenge(authService *services.AuthService, user *model.User) (string, error) {
+	challengeId, err := services.NewTwoFactorService(database.DB).
+		CreateChallenge(user.ID, time.Now().Add(services.CHALLENGE_TOKEN_EXPIRY))
+	if err != nil {
+		return "", err
+	}
+	return authService.CreateChallengeToken(user, challengeId)
+}
+
+func EnrollTwoFactor(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId := utils.GetUserInfoFromToken(token, "user_id")
+
+	user, err := services.NewUserService(database.DB).GetUserByID(userId)
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	secret, uri, err := services.NewTwoFactorService(database.DB).BeginEnrollment(user)
+	if err != nil {
+		if err.Error() == "2fa already enabled" {
+			return utils.HandleError(c, fiber.StatusConflict, "Two-factor authentication is already enabled", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	response := response.TwoFactorEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: uri,
+	}
+	return utils.HandleSuccess(c, "Two-factor enrolment started", response)
+}
+
+func ConfirmTwoFactor(c *fiber.Ctx) error {
+	var request request.TwoFactorCodeRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	tx := database.DB.Begin()
+
+	recoveryCodes, err := services.NewTwoFactorService(tx).ConfirmEnrollment(userId, request.Code)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.HandleError(c, fiber.StatusNotFound, "Two-factor enrolment not started", err)
+		}
+		if err.Error() == "2fa already enabled" {
+			return utils.HandleError(c, fiber.StatusConflict, "Two-factor authentication is already enabled", err)
+		}
+		if err.Error() == "invalid code" {
+			return utils.HandleError(c, fiber.StatusBadRequest, "Invalid code", err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	twoFactorLogger.Infof("User %d enabled 2FA", userId)
+	response := response.RecoveryCodesResponse{RecoveryCodes: recoveryCodes}
+	return utils.HandleSuccess(c, "Two-factor authentication enabled", response)
+}
+
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	var request request.TwoFactorCodeRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	tx := database.DB.Begin()
+	twoFactorService := services.NewTwoFactorService(tx)
+
+	if err := twoFactorService.VerifyCode(userId, request.Code); err != nil {
+		tx.Rollback()
+		return handleTwoFactorCodeError(c, err)
+	}
+
+	recoveryCodes, err := twoFactorService.RegenerateRecoveryCodes(userId)
+	if err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	response := response.RecoveryCodesResponse{RecoveryCodes: recoveryCodes}
+	return utils.HandleSuccess(c, "Recovery codes regenerated", response)
+}
+
+func DisableTwoFactor(c *fiber.Ctx) error {
+	var request request.TwoFactorCodeRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	tx := database.DB.Begin()
+
+	if err := services.NewTwoFactorService(tx).Disable(userId, request.Code); err != nil {
+		tx.Rollback()
+		return handleTwoFactorCodeError(c, err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	twoFactorLogger.Infof("User %d disabled 2FA", userId)
+	return utils.HandleSuccess(c, "Two-factor authentication disabled", nil)
+}
+
+func handleTwoFactorCodeError(c *fiber.Ctx, err error) error {
+	if err.Error() == "2fa not enabled" {
+		return utils.HandleError(c, fiber.StatusBadRequest, "Two-factor authentication is not enabled", err)
+	}
+	if err.Error() == "invalid code" {
+		return utils.HandleError(c, fiber.StatusBadRequest, "Invalid code", err)
+	}
+	return utils.HandleInternalServerError(c, err)
+}
@@ -1,19 +1,30 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model"
 	"github.com/RowenTey/JustJio/server/api/model/request"
 	"github.com/RowenTey/JustJio/server/api/model/response"
 	"github.com/RowenTey/JustJio/server/api/services"
 	"github.com/RowenTey/JustJio/server/api/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
 )
 
+// MIME_MERGE_PATCH_JSON is the content type of a JSON Merge Patch (RFC 7396)
+const MIME_MERGE_PATCH_JSON = "application/merge-patch+json"
+
 var userLogger = log.WithFields(log.Fields{"service": "UserHandler"})
 
 func GetUser(c *fiber.Ctx) error {
@@ -22,39 +33,134 @@ func GetUser(c *fiber.Ctx) error {
 	if err != nil {
 		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No user found with ID %s", id))
 	}
+
+	// Only the user sees their own private fields
+	token := c.Locals("user").(*jwt.Token)
+	if userId, err := utils.GetUserIdFromToken(token); err == nil && userId == user.ID {
+		return utils.HandleSuccess(c, "User found successfully", response.NewProfileResponse(user))
+	}
 	return utils.HandleSuccess(c, "User found successfully", user)
 }
 
+// UpdateUser applies a JSON Merge Patch of profile fields, e.g. {"bio": "hi", "phoneNum": null}
 func UpdateUser(c *fiber.Ctx) error {
-	var request request.UpdateUserRequest
-	if err := c.BodyParser(&request); err != nil {
+	contentType := c.Get(fiber.HeaderContentType)
+	if !strings.HasPrefix(contentType, MIME_MERGE_PATCH_JSON) && !strings.HasPrefix(contentType, fiber.MIMEApplicationJSON) {
+		return utils.HandleError(c, fiber.StatusUnsupportedMediaType,
+			"Body must be "+MIME_MERGE_PATCH_JSON, nil)
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &patch); err != nil {
 		return utils.HandleInvalidInputError(c, err)
 	}
 
-	id := c.Params("userId")
-	userService := services.NewUserService(database.DB)
-	err := userService.UpdateUserField(id, request.Field, request.Value)
+	userID, err := c.ParamsInt("userId")
 	if err != nil {
-		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No user found with ID %s", id))
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	user, err := services.NewUserService(database.DB).UpdateProfile(uint(userID), patch)
+	if err != nil {
+		var fieldErr *services.ProfileFieldError
+		if errors.As(err, &fieldErr) {
+			return utils.HandleInvalidInputError(c, err)
+		}
+		if errors.Is(err, services.ErrUsernameTaken) || errors.Is(err, services.ErrPhoneNumTaken) {
+			return utils.HandleError(c, fiber.StatusConflict, err.Error(), err)
+		}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return utils.HandleError(c, fiber.StatusConflict, "Username or phone number already in use", err)
+		}
+		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No user found with ID %d", userID))
 	}
 
-	userLogger.Infof("User %s updated field %s to %s", id, request.Field, request.Value)
-	return utils.HandleSuccess(c, "User successfully updated", request)
+	userLogger.Infof("User %d updated their profile", userID)
+	return utils.HandleSuccess(c, "User successfully updated", response.NewProfileResponse(user))
 }
 
-func DeleteUser(c *fiber.Ctx) error {
-	id := c.Params("userId")
+// UploadPicture replaces the profile picture with a multipart "picture" upload
+func UploadPicture(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("userId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
 
-	userService := services.NewUserService(database.DB)
+	fileHeader, err := c.FormFile("picture")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+	if fileHeader.Size > utils.AVATAR_MAX_BYTES {
+		return utils.HandleError(c, fiber.StatusRequestEntityTooLarge, "Picture is too large", utils.ErrAvatarTooLarge)
+	}
 
-	err := userService.DeleteUser(id)
+	file, err := fileHeader.Open()
 	if err != nil {
-		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No user found with ID %s", id))
+		return utils.HandleInternalServerError(c, err)
+	}
+	defer file.Close()
+
+	// Read one byte past the limit to catch a Size that lies
+	data, err := io.ReadAll(io.LimitReader(file, utils.AVATAR_MAX_BYTES+1))
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	resized, err := utils.ResizeAvatar(data)
+	if err != nil {
+		if errors.Is(err, utils.ErrAvatarTooLarge) {
+			return utils.HandleError(c, fiber.StatusRequestEntityTooLarge, "Picture is too large", err)
+		}
+		if errors.Is(err, utils.ErrAvatarUnsupportedType) {
+			return utils.HandleError(c, fiber.StatusUnsupportedMediaType, "Picture must be a JPEG, PNG, GIF or WebP image", err)
+		}
+		return utils.HandleInternalServerError(c, err)
 	}
-	return utils.HandleSuccess(c, "User successfully deleted", nil)
+
+	store, err := utils.NewBlobStore()
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	urls, err := services.NewUserService(database.DB).SetProfilePicture(c.Context(), store, uint(userID), resized)
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No user found with ID %d", userID))
+	}
+
+	userLogger.Infof("User %d uploaded a new profile picture", userID)
+	return utils.HandleSuccess(c, "Profile picture updated successfully", urls)
+}
+
+// DeleteUser schedules the account for deletion after a grace period, during which it can be cancelled.
+// Fails with the settlement plan while the user has unsettled bills or transactions.
+func DeleteUser(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+	if c.Params("userId") != strconv.FormatUint(uint64(userId), 10) {
+		return utils.HandleError(c, fiber.StatusForbidden, "Users can only delete their own account", nil)
+	}
+
+	deletion, plan, err := services.NewAccountDeletionService(database.DB).ScheduleDeletion(userId)
+	if err != nil {
+		if errors.Is(err, services.ErrUnsettledDebts) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Settle your bills and transactions before deleting your account",
+				"data":    plan,
+			})
+		}
+		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No user found with ID %d", userId))
+	}
+
+	recordAuditEvent(c, userId, services.AUDIT_EVENT_ACCOUNT_DELETION_SCHEDULED, true,
+		map[string]any{"scheduledFor": deletion.ScheduledFor})
+	return utils.HandleSuccess(c, "User scheduled for deletion", deletion)
 }
 
-func SendFriendRequest(c *fiber.Ctx) error {
+func SendFriendRequest(c *fiber.Ctx, notificationsChan chan<- NotificationData) error {
 	userID, err := c.ParamsInt("userId")
 	if err != nil {
 		return utils.HandleInvalidInputError(c, err)
@@ -66,16 +172,22 @@ func SendFriendRequest(c *fiber.Ctx) error {
 	}
 
 	userService := services.NewUserService(database.DB)
-	if err := userService.SendFriendRequest(uint(userID), request.FriendID); err != nil {
+	friendRequest, err := userService.SendFriendRequest(uint(userID), request.FriendID)
+	if err != nil {
 		if err.Error() == "cannot send friend request to yourself" ||
 			err.Error() == "already friends" ||
 			err.Error() == "friend request already sent" {
 			return utils.HandleError(
 				c, fiber.StatusConflict, err.Error(), err)
 		}
+		if err.Error() == "cannot send friend request to this user" {
+			return utils.HandleError(
+				c, fiber.StatusForbidden, err.Error(), err)
+		}
 		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No user found with ID %d", userID))
 	}
 
+	notifyFriendRequest(friendRequest, "sent", notificationsChan)
 	return utils.HandleSuccess(c, "Friend request sent", nil)
 }
 
@@ -154,7 +266,7 @@ func SearchFriends(c *fiber.Ctx) error {
 
 	userService := services.NewUserService(database.DB)
 
-	friends, err := userService.SearchUsers(userID, query)
+	friends, err := userService.SearchUsers(userID, query, c.QueryInt("page", 1))
 	if err != nil {
 		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No user found with ID %s", userID))
 	}
@@ -162,6 +274,87 @@ func SearchFriends(c *fiber.Ctx) error {
 	return utils.HandleSuccess(c, "Friends retrieved successfully", friends)
 }
 
+func GetBlockedUsers(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("userId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	blocks, err := services.NewUserService(database.DB).GetBlockedUsers(uint(userID))
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Blocked users retrieved successfully", blocks)
+}
+
+func BlockUser(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("userId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	var request request.BlockUserRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	tx := database.DB.Begin()
+
+	if err := services.NewUserService(tx).BlockUser(uint(userID), request.UserID); err != nil {
+		tx.Rollback()
+		if err.Error() == "cannot block yourself" {
+			return utils.HandleInvalidInputError(c, err)
+		}
+		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No user found with ID %d", request.UserID))
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	userLogger.Infof("User %d blocked user %d", userID, request.UserID)
+	return utils.HandleSuccess(c, "User blocked successfully", nil)
+}
+
+func UnblockUser(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("userId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	blockedID, err := c.ParamsInt("blockedId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	if err := services.NewUserService(database.DB).UnblockUser(uint(userID), uint(blockedID)); err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("User %d is not blocked", blockedID))
+	}
+
+	return utils.HandleSuccess(c, "User unblocked successfully", nil)
+}
+
+func GetFriendSuggestions(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("userId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	limit := c.QueryInt("limit", services.FRIEND_SUGGESTIONS_LIMIT)
+	if limit <= 0 || limit > 50 {
+		limit = services.FRIEND_SUGGESTIONS_LIMIT
+	}
+
+	suggestions, err := services.NewUserService(database.DB).GetFriendSuggestions(uint(userID), limit)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Friend suggestions retrieved successfully", suggestions)
+}
+
 func GetFriendRequestsByStatus(c *fiber.Ctx) error {
 	userID, err := c.ParamsInt("userId")
 	if err != nil {
@@ -182,6 +375,49 @@ func GetFriendRequestsByStatus(c *fiber.Ctx) error {
 	return utils.HandleSuccess(c, "Friend requests retrieved successfully", requests)
 }
 
+func GetSentFriendRequests(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("userId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	status := c.Query("status", "pending")
+	userService := services.NewUserService(database.DB)
+
+	requests, err := userService.GetSentFriendRequestsByStatus(uint(userID), status)
+	if err != nil {
+		if err.Error() == "invalid status" {
+			return utils.HandleInvalidInputError(c, err)
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	return utils.HandleSuccess(c, "Sent friend requests retrieved successfully", requests)
+}
+
+func CancelFriendRequest(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("userId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	requestID, err := c.ParamsInt("requestId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
+	userService := services.NewUserService(database.DB)
+	if _, err := userService.CancelFriendRequest(uint(userID), uint(requestID)); err != nil {
+		if err.Error() == "friend request already processed" {
+			return utils.HandleError(
+				c, fiber.StatusConflict, err.Error(), err)
+		}
+		return utils.HandleNotFoundOrInternalError(c, err, fmt.Sprintf("No friend request found with ID %d", requestID))
+	}
+
+	return utils.HandleSuccess(c, "Friend request cancelled successfully", nil)
+}
+
 func CountPendingFriendRequests(c *fiber.Ctx) error {
 	userID, err := c.ParamsInt("userId")
 	if err != nil {
@@ -201,7 +437,12 @@ func CountPendingFriendRequests(c *fiber.Ctx) error {
 	return utils.HandleSuccess(c, "Pending friend requests counted successfully", response)
 }
 
-func RespondToFriendRequest(c *fiber.Ctx) error {
+func RespondToFriendRequest(c *fiber.Ctx, notificationsChan chan<- NotificationData) error {
+	userID, err := c.ParamsInt("userId")
+	if err != nil {
+		return utils.HandleInvalidInputError(c, err)
+	}
+
 	var request request.RespondToFriendRequestRequest
 	if err := c.BodyParser(&request); err != nil {
 		return utils.HandleInvalidInputError(c, err)
@@ -211,24 +452,68 @@ func RespondToFriendRequest(c *fiber.Ctx) error {
 
 	switch request.Action {
 	case "accept":
-		if err := userService.AcceptFriendRequest(uint(request.RequestID)); err != nil {
-			if err.Error() == "friend request already processed" {
+		friendRequest, err := userService.AcceptFriendRequest(uint(userID), uint(request.RequestID))
+		if err != nil {
+			if err.Error() == "friend request already processed" ||
+				err.Error() == "friend request expired" {
 				return utils.HandleError(
 					c, fiber.StatusConflict, err.Error(), err)
 			}
 			return utils.HandleNotFoundOrInternalError(c, err, "Error processing friend request")
 		}
+		notifyFriendRequest(friendRequest, "accepted", notificationsChan)
 		return utils.HandleSuccess(c, "Friend request accepted successfully", nil)
 	case "reject":
-		if err := userService.RejectFriendRequest(uint(request.RequestID)); err != nil {
-			if err.Error() == "friend request already processed" {
+		friendRequest, err := userService.RejectFriendRequest(uint(userID), uint(request.RequestID))
+		if err != nil {
+			if err.Error() == "friend request already processed" ||
+				err.Error() == "friend request expired" {
 				return utils.HandleError(
 					c, fiber.StatusConflict, err.Error(), err)
 			}
 			return utils.HandleNotFoundOrInternalError(c, err, "Error processing friend request")
 		}
+		notifyFriendRequest(friendRequest, "rejected", notificationsChan)
 		return utils.HandleSuccess(c, "Friend request rejected successfully", nil)
 	default:
 		return utils.HandleInvalidInputError(c, fmt.Errorf("invalid action: must be 'accept' or 'reject'"))
 	}
 }
+
+// notifyFriendRequest tells both the sender and the receiver that a friend request was sent, accepted or rejected
+func notifyFriendRequest(friendRequest *model.FriendRequest, event string, notificationsChan chan<- NotificationData) {
+	db := database.DB
+
+	go func() {
+		userService := services.NewUserService(db)
+		sender, err := userService.GetUserByID(strconv.FormatUint(uint64(friendRequest.SenderID), 10))
+		if err != nil {
+			userLogger.Error("Error getting friend request sender: ", err)
+			return
+		}
+		receiver, err := userService.GetUserByID(strconv.FormatUint(uint64(friendRequest.ReceiverID), 10))
+		if err != nil {
+			userLogger.Error("Error getting friend request receiver: ", err)
+			return
+		}
+
+		notificationService := services.NewNotificationService(db)
+		switch event {
+		case "sent":
+			notificationService.NotifyUser(receiver.ID, "New Friend Request",
+				fmt.Sprintf("%s sent you a friend request", sender.Username), notificationsChan)
+			notificationService.NotifyUser(sender.ID, "Friend Request Sent",
+				fmt.Sprintf("Your friend request to %s was sent", receiver.Username), notificationsChan)
+		case "accepted":
+			notificationService.NotifyUser(sender.ID, "Friend Request Accepted",
+				fmt.Sprintf("%s accepted your friend request", receiver.Username), notificationsChan)
+			notificationService.NotifyUser(receiver.ID, "New Friend",
+				fmt.Sprintf("You are now friends with %s", sender.Username), notificationsChan)
+		case "rejected":
+			notificationService.NotifyUser(sender.ID, "Friend Request Declined",
+				fmt.Sprintf("%s declined your friend request", receiver.Username), notificationsChan)
+			notificationService.NotifyUser(receiver.ID, "Friend Request Declined",
+				fmt.Sprintf("You declined %s's friend request", sender.Username), notificationsChan)
+		}
+	}()
+}
@@ -1,13 +1,23 @@
 package handlers
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/RowenTey/JustJio/server/api/database"
 	"github.com/RowenTey/JustJio/server/api/middleware"
@@ -35,6 +45,7 @@ type UserHandlerTestSuite struct {
 	testFriendID    uint
 	testFriendToken string
 	testRequestID   uint
+	testNotifChan   chan NotificationData
 }
 
 func (suite *UserHandlerTestSuite) SetupSuite() {
@@ -59,23 +70,54 @@ func (suite *UserHandlerTestSuite) SetupSuite() {
 	assert.NoError(suite.T(), err)
 
 	// Setup Fiber app
+	suite.testNotifChan = make(chan NotificationData, 100)
+
 	suite.app = fiber.New()
-	suite.app.Use(middleware.Authenticated(mockJWTSecret))
+	suite.app.Use(middleware.Authenticated())
 
 	// Register User routes
 	userRoutes := suite.app.Group("/users/:userId")
 	userRoutes.Get("/", GetUser)
-	userRoutes.Patch("/", UpdateUser)
+	userRoutes.Patch("/", middleware.IsSelf, UpdateUser)
+	userRoutes.Put("/picture", middleware.IsSelf, UploadPicture)
 	userRoutes.Delete("/", DeleteUser)
 	userRoutes.Get("/friends", GetFriends)
 	userRoutes.Get("/friends/count", GetNumFriends)
 	userRoutes.Get("/friends/search", SearchFriends)
-	userRoutes.Post("/friends", SendFriendRequest)
+	userRoutes.Get("/friends/suggestions", middleware.IsSelf, GetFriendSuggestions)
+	userRoutes.Get("/friends/presence", GetFriendsPresence)
+	userRoutes.Post("/friends", middleware.IsSelf, func(c *fiber.Ctx) error {
+		return SendFriendRequest(c, suite.testNotifChan)
+	})
 	userRoutes.Delete("/friends/:friendId", RemoveFriend)
 	userRoutes.Get("/friends/check", IsFriend)
-	userRoutes.Get("/friends/requests", GetFriendRequestsByStatus)
-	userRoutes.Get("/friends/requests/count", CountPendingFriendRequests)
-	userRoutes.Patch("/friends/requests/respond", RespondToFriendRequest)
+	userRoutes.Get("/friends/requests", middleware.IsSelf, GetFriendRequestsByStatus)
+	userRoutes.Get("/friends/requests/count", middleware.IsSelf, CountPendingFriendRequests)
+	userRoutes.Get("/friends/requests/sent", middleware.IsSelf, GetSentFriendRequests)
+	userRoutes.Patch("/friends/requests/respond", middleware.IsSelf, func(c *fiber.Ctx) error {
+		return RespondToFriendRequest(c, suite.testNotifChan)
+	})
+	userRoutes.Delete("/friends/requests/:requestId", middleware.IsSelf, CancelFriendRequest)
+	circleRoutes := userRoutes.Group("/circles", middleware.IsSelf)
+	circleRoutes.Get("/", GetFriendCircles)
+	circleRoutes.Post("/", CreateFriendCircle)
+	circleRoutes.Patch("/:circleId", RenameFriendCircle)
+	circleRoutes.Delete("/:circleId", DeleteFriendCircle)
+	circleRoutes.Post("/:circleId/members", AddFriendCircleMembers)
+	circleRoutes.Delete("/:circleId/members/:memberId", RemoveFriendCircleMember)
+	blockRoutes := userRoutes.Group("/blocks", middleware.IsSelf)
+	blockRoutes.Get("/", GetBlockedUsers)
+	blockRoutes.Post("/", BlockUser)
+	blockRoutes.Delete("/:blockedId", UnblockUser)
+
+	accountRoutes := suite.app.Group("/account")
+	accountRoutes.Post("/email", ChangeEmail)
+	accountRoutes.Post("/email/verify", ConfirmEmailChange)
+	accountRoutes.Get("/exports", GetDataExports)
+	accountRoutes.Post("/exports", RequestDataExport)
+	accountRoutes.Get("/exports/:exportId/download", DownloadDataExport)
+	accountRoutes.Get("/deletion", GetAccountDeletion)
+	accountRoutes.Delete("/deletion", CancelAccountDeletion)
 }
 
 func (suite *UserHandlerTestSuite) TearDownSuite() {
@@ -94,9 +136,10 @@ func (suite *UserHandlerTestSuite) SetupTest() {
 	// Create test user
 	hashedPassword1, _ := utils.HashPassword("password123")
 	user := model.User{
-		Username: "testuser",
-		Email:    "user@example.com",
-		Password: hashedPassword1,
+		Username:    "testuser",
+		Email:       "user@example.com",
+		Password:    hashedPassword1,
+		HasPassword: true,
 	}
 	result := suite.db.Create(&user)
 	assert.NoError(suite.T(), result.Error)
@@ -108,9 +151,11 @@ func (suite *UserHandlerTestSuite) SetupTest() {
 	// Create test friend
 	hashedPassword2, _ := utils.HashPassword("password456")
 	friend := model.User{
-		Username: "testfriend",
-		Email:    "friend@example.com",
-		Password: hashedPassword2,
+		Username:     "testfriend",
+		Email:        "friend@example.com",
+		Password:     hashedPassword2,
+		HasPassword:  true,
+		IsEmailValid: true,
 	}
 	result = suite.db.Create(&friend)
 	assert.NoError(suite.T(), result.Error)
@@ -138,6 +183,7 @@ func (suite *UserHandlerTestSuite) TearDownTest() {
 	suite.db.Exec("TRUNCATE TABLE friend_requests CASCADE")
 	suite.db.Exec("TRUNCATE TABLE user_friends CASCADE")
 	suite.db.Exec("TRUNCATE TABLE users CASCADE")
+	suite.db.Exec("TRUNCATE TABLE otps")
 
 	// Reset the global DB variable
 	database.DB = nil
@@ -165,6 +211,41 @@ func (suite *UserHandlerTestSuite) TestGetUser_Success() {
 	assert.Equal(suite.T(), "testuser", userData["username"])
 }
 
+func (suite *UserHandlerTestSuite) TestGetUser_PrivateFieldsOnlyForSelf() {
+	suite.db.Model(&model.User{}).Where("id = ?", suite.testUserID).
+		Updates(map[string]any{"phone_num": "+6591234567", "time_zone": "Asia/Singapore", "locale": "en-SG"})
+
+	getUser := func(token string) map[string]any {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/users/%d", suite.testUserID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := suite.app.Test(req, -1)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+		var responseBody map[string]any
+		err = json.NewDecoder(resp.Body).Decode(&responseBody)
+		assert.NoError(suite.T(), err)
+		return responseBody["data"].(map[string]any)
+	}
+
+	self := getUser(suite.testUserToken)
+	assert.Equal(suite.T(), "testuser", self["username"])
+	assert.Equal(suite.T(), "+6591234567", self["phoneNum"])
+	assert.Equal(suite.T(), "Asia/Singapore", self["timeZone"])
+	assert.Equal(suite.T(), "en-SG", self["locale"])
+
+	other := getUser(suite.testFriendToken)
+	assert.Equal(suite.T(), "testuser", other["username"])
+	assert.NotContains(suite.T(), other, "phoneNum")
+	assert.NotContains(suite.T(), other, "timeZone")
+	assert.NotContains(suite.T(), other, "locale")
+
+	// The password hash is never serialized, not even for the user
+	assert.NotContains(suite.T(), self, "password")
+	assert.NotContains(suite.T(), other, "password")
+}
+
 func (suite *UserHandlerTestSuite) TestGetUser_NotFound() {
 	nonExistentUserID := "999999"
 	req := httptest.NewRequest(http.MethodGet, "/users/"+nonExistentUserID, nil)
@@ -175,26 +256,181 @@ func (suite *UserHandlerTestSuite) TestGetUser_NotFound() {
 	assert.Equal(suite.T(), fiber.StatusNotFound, resp.StatusCode)
 }
 
-func (suite *UserHandlerTestSuite) TestUpdateUser_Success() {
-	updateReq := request.UpdateUserRequest{
-		Field: "username",
-		Value: "updatedusername",
-	}
-	reqBody, _ := json.Marshal(updateReq)
-
-	req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%d", suite.testUserID), bytes.NewBuffer(reqBody))
-	req.Header.Set("Content-Type", "application/json")
+func (suite *UserHandlerTestSuite) patchUser(body string) int {
+	req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%d", suite.testUserID), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", MIME_MERGE_PATCH_JSON)
 	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
 
 	resp, err := suite.app.Test(req, -1)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+	return resp.StatusCode
+}
+
+func (suite *UserHandlerTestSuite) TestUpdateUser_Success() {
+	status := suite.patchUser(`{
+		"username": "updatedusername",
+		"displayName": "  Updated User ",
+		"bio": "Hello there",
+		"phoneNum": "+65 9123 4567",
+		"timeZone": "Asia/Singapore",
+		"locale": "en-sg"
+	}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
 
 	// Verify update in database
 	var user model.User
-	err = suite.db.First(&user, suite.testUserID).Error
+	err := suite.db.First(&user, suite.testUserID).Error
 	assert.NoError(suite.T(), err)
 	assert.Equal(suite.T(), "updatedusername", user.Username)
+	assert.Equal(suite.T(), "Updated User", user.DisplayName)
+	assert.Equal(suite.T(), "Hello there", user.Bio)
+	assert.Equal(suite.T(), "+6591234567", user.PhoneNum)
+	assert.Equal(suite.T(), "Asia/Singapore", user.TimeZone)
+	assert.Equal(suite.T(), "en-SG", user.Locale)
+
+	// null removes a field and missing fields are left alone
+	status = suite.patchUser(`{"bio": null}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	suite.db.First(&user, suite.testUserID)
+	assert.Equal(suite.T(), "", user.Bio)
+	assert.Equal(suite.T(), "+6591234567", user.PhoneNum)
+}
+
+func (suite *UserHandlerTestSuite) TestUpdateUser_OtherUserForbidden() {
+	req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%d", suite.testUserID), bytes.NewBufferString(`{"bio": "hacked"}`))
+	req.Header.Set("Content-Type", MIME_MERGE_PATCH_JSON)
+	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+
+	var user model.User
+	suite.db.First(&user, suite.testUserID)
+	assert.Equal(suite.T(), "", user.Bio)
+}
+
+func (suite *UserHandlerTestSuite) TestUpdateUser_SystemFieldsNotWritable() {
+	suite.db.Model(&model.User{}).Where("id = ?", suite.testUserID).Update("is_email_valid", false)
+
+	status := suite.patchUser(`{"bio": "hi", "isEmailValid": true}`)
+	assert.Equal(suite.T(), fiber.StatusBadRequest, status)
+
+	// Nothing in the patch is applied
+	var user model.User
+	suite.db.First(&user, suite.testUserID)
+	assert.False(suite.T(), user.IsEmailValid)
+	assert.Equal(suite.T(), "", user.Bio)
+}
+
+func (suite *UserHandlerTestSuite) TestUpdateUser_InvalidValue() {
+	assert.Equal(suite.T(), fiber.StatusBadRequest, suite.patchUser(`{"timeZone": "Mars/Olympus_Mons"}`))
+	assert.Equal(suite.T(), fiber.StatusBadRequest, suite.patchUser(`{"phoneNum": "12345"}`))
+	assert.Equal(suite.T(), fiber.StatusBadRequest, suite.patchUser(`{"username": null}`))
+}
+
+func (suite *UserHandlerTestSuite) TestUpdateUser_Conflict() {
+	suite.db.Model(&model.User{}).Where("id = ?", suite.testFriendID).Update("phone_num", "+6591234567")
+
+	var friend model.User
+	suite.db.First(&friend, suite.testFriendID)
+
+	assert.Equal(suite.T(), fiber.StatusConflict, suite.patchUser(fmt.Sprintf(`{"username": %q}`, friend.Username)))
+	assert.Equal(suite.T(), fiber.StatusConflict, suite.patchUser(`{"phoneNum": "+65 9123 4567"}`))
+}
+
+func (suite *UserHandlerTestSuite) putPicture(filename string, data []byte) *http.Response {
+	return suite.putPictureAs(suite.testUserToken, filename, data)
+}
+
+func (suite *UserHandlerTestSuite) putPictureAs(token, filename string, data []byte) *http.Response {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("picture", filename)
+	part.Write(data)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/users/%d/picture", suite.testUserID), &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	return resp
+}
+
+func (suite *UserHandlerTestSuite) TestUploadPicture_Success() {
+	blobDir := suite.T().TempDir()
+	suite.T().Setenv("BLOB_STORE", "local")
+	suite.T().Setenv("BLOB_DIR", blobDir)
+
+	img := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	resp := suite.putPicture("avatar.png", buf.Bytes())
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var user model.User
+	suite.db.First(&user, suite.testUserID)
+	assert.Regexp(suite.T(), `/blobs/avatars/\d+/[0-9A-Z]+/medium\.jpg$`, user.PictureUrl)
+	for name := range utils.AvatarSizes {
+		_, err := os.Stat(filepath.Join(blobDir, filepath.FromSlash(user.PictureKey), name+".jpg"))
+		assert.NoError(suite.T(), err)
+	}
+}
+
+func (suite *UserHandlerTestSuite) TestUploadPicture_ServedWithoutToken() {
+	blobDir := suite.T().TempDir()
+	suite.T().Setenv("BLOB_STORE", "local")
+	suite.T().Setenv("BLOB_DIR", blobDir)
+
+	img := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	resp := suite.putPicture("avatar.png", buf.Bytes())
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var user model.User
+	suite.db.First(&user, suite.testUserID)
+	pictureURL, err := url.Parse(user.PictureUrl)
+	assert.NoError(suite.T(), err)
+
+	// Served the same way as the router does, behind the same authentication
+	app := fiber.New()
+	app.Use(middleware.Authenticated())
+	for _, prefix := range utils.BLOB_PUBLIC_PREFIXES {
+		app.Static(utils.BLOB_ROUTE+"/"+prefix, filepath.Join(blobDir, prefix))
+	}
+
+	// Browsers load pictures with <img>, which never sends the token
+	req := httptest.NewRequest(http.MethodGet, pictureURL.Path, nil)
+	resp, err = app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), "image/jpeg", resp.Header.Get(fiber.HeaderContentType))
+}
+
+func (suite *UserHandlerTestSuite) TestUploadPicture_OtherUserForbidden() {
+	suite.T().Setenv("BLOB_DIR", suite.T().TempDir())
+
+	img := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	// testfriend can't replace testuser's picture
+	resp := suite.putPictureAs(suite.testFriendToken, "avatar.png", buf.Bytes())
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+}
+
+func (suite *UserHandlerTestSuite) TestUploadPicture_UnsupportedType() {
+	suite.T().Setenv("BLOB_DIR", suite.T().TempDir())
+
+	// The file name doesn't matter, only the content
+	resp := suite.putPicture("avatar.png", []byte("<html><script>alert(1)</script></html>"))
+	assert.Equal(suite.T(), fiber.StatusUnsupportedMediaType, resp.StatusCode)
 }
 
 func (suite *UserHandlerTestSuite) TestDeleteUser_Success() {
@@ -205,10 +441,55 @@ func (suite *UserHandlerTestSuite) TestDeleteUser_Success() {
 	assert.NoError(suite.T(), err)
 	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
 
-	// Verify user was deleted
+	// The account is only deleted after the grace period
 	var count int64
 	err = suite.db.Model(&model.User{}).Where("id = ?", suite.testUserID).Count(&count).Error
 	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1), count)
+
+	var deletion model.AccountDeletion
+	err = suite.db.First(&deletion, suite.testUserID).Error
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), deletion.ScheduledFor.After(time.Now()))
+
+	// It can be cancelled until then
+	req = httptest.NewRequest(http.MethodDelete, "/account/deletion", nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+	resp, err = suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	suite.db.Model(&model.AccountDeletion{}).Where("user_id = ?", suite.testUserID).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+}
+
+func (suite *UserHandlerTestSuite) TestDeleteUser_OtherUser() {
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/users/%d", suite.testFriendID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+}
+
+func (suite *UserHandlerTestSuite) TestDeleteAccount_AnonymizesUser() {
+	suite.db.Exec("INSERT INTO user_friends (user_id, friend_id) VALUES (?, ?), (?, ?)",
+		suite.testUserID, suite.testFriendID, suite.testFriendID, suite.testUserID)
+
+	deleted, err := services.NewAccountDeletionService(suite.db).DeleteAccount(suite.testUserID)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), deleted.Handoffs)
+
+	// The row stays so references to it remain valid, but nothing identifies the user
+	var user model.User
+	suite.db.First(&user, suite.testUserID)
+	assert.Equal(suite.T(), fmt.Sprintf("deleted-user-%d", suite.testUserID), user.Username)
+	assert.Equal(suite.T(), services.DELETED_USER_DISPLAY_NAME, user.DisplayName)
+	assert.NotEqual(suite.T(), "user@example.com", user.Email)
+	assert.Empty(suite.T(), user.Password)
+
+	var count int64
+	suite.db.Table("user_friends").Where("user_id = ? OR friend_id = ?", suite.testUserID, suite.testUserID).Count(&count)
 	assert.Equal(suite.T(), int64(0), count)
 }
 
@@ -262,7 +543,7 @@ func (suite *UserHandlerTestSuite) TestSendFriendRequest_ToSelf() {
 func (suite *UserHandlerTestSuite) TestRemoveFriend_Success() {
 	// First make the users friends
 	userService := services.NewUserService(database.DB)
-	err := userService.AcceptFriendRequest(suite.testRequestID)
+	_, err := userService.AcceptFriendRequest(suite.testUserID, suite.testRequestID)
 	assert.NoError(suite.T(), err)
 
 	req := httptest.NewRequest(http.MethodDelete,
@@ -284,7 +565,7 @@ func (suite *UserHandlerTestSuite) TestRemoveFriend_Success() {
 func (suite *UserHandlerTestSuite) TestGetFriends_Success() {
 	// First make the users friends
 	userService := services.NewUserService(database.DB)
-	err := userService.AcceptFriendRequest(suite.testRequestID)
+	_, err := userService.AcceptFriendRequest(suite.testUserID, suite.testRequestID)
 	assert.NoError(suite.T(), err)
 
 	req := httptest.NewRequest(http.MethodGet,
@@ -302,10 +583,119 @@ func (suite *UserHandlerTestSuite) TestGetFriends_Success() {
 	assert.Len(suite.T(), responseBody["data"].([]any), 1)
 }
 
+func (suite *UserHandlerTestSuite) TestGetFriendsPresence_Success() {
+	userService := services.NewUserService(database.DB)
+	_, err := userService.AcceptFriendRequest(suite.testUserID, suite.testRequestID)
+	assert.NoError(suite.T(), err)
+
+	changed, err := userService.MarkOnline(fmt.Sprint(suite.testFriendID), time.Now())
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), changed)
+
+	getPresence := func() map[string]any {
+		req := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/users/%d/friends/presence", suite.testUserID), nil)
+		req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+		resp, err := suite.app.Test(req, -1)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+		var responseBody map[string]any
+		err = json.NewDecoder(resp.Body).Decode(&responseBody)
+		assert.NoError(suite.T(), err)
+
+		presences := responseBody["data"].([]any)
+		assert.Len(suite.T(), presences, 1)
+		return presences[0].(map[string]any)
+	}
+
+	presence := getPresence()
+	assert.Equal(suite.T(), float64(suite.testFriendID), presence["userId"])
+	assert.Equal(suite.T(), true, presence["isOnline"])
+
+	// Hidden presence looks offline, even while connected
+	_, err = userService.SetPresenceHidden(suite.testFriendID, true)
+	assert.NoError(suite.T(), err)
+
+	presence = getPresence()
+	assert.Equal(suite.T(), false, presence["isOnline"])
+	assert.Nil(suite.T(), presence["lastSeen"])
+}
+
+func (suite *UserHandlerTestSuite) TestGetFriendsPresence_OtherUser() {
+	req := httptest.NewRequest(http.MethodGet,
+		fmt.Sprintf("/users/%d/friends/presence", suite.testFriendID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+}
+
+func (suite *UserHandlerTestSuite) TestFriendCircles_Lifecycle() {
+	userService := services.NewUserService(database.DB)
+	_, err := userService.AcceptFriendRequest(suite.testUserID, suite.testRequestID)
+	assert.NoError(suite.T(), err)
+
+	send := func(method, path string, body any) (int, map[string]any) {
+		reqBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, fmt.Sprintf("/users/%d/circles%s", suite.testUserID, path),
+			bytes.NewBuffer(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+		resp, err := suite.app.Test(req, -1)
+		assert.NoError(suite.T(), err)
+
+		var responseBody map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&responseBody)
+		return resp.StatusCode, responseBody
+	}
+
+	status, body := send(http.MethodPost, "", request.CreateFriendCircleRequest{Name: "Uni"})
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	circleID := uint(body["data"].(map[string]any)["id"].(float64))
+
+	status, _ = send(http.MethodPost, "", request.CreateFriendCircleRequest{Name: "Uni"})
+	assert.Equal(suite.T(), fiber.StatusConflict, status)
+
+	status, body = send(http.MethodPost, fmt.Sprintf("/%d/members", circleID),
+		request.AddFriendCircleMembersRequest{Members: []uint{suite.testFriendID}})
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	assert.Len(suite.T(), body["data"].(map[string]any)["members"].([]any), 1)
+
+	// Removing the friend takes them out of the circle too
+	err = userService.RemoveFriend(suite.testUserID, suite.testFriendID)
+	assert.NoError(suite.T(), err)
+
+	status, body = send(http.MethodGet, "", nil)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+	circles := body["data"].([]any)
+	assert.Len(suite.T(), circles, 1)
+	assert.Empty(suite.T(), circles[0].(map[string]any)["members"])
+
+	status, _ = send(http.MethodPost, fmt.Sprintf("/%d/members", circleID),
+		request.AddFriendCircleMembersRequest{Members: []uint{suite.testFriendID}})
+	assert.Equal(suite.T(), fiber.StatusBadRequest, status)
+
+	status, _ = send(http.MethodDelete, fmt.Sprintf("/%d", circleID), nil)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+}
+
+func (suite *UserHandlerTestSuite) TestFriendCircles_OtherUser() {
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/users/%d/circles", suite.testFriendID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+}
+
 func (suite *UserHandlerTestSuite) TestIsFriend_True() {
 	// First make the users friends
 	userService := services.NewUserService(database.DB)
-	err := userService.AcceptFriendRequest(suite.testRequestID)
+	_, err := userService.AcceptFriendRequest(suite.testUserID, suite.testRequestID)
 	assert.NoError(suite.T(), err)
 
 	requestBody := request.ModifyFriendRequest{
@@ -331,7 +721,7 @@ func (suite *UserHandlerTestSuite) TestIsFriend_True() {
 func (suite *UserHandlerTestSuite) TestGetNumFriends_Success() {
 	// First make the users friends
 	userService := services.NewUserService(database.DB)
-	err := userService.AcceptFriendRequest(suite.testRequestID)
+	_, err := userService.AcceptFriendRequest(suite.testUserID, suite.testRequestID)
 	assert.NoError(suite.T(), err)
 
 	req := httptest.NewRequest(http.MethodGet,
@@ -363,6 +753,330 @@ func (suite *UserHandlerTestSuite) TestSearchFriends_Success() {
 	assert.Len(suite.T(), responseBody["data"].([]any), 1)
 }
 
+func (suite *UserHandlerTestSuite) TestSearchFriends_FuzzyMatch() {
+	for _, query := range []string{"tesfriend", "friend@exam"} {
+		req := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/users/%d/friends/search?query=%s", suite.testUserID, query), nil)
+		req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+		resp, err := suite.app.Test(req, -1)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+		var responseBody map[string]any
+		err = json.NewDecoder(resp.Body).Decode(&responseBody)
+		assert.NoError(suite.T(), err)
+		assert.Len(suite.T(), responseBody["data"].([]any), 1, query)
+	}
+}
+
+func (suite *UserHandlerTestSuite) TestSearchFriends_Pagination() {
+	req := httptest.NewRequest(http.MethodGet,
+		fmt.Sprintf("/users/%d/friends/search?query=test&page=2", suite.testUserID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var responseBody map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&responseBody)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), responseBody["data"].([]any), 0)
+}
+
+func (suite *UserHandlerTestSuite) TestSearchFriends_ExcludesUnverifiedUsers() {
+	// testuser hasn't verified their email
+	req := httptest.NewRequest(http.MethodGet,
+		fmt.Sprintf("/users/%d/friends/search?query=test", suite.testFriendID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var responseBody map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&responseBody)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), responseBody["data"].([]any), 0)
+}
+
+func (suite *UserHandlerTestSuite) TestBlockUser_HidesUsersFromEachOther() {
+	// Make them friends first so the block has a friendship to remove
+	suite.db.Exec("INSERT INTO user_friends (user_id, friend_id) VALUES (?, ?), (?, ?)",
+		suite.testUserID, suite.testFriendID, suite.testFriendID, suite.testUserID)
+
+	reqBody, _ := json.Marshal(request.BlockUserRequest{UserID: suite.testFriendID})
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/users/%d/blocks", suite.testUserID), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var friendships int64
+	err = suite.db.Table("user_friends").
+		Where("user_id IN ?", []uint{suite.testUserID, suite.testFriendID}).
+		Count(&friendships).Error
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(0), friendships)
+
+	// The pending friend request from the blocked user is rejected
+	var friendRequest model.FriendRequest
+	assert.NoError(suite.T(), suite.db.First(&friendRequest, suite.testRequestID).Error)
+	assert.Equal(suite.T(), "rejected", friendRequest.Status)
+
+	// The blocked user no longer shows up in search
+	req = httptest.NewRequest(http.MethodGet,
+		fmt.Sprintf("/users/%d/friends/search?query=test", suite.testUserID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err = suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	var responseBody map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&responseBody)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), responseBody["data"].([]any), 0)
+
+	// And can't send a new friend request
+	reqBody, _ = json.Marshal(request.ModifyFriendRequest{FriendID: suite.testUserID})
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/users/%d/friends", suite.testFriendID), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+
+	resp, err = suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+}
+
+func (suite *UserHandlerTestSuite) TestBlockUser_OtherUserForbidden() {
+	// testfriend can't block someone on testuser's behalf
+	reqBody, _ := json.Marshal(request.BlockUserRequest{UserID: suite.testFriendID})
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/users/%d/blocks", suite.testUserID), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+
+	// Or see who they blocked
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/users/%d/blocks", suite.testUserID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+
+	resp, err = suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+
+	var count int64
+	suite.db.Model(&model.UserBlock{}).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+}
+
+func (suite *UserHandlerTestSuite) TestUnblockUser_NotBlocked() {
+	req := httptest.NewRequest(http.MethodDelete,
+		fmt.Sprintf("/users/%d/blocks/%d", suite.testUserID, suite.testFriendID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *UserHandlerTestSuite) TestGetFriendSuggestions_MutualFriends() {
+	// testfriend and a new user are both friends with a third user
+	mutual := model.User{Username: "mutualfriend", Email: "mutual@example.com", Password: "password789", IsEmailValid: true}
+	assert.NoError(suite.T(), suite.db.Create(&mutual).Error)
+	suite.db.Exec("INSERT INTO user_friends (user_id, friend_id) VALUES (?, ?), (?, ?)",
+		suite.testFriendID, mutual.ID, mutual.ID, suite.testFriendID)
+	suggested := model.User{Username: "suggested", Email: "suggested@example.com", Password: "password789", IsEmailValid: true}
+	assert.NoError(suite.T(), suite.db.Create(&suggested).Error)
+	suite.db.Exec("INSERT INTO user_friends (user_id, friend_id) VALUES (?, ?), (?, ?)",
+		suggested.ID, mutual.ID, mutual.ID, suggested.ID)
+
+	req := httptest.NewRequest(http.MethodGet,
+		fmt.Sprintf("/users/%d/friends/suggestions", suite.testFriendID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var responseBody map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&responseBody)
+	assert.NoError(suite.T(), err)
+	suggestions := responseBody["data"].([]any)
+	assert.Len(suite.T(), suggestions, 1)
+	suggestion := suggestions[0].(map[string]any)
+	assert.Equal(suite.T(), "suggested", suggestion["user"].(map[string]any)["username"])
+	assert.Equal(suite.T(), "1 mutual friend", suggestion["reason"])
+}
+
+func (suite *UserHandlerTestSuite) TestGetFriendSuggestions_OtherUserForbidden() {
+	// Suggestions are built from the user's friends, so they're only shown to the user
+	req := httptest.NewRequest(http.MethodGet,
+		fmt.Sprintf("/users/%d/friends/suggestions", suite.testFriendID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+}
+
+func (suite *UserHandlerTestSuite) postAccountJSON(path, body string) int {
+	return suite.postAccountJSONAs(suite.testUserToken, path, body)
+}
+
+func (suite *UserHandlerTestSuite) postAccountJSONAs(token, path, body string) int {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	return resp.StatusCode
+}
+
+func (suite *UserHandlerTestSuite) TestChangeEmail_Success() {
+	mailDir := suite.T().TempDir()
+	suite.T().Setenv("MAILER", "file")
+	suite.T().Setenv("MAILER_DIR", mailDir)
+
+	status := suite.postAccountJSON("/account/email", `{"email": "new@example.com", "currentPassword": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	_, body, err := tests.ReadLastEmail(mailDir)
+	assert.NoError(suite.T(), err)
+	otp := regexp.MustCompile(`\d{6}`).FindString(body)
+
+	// The email isn't changed until the new address is confirmed
+	var user model.User
+	suite.db.First(&user, suite.testUserID)
+	assert.Equal(suite.T(), "user@example.com", user.Email)
+
+	status = suite.postAccountJSON("/account/email/verify", fmt.Sprintf(`{"email": "new@example.com", "otp": "%s"}`, otp))
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	suite.db.First(&user, suite.testUserID)
+	assert.Equal(suite.T(), "new@example.com", user.Email)
+	assert.True(suite.T(), user.IsEmailValid)
+
+	// The old address is told about the change
+	subject, _, err := tests.ReadLastEmail(mailDir)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "JustJio Email Changed", subject)
+}
+
+func (suite *UserHandlerTestSuite) TestChangeEmail_AlreadyInUse() {
+	status := suite.postAccountJSON("/account/email", `{"email": "friend@example.com", "currentPassword": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusConflict, status)
+}
+
+func (suite *UserHandlerTestSuite) TestChangeEmail_RequiresCurrentPassword() {
+	mailDir := suite.T().TempDir()
+	suite.T().Setenv("MAILER", "file")
+	suite.T().Setenv("MAILER_DIR", mailDir)
+
+	status := suite.postAccountJSON("/account/email", `{"email": "new@example.com"}`)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+
+	status = suite.postAccountJSON("/account/email", `{"email": "new@example.com", "currentPassword": "wrongpassword"}`)
+	assert.Equal(suite.T(), fiber.StatusUnauthorized, status)
+
+	// No OTP was sent to the new address
+	var count int64
+	suite.db.Model(&model.OTP{}).Where("email = ?", "new@example.com").Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+}
+
+func (suite *UserHandlerTestSuite) TestChangeEmail_SocialAccountWithoutTwoFactor() {
+	err := suite.db.Model(&model.User{}).Where("id = ?", suite.testUserID).Update("has_password", false).Error
+	assert.NoError(suite.T(), err)
+
+	status := suite.postAccountJSON("/account/email", `{"email": "new@example.com", "currentPassword": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusForbidden, status)
+}
+
+func (suite *UserHandlerTestSuite) TestConfirmEmailChange_OtherUserRejected() {
+	mailDir := suite.T().TempDir()
+	suite.T().Setenv("MAILER", "file")
+	suite.T().Setenv("MAILER_DIR", mailDir)
+
+	status := suite.postAccountJSON("/account/email", `{"email": "new@example.com", "currentPassword": "password123"}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	_, body, err := tests.ReadLastEmail(mailDir)
+	assert.NoError(suite.T(), err)
+	otp := regexp.MustCompile(`\d{6}`).FindString(body)
+
+	// The OTP only confirms the change for the user who re-authenticated
+	status = suite.postAccountJSONAs(suite.testFriendToken, "/account/email/verify",
+		fmt.Sprintf(`{"email": "new@example.com", "otp": "%s"}`, otp))
+	assert.Equal(suite.T(), fiber.StatusBadRequest, status)
+
+	var friend model.User
+	suite.db.First(&friend, suite.testFriendID)
+	assert.Equal(suite.T(), "friend@example.com", friend.Email)
+}
+
+func (suite *UserHandlerTestSuite) TestConfirmEmailChange_InvalidOTP() {
+	status := suite.postAccountJSON("/account/email/verify", `{"email": "new@example.com", "otp": "000000"}`)
+	assert.Equal(suite.T(), fiber.StatusBadRequest, status)
+}
+
+func (suite *UserHandlerTestSuite) TestDataExport_RequestAndDownload() {
+	suite.T().Setenv("BLOB_STORE", "local")
+	suite.T().Setenv("BLOB_DIR", suite.T().TempDir())
+
+	status := suite.postAccountJSON("/account/exports", `{}`)
+	assert.Equal(suite.T(), fiber.StatusOK, status)
+
+	// Only one export can be prepared at a time
+	status = suite.postAccountJSON("/account/exports", `{}`)
+	assert.Equal(suite.T(), fiber.StatusConflict, status)
+
+	// Run the job the worker would
+	exportService := services.NewDataExportService(suite.db)
+	export, err := exportService.ClaimNextExport()
+	assert.NoError(suite.T(), err)
+	store, err := utils.NewBlobStore()
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), exportService.BuildExport(context.Background(), store, export))
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/account/exports/%d/download", export.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), "application/zip", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(suite.T(), err)
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	assert.NoError(suite.T(), err)
+
+	names := make([]string, len(zr.File))
+	for i, f := range zr.File {
+		names[i] = f.Name
+	}
+	assert.Contains(suite.T(), names, "profile.json")
+	assert.Contains(suite.T(), names, "friends.csv")
+	assert.Contains(suite.T(), names, "push_subscriptions.json")
+	assert.Len(suite.T(), names, 20)
+}
+
+func (suite *UserHandlerTestSuite) TestDataExport_DownloadNotReady() {
+	export, err := services.NewDataExportService(suite.db).RequestExport(suite.testUserID)
+	assert.NoError(suite.T(), err)
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/account/exports/%d/download", export.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusConflict, resp.StatusCode)
+}
+
 func (suite *UserHandlerTestSuite) TestGetFriendRequestsByStatus_Success() {
 	req := httptest.NewRequest(http.MethodGet,
 		fmt.Sprintf("/users/%d/friends/requests?status=pending", suite.testUserID), nil)
@@ -378,6 +1092,69 @@ func (suite *UserHandlerTestSuite) TestGetFriendRequestsByStatus_Success() {
 	assert.Len(suite.T(), responseBody["data"].([]any), 1)
 }
 
+func (suite *UserHandlerTestSuite) TestGetSentFriendRequests_Success() {
+	req := httptest.NewRequest(http.MethodGet,
+		fmt.Sprintf("/users/%d/friends/requests/sent", suite.testFriendID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var responseBody map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&responseBody)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), responseBody["data"].([]any), 1)
+}
+
+func (suite *UserHandlerTestSuite) TestCancelFriendRequest_Success() {
+	req := httptest.NewRequest(http.MethodDelete,
+		fmt.Sprintf("/users/%d/friends/requests/%d", suite.testFriendID, suite.testRequestID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusOK, resp.StatusCode)
+
+	var friendRequest model.FriendRequest
+	assert.NoError(suite.T(), suite.db.First(&friendRequest, suite.testRequestID).Error)
+	assert.Equal(suite.T(), "cancelled", friendRequest.Status)
+}
+
+func (suite *UserHandlerTestSuite) TestCancelFriendRequest_OnlySender() {
+	// testuser received the request, so they can't cancel it
+	req := httptest.NewRequest(http.MethodDelete,
+		fmt.Sprintf("/users/%d/friends/requests/%d", suite.testUserID, suite.testRequestID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *UserHandlerTestSuite) TestSentFriendRequests_OtherUserForbidden() {
+	// testuser can't list or cancel the requests testfriend sent
+	req := httptest.NewRequest(http.MethodGet,
+		fmt.Sprintf("/users/%d/friends/requests/sent", suite.testFriendID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodDelete,
+		fmt.Sprintf("/users/%d/friends/requests/%d", suite.testFriendID, suite.testRequestID), nil)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
+
+	resp, err = suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode)
+
+	var friendRequest model.FriendRequest
+	assert.NoError(suite.T(), suite.db.First(&friendRequest, suite.testRequestID).Error)
+	assert.Equal(suite.T(), "pending", friendRequest.Status)
+}
+
 func (suite *UserHandlerTestSuite) TestCountPendingFriendRequests_Success() {
 	req := httptest.NewRequest(http.MethodGet,
 		fmt.Sprintf("/users/%d/friends/requests/count", suite.testUserID), nil)
@@ -403,7 +1180,7 @@ func (suite *UserHandlerTestSuite) TestRespondToFriendRequest_Accept() {
 	req := httptest.NewRequest(http.MethodPatch,
 		fmt.Sprintf("/users/%d/friends/requests/respond", suite.testUserID), bytes.NewBuffer(reqBody))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
 
 	resp, err := suite.app.Test(req, -1)
 	assert.NoError(suite.T(), err)
@@ -425,9 +1202,9 @@ func (suite *UserHandlerTestSuite) TestRespondToFriendRequest_Reject() {
 	reqBody, _ := json.Marshal(respondReq)
 
 	req := httptest.NewRequest(http.MethodPatch,
-		fmt.Sprintf("/users/%d/friends/requests/respond", suite.testFriendID), bytes.NewBuffer(reqBody))
+		fmt.Sprintf("/users/%d/friends/requests/respond", suite.testUserID), bytes.NewBuffer(reqBody))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+	req.Header.Set("Authorization", "Bearer "+suite.testUserToken)
 
 	resp, err := suite.app.Test(req, -1)
 	assert.NoError(suite.T(), err)
@@ -439,3 +1216,49 @@ func (suite *UserHandlerTestSuite) TestRespondToFriendRequest_Reject() {
 	assert.NoError(suite.T(), err)
 	assert.Equal(suite.T(), "rejected", request.Status)
 }
+
+func (suite *UserHandlerTestSuite) TestRespondToFriendRequest_SenderCannotAccept() {
+	respondReq := request.RespondToFriendRequestRequest{
+		RequestID: suite.testRequestID,
+		Action:    "accept",
+	}
+	reqBody, _ := json.Marshal(respondReq)
+
+	// testfriend sent the request, so only testuser can respond to it
+	req := httptest.NewRequest(http.MethodPatch,
+		fmt.Sprintf("/users/%d/friends/requests/respond", suite.testFriendID), bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+
+	resp, err := suite.app.Test(req, -1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), fiber.StatusNotFound, resp.StatusCode)
+
+	var request model.FriendRequest
+	err = suite.db.First(&request, suite.testRequestID).Error
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "pending", request.Status)
+}
+
+func (suite *UserHandlerTestSuite) TestFriendRequests_OtherUserForbidden() {
+	// testfriend can't see testuser's requests or send and respond to requests as testuser
+	for _, r := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/users/%d/friends/requests?status=pending", ""},
+		{http.MethodGet, "/users/%d/friends/requests/count", ""},
+		{http.MethodPost, "/users/%d/friends", fmt.Sprintf(`{"friendId": %d}`, suite.testFriendID)},
+		{http.MethodPatch, "/users/%d/friends/requests/respond",
+			fmt.Sprintf(`{"requestId": %d, "action": "accept"}`, suite.testRequestID)},
+	} {
+		req := httptest.NewRequest(r.method, fmt.Sprintf(r.path, suite.testUserID), bytes.NewBuffer([]byte(r.body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+suite.testFriendToken)
+
+		resp, err := suite.app.Test(req, -1)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), fiber.StatusForbidden, resp.StatusCode, r.method+" "+r.path)
+	}
+}
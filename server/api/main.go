@@ -38,7 +38,10 @@ func main() {
 
 	notificationsChan := worker.RunPushNotification()
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		// Leave room for the multipart overhead around a profile picture
+		BodyLimit: utils.AVATAR_MAX_BYTES + 1<<20,
+	})
 
 	database.ConnectDB()
 	if env == "dev" || env == "staging" {
@@ -47,12 +50,18 @@ func main() {
 		}
 	}
 
+	worker.RunCleanup()
+	worker.RunDataExport(notificationsChan)
+
 	kafkaService, err := services.NewKafkaService(config.Config("KAFKA_URL"), env)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer kafkaService.Close()
 
+	worker.RunAccountDeletion(kafkaService, notificationsChan)
+	worker.RunPresence(kafkaService)
+
 	middleware.Fiber(app, env, config.Config("ALLOWED_ORIGINS"))
 	router.Initalize(app, kafkaService, notificationsChan)
 
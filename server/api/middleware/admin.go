@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// IsAdmin only lets through users whose ID is listed in ADMIN_USER_IDS
+func IsAdmin(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId := utils.GetUserInfoFromToken(token, "user_id")
+
+	for _, adminId := range strings.Split(config.Config("ADMIN_USER_IDS"), ",") {
+		if strings.TrimSpace(adminId) == userId {
+			return c.Next()
+		}
+	}
+
+	return utils.HandleError(c, fiber.StatusForbidden, "Admin access required", errors.New("user is not an admin"))
+}
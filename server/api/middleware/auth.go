@@ -1,10 +1,17 @@
 package middleware
 
 import (
+	"errors"
 	"strings"
 
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
 	"github.com/gofiber/fiber/v2"
 	jwtware "github.com/gofiber/jwt/v3"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
 )
 
 func jwtError(c *fiber.Ctx, err error) error {
@@ -22,8 +29,9 @@ func jwtError(c *fiber.Ctx, err error) error {
 }
 
 func whitelist(c *fiber.Ctx) bool {
-	whitelistPaths := []string{"/v1/auth", "/docs"}
-	whitelistEndpoints := []string{"/", "/openapi.yaml"}
+	// Only public blobs, such as profile pictures, are served under BLOB_ROUTE
+	whitelistPaths := []string{"/v1/auth", "/docs", utils.BLOB_ROUTE + "/"}
+	whitelistEndpoints := []string{"/", "/openapi.yaml", "/.well-known/jwks.json"}
 
 	for _, url := range whitelistPaths {
 		if strings.HasPrefix(c.Path(), url) {
@@ -40,10 +48,88 @@ func whitelist(c *fiber.Ctx) bool {
 	return false
 }
 
-func Authenticated(secret string) fiber.Handler {
-	return jwtware.New(jwtware.Config{
-		Filter:       whitelist,
-		SigningKey:   []byte(secret),
-		ErrorHandler: jwtError,
+// Reject tokens whose ID has been revoked (logout, refresh token reuse)
+func isTokenRevoked(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	tokenId, ok := token.Claims.(jwt.MapClaims)["jti"].(string)
+	if !ok || tokenId == "" {
+		return jwtError(c, errors.New("missing token ID"))
+	}
+
+	revoked, err := services.NewTokenService(database.DB).IsTokenRevoked(tokenId)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+	if revoked {
+		return jwtError(c, errors.New("token has been revoked"))
+	}
+
+	return c.Next()
+}
+
+// Look up the public key from the token's key ID so tokens signed with
+// rotated keys stay valid until they expire
+func signingKeyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != services.SIGNING_KEY_ALGORITHM {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.New("missing key ID")
+	}
+
+	return services.NewSigningKeyService(database.DB).GetPublicKey(kid)
+}
+
+// Authenticate a personal access token and expose its user as claims, the same way handlers
+// read them from a JWT. The scopes claim is only set for personal access tokens.
+func personalAccessToken(c *fiber.Ctx, rawToken string) error {
+	patService := services.NewPersonalAccessTokenService(database.DB)
+
+	pat, err := patService.Authenticate(rawToken, c.IP())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "token expired" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Unauthorized. Invalid or expired personal access token",
+				"data":    nil,
+			})
+		}
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	scopes, err := patService.GetScopes(pat)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	c.Locals("user", &jwt.Token{
+		Valid: true,
+		Claims: jwt.MapClaims{
+			"user_id":     float64(pat.UserID),
+			"username":    pat.User.Username,
+			"user_email":  pat.User.Email,
+			"picture_url": pat.User.PictureUrl,
+			"pat_id":      float64(pat.ID),
+			"scopes":      scopes,
+		},
 	})
+	return c.Next()
+}
+
+func Authenticated() fiber.Handler {
+	jwtHandler := jwtware.New(jwtware.Config{
+		Filter:         whitelist,
+		KeyFunc:        signingKeyFunc,
+		SuccessHandler: isTokenRevoked,
+		ErrorHandler:   jwtError,
+	})
+
+	return func(c *fiber.Ctx) error {
+		rawToken, found := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if found && services.IsPersonalAccessToken(rawToken) && !whitelist(c) {
+			return personalAccessToken(c, rawToken)
+		}
+		return jwtHandler(c)
+	}
 }
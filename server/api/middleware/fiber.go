@@ -3,7 +3,6 @@ package middleware
 import (
 	"time"
 
-	"github.com/RowenTey/JustJio/server/api/config"
 	"github.com/ansrivas/fiberprometheus/v2"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -63,6 +62,6 @@ func Fiber(a *fiber.App, env, allowedOrigins string) {
 		},
 
 		// JWT middleware
-		Authenticated(config.Config("JWT_SECRET")),
+		Authenticated(),
 	)
 }
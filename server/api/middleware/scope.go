@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// tokenScopes returns the scopes of a personal access token, or false for a login session
+func tokenScopes(c *fiber.Ctx) ([]string, bool) {
+	token := c.Locals("user").(*jwt.Token)
+	scopes, ok := token.Claims.(jwt.MapClaims)["scopes"].([]string)
+	return scopes, ok
+}
+
+// RequireScope only lets through personal access tokens granted the scope.
+// Login sessions have full access.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scopes, isPersonalAccessToken := tokenScopes(c)
+		if isPersonalAccessToken && !slices.Contains(scopes, scope) {
+			return utils.HandleError(c, fiber.StatusForbidden,
+				"Token is missing the "+scope+" scope", errors.New("insufficient scope"))
+		}
+		return c.Next()
+	}
+}
+
+// SessionOnly rejects personal access tokens, for endpoints no scope grants access to
+func SessionOnly(c *fiber.Ctx) error {
+	if _, isPersonalAccessToken := tokenScopes(c); isPersonalAccessToken {
+		return utils.HandleError(c, fiber.StatusForbidden,
+			"Personal access tokens can't be used for this endpoint", errors.New("login session required"))
+	}
+	return c.Next()
+}
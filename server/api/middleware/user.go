@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// IsSelf only lets users through to their own resources under /users/:userId
+func IsSelf(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId, err := utils.GetUserIdFromToken(token)
+	if err != nil {
+		return utils.HandleInternalServerError(c, err)
+	}
+
+	if c.Params("userId") != strconv.FormatUint(uint64(userId), 10) {
+		return utils.HandleError(c, fiber.StatusForbidden, "Users can only access their own resources", nil)
+	}
+	return c.Next()
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// RequireVerifiedEmail only lets through users who have verified their email address.
+// It reads the user from the database as the token may predate the verification.
+func RequireVerifiedEmail(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	userId := utils.GetUserInfoFromToken(token, "user_id")
+
+	user, err := services.NewUserService(database.DB).GetUserByID(userId)
+	if err != nil {
+		return utils.HandleNotFoundOrInternalError(c, err, "User not found")
+	}
+
+	if !user.IsEmailValid {
+		return utils.HandleError(c, fiber.StatusForbidden,
+			"Please verify your email address first", errors.New("email not verified"))
+	}
+	return c.Next()
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// AccountDeletion is kept after the account is deleted to mark the anonymized user
+type AccountDeletion struct {
+	UserID       uint       `gorm:"primaryKey; autoIncrement:false" json:"userId"`
+	RequestedAt  time.Time  `gorm:"autoCreateTime" json:"requestedAt"`
+	ScheduledFor time.Time  `gorm:"not null; index" json:"scheduledFor"` // end of the grace period
+	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+
+	// Associations
+	User User `gorm:"foreignKey:user_id; constraint:OnDelete:CASCADE" json:"-"`
+}
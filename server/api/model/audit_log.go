@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// AuditLog is an append-only record of a security-relevant account event.
+// It has no foreign key to users so entries outlive the account they describe.
+type AuditLog struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	UserID    *uint             `gorm:"index" json:"userId"` // nil when the attempt didn't match an account
+	Event     string            `gorm:"not null; index" json:"event"`
+	Success   bool              `gorm:"not null" json:"success"`
+	Details   datatypes.JSONMap `json:"details,omitempty"`
+	IPAddress string            `json:"ipAddress"`
+	UserAgent string            `json:"userAgent"`
+	CreatedAt time.Time         `gorm:"autoCreateTime; index" json:"createdAt"`
+}
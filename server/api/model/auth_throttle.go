@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// AuthThrottle tracks failed attempts against an auth endpoint for one account or IP
+type AuthThrottle struct {
+	ID            string     `gorm:"primaryKey" json:"id"` // e.g. login:user:42 or login:ip:127.0.0.1
+	Failures      int        `gorm:"not null; default:0" json:"failures"`
+	BlockedUntil  *time.Time `json:"blockedUntil,omitempty"` // Attempts are rejected until then
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty"`  // Set when an account is locked out
+	LastFailureAt time.Time  `gorm:"not null; index" json:"lastFailureAt"`
+}
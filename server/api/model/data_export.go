@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+type DataExport struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null; index" json:"userId"`
+	Status      string     `gorm:"not null; default:'pending'; index" json:"status"` // pending, processing, ready, failed
+	BlobKey     string     `json:"-"`                                                // key of the archive in the blob store once ready
+	Size        int64      `json:"size"`
+	RequestedAt time.Time  `gorm:"autoCreateTime" json:"requestedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `gorm:"index" json:"expiresAt,omitempty"` // the archive is deleted after this
+
+	// Associations
+	User User `gorm:"foreignKey:user_id; constraint:OnDelete:CASCADE" json:"-"`
+}
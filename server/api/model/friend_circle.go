@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// FriendCircle is a named group of the owner's friends, e.g. "Uni" or "Badminton",
+// for inviting them together. Only the owner sees it.
+type FriendCircle struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OwnerID   uint      `gorm:"not null; uniqueIndex:friend_circle_name_idx" json:"ownerId"`
+	Name      string    `gorm:"not null; uniqueIndex:friend_circle_name_idx" json:"name"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	// Associations
+	Owner   User   `gorm:"foreignKey:owner_id; constraint:OnDelete:CASCADE" json:"-"`
+	Members []User `gorm:"many2many:friend_circle_members; constraint:OnDelete:CASCADE" json:"members"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// UserIdentity links a user to an account at an external identity provider.
+// Identities are matched by the provider's stable subject, never by email.
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null; index" json:"userId"`
+	Provider  string    `gorm:"not null; uniqueIndex:provider_subject_idx" json:"provider"`
+	Subject   string    `gorm:"not null; uniqueIndex:provider_subject_idx" json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	// Associations
+	User User `gorm:"foreignKey:user_id; constraint:OnDelete:CASCADE" json:"-"`
+}
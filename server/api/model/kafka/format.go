@@ -1,6 +1,15 @@
 package model_kafka
 
+import "time"
+
 type KafkaMessage struct {
 	MsgType string      `json:"type"`
 	Data    interface{} `json:"data"`
 }
+
+// PresenceEvent is published by the WS server when a user's first connection opens or their last one closes
+type PresenceEvent struct {
+	UserID   string    `json:"userId"`
+	IsOnline bool      `json:"isOnline"`
+	At       time.Time `json:"at"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// MagicLink is a single-use login link sent by email. Only a hash of the token is stored.
+type MagicLink struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null; index" json:"userId"`
+	TokenHash string    `gorm:"not null; uniqueIndex" json:"-"`
+	ExpiresAt time.Time `gorm:"not null" json:"expiresAt"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	// Associations
+	User User `gorm:"foreignKey:user_id; constraint:OnDelete:CASCADE" json:"-"`
+}
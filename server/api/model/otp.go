@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+type OTP struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Email      string     `gorm:"not null; uniqueIndex:email_purpose_idx" json:"email"`
+	Purpose    string     `gorm:"not null; uniqueIndex:email_purpose_idx" json:"purpose"` // verify-email, reset-password, change-email:<user id>
+	CodeHash   string     `gorm:"not null" json:"-"`
+	Attempts   int        `gorm:"not null; default:0" json:"attempts"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expiresAt"`
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"` // Set once the correct code is entered
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
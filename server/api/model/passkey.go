@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Passkey is a WebAuthn credential registered by a user to log in without a password
+type Passkey struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"not null; index" json:"userId"`
+	Name            string     `gorm:"not null" json:"name"`
+	CredentialID    []byte     `gorm:"not null; uniqueIndex" json:"-"`
+	PublicKey       []byte     `gorm:"not null" json:"-"` // COSE encoded
+	AttestationType string     `json:"-"`
+	AAGUID          []byte     `json:"-"`
+	Transports      string     `json:"-"`        // comma separated
+	Flags           uint8      `json:"-"`        // authenticator data flags from the last ceremony
+	SignCount       uint32     `json:"-"`        // used to detect cloned authenticators
+	BackedUp        bool       `json:"backedUp"` // synced across devices, e.g. by a password manager
+	LastUsedAt      *time.Time `json:"lastUsedAt"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+
+	// Associations
+	User User `gorm:"foreignKey:user_id; constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// WebAuthnSession holds the challenge of a registration or login ceremony until the client responds.
+// It is deleted when used, so every challenge can only be answered once.
+type WebAuthnSession struct {
+	ID        string         `gorm:"primaryKey" json:"id"`
+	UserID    *uint          `json:"userId"` // nil for logins, the user is only known once they respond
+	Ceremony  string         `gorm:"not null" json:"ceremony"`
+	Data      datatypes.JSON `gorm:"not null" json:"-"`
+	ExpiresAt time.Time      `gorm:"not null; index" json:"expiresAt"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// PersonalAccessToken is a long-lived, scoped credential for scripts and bots.
+// Only the hash of the token is stored.
+type PersonalAccessToken struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	UserID     uint           `gorm:"not null; index" json:"userId"`
+	Name       string         `gorm:"not null" json:"name"`
+	TokenHash  string         `gorm:"not null; uniqueIndex" json:"-"`
+	Scopes     datatypes.JSON `gorm:"not null" json:"scopes"` // e.g. ["bills:write", "messages:write"]
+	LastUsedAt *time.Time     `json:"lastUsedAt"`
+	LastUsedIP string         `json:"lastUsedIp"`
+	ExpiresAt  *time.Time     `json:"expiresAt"` // nil when the token never expires
+	CreatedAt  time.Time      `gorm:"autoCreateTime" json:"createdAt"`
+
+	// Associations
+	User User `gorm:"foreignKey:user_id; constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -1,5 +1,14 @@
 package request
 
+import "encoding/json"
+
+// Only what a user may choose when signing up, everything else is set by the server
+type SignUpRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -15,11 +24,90 @@ type GoogleAuthRequest struct {
 }
 
 type VerifyOTPRequest struct {
-	Email string `json:"email"`
-	OTP   string `json:"otp"`
+	Email   string `json:"email"`
+	OTP     string `json:"otp"`
+	Purpose string `json:"purpose"`
 }
 
 type ResetPasswordRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"` // TOTP or recovery code
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type OIDCLoginRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+type ConfirmLinkRequest struct {
+	LinkToken string `json:"linkToken"`
+	Password  string `json:"password"` // either the account password
+	OTP       string `json:"otp"`      // or an OTP sent with purpose link-account
+	Code      string `json:"code"`     // TOTP or recovery code, if 2FA is enabled
+}
+
+type SetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type ChangeEmailRequest struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"currentPassword"` // either the account password
+	Code            string `json:"code"`            // or a TOTP or recovery code, if the account has no password
+}
+
+type ConfirmEmailChangeRequest struct {
+	Email string `json:"email"`
+	OTP   string `json:"otp"`
+}
+
+type SendMagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type MagicLinkLoginRequest struct {
+	Token string `json:"token"`
+}
+
+type UnlockAccountRequest struct {
+	Token string `json:"token"`
+}
+
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"` // 0 for a token that never expires
+}
+
+type FinishPasskeyRegistrationRequest struct {
+	SessionID  string          `json:"sessionId"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"` // result of navigator.credentials.create()
+}
+
+type PasskeyLoginRequest struct {
+	SessionID  string          `json:"sessionId"`
+	Credential json.RawMessage `json:"credential"` // result of navigator.credentials.get()
+}
+
+type RenamePasskeyRequest struct {
+	Name string `json:"name"`
+}
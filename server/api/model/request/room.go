@@ -9,6 +9,7 @@ import (
 type CreateRoomRequest struct {
 	Room       model.Room     `json:"room"`
 	InviteesId datatypes.JSON `json:"invitees" swaggertype:"array,string"`
+	CircleIDs  []uint         `json:"circles"` // friend circles whose members are invited too
 	Message    string         `json:"message"`
 }
 
@@ -18,5 +19,6 @@ type RespondToRoomInviteRequest struct {
 
 type InviteUserRequest struct {
 	InviteesId datatypes.JSON `json:"invitees" swaggertype:"array,string"`
+	CircleIDs  []uint         `json:"circles"` // friend circles whose members are invited too, unless already invited
 	Message    string         `json:"message"`
 }
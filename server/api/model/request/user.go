@@ -1,10 +1,5 @@
 package request
 
-type UpdateUserRequest struct {
-	Field string `json:"field"`
-	Value string `json:"value"`
-}
-
 type ModifyFriendRequest struct {
 	FriendID uint `json:"friendId"`
 }
@@ -13,3 +8,24 @@ type RespondToFriendRequestRequest struct {
 	Action    string `json:"action"`
 	RequestID uint   `json:"requestId"`
 }
+
+type BlockUserRequest struct {
+	UserID uint `json:"userId"`
+}
+
+type SetPresenceVisibilityRequest struct {
+	Hidden bool `json:"hidden"`
+}
+
+type CreateFriendCircleRequest struct {
+	Name    string `json:"name"`
+	Members []uint `json:"members"`
+}
+
+type RenameFriendCircleRequest struct {
+	Name string `json:"name"`
+}
+
+type AddFriendCircleMembersRequest struct {
+	Members []uint `json:"members"`
+}
@@ -1,8 +1,46 @@
 package response
 
+import "github.com/RowenTey/JustJio/server/api/model"
+
 type AuthResponse struct {
 	Username   string `json:"username"`
 	Email      string `json:"email"`
 	PictureUrl string `json:"pictureUrl"`
 	UID        uint   `json:"id"`
 }
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type OIDCAuthURLResponse struct {
+	AuthURL string `json:"authUrl"`
+	State   string `json:"state"`
+}
+
+type LinkRequiredResponse struct {
+	LinkRequired bool   `json:"linkRequired"`
+	LinkToken    string `json:"linkToken"`
+	Provider     string `json:"provider"`
+	Email        string `json:"email"`
+}
+
+type PersonalAccessTokenResponse struct {
+	Token               string                     `json:"token"` // only returned once, when the token is created
+	PersonalAccessToken *model.PersonalAccessToken `json:"personalAccessToken"`
+}
+
+type PasskeyCeremonyResponse struct {
+	SessionID string `json:"sessionId"`
+	Options   any    `json:"options"` // passed to navigator.credentials.create() or get()
+}
@@ -1,5 +1,11 @@
 package response
 
+import (
+	"encoding/json"
+
+	"github.com/RowenTey/JustJio/server/api/model"
+)
+
 type IsFriendResponse struct {
 	IsFriend bool `json:"isFriend"`
 }
@@ -11,3 +17,38 @@ type GetNumFriendsResponse struct {
 type CountPendingRequestsResponse struct {
 	Count int64 `json:"count"`
 }
+
+// ProfileResponse is the user's own profile, including the fields other users can't see
+type ProfileResponse struct {
+	model.User
+	PhoneNum string `json:"phoneNum"`
+	TimeZone string `json:"timeZone"`
+	Locale   string `json:"locale"`
+}
+
+func NewProfileResponse(user *model.User) ProfileResponse {
+	return ProfileResponse{
+		User:     *user,
+		PhoneNum: user.PhoneNum,
+		TimeZone: user.TimeZone,
+		Locale:   user.Locale,
+	}
+}
+
+// MarshalJSON adds the private fields to the user's own JSON, which would otherwise
+// be used as is since model.User implements json.Marshaler
+func (p ProfileResponse) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(p.User)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["phoneNum"] = p.PhoneNum
+	fields["timeZone"] = p.TimeZone
+	fields["locale"] = p.Locale
+	return json.Marshal(fields)
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// SigningKey is an asymmetric key used to sign access tokens. New tokens are signed with the
+// newest key until RotatesAt, and its public key is published until ExpiresAt so tokens
+// signed just before rotation stay valid.
+type SigningKey struct {
+	ID         string    `gorm:"primaryKey" json:"kid"`
+	Algorithm  string    `gorm:"not null" json:"alg"`
+	PrivateKey string    `gorm:"not null" json:"-"` // Encrypted PKCS #8 DER
+	PublicKey  string    `gorm:"not null" json:"-"` // Base64 PKIX DER
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	RotatesAt  time.Time `gorm:"not null" json:"rotatesAt"`
+	ExpiresAt  time.Time `gorm:"not null; index" json:"expiresAt"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+type RefreshToken struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"not null; index" json:"userId"`
+	TokenHash     string     `gorm:"not null; uniqueIndex" json:"-"`
+	FamilyID      string     `gorm:"not null; index; type:uuid" json:"familyId"` // All tokens rotated from the same login share a family
+	AccessTokenID string     `gorm:"not null" json:"-"`                          // jti of the access token issued alongside this refresh token
+	IPAddress     string     `json:"ipAddress"`
+	UserAgent     string     `json:"userAgent"`
+	ExpiresAt     time.Time  `gorm:"not null" json:"expiresAt"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty"` // Set once the token is rotated or its family is revoked
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+
+	// Associations
+	User User `gorm:"foreignKey:user_id; constraint:OnDelete:CASCADE" json:"-"`
+}
+
+type RevokedToken struct {
+	ID        string    `gorm:"primaryKey" json:"id"` // jti of the revoked access token
+	UserID    uint      `gorm:"not null" json:"userId"`
+	ExpiresAt time.Time `gorm:"not null; index" json:"expiresAt"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+type UserTOTP struct {
+	UserID       uint       `gorm:"primaryKey; autoIncrement:false" json:"userId"`
+	Secret       string     `gorm:"not null" json:"-"`
+	LastUsedStep int64      `gorm:"not null; default:0" json:"-"` // Prevents a code from being replayed within its window
+	ConfirmedAt  *time.Time `json:"confirmedAt,omitempty"`        // 2FA is only enforced once enrolment is confirmed
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+
+	// Associations
+	User User `gorm:"foreignKey:user_id; constraint:OnDelete:CASCADE" json:"-"`
+}
+
+type RecoveryCode struct {
+	ID       uint       `gorm:"primaryKey" json:"id"`
+	UserID   uint       `gorm:"not null; index" json:"userId"`
+	CodeHash string     `gorm:"not null" json:"-"`
+	UsedAt   *time.Time `json:"usedAt,omitempty"`
+
+	// Associations
+	User User `gorm:"foreignKey:user_id; constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TwoFactorChallenge backs a challenge token so it can only be redeemed once and only for a few codes
+type TwoFactorChallenge struct {
+	ID        string    `gorm:"primaryKey" json:"id"` // jti of the challenge token
+	UserID    uint      `gorm:"not null; index" json:"userId"`
+	Attempts  int       `gorm:"not null; default:0" json:"attempts"`
+	ExpiresAt time.Time `gorm:"not null; index" json:"expiresAt"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	// Associations
+	User User `gorm:"foreignKey:user_id; constraint:OnDelete:CASCADE" json:"-"`
+}
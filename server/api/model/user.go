@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -8,13 +9,21 @@ import (
 
 type User struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
-	Username     string    `gorm:"index:username_idx, class:FULLTEXT, unique; not null" json:"username"`
+	Username     string    `gorm:"index:username_idx, unique; not null" json:"username"` // also trigram indexed for search
+	DisplayName  string    `gorm:"not null; default:''" json:"displayName"`
+	Bio          string    `gorm:"not null; default:''" json:"bio"`
+	PhoneNum     string    `gorm:"not null; default:''" json:"-"` // E.164, unique when set. Private, see response.ProfileResponse
+	TimeZone     string    `gorm:"not null; default:''" json:"-"` // IANA name, e.g. Asia/Singapore. Private
+	Locale       string    `gorm:"not null; default:''" json:"-"` // BCP 47 tag, e.g. en-SG. Private
 	Email        string    `gorm:"unique; not null" json:"email"`
-	Password     string    `gorm:"not null" json:"password"`
+	Password     string    `gorm:"not null" json:"-"`
+	HasPassword  bool      `gorm:"not null; default:false" json:"-"` // false for social-only accounts and old hashes the user never proved to know
 	PictureUrl   string    `gorm:"default:'https://i.pinimg.com/736x/a8/57/00/a85700f3c614f6313750b9d8196c08f5.jpg'" json:"pictureUrl"`
+	PictureKey   string    `json:"-"` // blob store prefix of an uploaded picture, empty for the default or a social login picture
 	IsEmailValid bool      `gorm:"default:false" json:"isEmailValid"`
 	IsOnline     bool      `gorm:"default:false" json:"isOnline"`
 	LastSeen     time.Time `json:"lastSeen"`
+	HidePresence bool      `gorm:"not null; default:false" json:"hidePresence"` // friends always see the user as offline
 	RegisteredAt time.Time `gorm:"autoCreateTime" json:"registeredAt"`
 	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 
@@ -40,3 +49,13 @@ func (u *User) BeforeUpdate(tx *gorm.DB) error {
 	u.UpdatedAt = time.Now()
 	return nil
 }
+
+// MarshalJSON leaves out the presence of users who hide it
+func (u User) MarshalJSON() ([]byte, error) {
+	type user User // drops the method so Marshal doesn't recurse
+	if u.HidePresence {
+		u.IsOnline = false
+		u.LastSeen = time.Time{}
+	}
+	return json.Marshal(user(u))
+}
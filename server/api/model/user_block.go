@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// UserBlock stops the blocked user from reaching the blocker.
+// Blocks hide both users from each other, whoever created the block.
+type UserBlock struct {
+	BlockerID uint      `gorm:"primaryKey" json:"blockerId"`
+	BlockedID uint      `gorm:"primaryKey; index" json:"blockedId"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	// Associations
+	Blocker User `gorm:"foreignKey:blocker_id; constraint:OnDelete:CASCADE" json:"-"`
+	Blocked User `gorm:"foreignKey:blocked_id; constraint:OnDelete:CASCADE" json:"blocked"`
+}
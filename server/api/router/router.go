@@ -1,10 +1,13 @@
 package router
 
 import (
+	"path/filepath"
+
 	"github.com/RowenTey/JustJio/server/api/handlers"
 	"github.com/RowenTey/JustJio/server/api/middleware"
 	model_push_notifications "github.com/RowenTey/JustJio/server/api/model/push_notifications"
 	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/swagger"
@@ -27,6 +30,14 @@ func Initalize(router *fiber.App, kafkaSvc *services.KafkaService, notifications
 		URL: "/openapi.yaml",
 	}))
 
+	// uploaded files kept by the local blob store, keys are never reused
+	for _, prefix := range utils.BLOB_PUBLIC_PREFIXES {
+		router.Static(utils.BLOB_ROUTE+"/"+prefix, filepath.Join(utils.BlobDir(), prefix), fiber.Static{MaxAge: 31536000})
+	}
+
+	// public keys for verifying access tokens
+	router.Get("/.well-known/jwks.json", handlers.GetJWKS)
+
 	v1 := router.Group("/v1")
 
 	/* public routes */
@@ -42,73 +53,167 @@ func Initalize(router *fiber.App, kafkaSvc *services.KafkaService, notifications
 	auth.Post("/verify", handlers.VerifyOTP)
 	auth.Post("/otp", handlers.SendOTPEmail)
 	auth.Patch("/reset", handlers.ResetPassword)
+	auth.Post("/refresh", handlers.RefreshToken)
+	auth.Post("/logout", handlers.Logout)
+	auth.Post("/2fa", func(c *fiber.Ctx) error {
+		return handlers.VerifyTwoFactorLogin(c, kafkaSvc)
+	})
+	auth.Get("/oidc/:provider", handlers.GetOIDCAuthURL)
+	auth.Post("/oidc/:provider", func(c *fiber.Ctx) error {
+		return handlers.OIDCLogin(c, kafkaSvc)
+	})
+	auth.Post("/link", func(c *fiber.Ctx) error {
+		return handlers.ConfirmLink(c, kafkaSvc)
+	})
+	auth.Post("/unlock", handlers.UnlockAccount)
+	auth.Post("/magic-link", handlers.SendMagicLink)
+	auth.Post("/magic-link/verify", func(c *fiber.Ctx) error {
+		return handlers.MagicLinkLogin(c, kafkaSvc)
+	})
+	auth.Post("/passkey", handlers.BeginPasskeyLogin)
+	auth.Post("/passkey/verify", func(c *fiber.Ctx) error {
+		return handlers.PasskeyLogin(c, kafkaSvc)
+	})
 
 	/* private routes */
 
+	// security settings of the logged in user
+	account := v1.Group("/account", middleware.SessionOnly)
+	account.Post("/2fa", handlers.EnrollTwoFactor)
+	account.Post("/2fa/confirm", handlers.ConfirmTwoFactor)
+	account.Post("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+	account.Delete("/2fa", handlers.DisableTwoFactor)
+	account.Post("/password", handlers.SetPassword)
+	account.Patch("/password", handlers.ChangePassword)
+	account.Post("/email", handlers.ChangeEmail)
+	account.Post("/email/verify", handlers.ConfirmEmailChange)
+	account.Get("/identities", handlers.GetIdentities)
+	account.Post("/identities/:provider", handlers.LinkIdentity)
+	account.Delete("/identities/:identityId", handlers.UnlinkIdentity)
+	account.Get("/activity", handlers.GetAccountActivity)
+	account.Get("/sessions", handlers.GetSessions)
+	account.Delete("/sessions", handlers.RevokeOtherSessions)
+	account.Delete("/sessions/:sessionId", handlers.RevokeSession)
+	account.Get("/tokens", handlers.GetPersonalAccessTokens)
+	account.Post("/tokens", handlers.CreatePersonalAccessToken)
+	account.Delete("/tokens/:tokenId", handlers.RevokePersonalAccessToken)
+	account.Get("/passkeys", handlers.GetPasskeys)
+	account.Post("/passkeys/register", handlers.BeginPasskeyRegistration)
+	account.Post("/passkeys", handlers.FinishPasskeyRegistration)
+	account.Patch("/passkeys/:passkeyId", handlers.RenamePasskey)
+	account.Delete("/passkeys/:passkeyId", handlers.DeletePasskey)
+	account.Get("/exports", handlers.GetDataExports)
+	account.Post("/exports", handlers.RequestDataExport)
+	account.Get("/exports/:exportId/download", handlers.DownloadDataExport)
+	account.Get("/deletion", handlers.GetAccountDeletion)
+	account.Get("/deletion/settlement", handlers.GetSettlementPlan)
+	account.Delete("/deletion", handlers.CancelAccountDeletion)
+	account.Put("/presence", func(c *fiber.Ctx) error {
+		return handlers.SetPresenceVisibility(c, kafkaSvc)
+	})
+
+	admin := v1.Group("/admin", middleware.SessionOnly, middleware.IsAdmin)
+	admin.Get("/audit-logs", handlers.GetAuditLogs)
+
+	// personal access tokens can only use routes that require a scope
+	readUsers := middleware.RequireScope(services.SCOPE_USERS_READ)
+	writeUsers := middleware.RequireScope(services.SCOPE_USERS_WRITE)
+	readRooms := middleware.RequireScope(services.SCOPE_ROOMS_READ)
+	writeRooms := middleware.RequireScope(services.SCOPE_ROOMS_WRITE)
+	readMessages := middleware.RequireScope(services.SCOPE_MESSAGES_READ)
+	writeMessages := middleware.RequireScope(services.SCOPE_MESSAGES_WRITE)
+	readBills := middleware.RequireScope(services.SCOPE_BILLS_READ)
+	writeBills := middleware.RequireScope(services.SCOPE_BILLS_WRITE)
+	readTransactions := middleware.RequireScope(services.SCOPE_TRANSACTIONS_READ)
+	writeTransactions := middleware.RequireScope(services.SCOPE_TRANSACTIONS_WRITE)
+
 	users := v1.Group("/users")
-	users.Get("/:userId", handlers.GetUser)
-	users.Patch("/:userId", handlers.UpdateUser)
-	users.Delete("/:userId", handlers.DeleteUser)
+	users.Get("/:userId", readUsers, handlers.GetUser)
+	users.Patch("/:userId", writeUsers, middleware.IsSelf, handlers.UpdateUser)
+	users.Delete("/:userId", middleware.SessionOnly, handlers.DeleteUser)
+	users.Put("/:userId/picture", writeUsers, middleware.IsSelf, handlers.UploadPicture)
 
 	friends := users.Group("/:userId/friends")
-	friends.Get("/", handlers.GetFriends)
-	friends.Post("/check", handlers.IsFriend)
-	friends.Get("/count", handlers.GetNumFriends)
-	friends.Get("/search", handlers.SearchFriends)
-	friends.Delete("/:friendId", handlers.RemoveFriend)
-
-	friendRequests := users.Group("/:userId/friendRequests")
-	friendRequests.Get("/", handlers.GetFriendRequestsByStatus)
-	friendRequests.Get("/count", handlers.CountPendingFriendRequests)
-	friendRequests.Post("/", handlers.SendFriendRequest)
-	friendRequests.Patch("/", handlers.RespondToFriendRequest)
-
-	userNotifications := users.Group("/:userId/notifications")
+	friends.Get("/", readUsers, handlers.GetFriends)
+	friends.Post("/check", readUsers, handlers.IsFriend)
+	friends.Get("/count", readUsers, handlers.GetNumFriends)
+	friends.Get("/search", readUsers, handlers.SearchFriends)
+	friends.Get("/suggestions", readUsers, middleware.IsSelf, handlers.GetFriendSuggestions)
+	friends.Get("/presence", readUsers, handlers.GetFriendsPresence)
+	friends.Delete("/:friendId", writeUsers, handlers.RemoveFriend)
+
+	circles := users.Group("/:userId/circles", middleware.IsSelf)
+	circles.Get("/", readUsers, handlers.GetFriendCircles)
+	circles.Post("/", writeUsers, handlers.CreateFriendCircle)
+	circles.Get("/:circleId", readUsers, handlers.GetFriendCircle)
+	circles.Patch("/:circleId", writeUsers, handlers.RenameFriendCircle)
+	circles.Delete("/:circleId", writeUsers, handlers.DeleteFriendCircle)
+	circles.Post("/:circleId/members", writeUsers, handlers.AddFriendCircleMembers)
+	circles.Delete("/:circleId/members/:memberId", writeUsers, handlers.RemoveFriendCircleMember)
+
+	friendRequests := users.Group("/:userId/friendRequests", middleware.IsSelf)
+	friendRequests.Get("/", readUsers, handlers.GetFriendRequestsByStatus)
+	friendRequests.Get("/count", readUsers, handlers.CountPendingFriendRequests)
+	friendRequests.Get("/sent", readUsers, handlers.GetSentFriendRequests)
+	friendRequests.Post("/", writeUsers, func(c *fiber.Ctx) error {
+		return handlers.SendFriendRequest(c, notificationsChan)
+	})
+	friendRequests.Patch("/", writeUsers, func(c *fiber.Ctx) error {
+		return handlers.RespondToFriendRequest(c, notificationsChan)
+	})
+	friendRequests.Delete("/:requestId", writeUsers, handlers.CancelFriendRequest)
+
+	blocks := users.Group("/:userId/blocks", middleware.IsSelf)
+	blocks.Get("/", readUsers, handlers.GetBlockedUsers)
+	blocks.Post("/", writeUsers, handlers.BlockUser)
+	blocks.Delete("/:blockedId", writeUsers, handlers.UnblockUser)
+
+	userNotifications := users.Group("/:userId/notifications", middleware.SessionOnly)
 	userNotifications.Get("/:id", handlers.GetNotification)
 	userNotifications.Patch("/:id", handlers.MarkNotificationAsRead)
 
 	rooms := v1.Group("/rooms")
-	rooms.Get("/", handlers.GetRooms)
-	rooms.Get("/count", handlers.GetNumRooms)
-	rooms.Get("/invites", handlers.GetRoomInvitations)
-	rooms.Get("/invites/count", handlers.GetNumRoomInvitations)
-	rooms.Get("/:roomId", middleware.IsUserInRoom, handlers.GetRoom)
-	rooms.Get("/:roomId/attendees", middleware.IsUserInRoom, handlers.GetRoomAttendees)
-	rooms.Get("/:roomId/uninvited", middleware.IsUserInRoom, handlers.GetUninvitedFriendsForRoom)
-	rooms.Post("/", handlers.CreateRoom)
-	rooms.Post("/:roomId", middleware.IsUserInRoom, handlers.InviteUser)
-	rooms.Patch("/:roomId", handlers.RespondToRoomInvite)
-	rooms.Patch("/:roomId/join", handlers.JoinRoom)
-	rooms.Patch("/:roomId/close", middleware.IsUserInRoom, handlers.CloseRoom)
-	rooms.Patch("/:roomId/leave", middleware.IsUserInRoom, handlers.LeaveRoom)
+	rooms.Get("/", readRooms, handlers.GetRooms)
+	rooms.Get("/count", readRooms, handlers.GetNumRooms)
+	rooms.Get("/invites", readRooms, handlers.GetRoomInvitations)
+	rooms.Get("/invites/count", readRooms, handlers.GetNumRoomInvitations)
+	rooms.Get("/:roomId", readRooms, middleware.IsUserInRoom, handlers.GetRoom)
+	rooms.Get("/:roomId/attendees", readRooms, middleware.IsUserInRoom, handlers.GetRoomAttendees)
+	rooms.Get("/:roomId/uninvited", readRooms, middleware.IsUserInRoom, handlers.GetUninvitedFriendsForRoom)
+	rooms.Post("/", writeRooms, middleware.RequireVerifiedEmail, handlers.CreateRoom)
+	rooms.Post("/:roomId", writeRooms, middleware.IsUserInRoom, handlers.InviteUser)
+	rooms.Patch("/:roomId", writeRooms, handlers.RespondToRoomInvite)
+	rooms.Patch("/:roomId/join", writeRooms, handlers.JoinRoom)
+	rooms.Patch("/:roomId/close", writeRooms, middleware.IsUserInRoom, handlers.CloseRoom)
+	rooms.Patch("/:roomId/leave", writeRooms, middleware.IsUserInRoom, handlers.LeaveRoom)
 
 	messages := rooms.Group("/:roomId/messages")
 	messages.Use(middleware.IsUserInRoom)
-	messages.Get("/", handlers.GetMessages)
-	messages.Get("/:msgId", handlers.GetMessage)
-	messages.Post("/", func(c *fiber.Ctx) error {
+	messages.Get("/", readMessages, handlers.GetMessages)
+	messages.Get("/:msgId", readMessages, handlers.GetMessage)
+	messages.Post("/", writeMessages, func(c *fiber.Ctx) error {
 		return handlers.CreateMessage(c, kafkaSvc)
 	})
 
 	bills := v1.Group("/bills")
-	bills.Get("/", handlers.GetBillsByRoom)
-	bills.Get("/consolidate/:roomId", handlers.IsRoomBillConsolidated)
-	bills.Post("/", handlers.CreateBill)
-	bills.Post("/consolidate", handlers.ConsolidateBills)
+	bills.Get("/", readBills, handlers.GetBillsByRoom)
+	bills.Get("/consolidate/:roomId", readBills, handlers.IsRoomBillConsolidated)
+	bills.Post("/", writeBills, middleware.RequireVerifiedEmail, handlers.CreateBill)
+	bills.Post("/consolidate", writeBills, handlers.ConsolidateBills)
 
 	transactions := v1.Group("/transactions")
-	transactions.Get("/", handlers.GetTransactionsByUser)
-	transactions.Patch("/:txId/settle", func(c *fiber.Ctx) error {
+	transactions.Get("/", readTransactions, handlers.GetTransactionsByUser)
+	transactions.Patch("/:txId/settle", writeTransactions, func(c *fiber.Ctx) error {
 		return handlers.SettleTransaction(c, notificationsChan)
 	})
 
-	notifications := v1.Group("/notifications")
+	notifications := v1.Group("/notifications", middleware.SessionOnly)
 	notifications.Get("/", handlers.GetNotifications)
 	notifications.Post("/", func(c *fiber.Ctx) error {
 		return handlers.CreateNotification(c, notificationsChan)
 	})
 
-	subscriptions := v1.Group("/subscriptions")
+	subscriptions := v1.Group("/subscriptions", middleware.SessionOnly)
 	subscriptions.Get("/:endpoint", handlers.GetSubscriptionByEndpoint)
 	subscriptions.Post("/", func(c *fiber.Ctx) error {
 		return handlers.CreateSubscription(c, notificationsChan)
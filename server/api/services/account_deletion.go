@@ -0,0 +1,296 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DEFAULT_ACCOUNT_DELETION_GRACE_DAYS = 14
+
+	DELETED_USER_DISPLAY_NAME = "Deleted user"
+)
+
+var ErrUnsettledDebts = errors.New("unsettled bills or transactions")
+
+type AccountDeletionService struct {
+	DB     *gorm.DB
+	Logger *log.Entry
+}
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewAccountDeletionService = func(db *gorm.DB) *AccountDeletionService {
+	return &AccountDeletionService{
+		DB:     db,
+		Logger: log.WithFields(log.Fields{"service": "AccountDeletionService"}),
+	}
+}
+
+// SettlementPlan lists what has to be settled before an account can be deleted
+type SettlementPlan struct {
+	Transactions []model.Transaction `json:"transactions"` // unpaid, to pay or collect
+	Bills        []model.Bill        `json:"bills"`        // in rooms whose bills aren't consolidated yet
+}
+
+func (p *SettlementPlan) IsEmpty() bool {
+	return len(p.Transactions) == 0 && len(p.Bills) == 0
+}
+
+// RoomHandoff is a hosted room given to another attendee when its host is deleted
+type RoomHandoff struct {
+	RoomID    string
+	RoomName  string
+	NewHostID uint
+}
+
+// DeletedAccount is what's left to clean up outside the database once an account is deleted
+type DeletedAccount struct {
+	UserID         uint
+	PictureKey     string
+	ExportBlobKeys []string
+	Handoffs       []RoomHandoff
+}
+
+// AccountDeletionGracePeriod returns how long the user has to cancel a deletion,
+// set by ACCOUNT_DELETION_GRACE_DAYS
+func AccountDeletionGracePeriod() time.Duration {
+	days := DEFAULT_ACCOUNT_DELETION_GRACE_DAYS
+	if v, err := strconv.Atoi(config.Config("ACCOUNT_DELETION_GRACE_DAYS")); err == nil && v >= 0 {
+		days = v
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GetSettlementPlan returns the user's unpaid transactions and the bills that will still turn into transactions
+func (s *AccountDeletionService) GetSettlementPlan(userID uint) (*SettlementPlan, error) {
+	return getSettlementPlan(s.DB, userID)
+}
+
+func getSettlementPlan(db *gorm.DB, userID uint) (*SettlementPlan, error) {
+	plan := SettlementPlan{Transactions: []model.Transaction{}, Bills: []model.Bill{}}
+
+	if err := db.
+		Where("is_paid = ? AND (payer_id = ? OR payee_id = ?)", false, userID, userID).
+		Preload("Payer").
+		Preload("Payee").
+		Find(&plan.Transactions).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.
+		Where("consolidation_id IS NULL").
+		Where("owner_id = ? OR EXISTS (SELECT 1 FROM payers WHERE payers.bill_id = bills.id AND payers.user_id = ?)",
+			userID, userID).
+		Find(&plan.Bills).Error; err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
+
+// ScheduleDeletion deletes the account once the grace period is over, unless it is cancelled first.
+// Returns ErrUnsettledDebts with the settlement plan while the user still owes or is owed money.
+func (s *AccountDeletionService) ScheduleDeletion(userID uint) (*model.AccountDeletion, *SettlementPlan, error) {
+	plan, err := s.GetSettlementPlan(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !plan.IsEmpty() {
+		return nil, plan, ErrUnsettledDebts
+	}
+
+	deletion := model.AccountDeletion{
+		UserID:       userID,
+		ScheduledFor: time.Now().Add(AccountDeletionGracePeriod()),
+	}
+	// Asking again doesn't restart the grace period
+	if err := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&deletion).Error; err != nil {
+		return nil, nil, err
+	}
+	var scheduled model.AccountDeletion
+	if err := s.DB.First(&scheduled, userID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	s.Logger.Infof("Scheduled deletion of user %d for %s", userID, scheduled.ScheduledFor)
+	return &scheduled, nil, nil
+}
+
+// GetScheduledDeletion returns the user's pending deletion, or gorm.ErrRecordNotFound
+func (s *AccountDeletionService) GetScheduledDeletion(userID uint) (*model.AccountDeletion, error) {
+	var deletion model.AccountDeletion
+	if err := s.DB.Where("user_id = ? AND completed_at IS NULL", userID).First(&deletion).Error; err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+// CancelDeletion keeps the account, returns gorm.ErrRecordNotFound if no deletion is pending
+func (s *AccountDeletionService) CancelDeletion(userID uint) error {
+	result := s.DB.Where("user_id = ? AND completed_at IS NULL", userID).Delete(&model.AccountDeletion{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetDueDeletions returns the deletions whose grace period is over
+func (s *AccountDeletionService) GetDueDeletions() (*[]model.AccountDeletion, error) {
+	var deletions []model.AccountDeletion
+	if err := s.DB.
+		Where("completed_at IS NULL AND scheduled_for <= ?", time.Now()).
+		Find(&deletions).Error; err != nil {
+		return nil, err
+	}
+	return &deletions, nil
+}
+
+// DeleteAccount anonymizes the user in place, so their messages, bills and settled transactions
+// keep pointing at a valid row, and deletes everything else that belongs to them.
+// Hosted rooms are handed to another attendee, or closed when nobody else is left.
+// Blobs and the Kafka topic are left to the caller, see DeletedAccount.
+func (s *AccountDeletionService) DeleteAccount(userID uint) (*DeletedAccount, error) {
+	deleted := DeletedAccount{UserID: userID, ExportBlobKeys: []string{}, Handoffs: []RoomHandoff{}}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		// Debts may have been added during the grace period
+		plan, err := getSettlementPlan(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !plan.IsEmpty() {
+			return ErrUnsettledDebts
+		}
+
+		handoffs, err := handOffHostedRooms(tx, userID)
+		if err != nil {
+			return err
+		}
+		deleted.Handoffs = handoffs
+
+		if err := tx.Exec(`
+			UPDATE rooms SET attendees_count = attendees_count - 1
+			WHERE id IN (SELECT room_id FROM room_users WHERE user_id = ?) AND attendees_count > 0`,
+			userID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.DataExport{}).
+			Where("user_id = ? AND blob_key <> ''", userID).
+			Pluck("blob_key", &deleted.ExportBlobKeys).Error; err != nil {
+			return err
+		}
+
+		for _, statement := range []string{
+			"DELETE FROM room_users WHERE user_id = @user",
+			"DELETE FROM room_invites WHERE user_id = @user OR inviter_id = @user",
+			"DELETE FROM user_friends WHERE user_id = @user OR friend_id = @user",
+			"DELETE FROM friend_requests WHERE sender_id = @user OR receiver_id = @user",
+			"DELETE FROM user_blocks WHERE blocker_id = @user OR blocked_id = @user",
+			"DELETE FROM friend_circle_members WHERE user_id = @user OR " +
+				"friend_circle_id IN (SELECT id FROM friend_circles WHERE owner_id = @user)",
+			"DELETE FROM friend_circles WHERE owner_id = @user",
+			"DELETE FROM notifications WHERE user_id = @user",
+			"DELETE FROM subscriptions WHERE user_id = @user",
+			"DELETE FROM data_exports WHERE user_id = @user",
+			"DELETE FROM refresh_tokens WHERE user_id = @user",
+			"DELETE FROM personal_access_tokens WHERE user_id = @user",
+			"DELETE FROM passkeys WHERE user_id = @user",
+			"DELETE FROM web_authn_sessions WHERE user_id = @user",
+			"DELETE FROM user_identities WHERE user_id = @user",
+			"DELETE FROM user_totps WHERE user_id = @user",
+			"DELETE FROM recovery_codes WHERE user_id = @user",
+			"DELETE FROM two_factor_challenges WHERE user_id = @user",
+			"DELETE FROM magic_links WHERE user_id = @user",
+		} {
+			if err := tx.Exec(statement, map[string]interface{}{"user": userID}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec("DELETE FROM otps WHERE email = ?", user.Email).Error; err != nil {
+			return err
+		}
+
+		deleted.PictureKey = user.PictureKey
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"username":       fmt.Sprintf("deleted-user-%d", userID),
+			"display_name":   DELETED_USER_DISPLAY_NAME,
+			"email":          fmt.Sprintf("deleted-user-%d@deleted.invalid", userID),
+			"password":       "",
+			"has_password":   false,
+			"picture_url":    gorm.Expr("DEFAULT"),
+			"picture_key":    "",
+			"bio":            "",
+			"phone_num":      "",
+			"time_zone":      "",
+			"locale":         "",
+			"is_email_valid": false,
+			"is_online":      false,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&model.AccountDeletion{}).
+			Where("user_id = ?", userID).
+			Update("completed_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.Logger.Infof("Deleted account of user %d", userID)
+	return &deleted, nil
+}
+
+// handOffHostedRooms makes the longest registered other attendee the host of each room the user hosts.
+// Open rooms without anyone else are closed.
+func handOffHostedRooms(tx *gorm.DB, userID uint) ([]RoomHandoff, error) {
+	var rooms []model.Room
+	if err := tx.Where("host_id = ?", userID).Find(&rooms).Error; err != nil {
+		return nil, err
+	}
+
+	handoffs := []RoomHandoff{}
+	for _, room := range rooms {
+		var newHostIDs []uint
+		if err := tx.Table("room_users").
+			Where("room_id = ? AND user_id <> ?", room.ID, userID).
+			Order("user_id").
+			Limit(1).
+			Pluck("user_id", &newHostIDs).Error; err != nil {
+			return nil, err
+		}
+
+		if len(newHostIDs) == 0 {
+			if err := tx.Model(&room).Update("is_closed", true).Error; err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := tx.Model(&room).Update("host_id", newHostIDs[0]).Error; err != nil {
+			return nil, err
+		}
+		handoffs = append(handoffs, RoomHandoff{RoomID: room.ID, RoomName: room.Name, NewHostID: newHostIDs[0]})
+	}
+
+	return handoffs, nil
+}
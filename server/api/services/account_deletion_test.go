@@ -0,0 +1,189 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+)
+
+type AccountDeletionServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	deletionService *AccountDeletionService
+}
+
+func TestAccountDeletionServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(AccountDeletionServiceTestSuite))
+}
+
+func (s *AccountDeletionServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.deletionService = NewAccountDeletionService(s.DB)
+}
+
+func (s *AccountDeletionServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *AccountDeletionServiceTestSuite) expectSettlementPlan(transactions, bills *sqlmock.Rows) {
+	s.mock.ExpectQuery(`SELECT \* FROM "transactions" WHERE is_paid = \$1 AND \(payer_id = \$2 OR payee_id = \$3\)`).
+		WithArgs(false, 1, 1).
+		WillReturnRows(transactions)
+	s.mock.ExpectQuery(`SELECT \* FROM "bills" WHERE consolidation_id IS NULL AND \(owner_id = \$1 OR EXISTS \(SELECT 1 FROM payers WHERE payers.bill_id = bills.id AND payers.user_id = \$2\)\)`).
+		WithArgs(1, 1).
+		WillReturnRows(bills)
+}
+
+func (s *AccountDeletionServiceTestSuite) TestScheduleDeletion_Success() {
+	// arrange
+	s.T().Setenv("ACCOUNT_DELETION_GRACE_DAYS", "7")
+	scheduledFor := time.Now().Add(7 * 24 * time.Hour)
+
+	s.expectSettlementPlan(sqlmock.NewRows([]string{"id"}), sqlmock.NewRows([]string{"id"}))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`INSERT INTO "account_deletions" \("user_id","requested_at","scheduled_for","completed_at"\) VALUES \(\$1,\$2,\$3,\$4\) ON CONFLICT DO NOTHING`).
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+	s.mock.ExpectQuery(`SELECT \* FROM "account_deletions" WHERE "account_deletions"."user_id" = \$1`).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "scheduled_for"}).AddRow(1, scheduledFor))
+
+	// act
+	deletion, plan, err := s.deletionService.ScheduleDeletion(1)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Nil(s.T(), plan)
+	assert.Equal(s.T(), uint(1), deletion.UserID)
+	assert.WithinDuration(s.T(), scheduledFor, deletion.ScheduledFor, time.Second)
+}
+
+func (s *AccountDeletionServiceTestSuite) TestScheduleDeletion_UnsettledDebts() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "transactions" WHERE is_paid = \$1 AND \(payer_id = \$2 OR payee_id = \$3\)`).
+		WithArgs(false, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "consolidation_id", "payer_id", "payee_id", "amount"}).
+			AddRow(1, 1, 1, 2, 12.5))
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(2, "janedoe"))
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(1, "johndoe"))
+	s.mock.ExpectQuery(`SELECT \* FROM "bills" WHERE consolidation_id IS NULL`).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// act
+	deletion, plan, err := s.deletionService.ScheduleDeletion(1)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, deletion)
+	assert.ErrorIs(s.T(), err, ErrUnsettledDebts)
+	assert.Len(s.T(), plan.Transactions, 1)
+	assert.Equal(s.T(), "janedoe", plan.Transactions[0].Payee.Username)
+	assert.Empty(s.T(), plan.Bills)
+}
+
+func (s *AccountDeletionServiceTestSuite) TestCancelDeletion_NotScheduled() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "account_deletions" WHERE user_id = \$1 AND completed_at IS NULL`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.deletionService.CancelDeletion(1)
+
+	// assert
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *AccountDeletionServiceTestSuite) TestDeleteAccount_UnsettledDebts() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1 ORDER BY "users"."id" LIMIT \$2 FOR UPDATE`).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(1, "johndoe"))
+	s.expectSettlementPlan(
+		sqlmock.NewRows([]string{"id"}),
+		sqlmock.NewRows([]string{"id", "name", "room_id", "owner_id"}).AddRow(1, "Dinner", "room-1", 1))
+	s.mock.ExpectRollback()
+
+	// act
+	deleted, err := s.deletionService.DeleteAccount(1)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, deleted)
+	assert.ErrorIs(s.T(), err, ErrUnsettledDebts)
+}
+
+func (s *AccountDeletionServiceTestSuite) TestDeleteAccount_HandsOffRoomsAndAnonymizes() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1 ORDER BY "users"."id" LIMIT \$2 FOR UPDATE`).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "picture_key"}).
+			AddRow(1, "johndoe", "john@example.com", "avatars/1/abc"))
+	s.expectSettlementPlan(sqlmock.NewRows([]string{"id"}), sqlmock.NewRows([]string{"id"}))
+
+	// One hosted room has another attendee, the other is closed
+	s.mock.ExpectQuery(`SELECT \* FROM "rooms" WHERE host_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "host_id"}).
+			AddRow("room-1", "Dinner", 1).
+			AddRow("room-2", "Solo", 1))
+	s.mock.ExpectQuery(`SELECT "user_id" FROM "room_users" WHERE room_id = \$1 AND user_id <> \$2 ORDER BY user_id LIMIT \$3`).
+		WithArgs("room-1", 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+	s.mock.ExpectExec(`UPDATE "rooms" SET "host_id"=\$1,"updated_at"=\$2 WHERE "id" = \$3`).
+		WithArgs(2, sqlmock.AnyArg(), "room-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectQuery(`SELECT "user_id" FROM "room_users" WHERE room_id = \$1 AND user_id <> \$2 ORDER BY user_id LIMIT \$3`).
+		WithArgs("room-2", 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	s.mock.ExpectExec(`UPDATE "rooms" SET "is_closed"=\$1,"updated_at"=\$2 WHERE "id" = \$3`).
+		WithArgs(true, sqlmock.AnyArg(), "room-2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.mock.ExpectExec(`UPDATE rooms SET attendees_count = attendees_count - 1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.mock.ExpectQuery(`SELECT "blob_key" FROM "data_exports" WHERE user_id = \$1 AND blob_key <> ''`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"blob_key"}).AddRow("exports/1/abc.zip"))
+	for i := 0; i < 19; i++ {
+		s.mock.ExpectExec(`DELETE FROM`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	s.mock.ExpectExec(`DELETE FROM otps WHERE email = \$1`).
+		WithArgs("john@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(`UPDATE "users" SET .*"email"=\$\d.*"password"=\$\d.*"picture_url"=DEFAULT.*"username"=\$\d`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(`UPDATE "account_deletions" SET "completed_at"=\$1 WHERE user_id = \$2`).
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	deleted, err := s.deletionService.DeleteAccount(1)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "avatars/1/abc", deleted.PictureKey)
+	assert.Equal(s.T(), []string{"exports/1/abc.zip"}, deleted.ExportBlobKeys)
+	assert.Equal(s.T(), []RoomHandoff{{RoomID: "room-1", RoomName: "Dinner", NewHostID: 2}}, deleted.Handoffs)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/tests"
+)
+
+type AuditServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	auditService *AuditService
+}
+
+func TestAuditServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditServiceTestSuite))
+}
+
+func (s *AuditServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.auditService = NewAuditService(s.DB)
+}
+
+func (s *AuditServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *AuditServiceTestSuite) TestRecord_Success() {
+	// arrange
+	userId := uint(1)
+	entry := &model.AuditLog{
+		UserID:    &userId,
+		Event:     AUDIT_EVENT_LOGIN,
+		Success:   true,
+		Details:   map[string]any{"method": "password"},
+		IPAddress: "127.0.0.1",
+		UserAgent: "test",
+	}
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "audit_logs" \("user_id","event","success","details","ip_address","user_agent","created_at"\)`).
+		WithArgs(userId, AUDIT_EVENT_LOGIN, true, sqlmock.AnyArg(), "127.0.0.1", "test", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.auditService.Record(entry)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), uint(1), entry.ID)
+}
+
+func (s *AuditServiceTestSuite) TestGetAuditLogs_FiltersByUserAndEvent() {
+	// arrange
+	userId := uint(1)
+	rows := sqlmock.NewRows([]string{"id", "user_id", "event", "success"}).
+		AddRow(2, userId, AUDIT_EVENT_LOGIN, false).
+		AddRow(1, userId, AUDIT_EVENT_LOGIN, true)
+
+	s.mock.ExpectQuery(`SELECT \* FROM "audit_logs" WHERE user_id = \$1 AND event = \$2 ORDER BY created_at DESC, id DESC LIMIT \$3`).
+		WithArgs(userId, AUDIT_EVENT_LOGIN, AUDIT_LOG_PAGE_SIZE).
+		WillReturnRows(rows)
+
+	// act
+	auditLogs, err := s.auditService.GetAuditLogs(AuditLogFilter{UserID: &userId, Event: AUDIT_EVENT_LOGIN}, 1)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), *auditLogs, 2)
+	assert.Equal(s.T(), uint(2), (*auditLogs)[0].ID)
+}
+
+func (s *AuditServiceTestSuite) TestGetAuditLogs_Error() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "audit_logs" ORDER BY created_at DESC, id DESC LIMIT \$1 OFFSET \$2`).
+		WithArgs(AUDIT_LOG_PAGE_SIZE, AUDIT_LOG_PAGE_SIZE).
+		WillReturnError(assert.AnError)
+
+	// act
+	auditLogs, err := s.auditService.GetAuditLogs(AuditLogFilter{}, 2)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, auditLogs)
+}
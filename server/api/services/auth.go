@@ -2,14 +2,15 @@ package services
 
 import (
 	"context"
-	"fmt"
-	"math/rand"
+	"errors"
+	"net/url"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/RowenTey/JustJio/server/api/config"
 	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/utils"
 
 	"github.com/golang-jwt/jwt"
 
@@ -19,30 +20,39 @@ import (
 )
 
 type AuthService struct {
-	HashFunc      func(password string) (string, error)
-	JwtSecret     string
-	SendSMTPEmail func(from, to, subject, textBody string) error
-	OAuthConfig   *oauth2.Config
-	Logger        *log.Entry
+	HashFunc    func(password string) (string, error)
+	JwtSecret   string
+	Mailer      utils.Mailer
+	OAuthConfig *oauth2.Config
+	Logger      *log.Entry
 }
 
 // NOTE: used var instead of func to enable mocking in tests
 var NewAuthService = func(
 	hashFunc func(password string) (string, error),
 	jwtSecret string,
-	sendSMTPEmail func(from, to, subject, textBody string) error,
+	mailer utils.Mailer,
 	oauthConfig *oauth2.Config,
 ) *AuthService {
 	return &AuthService{
-		HashFunc:      hashFunc,
-		JwtSecret:     jwtSecret,
-		SendSMTPEmail: sendSMTPEmail,
-		OAuthConfig:   oauthConfig,
-		Logger:        log.WithFields(log.Fields{"service": "AuthService"}),
+		HashFunc:    hashFunc,
+		JwtSecret:   jwtSecret,
+		Mailer:      mailer,
+		OAuthConfig: oauthConfig,
+		Logger:      log.WithFields(log.Fields{"service": "AuthService"}),
 	}
 }
 
-const TOKEN_EXPIRY_DURATION = time.Hour * 72 // 3 days
+const (
+	ACCESS_TOKEN_EXPIRY_DURATION = time.Minute * 15
+	CHALLENGE_TOKEN_EXPIRY       = time.Minute * 5
+	CHALLENGE_TOKEN_AUDIENCE     = "2fa-challenge"
+	OIDC_STATE_EXPIRY            = time.Minute * 10
+	OIDC_STATE_AUDIENCE          = "oidc-state"
+	LINK_TOKEN_EXPIRY            = time.Minute * 10
+	LINK_TOKEN_AUDIENCE          = "account-link"
+	UNLOCK_TOKEN_AUDIENCE        = "account-unlock"
+)
 
 func (s *AuthService) SignUp(newUser *model.User) (*model.User, error) {
 	var err error
@@ -51,46 +61,199 @@ func (s *AuthService) SignUp(newUser *model.User) (*model.User, error) {
 	if err != nil {
 		return nil, err
 	}
+	newUser.HasPassword = true
 
 	return newUser, nil
 }
 
-func (s *AuthService) CreateToken(user *model.User) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+// CreateToken issues a short-lived access token for the session (refresh token family)
+// signed with the current asymmetric signing key, and returns it along with its token ID (jti)
+func (s *AuthService) CreateToken(user *model.User, sessionId string, key *SigningKeyPair) (string, string, error) {
+	token := jwt.New(jwt.SigningMethodRS256)
+	token.Header["kid"] = key.ID
+	tokenId := utils.CreateULID().String()
 
 	claims := token.Claims.(jwt.MapClaims)
+	claims["jti"] = tokenId
+	claims["sid"] = sessionId
 	claims["username"] = user.Username
 	claims["user_id"] = user.ID
 	claims["user_email"] = user.Email
 	claims["picture_url"] = user.PictureUrl
-	claims["exp"] = time.Now().Add(TOKEN_EXPIRY_DURATION).Unix()
+	claims["exp"] = time.Now().Add(ACCESS_TOKEN_EXPIRY_DURATION).Unix()
 
-	t, err := token.SignedString([]byte(s.JwtSecret))
+	t, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		return "", "", err
+	}
+	return t, tokenId, nil
+}
+
+// CreateChallengeToken issues a short-lived token proving the user passed the password check.
+// It is signed with a separate key so it can never be used as an access token.
+// The challengeId is the stored challenge that makes the token single-use.
+func (s *AuthService) CreateChallengeToken(user *model.User, challengeId string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+	claims["jti"] = challengeId
+	claims["user_id"] = user.ID
+	claims["aud"] = CHALLENGE_TOKEN_AUDIENCE
+	claims["exp"] = time.Now().Add(CHALLENGE_TOKEN_EXPIRY).Unix()
+
+	return token.SignedString(s.internalKey(CHALLENGE_TOKEN_AUDIENCE))
+}
+
+// ParseChallengeToken validates a challenge token and returns the user ID and challenge ID it was issued for
+func (s *AuthService) ParseChallengeToken(tokenStr string) (uint, string, error) {
+	claims, err := s.parseInternalToken(tokenStr, CHALLENGE_TOKEN_AUDIENCE)
+	if err != nil {
+		return 0, "", err
+	}
+
+	userId, ok := claims["user_id"].(float64)
+	challengeId, _ := claims["jti"].(string)
+	if !ok || challengeId == "" {
+		return 0, "", errors.New("invalid challenge token")
+	}
+
+	return uint(userId), challengeId, nil
+}
+
+// CreateOIDCState issues the state parameter for an OIDC login. It binds the
+// provider and nonce to the login attempt without storing anything server side.
+func (s *AuthService) CreateOIDCState(provider, nonce string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+	claims["provider"] = provider
+	claims["nonce"] = nonce
+	claims["aud"] = OIDC_STATE_AUDIENCE
+	claims["exp"] = time.Now().Add(OIDC_STATE_EXPIRY).Unix()
+
+	return token.SignedString(s.internalKey(OIDC_STATE_AUDIENCE))
+}
+
+// ParseOIDCState validates the state returned by the provider and returns its nonce
+func (s *AuthService) ParseOIDCState(state, provider string) (string, error) {
+	claims, err := s.parseInternalToken(state, OIDC_STATE_AUDIENCE)
 	if err != nil {
 		return "", err
 	}
-	return t, nil
+
+	nonce, ok := claims["nonce"].(string)
+	if !ok || claims["provider"] != provider {
+		return "", errors.New("invalid state")
+	}
+
+	return nonce, nil
+}
+
+// PendingLink is an external identity waiting for the owner of the account
+// with the same email to confirm the link
+type PendingLink struct {
+	UserID   uint
+	Provider string
+	Subject  string
+	Email    string
+}
+
+func (s *AuthService) CreateLinkToken(link *PendingLink) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+	claims["user_id"] = link.UserID
+	claims["provider"] = link.Provider
+	claims["sub"] = link.Subject
+	claims["email"] = link.Email
+	claims["aud"] = LINK_TOKEN_AUDIENCE
+	claims["exp"] = time.Now().Add(LINK_TOKEN_EXPIRY).Unix()
+
+	return token.SignedString(s.internalKey(LINK_TOKEN_AUDIENCE))
+}
+
+func (s *AuthService) ParseLinkToken(tokenStr string) (*PendingLink, error) {
+	claims, err := s.parseInternalToken(tokenStr, LINK_TOKEN_AUDIENCE)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, ok := claims["user_id"].(float64)
+	provider, _ := claims["provider"].(string)
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	if !ok || provider == "" || subject == "" {
+		return nil, errors.New("invalid link token")
+	}
+
+	return &PendingLink{
+		UserID:   uint(userId),
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+	}, nil
 }
 
-func (s *AuthService) SendOTPEmail(otp, username, email, purpose string) error {
-	from := config.Config("ADMIN_EMAIL")
+// CreateUnlockToken issues the token emailed to a locked out user, which clears the lockout.
+// It expires with the lockout it was issued for.
+func (s *AuthService) CreateUnlockToken(userId uint) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
 
-	title := ""
-	message := []byte("")
-	if purpose == "verify-email" {
-		title = "JustJio Email Verification"
-		message = []byte("Welcome " + username + ",\r\n\r\n" +
-			"We are happy to see you signed up with JustJio.\r\n\r\n" +
-			"Your OTP is: " + otp)
-	} else if purpose == "reset-password" {
-		title = "JustJio Password Reset"
-		message = []byte("Hi " + username + ",\r\n\r\n" +
-			"Please use the following OTP to reset your password.\r\n\r\n" +
-			"Your OTP is: " + otp)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["user_id"] = userId
+	claims["aud"] = UNLOCK_TOKEN_AUDIENCE
+	claims["exp"] = time.Now().Add(LOCKOUT_DURATION).Unix()
+
+	return token.SignedString(s.internalKey(UNLOCK_TOKEN_AUDIENCE))
+}
+
+// ParseUnlockToken validates an unlock token and returns the ID of the user it was issued for
+func (s *AuthService) ParseUnlockToken(tokenStr string) (uint, error) {
+	claims, err := s.parseInternalToken(tokenStr, UNLOCK_TOKEN_AUDIENCE)
+	if err != nil {
+		return 0, err
 	}
 
-	err := s.SendSMTPEmail(from, email, title, string(message))
+	userId, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, errors.New("invalid unlock token")
+	}
+
+	return uint(userId), nil
+}
+
+// internalKey derives a separate signing key per audience so tokens that are only
+// used within the auth flows can never be used as access tokens
+func (s *AuthService) internalKey(audience string) []byte {
+	return []byte(s.JwtSecret + ":" + audience)
+}
+
+func (s *AuthService) parseInternalToken(tokenStr, audience string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return s.internalKey(audience), nil
+	})
 	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !claims.VerifyAudience(audience, true) {
+		return nil, errors.New("invalid token audience")
+	}
+
+	return claims, nil
+}
+
+// SendOTPEmail emails an OTP, using the template named after its purpose.
+// locale can be a language tag or an Accept-Language header value.
+func (s *AuthService) SendOTPEmail(otp, username, email, purpose, locale string) error {
+	if err := s.sendEmail(email, purpose, locale, map[string]any{
+		"Username": username,
+		"OTP":      otp,
+	}); err != nil {
 		return err
 	}
 
@@ -98,19 +261,60 @@ func (s *AuthService) SendOTPEmail(otp, username, email, purpose string) error {
 	return nil
 }
 
-func (s *AuthService) VerifyOTP(storedOtp, email string, otp string) bool {
-	return storedOtp == otp
+// SendMagicLinkEmail emails a login link, which the client redeems with the token in its query string
+func (s *AuthService) SendMagicLinkEmail(token, username, email, locale string) error {
+	if err := s.sendEmail(email, "magic-link", locale, map[string]any{
+		"Username":      username,
+		"Link":          config.Config("MAGIC_LINK_URL") + "?token=" + url.QueryEscape(token),
+		"ExpiryMinutes": int(MAGIC_LINK_EXPIRY_DURATION.Minutes()),
+	}); err != nil {
+		return err
+	}
+
+	s.Logger.Info("Magic link sent to " + email + " successfully!")
+	return nil
+}
+
+// SendAccountLockedEmail tells the user their account was locked out, with a link to unlock it
+func (s *AuthService) SendAccountLockedEmail(unlockToken, username, email, locale string) error {
+	if err := s.sendEmail(email, "account-locked", locale, map[string]any{
+		"Username":    username,
+		"Link":        config.Config("ACCOUNT_UNLOCK_URL") + "?token=" + url.QueryEscape(unlockToken),
+		"LockMinutes": int(LOCKOUT_DURATION.Minutes()),
+	}); err != nil {
+		return err
+	}
+
+	s.Logger.Info("Account locked email sent to " + email + " successfully!")
+	return nil
 }
 
-func (s *AuthService) GenerateOTP() string {
-	// Seed the random number generator
-	rand.New(rand.NewSource(time.Now().Unix()))
+// SendEmailChangedEmail tells the old address of an account that its email was changed
+func (s *AuthService) SendEmailChangedEmail(username, oldEmail, newEmail, locale string) error {
+	if err := s.sendEmail(oldEmail, "email-changed", locale, map[string]any{
+		"Username": username,
+		"NewEmail": newEmail,
+	}); err != nil {
+		return err
+	}
+
+	s.Logger.Info("Email changed notice sent to " + oldEmail + " successfully!")
+	return nil
+}
 
-	// Generate a random number between 000000 and 999999
-	randomNumber := rand.Intn(1000000)
+func (s *AuthService) sendEmail(to, template, locale string, data any) error {
+	content, err := utils.RenderEmail(template, locale, data)
+	if err != nil {
+		return err
+	}
 
-	// Format as a zero-padded 6-digit string
-	return fmt.Sprintf("%06d", randomNumber)
+	return s.Mailer.Send(&utils.Email{
+		From:     config.Config("ADMIN_EMAIL"),
+		To:       to,
+		Subject:  content.Subject,
+		TextBody: content.TextBody,
+		HTMLBody: content.HTMLBody,
+	})
 }
 
 func (s *AuthService) GetGoogleUser(code string) (*googleOAuth2.Userinfo, error) {
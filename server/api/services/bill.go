@@ -79,6 +79,22 @@ func (bs *BillService) GetBillsForRoom(roomId string) (*[]model.Bill, error) {
 	return &bills, nil
 }
 
+// GetBillsByUser returns every bill the user owns or has to pay for
+func (bs *BillService) GetBillsByUser(userId uint) (*[]model.Bill, error) {
+	db := bs.DB.Table("bills")
+	var bills []model.Bill
+
+	if err := db.
+		Where("owner_id = ? OR EXISTS (SELECT 1 FROM payers WHERE payers.bill_id = bills.id AND payers.user_id = ?)", userId, userId).
+		Preload("Payers").
+		Order("date DESC").
+		Find(&bills).Error; err != nil {
+		return nil, err
+	}
+
+	return &bills, nil
+}
+
 func (bs *BillService) DeleteRoomBills(roomId string) error {
 	db := bs.DB.Table("bills")
 
@@ -465,8 +465,8 @@ func createTestBill(id uint, name string, amount float32, roomId string, ownerId
 
 func userArgs(u *model.User) []driver.Value {
 	return []driver.Value{
-		u.Username, u.Email, u.Password, u.PictureUrl,
-		u.IsEmailValid, u.IsOnline, u.LastSeen,
+		u.Username, u.DisplayName, u.Bio, u.PhoneNum, u.TimeZone, u.Locale, u.Email, u.Password, u.HasPassword, u.PictureUrl, u.PictureKey,
+		u.IsEmailValid, u.IsOnline, u.LastSeen, u.HidePresence,
 		u.RegisteredAt, u.UpdatedAt, u.ID,
 	}
 }
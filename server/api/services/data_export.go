@@ -0,0 +1,561 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DATA_EXPORT_STATUS_PENDING    = "pending"
+	DATA_EXPORT_STATUS_PROCESSING = "processing"
+	DATA_EXPORT_STATUS_READY      = "ready"
+	DATA_EXPORT_STATUS_FAILED     = "failed"
+
+	DATA_EXPORT_RETENTION = 7 * 24 * time.Hour
+)
+
+var ErrDataExportInProgress = errors.New("data export already in progress")
+
+type DataExportService struct {
+	DB     *gorm.DB
+	Logger *log.Entry
+}
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewDataExportService = func(db *gorm.DB) *DataExportService {
+	return &DataExportService{
+		DB:     db,
+		Logger: log.WithFields(log.Fields{"service": "DataExportService"}),
+	}
+}
+
+// RequestExport queues an export of the user's data for the worker to build
+func (s *DataExportService) RequestExport(userID uint) (*model.DataExport, error) {
+	var count int64
+	if err := s.DB.Model(&model.DataExport{}).
+		Where("user_id = ? AND status IN ?", userID,
+			[]string{DATA_EXPORT_STATUS_PENDING, DATA_EXPORT_STATUS_PROCESSING}).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrDataExportInProgress
+	}
+
+	export := model.DataExport{UserID: userID, Status: DATA_EXPORT_STATUS_PENDING}
+	if err := s.DB.Create(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (s *DataExportService) GetExports(userID uint) (*[]model.DataExport, error) {
+	var exports []model.DataExport
+	if err := s.DB.Where("user_id = ?", userID).Order("requested_at DESC").Find(&exports).Error; err != nil {
+		return nil, err
+	}
+	return &exports, nil
+}
+
+func (s *DataExportService) GetExport(userID, exportID uint) (*model.DataExport, error) {
+	var export model.DataExport
+	if err := s.DB.Where("id = ? AND user_id = ?", exportID, userID).First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// ClaimNextExport marks the oldest pending export as processing so no other worker builds it.
+// Returns gorm.ErrRecordNotFound when nothing is pending.
+func (s *DataExportService) ClaimNextExport() (*model.DataExport, error) {
+	var export model.DataExport
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", DATA_EXPORT_STATUS_PENDING).
+			Order("id").
+			First(&export).Error; err != nil {
+			return err
+		}
+		return tx.Model(&export).Update("status", DATA_EXPORT_STATUS_PROCESSING).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// RequeueInterruptedExports puts exports left processing by a previous run back in the queue
+func (s *DataExportService) RequeueInterruptedExports() error {
+	return s.DB.Model(&model.DataExport{}).
+		Where("status = ?", DATA_EXPORT_STATUS_PROCESSING).
+		Update("status", DATA_EXPORT_STATUS_PENDING).Error
+}
+
+// BuildExport collects the user's data into a ZIP archive and keeps it in the store until it expires
+func (s *DataExportService) BuildExport(ctx context.Context, store utils.BlobStore, export *model.DataExport) error {
+	if err := s.buildExport(ctx, store, export); err != nil {
+		if updateErr := s.DB.Model(export).Update("status", DATA_EXPORT_STATUS_FAILED).Error; updateErr != nil {
+			s.Logger.Error("Error marking data export as failed: ", updateErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *DataExportService) buildExport(ctx context.Context, store utils.BlobStore, export *model.DataExport) error {
+	archive, err := s.BuildArchive(export.UserID)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("exports/%d/%s.zip", export.UserID, utils.CreateULID())
+	if err := store.Put(ctx, key, archive, "application/zip"); err != nil {
+		return err
+	}
+
+	completedAt := time.Now()
+	expiresAt := completedAt.Add(DATA_EXPORT_RETENTION)
+	if err := s.DB.Model(export).Updates(map[string]interface{}{
+		"status":       DATA_EXPORT_STATUS_READY,
+		"blob_key":     key,
+		"size":         len(archive),
+		"completed_at": completedAt,
+		"expires_at":   expiresAt,
+	}).Error; err != nil {
+		return err
+	}
+
+	s.Logger.Infof("Built data export %d for user %d", export.ID, export.UserID)
+	return nil
+}
+
+// DeleteExpiredExports removes archives past their expiry, and failed exports after the same period
+func (s *DataExportService) DeleteExpiredExports(ctx context.Context, store utils.BlobStore) error {
+	now := time.Now()
+	var exports []model.DataExport
+	if err := s.DB.
+		Where("expires_at < ? OR (status = ? AND requested_at < ?)",
+			now, DATA_EXPORT_STATUS_FAILED, now.Add(-DATA_EXPORT_RETENTION)).
+		Find(&exports).Error; err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.BlobKey != "" {
+			if err := store.Delete(ctx, export.BlobKey); err != nil {
+				s.Logger.Warn("Error deleting data export archive: ", err)
+				continue
+			}
+		}
+		if err := s.DB.Delete(&export).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Records written to the archive. Other users appear by ID and name only.
+type (
+	exportProfile struct {
+		ID           uint      `json:"id"`
+		Username     string    `json:"username"`
+		DisplayName  string    `json:"displayName"`
+		Email        string    `json:"email"`
+		Bio          string    `json:"bio"`
+		PhoneNum     string    `json:"phoneNum"`
+		TimeZone     string    `json:"timeZone"`
+		Locale       string    `json:"locale"`
+		PictureUrl   string    `json:"pictureUrl"`
+		IsEmailValid bool      `json:"isEmailValid"`
+		RegisteredAt time.Time `json:"registeredAt"`
+		UpdatedAt    time.Time `json:"updatedAt"`
+	}
+	exportFriend struct {
+		ID          uint   `json:"id"`
+		Username    string `json:"username"`
+		DisplayName string `json:"displayName"`
+	}
+	exportFriendCircle struct {
+		ID        uint      `json:"id"`
+		Name      string    `json:"name"`
+		Members   []string  `json:"members"` // usernames, separated by ; in the CSV
+		CreatedAt time.Time `json:"createdAt"`
+	}
+	exportFriendRequest struct {
+		ID          uint       `json:"id"`
+		Direction   string     `json:"direction"` // sent or received
+		UserID      uint       `json:"userId"`
+		Username    string     `json:"username"`
+		Status      string     `json:"status"`
+		SentAt      time.Time  `json:"sentAt"`
+		RespondedAt *time.Time `json:"respondedAt"`
+	}
+	exportRoom struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		Venue     string    `json:"venue"`
+		Date      time.Time `json:"date"`
+		Time      string    `json:"time"`
+		IsHost    bool      `json:"isHost"`
+		IsClosed  bool      `json:"isClosed"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+	exportRoomInvite struct {
+		ID        uint      `json:"id"`
+		RoomID    string    `json:"roomId"`
+		RoomName  string    `json:"roomName"`
+		Direction string    `json:"direction"` // sent or received
+		UserID    uint      `json:"userId"`
+		InviterID uint      `json:"inviterId"`
+		Status    string    `json:"status"`
+		Message   string    `json:"message"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+	exportMessage struct {
+		ID      uint      `json:"id"`
+		RoomID  string    `json:"roomId"`
+		Content string    `json:"content"`
+		SentAt  time.Time `json:"sentAt"`
+	}
+	exportBill struct {
+		ID           uint      `json:"id"`
+		RoomID       string    `json:"roomId"`
+		Name         string    `json:"name"`
+		Amount       float32   `json:"amount"`
+		Date         time.Time `json:"date"`
+		IsOwner      bool      `json:"isOwner"`
+		IncludeOwner bool      `json:"includeOwner"`
+		NumPayers    int       `json:"numPayers"`
+	}
+	exportTransaction struct {
+		ID              uint       `json:"id"`
+		ConsolidationID uint       `json:"consolidationId"`
+		Direction       string     `json:"direction"` // pay or receive
+		UserID          uint       `json:"userId"`
+		Username        string     `json:"username"`
+		Amount          float32    `json:"amount"`
+		IsPaid          bool       `json:"isPaid"`
+		PaidOn          *time.Time `json:"paidOn"`
+	}
+	exportNotification struct {
+		ID        uint      `json:"id"`
+		Title     string    `json:"title"`
+		Content   string    `json:"content"`
+		IsRead    bool      `json:"isRead"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+	exportPushSubscription struct {
+		ID       string `json:"id"`
+		Endpoint string `json:"endpoint"`
+	}
+)
+
+// BuildArchive returns a ZIP with a JSON and a CSV file for each kind of data kept about the user
+func (s *DataExportService) BuildArchive(userID uint) ([]byte, error) {
+	userIDStr := strconv.FormatUint(uint64(userID), 10)
+
+	userService := NewUserService(s.DB)
+	user, err := userService.GetUserByID(userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	friends, err := userService.GetFriends(userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	friendRequests, err := userService.GetAllFriendRequests(userID)
+	if err != nil {
+		return nil, err
+	}
+	circles, err := NewFriendCircleService(s.DB).GetCircles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roomService := NewRoomService(s.DB)
+	rooms, err := roomService.GetAllRooms(userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	invites, err := roomService.GetAllRoomInvites(userIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := NewMessageService(s.DB).GetMessagesBySender(userID)
+	if err != nil {
+		return nil, err
+	}
+	bills, err := NewBillService(s.DB).GetBillsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	transactionService := NewTransactionService(s.DB)
+	unpaid, err := transactionService.GetTransactionsByUser(false, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	paid, err := transactionService.GetTransactionsByUser(true, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications, err := NewNotificationService(s.DB).GetNotifications(userID)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, err := NewSubscriptionService(s.DB).GetSubscriptionsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	sections := []struct {
+		name    string
+		records any
+	}{
+		{"profile", []exportProfile{toExportProfile(user)}},
+		{"friends", mapRecords(friends, toExportFriend)},
+		{"friend_requests", mapRecords(*friendRequests, func(r model.FriendRequest) exportFriendRequest {
+			return toExportFriendRequest(userID, r)
+		})},
+		{"friend_circles", mapRecords(*circles, toExportFriendCircle)},
+		{"rooms", mapRecords(*rooms, func(r model.Room) exportRoom { return toExportRoom(userID, r) })},
+		{"room_invites", mapRecords(*invites, func(i model.RoomInvite) exportRoomInvite {
+			return toExportRoomInvite(userID, i)
+		})},
+		{"messages", mapRecords(*messages, toExportMessage)},
+		{"bills", mapRecords(*bills, func(b model.Bill) exportBill { return toExportBill(userID, b) })},
+		{"transactions", mapRecords(append(*unpaid, *paid...), func(t model.Transaction) exportTransaction {
+			return toExportTransaction(userID, t)
+		})},
+		{"notifications", mapRecords(*notifications, toExportNotification)},
+		{"push_subscriptions", mapRecords(*subscriptions, toExportPushSubscription)},
+	}
+	for _, section := range sections {
+		if err := writeExportSection(zw, section.name, section.records); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeExportSection writes name.json and name.csv, with the CSV columns named after the JSON fields
+func writeExportSection(zw *zip.Writer, name string, records any) error {
+	w, err := zw.Create(name + ".json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(records); err != nil {
+		return err
+	}
+
+	w, err = zw.Create(name + ".csv")
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+
+	rows := reflect.ValueOf(records)
+	recordType := rows.Type().Elem()
+	header := make([]string, recordType.NumField())
+	for i := range header {
+		header[i], _, _ = strings.Cut(recordType.Field(i).Tag.Get("json"), ",")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for i := 0; i < rows.Len(); i++ {
+		row := make([]string, len(header))
+		for j := range row {
+			row[j] = formatExportValue(rows.Index(i).Field(j).Interface())
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatExportValue(value any) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, ";")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func mapRecords[T, R any](items []T, convert func(T) R) []R {
+	records := make([]R, len(items))
+	for i, item := range items {
+		records[i] = convert(item)
+	}
+	return records
+}
+
+// optionalTime is nil for timestamps that were never set
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func toExportProfile(u *model.User) exportProfile {
+	return exportProfile{
+		ID:           u.ID,
+		Username:     u.Username,
+		DisplayName:  u.DisplayName,
+		Email:        u.Email,
+		Bio:          u.Bio,
+		PhoneNum:     u.PhoneNum,
+		TimeZone:     u.TimeZone,
+		Locale:       u.Locale,
+		PictureUrl:   u.PictureUrl,
+		IsEmailValid: u.IsEmailValid,
+		RegisteredAt: u.RegisteredAt,
+		UpdatedAt:    u.UpdatedAt,
+	}
+}
+
+func toExportFriend(u model.User) exportFriend {
+	return exportFriend{ID: u.ID, Username: u.Username, DisplayName: u.DisplayName}
+}
+
+func toExportFriendCircle(c model.FriendCircle) exportFriendCircle {
+	members := make([]string, len(c.Members))
+	for i, member := range c.Members {
+		members[i] = member.Username
+	}
+	return exportFriendCircle{ID: c.ID, Name: c.Name, Members: members, CreatedAt: c.CreatedAt}
+}
+
+func toExportFriendRequest(userID uint, r model.FriendRequest) exportFriendRequest {
+	record := exportFriendRequest{
+		ID:          r.ID,
+		Direction:   "sent",
+		UserID:      r.ReceiverID,
+		Username:    r.Receiver.Username,
+		Status:      r.Status,
+		SentAt:      r.SentAt,
+		RespondedAt: optionalTime(r.RespondedAt),
+	}
+	if r.ReceiverID == userID {
+		record.Direction = "received"
+		record.UserID = r.SenderID
+		record.Username = r.Sender.Username
+	}
+	return record
+}
+
+func toExportRoom(userID uint, r model.Room) exportRoom {
+	return exportRoom{
+		ID:        r.ID,
+		Name:      r.Name,
+		Venue:     r.Venue,
+		Date:      r.Date,
+		Time:      r.Time,
+		IsHost:    r.HostID == userID,
+		IsClosed:  r.IsClosed,
+		CreatedAt: r.CreatedAt,
+	}
+}
+
+func toExportRoomInvite(userID uint, i model.RoomInvite) exportRoomInvite {
+	direction := "received"
+	if i.InviterID == userID {
+		direction = "sent"
+	}
+	return exportRoomInvite{
+		ID:        i.ID,
+		RoomID:    i.RoomID,
+		RoomName:  i.Room.Name,
+		Direction: direction,
+		UserID:    i.UserID,
+		InviterID: i.InviterID,
+		Status:    i.Status,
+		Message:   i.Message,
+		CreatedAt: i.CreatedAt,
+	}
+}
+
+func toExportMessage(m model.Message) exportMessage {
+	return exportMessage{ID: m.ID, RoomID: m.RoomID, Content: m.Content, SentAt: m.SentAt}
+}
+
+func toExportBill(userID uint, b model.Bill) exportBill {
+	return exportBill{
+		ID:           b.ID,
+		RoomID:       b.RoomID,
+		Name:         b.Name,
+		Amount:       b.Amount,
+		Date:         b.Date,
+		IsOwner:      b.OwnerID == userID,
+		IncludeOwner: b.IncludeOwner,
+		NumPayers:    len(b.Payers),
+	}
+}
+
+func toExportTransaction(userID uint, t model.Transaction) exportTransaction {
+	record := exportTransaction{
+		ID:              t.ID,
+		ConsolidationID: t.ConsolidationID,
+		Direction:       "pay",
+		UserID:          t.PayeeID,
+		Username:        t.Payee.Username,
+		Amount:          t.Amount,
+		IsPaid:          t.IsPaid,
+		PaidOn:          optionalTime(t.PaidOn),
+	}
+	if t.PayeeID == userID {
+		record.Direction = "receive"
+		record.UserID = t.PayerID
+		record.Username = t.Payer.Username
+	}
+	return record
+}
+
+func toExportNotification(n model.Notification) exportNotification {
+	return exportNotification{ID: n.ID, Title: n.Title, Content: n.Content, IsRead: n.IsRead, CreatedAt: n.CreatedAt}
+}
+
+// Push subscription keys are secrets, so only the endpoint is exported
+func toExportPushSubscription(s model.Subscription) exportPushSubscription {
+	return exportPushSubscription{ID: s.ID, Endpoint: s.Endpoint}
+}
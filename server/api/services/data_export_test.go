@@ -0,0 +1,208 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/tests"
+	"github.com/RowenTey/JustJio/server/api/utils"
+)
+
+type DataExportServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	exportService *DataExportService
+}
+
+func TestDataExportServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(DataExportServiceTestSuite))
+}
+
+func (s *DataExportServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.exportService = NewDataExportService(s.DB)
+}
+
+func (s *DataExportServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *DataExportServiceTestSuite) TestRequestExport_Success() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "data_exports" WHERE user_id = \$1 AND status IN \(\$2,\$3\)`).
+		WithArgs(1, DATA_EXPORT_STATUS_PENDING, DATA_EXPORT_STATUS_PROCESSING).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "data_exports"`).
+		WithArgs(1, DATA_EXPORT_STATUS_PENDING, "", 0, sqlmock.AnyArg(), nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	// act
+	export, err := s.exportService.RequestExport(1)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), uint(1), export.ID)
+	assert.Equal(s.T(), DATA_EXPORT_STATUS_PENDING, export.Status)
+}
+
+func (s *DataExportServiceTestSuite) TestRequestExport_InProgress() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "data_exports" WHERE user_id = \$1 AND status IN \(\$2,\$3\)`).
+		WithArgs(1, DATA_EXPORT_STATUS_PENDING, DATA_EXPORT_STATUS_PROCESSING).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	// act
+	export, err := s.exportService.RequestExport(1)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, export)
+	assert.ErrorIs(s.T(), err, ErrDataExportInProgress)
+}
+
+func (s *DataExportServiceTestSuite) TestClaimNextExport_Success() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`SELECT \* FROM "data_exports" WHERE status = \$1 ORDER BY id,"data_exports"."id" LIMIT \$2 FOR UPDATE SKIP LOCKED`).
+		WithArgs(DATA_EXPORT_STATUS_PENDING, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 1, DATA_EXPORT_STATUS_PENDING))
+	s.mock.ExpectExec(`UPDATE "data_exports" SET "status"=\$1 WHERE "id" = \$2`).
+		WithArgs(DATA_EXPORT_STATUS_PROCESSING, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	export, err := s.exportService.ClaimNextExport()
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), uint(3), export.ID)
+	assert.Equal(s.T(), DATA_EXPORT_STATUS_PROCESSING, export.Status)
+}
+
+func (s *DataExportServiceTestSuite) TestClaimNextExport_NothingPending() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`SELECT \* FROM "data_exports" WHERE status = \$1`).
+		WithArgs(DATA_EXPORT_STATUS_PENDING, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	s.mock.ExpectRollback()
+
+	// act
+	export, err := s.exportService.ClaimNextExport()
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, export)
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *DataExportServiceTestSuite) TestDeleteExpiredExports_Success() {
+	// arrange
+	store := &utils.LocalBlobStore{Dir: s.T().TempDir()}
+	ctx := context.Background()
+	assert.NoError(s.T(), store.Put(ctx, "exports/1/old.zip", []byte("zip"), "application/zip"))
+
+	s.mock.ExpectQuery(`SELECT \* FROM "data_exports" WHERE expires_at < \$1 OR \(status = \$2 AND requested_at < \$3\)`).
+		WithArgs(sqlmock.AnyArg(), DATA_EXPORT_STATUS_FAILED, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "blob_key"}).
+			AddRow(1, 1, DATA_EXPORT_STATUS_READY, "exports/1/old.zip").
+			AddRow(2, 1, DATA_EXPORT_STATUS_FAILED, ""))
+	for _, id := range []int{1, 2} {
+		s.mock.ExpectBegin()
+		s.mock.ExpectExec(`DELETE FROM "data_exports" WHERE "data_exports"."id" = \$1`).
+			WithArgs(id).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		s.mock.ExpectCommit()
+	}
+
+	// act
+	err := s.exportService.DeleteExpiredExports(ctx, store)
+
+	// assert
+	assert.NoError(s.T(), err)
+	_, err = os.Stat(filepath.Join(store.Dir, "exports", "1", "old.zip"))
+	assert.True(s.T(), os.IsNotExist(err))
+}
+
+func (s *DataExportServiceTestSuite) TestWriteExportSection_JSONAndCSV() {
+	// arrange
+	respondedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	records := []exportFriendRequest{
+		{ID: 1, Direction: "sent", UserID: 2, Username: "jane", Status: "accepted",
+			SentAt: respondedAt.Add(-time.Hour), RespondedAt: &respondedAt},
+		{ID: 2, Direction: "received", UserID: 3, Username: "bob, jr", Status: "pending",
+			SentAt: respondedAt},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	// act
+	err := writeExportSection(zw, "friend_requests", records)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), zr.File, 2)
+
+	var decoded []exportFriendRequest
+	assert.NoError(s.T(), json.Unmarshal(readZipFile(s.T(), zr, "friend_requests.json"), &decoded))
+	assert.Equal(s.T(), "jane", decoded[0].Username)
+	assert.Nil(s.T(), decoded[1].RespondedAt)
+
+	rows, err := csv.NewReader(bytes.NewReader(readZipFile(s.T(), zr, "friend_requests.csv"))).ReadAll()
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"id", "direction", "userId", "username", "status", "sentAt", "respondedAt"}, rows[0])
+	assert.Equal(s.T(), []string{"1", "sent", "2", "jane", "accepted", "2025-01-02T02:04:05Z", "2025-01-02T03:04:05Z"}, rows[1])
+	assert.Equal(s.T(), []string{"2", "received", "3", "bob, jr", "pending", "2025-01-02T03:04:05Z", ""}, rows[2])
+}
+
+func (s *DataExportServiceTestSuite) TestToExportFriendRequest_Direction() {
+	// arrange
+	request := model.FriendRequest{
+		ID: 1, SenderID: 1, ReceiverID: 2, Status: "pending",
+		Sender: model.User{Username: "john"}, Receiver: model.User{Username: "jane"},
+	}
+
+	// act
+	sent := toExportFriendRequest(1, request)
+	received := toExportFriendRequest(2, request)
+
+	// assert
+	assert.Equal(s.T(), "sent", sent.Direction)
+	assert.Equal(s.T(), "jane", sent.Username)
+	assert.Equal(s.T(), "received", received.Direction)
+	assert.Equal(s.T(), "john", received.Username)
+}
+
+func readZipFile(t *testing.T, zr *zip.Reader, name string) []byte {
+	f, err := zr.Open(name)
+	assert.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	return data
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MAX_FRIEND_CIRCLES            = 50
+	MAX_FRIEND_CIRCLE_NAME_LENGTH = 30
+)
+
+var (
+	ErrInvalidCircleName = errors.New("circle name must be 1 to 30 characters")
+	ErrCircleNameTaken   = errors.New("circle name already taken")
+	ErrTooManyCircles    = errors.New("too many circles")
+	ErrNotFriends        = errors.New("circle members must be friends")
+)
+
+type FriendCircleService struct {
+	DB     *gorm.DB
+	Logger *log.Entry
+}
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewFriendCircleService = func(db *gorm.DB) *FriendCircleService {
+	return &FriendCircleService{
+		DB:     db,
+		Logger: log.WithFields(log.Fields{"service": "FriendCircleService"}),
+	}
+}
+
+func normalizeCircleName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MAX_FRIEND_CIRCLE_NAME_LENGTH {
+		return "", ErrInvalidCircleName
+	}
+	return name, nil
+}
+
+// GetCircles returns the owner's circles with their members, sorted by name
+func (s *FriendCircleService) GetCircles(ownerID uint) (*[]model.FriendCircle, error) {
+	var circles []model.FriendCircle
+	if err := s.DB.
+		Preload("Members").
+		Where("owner_id = ?", ownerID).
+		Order("name").
+		Find(&circles).Error; err != nil {
+		return nil, err
+	}
+	return &circles, nil
+}
+
+// GetCircle fails with ErrRecordNotFound for circles of other users
+func (s *FriendCircleService) GetCircle(ownerID, circleID uint) (*model.FriendCircle, error) {
+	var circle model.FriendCircle
+	if err := s.DB.
+		Preload("Members").
+		Where("id = ? AND owner_id = ?", circleID, ownerID).
+		First(&circle).Error; err != nil {
+		return nil, err
+	}
+	return &circle, nil
+}
+
+// ValidateCircles checks that every circle belongs to the owner, failing with ErrRecordNotFound otherwise
+func (s *FriendCircleService) ValidateCircles(ownerID uint, circleIDs []uint) error {
+	circleIDs = uniqueIDs(circleIDs)
+	if len(circleIDs) == 0 {
+		return nil
+	}
+
+	var count int64
+	if err := s.DB.Model(&model.FriendCircle{}).
+		Where("id IN ? AND owner_id = ?", circleIDs, ownerID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count != int64(len(circleIDs)) {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *FriendCircleService) CreateCircle(ownerID uint, name string, memberIDs []uint) (*model.FriendCircle, error) {
+	name, err := normalizeCircleName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := s.DB.Model(&model.FriendCircle{}).Where("owner_id = ?", ownerID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count >= MAX_FRIEND_CIRCLES {
+		return nil, ErrTooManyCircles
+	}
+
+	members, err := s.getFriends(ownerID, memberIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	circle := model.FriendCircle{
+		OwnerID: ownerID,
+		Name:    name,
+		Members: members,
+	}
+	// Members.* only links the existing users
+	if err := s.DB.Omit("Owner", "Members.*").Create(&circle).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrCircleNameTaken
+		}
+		return nil, err
+	}
+
+	if circle.Members == nil {
+		circle.Members = []model.User{}
+	}
+	return &circle, nil
+}
+
+func (s *FriendCircleService) RenameCircle(ownerID, circleID uint, name string) (*model.FriendCircle, error) {
+	name, err := normalizeCircleName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	circle, err := s.GetCircle(ownerID, circleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.Model(circle).Update("name", name).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrCircleNameTaken
+		}
+		return nil, err
+	}
+	return circle, nil
+}
+
+// DeleteCircle only removes the grouping, the members stay friends
+func (s *FriendCircleService) DeleteCircle(ownerID, circleID uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM friend_circle_members WHERE friend_circle_id IN
+			(SELECT id FROM friend_circles WHERE id = ? AND owner_id = ?)`, circleID, ownerID).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("id = ? AND owner_id = ?", circleID, ownerID).Delete(&model.FriendCircle{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// AddMembers adds friends to the circle, members already in it are left as they are
+func (s *FriendCircleService) AddMembers(ownerID, circleID uint, memberIDs []uint) (*model.FriendCircle, error) {
+	circle, err := s.GetCircle(ownerID, circleID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.getFriends(ownerID, memberIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return circle, nil
+	}
+
+	rows := make([]map[string]interface{}, len(members))
+	for i, member := range members {
+		rows[i] = map[string]interface{}{"friend_circle_id": circle.ID, "user_id": member.ID}
+	}
+	if err := s.DB.Table("friend_circle_members").
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return s.GetCircle(ownerID, circleID)
+}
+
+func (s *FriendCircleService) RemoveMember(ownerID, circleID, memberID uint) error {
+	result := s.DB.Exec(`DELETE FROM friend_circle_members WHERE user_id = ? AND friend_circle_id IN
+		(SELECT id FROM friend_circles WHERE id = ? AND owner_id = ?)`, memberID, circleID, ownerID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// getFriends loads the users, failing with ErrNotFriends unless all of them are the owner's friends
+func (s *FriendCircleService) getFriends(ownerID uint, userIDs []uint) ([]model.User, error) {
+	userIDs = uniqueIDs(userIDs)
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	var friends []model.User
+	if err := s.DB.
+		Joins("JOIN user_friends ON user_friends.friend_id = users.id AND user_friends.user_id = ?", ownerID).
+		Where("users.id IN ?", userIDs).
+		Find(&friends).Error; err != nil {
+		return nil, err
+	}
+	if len(friends) != len(userIDs) {
+		return nil, ErrNotFriends
+	}
+	return friends, nil
+}
+
+// removeFromEachOthersCircles runs when two users stop being friends
+func removeFromEachOthersCircles(db *gorm.DB, userID, otherID uint) error {
+	return db.Exec(`DELETE FROM friend_circle_members WHERE
+		(user_id = ? AND friend_circle_id IN (SELECT id FROM friend_circles WHERE owner_id = ?)) OR
+		(user_id = ? AND friend_circle_id IN (SELECT id FROM friend_circles WHERE owner_id = ?))`,
+		otherID, userID, userID, otherID).Error
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+)
+
+type FriendCircleServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	circleService *FriendCircleService
+}
+
+func TestFriendCircleServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(FriendCircleServiceTestSuite))
+}
+
+func (s *FriendCircleServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.circleService = NewFriendCircleService(s.DB)
+}
+
+func (s *FriendCircleServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *FriendCircleServiceTestSuite) TestCreateCircle_Success() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "friend_circles" WHERE owner_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	// Duplicate members are only looked up once
+	s.mock.ExpectQuery(`SELECT "users"."id",.* FROM "users" JOIN user_friends ON user_friends.friend_id = users.id AND user_friends.user_id = \$1 WHERE users.id IN \(\$2,\$3\)`).
+		WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(2, "jane").AddRow(3, "bob"))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "friend_circles" \("owner_id","name","created_at","updated_at"\) VALUES \(\$1,\$2,\$3,\$4\) RETURNING "id"`).
+		WithArgs(1, "Badminton", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	s.mock.ExpectExec(`INSERT INTO "friend_circle_members" \("friend_circle_id","user_id"\) VALUES \(\$1,\$2\),\(\$3,\$4\) ON CONFLICT DO NOTHING`).
+		WithArgs(7, 2, 7, 3).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.mock.ExpectCommit()
+
+	// act
+	circle, err := s.circleService.CreateCircle(1, "  Badminton ", []uint{2, 3, 2})
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), uint(7), circle.ID)
+	assert.Equal(s.T(), "Badminton", circle.Name)
+	assert.Len(s.T(), circle.Members, 2)
+}
+
+func (s *FriendCircleServiceTestSuite) TestCreateCircle_InvalidName() {
+	// act
+	circle, err := s.circleService.CreateCircle(1, strings.Repeat("a", MAX_FRIEND_CIRCLE_NAME_LENGTH+1), nil)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, circle)
+	assert.ErrorIs(s.T(), err, ErrInvalidCircleName)
+}
+
+func (s *FriendCircleServiceTestSuite) TestCreateCircle_TooManyCircles() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "friend_circles" WHERE owner_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(MAX_FRIEND_CIRCLES))
+
+	// act
+	circle, err := s.circleService.CreateCircle(1, "Family", nil)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, circle)
+	assert.ErrorIs(s.T(), err, ErrTooManyCircles)
+}
+
+func (s *FriendCircleServiceTestSuite) TestCreateCircle_NotFriends() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "friend_circles" WHERE owner_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	// User 3 isn't a friend, so only user 2 is found
+	s.mock.ExpectQuery(`SELECT "users"."id",.* FROM "users" JOIN user_friends`).
+		WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(2, "jane"))
+
+	// act
+	circle, err := s.circleService.CreateCircle(1, "Uni", []uint{2, 3})
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, circle)
+	assert.ErrorIs(s.T(), err, ErrNotFriends)
+}
+
+func (s *FriendCircleServiceTestSuite) TestValidateCircles_NotOwned() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "friend_circles" WHERE id IN \(\$1,\$2\) AND owner_id = \$3`).
+		WithArgs(4, 5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	// act
+	err := s.circleService.ValidateCircles(1, []uint{4, 5, 4})
+
+	// assert
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *FriendCircleServiceTestSuite) TestDeleteCircle_NotFound() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM friend_circle_members WHERE friend_circle_id IN`).
+		WithArgs(4, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(`DELETE FROM "friend_circles" WHERE id = \$1 AND owner_id = \$2`).
+		WithArgs(4, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectRollback()
+
+	// act
+	err := s.circleService.DeleteCircle(1, 4)
+
+	// assert
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *FriendCircleServiceTestSuite) TestRemoveMember_Success() {
+	// arrange
+	s.mock.ExpectExec(`DELETE FROM friend_circle_members WHERE user_id = \$1 AND friend_circle_id IN\s+\(SELECT id FROM friend_circles WHERE id = \$2 AND owner_id = \$3\)`).
+		WithArgs(2, 4, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// act
+	err := s.circleService.RemoveMember(1, 4, 2)
+
+	// assert
+	assert.NoError(s.T(), err)
+}
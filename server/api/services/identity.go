@@ -0,0 +1,76 @@
+package services
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/model"
+
+	"gorm.io/gorm"
+)
+
+type IdentityService struct {
+	DB     *gorm.DB
+	Logger *log.Entry
+}
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewIdentityService = func(db *gorm.DB) *IdentityService {
+	return &IdentityService{
+		DB:     db,
+		Logger: log.WithFields(log.Fields{"service": "IdentityService"}),
+	}
+}
+
+func (s *IdentityService) GetIdentity(provider, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	if err := s.DB.Where("provider = ? AND subject = ?", provider, subject).
+		First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (s *IdentityService) CreateIdentity(userId uint, provider, subject, email string) (*model.UserIdentity, error) {
+	identity := model.UserIdentity{
+		UserID:   userId,
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+	}
+
+	if err := s.DB.Omit("User").Create(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (s *IdentityService) GetIdentitiesByUser(userId uint) (*[]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	if err := s.DB.Where("user_id = ?", userId).
+		Order("created_at ASC").
+		Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return &identities, nil
+}
+
+func (s *IdentityService) CountIdentities(userId uint) (int64, error) {
+	var count int64
+	if err := s.DB.Model(&model.UserIdentity{}).
+		Where("user_id = ?", userId).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *IdentityService) DeleteIdentity(userId uint, identityId string) error {
+	result := s.DB.Where("id = ? AND user_id = ?", identityId, userId).Delete(&model.UserIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+)
+
+type IdentityServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	identityService *IdentityService
+}
+
+func TestIdentityServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(IdentityServiceTestSuite))
+}
+
+func (s *IdentityServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.identityService = NewIdentityService(s.DB)
+}
+
+func (s *IdentityServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *IdentityServiceTestSuite) TestGetIdentity_Success() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "user_identities" WHERE provider = \$1 AND subject = \$2 ORDER BY "user_identities"."id" LIMIT \$3`).
+		WithArgs("keycloak", "subject-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "subject", "email", "created_at"}).
+			AddRow(1, 1, "keycloak", "subject-1", "john@example.com", time.Now()))
+
+	// act
+	identity, err := s.identityService.GetIdentity("keycloak", "subject-1")
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), uint(1), identity.UserID)
+}
+
+func (s *IdentityServiceTestSuite) TestGetIdentity_NotFound() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "user_identities" WHERE provider = \$1 AND subject = \$2`).
+		WithArgs("keycloak", "subject-1", 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	// act
+	identity, err := s.identityService.GetIdentity("keycloak", "subject-1")
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, identity)
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *IdentityServiceTestSuite) TestCreateIdentity_Success() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "user_identities" \("user_id","provider","subject","email","created_at"\) VALUES \(\$1,\$2,\$3,\$4,\$5\) RETURNING "id"`).
+		WithArgs(1, "keycloak", "subject-1", "john@example.com", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	// act
+	identity, err := s.identityService.CreateIdentity(1, "keycloak", "subject-1", "john@example.com")
+
+	// assert
+	tests.AssertNoErrAndNotNil(s.T(), err, identity)
+	assert.Equal(s.T(), uint(1), identity.ID)
+}
+
+func (s *IdentityServiceTestSuite) TestGetIdentitiesByUser_Success() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "user_identities" WHERE user_id = \$1 ORDER BY created_at ASC`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "subject", "email", "created_at"}).
+			AddRow(1, 1, "google", "subject-1", "john@example.com", time.Now()).
+			AddRow(2, 1, "keycloak", "subject-2", "john@example.com", time.Now()))
+
+	// act
+	identities, err := s.identityService.GetIdentitiesByUser(1)
+
+	// assert
+	tests.AssertNoErrAndNotNil(s.T(), err, identities)
+	assert.Len(s.T(), *identities, 2)
+}
+
+func (s *IdentityServiceTestSuite) TestDeleteIdentity_Success() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "user_identities" WHERE id = \$1 AND user_id = \$2`).
+		WithArgs("2", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.identityService.DeleteIdentity(1, "2")
+
+	// assert
+	assert.NoError(s.T(), err)
+}
+
+func (s *IdentityServiceTestSuite) TestDeleteIdentity_NotOwned() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "user_identities" WHERE id = \$1 AND user_id = \$2`).
+		WithArgs("2", 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.identityService.DeleteIdentity(1, "2")
+
+	// assert
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -20,8 +21,13 @@ type KafkaService struct {
 	Admin    *kafka.AdminClient
 	Env      string
 	logger   *log.Entry
+
+	bootstrapServers string
 }
 
+// PRESENCE_TOPIC carries online and offline events from the WS server
+const PRESENCE_TOPIC = "presence"
+
 func NewKafkaService(bootstrapServers, env string) (*KafkaService, error) {
 	p, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": bootstrapServers})
 	if err != nil {
@@ -38,14 +44,21 @@ func NewKafkaService(bootstrapServers, env string) (*KafkaService, error) {
 		Admin:    a,
 		Env:      env,
 		logger:   log.WithFields(log.Fields{"service": "KafkaService"}),
+
+		bootstrapServers: bootstrapServers,
 	}, nil
 }
 
-func (ks *KafkaService) CreateTopic(topic string) error {
+// topicName adds the environment and KAFKA_TOPIC_PREFIX to a topic
+func (ks *KafkaService) topicName(topic string) string {
 	if ks.Env == "dev" || ks.Env == "staging" {
 		topic = fmt.Sprintf("%s-%s", ks.Env, topic)
 	}
-	topic = fmt.Sprintf("%s-%s", config.Config("KAFKA_TOPIC_PREFIX"), topic)
+	return fmt.Sprintf("%s-%s", config.Config("KAFKA_TOPIC_PREFIX"), topic)
+}
+
+func (ks *KafkaService) CreateTopic(topic string) error {
+	topic = ks.topicName(topic)
 
 	topicSpec := kafka.TopicSpecification{
 		Topic:             topic,
@@ -61,6 +74,20 @@ func (ks *KafkaService) CreateTopic(topic string) error {
 	return nil
 }
 
+func (ks *KafkaService) DeleteTopic(topic string) error {
+	results, err := ks.Admin.DeleteTopics(context.Background(), []string{ks.topicName(topic)})
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Error.Code() != kafka.ErrNoError && result.Error.Code() != kafka.ErrUnknownTopicOrPart {
+			return result.Error
+		}
+	}
+	return nil
+}
+
 func (ks *KafkaService) BroadcastMessage(userIds *[]string, message model_kafka.KafkaMessage) error {
 	messageJSON, err := json.Marshal(message)
 	if err != nil {
@@ -75,11 +102,7 @@ func (ks *KafkaService) BroadcastMessage(userIds *[]string, message model_kafka.
 		go func(userId string) {
 			defer wg.Done()
 
-			channel := fmt.Sprintf("user-%s", userId)
-			if ks.Env == "dev" || ks.Env == "staging" {
-				channel = fmt.Sprintf("%s-%s", ks.Env, channel)
-			}
-			channel = fmt.Sprintf("%s-%s", config.Config("KAFKA_TOPIC_PREFIX"), channel)
+			channel := ks.topicName(fmt.Sprintf("user-%s", userId))
 
 			if err := ks.PublishMessage(channel, string(messageJSON)); err != nil {
 				errorChan <- err
@@ -132,6 +155,44 @@ func (ks *KafkaService) PublishMessage(topic string, message string) error {
 	return nil
 }
 
+// Consume reads a topic as part of a consumer group, so each message is handled by one API instance.
+// It blocks until ctx is cancelled.
+func (ks *KafkaService) Consume(ctx context.Context, topic, groupId string, handler func(msg *kafka.Message)) error {
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":  ks.bootstrapServers,
+		"group.id":           ks.topicName(groupId),
+		"auto.offset.reset":  "earliest",
+		"enable.auto.commit": true,
+	})
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	if err := consumer.SubscribeTopics([]string{ks.topicName(topic)}, nil); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		msg, err := consumer.ReadMessage(time.Second)
+		if err != nil {
+			var kafkaErr kafka.Error
+			if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrTimedOut {
+				continue
+			}
+			ks.logger.Error("Error consuming message: ", err)
+			continue
+		}
+		handler(msg)
+	}
+}
+
 func (ks *KafkaService) Close() {
 	// Flush and close the producer and the events channel
 	unflushed := ks.Producer.Flush(10000)
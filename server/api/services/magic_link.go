@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	MAGIC_LINK_EXPIRY_DURATION = time.Minute * 15
+	MAGIC_LINK_RESEND_COOLDOWN = time.Minute
+)
+
+type MagicLinkService struct {
+	DB     *gorm.DB
+	Logger *log.Entry
+}
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewMagicLinkService = func(db *gorm.DB) *MagicLinkService {
+	return &MagicLinkService{
+		DB:     db,
+		Logger: log.WithFields(log.Fields{"service": "MagicLinkService"}),
+	}
+}
+
+// CreateMagicLink issues a new login link for the user, replacing any previous one.
+// Returns the raw token to be sent to the user, only its hash is stored.
+func (s *MagicLinkService) CreateMagicLink(userId uint) (string, error) {
+	db := s.DB
+	var existing model.MagicLink
+
+	err := db.Where("user_id = ?", userId).Order("created_at DESC").First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if err == nil && time.Since(existing.CreatedAt) < MAGIC_LINK_RESEND_COOLDOWN {
+		return "", errors.New("magic link recently sent")
+	}
+
+	if err := s.DeleteMagicLinks(userId); err != nil {
+		return "", err
+	}
+
+	rawToken := utils.GenerateRandomString(64)
+	magicLink := model.MagicLink{
+		UserID:    userId,
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(MAGIC_LINK_EXPIRY_DURATION),
+	}
+
+	if err := db.Omit("User").Create(&magicLink).Error; err != nil {
+		return "", err
+	}
+
+	s.Logger.Infof("Created magic link for user %d", userId)
+	return rawToken, nil
+}
+
+// ConsumeMagicLink redeems a login link, which can only succeed once per link
+func (s *MagicLinkService) ConsumeMagicLink(rawToken string) (*model.MagicLink, error) {
+	db := s.DB
+	var magicLink model.MagicLink
+
+	if err := db.Where("token_hash = ?", utils.HashToken(rawToken)).First(&magicLink).Error; err != nil {
+		return nil, err
+	}
+
+	// Only succeeds for one of any concurrent redemptions of the same link
+	result := db.Where("id = ?", magicLink.ID).Delete(&model.MagicLink{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if time.Now().After(magicLink.ExpiresAt) {
+		return nil, errors.New("magic link expired")
+	}
+
+	return &magicLink, nil
+}
+
+// DeleteMagicLinks removes the user's outstanding links, e.g. when one could not be delivered
+func (s *MagicLinkService) DeleteMagicLinks(userId uint) error {
+	return s.DB.Where("user_id = ?", userId).Delete(&model.MagicLink{}).Error
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+	"github.com/RowenTey/JustJio/server/api/utils"
+)
+
+type MagicLinkServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	magicLinkService *MagicLinkService
+}
+
+func TestMagicLinkServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(MagicLinkServiceTestSuite))
+}
+
+func (s *MagicLinkServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.magicLinkService = NewMagicLinkService(s.DB)
+}
+
+func (s *MagicLinkServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func magicLinkRows(token string, expiresAt, createdAt time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "created_at"}).
+		AddRow(1, 1, utils.HashToken(token), expiresAt, createdAt)
+}
+
+func (s *MagicLinkServiceTestSuite) TestCreateMagicLink_Success() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "magic_links" WHERE user_id = \$1 ORDER BY created_at DESC`).
+		WithArgs(1, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "magic_links" WHERE user_id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "magic_links" \("user_id","token_hash","expires_at","created_at"\)`).
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	// act
+	token, err := s.magicLinkService.CreateMagicLink(1)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), token, 64)
+}
+
+func (s *MagicLinkServiceTestSuite) TestCreateMagicLink_Cooldown() {
+	// arrange
+	now := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "magic_links" WHERE user_id = \$1`).
+		WithArgs(1, 1).
+		WillReturnRows(magicLinkRows("token", now.Add(MAGIC_LINK_EXPIRY_DURATION), now.Add(-10*time.Second)))
+
+	// act
+	token, err := s.magicLinkService.CreateMagicLink(1)
+
+	// assert
+	assert.Empty(s.T(), token)
+	assert.EqualError(s.T(), err, "magic link recently sent")
+}
+
+func (s *MagicLinkServiceTestSuite) TestConsumeMagicLink_Success() {
+	// arrange
+	now := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "magic_links" WHERE token_hash = \$1`).
+		WithArgs(utils.HashToken("token"), 1).
+		WillReturnRows(magicLinkRows("token", now.Add(time.Minute), now))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "magic_links" WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	magicLink, err := s.magicLinkService.ConsumeMagicLink("token")
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), uint(1), magicLink.UserID)
+}
+
+func (s *MagicLinkServiceTestSuite) TestConsumeMagicLink_AlreadyUsed() {
+	// arrange
+	now := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "magic_links" WHERE token_hash = \$1`).
+		WithArgs(utils.HashToken("token"), 1).
+		WillReturnRows(magicLinkRows("token", now.Add(time.Minute), now))
+
+	// A concurrent redemption deleted the link first
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "magic_links" WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	magicLink, err := s.magicLinkService.ConsumeMagicLink("token")
+
+	// assert
+	assert.Nil(s.T(), magicLink)
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *MagicLinkServiceTestSuite) TestConsumeMagicLink_Expired() {
+	// arrange
+	now := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "magic_links" WHERE token_hash = \$1`).
+		WithArgs(utils.HashToken("token"), 1).
+		WillReturnRows(magicLinkRows("token", now.Add(-time.Minute), now.Add(-MAGIC_LINK_EXPIRY_DURATION)))
+
+	// Expired links are removed too
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "magic_links" WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	magicLink, err := s.magicLinkService.ConsumeMagicLink("token")
+
+	// assert
+	assert.Nil(s.T(), magicLink)
+	assert.EqualError(s.T(), err, "magic link expired")
+}
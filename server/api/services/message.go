@@ -59,6 +59,17 @@ func (ms *MessageService) GetMessageById(msgId, roomId string) (*model.Message,
 	return &message, nil
 }
 
+// GetMessagesBySender returns every message the user sent, oldest first
+func (ms *MessageService) GetMessagesBySender(senderId uint) (*[]model.Message, error) {
+	db := ms.DB.Table("messages")
+	var messages []model.Message
+
+	if err := db.Where("sender_id = ?", senderId).Order("sent_at ASC").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return &messages, nil
+}
+
 func (ms *MessageService) DeleteMessage(msgId, roomId string) error {
 	db := ms.DB.Table("messages")
 
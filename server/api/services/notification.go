@@ -6,6 +6,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/RowenTey/JustJio/server/api/model"
+	model_push_notifications "github.com/RowenTey/JustJio/server/api/model/push_notifications"
 	"gorm.io/gorm"
 )
 
@@ -42,6 +43,34 @@ func (s *NotificationService) CreateNotification(userId uint, title, content str
 	return notification, nil
 }
 
+// NotifyUser stores a notification for the user and pushes it to all of their subscriptions.
+// Errors are only logged, since it's called after the change the notification is about.
+func (s *NotificationService) NotifyUser(
+	userId uint,
+	title, content string,
+	notificationsChan chan<- model_push_notifications.NotificationData,
+) {
+	if _, err := s.CreateNotification(userId, title, content); err != nil {
+		s.Logger.Error("Error creating notification: ", err)
+		return
+	}
+
+	subscriptionService := NewSubscriptionService(s.DB)
+	subscriptions, err := subscriptionService.GetSubscriptionsByUserID(userId)
+	if err != nil {
+		s.Logger.Error("Error getting subscriptions: ", err)
+		return
+	}
+
+	for _, sub := range *subscriptions {
+		notificationsChan <- model_push_notifications.NotificationData{
+			Subscription: subscriptionService.NewWebPushSubscriptionObj(&sub),
+			Title:        title,
+			Message:      content,
+		}
+	}
+}
+
 // MarkNotificationAsRead updates a notification's read status
 func (s *NotificationService) MarkNotificationAsRead(notificationId, userId uint) error {
 	var notification model.Notification
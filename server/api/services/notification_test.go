@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	model_push_notifications "github.com/RowenTey/JustJio/server/api/model/push_notifications"
 	"github.com/RowenTey/JustJio/server/api/tests"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -72,6 +73,45 @@ func (s *NotificationServiceTestSuite) TestCreateNotification_Success() {
 	assert.Equal(s.T(), false, result.IsRead)
 }
 
+func (s *NotificationServiceTestSuite) TestNotifyUser_PushesToSubscriptions() {
+	// arrange
+	content := "Test Content"
+	now := time.Now()
+	notificationsChan := make(chan model_push_notifications.NotificationData, 10)
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "notifications"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "content", "created_at", "is_read", "updated_at"}).
+			AddRow(1, s.userId, s.title, content, now, false, now))
+	s.mock.ExpectCommit()
+	s.mock.ExpectQuery(`SELECT \* FROM "subscriptions" WHERE user_id = \$1`).
+		WithArgs(s.userId).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "endpoint", "auth", "p256dh"}).
+			AddRow("sub-1", s.userId, "https://push.example.com/1", "auth", "key").
+			AddRow("sub-2", s.userId, "https://push.example.com/2", "auth", "key"))
+
+	// act
+	s.notificationService.NotifyUser(s.userId, s.title, content, notificationsChan)
+
+	// assert
+	assert.Len(s.T(), notificationsChan, 2)
+	data := <-notificationsChan
+	assert.Equal(s.T(), s.title, data.Title)
+	assert.Equal(s.T(), content, data.Message)
+	assert.Equal(s.T(), "https://push.example.com/1", data.Subscription.Endpoint)
+}
+
+func (s *NotificationServiceTestSuite) TestNotifyUser_NotStoredNotPushed() {
+	// arrange
+	notificationsChan := make(chan model_push_notifications.NotificationData, 10)
+
+	// act
+	s.notificationService.NotifyUser(s.userId, s.title, "", notificationsChan)
+
+	// assert
+	assert.Len(s.T(), notificationsChan, 0)
+}
+
 func (s *NotificationServiceTestSuite) TestCreateNotification_EmptyContent() {
 	// arrange
 	content := "" // Empty content
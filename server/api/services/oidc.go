@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCUser holds the verified claims of an ID token
+type OIDCUser struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+type OIDCProvider struct {
+	Name        string
+	OAuthConfig *oauth2.Config
+	Verifier    *oidc.IDTokenVerifier // nil for GitHub, which has no ID tokens
+	APIURL      string                // GitHub API serving the profile instead
+}
+
+type OIDCService struct {
+	Configs map[string]config.OIDCProviderConfig
+	Logger  *log.Entry
+}
+
+// Discovered providers are cached so the discovery document and signing keys
+// are not fetched on every login
+var (
+	oidcProviderCache   = make(map[string]*OIDCProvider)
+	oidcProviderCacheMu sync.Mutex
+)
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewOIDCService = func(configs map[string]config.OIDCProviderConfig) *OIDCService {
+	return &OIDCService{
+		Configs: configs,
+		Logger:  log.WithFields(log.Fields{"service": "OIDCService"}),
+	}
+}
+
+// GetProvider returns the named provider, running OIDC discovery against its issuer on first use
+func (s *OIDCService) GetProvider(ctx context.Context, name string) (*OIDCProvider, error) {
+	cfg, ok := s.Configs[name]
+	if !ok {
+		return nil, errors.New("unknown provider")
+	}
+
+	cacheKey := cfg.Name + "|" + cfg.IssuerURL + "|" + cfg.ClientID
+
+	oidcProviderCacheMu.Lock()
+	defer oidcProviderCacheMu.Unlock()
+
+	if provider, ok := oidcProviderCache[cacheKey]; ok {
+		return provider, nil
+	}
+
+	if cfg.Type == config.OIDC_PROVIDER_TYPE_GITHUB {
+		provider := newGitHubProvider(cfg)
+		oidcProviderCache[cacheKey] = provider
+		return provider, nil
+	}
+
+	// The provider keeps using this context to refresh its signing keys
+	discovered, err := oidc.NewProvider(context.WithoutCancel(ctx), cfg.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &OIDCProvider{
+		Name: cfg.Name,
+		OAuthConfig: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+			Endpoint:     discovered.Endpoint(),
+		},
+		Verifier: discovered.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}
+	oidcProviderCache[cacheKey] = provider
+
+	s.Logger.Info("Discovered OIDC provider ", cfg.Name, " at ", cfg.IssuerURL)
+	return provider, nil
+}
+
+// newGitHubProvider configures GitHub's OAuth2 flow, where the state alone protects the login
+// as GitHub doesn't support a nonce
+func newGitHubProvider(cfg config.OIDCProviderConfig) *OIDCProvider {
+	issuerURL := strings.TrimSuffix(cfg.IssuerURL, "/")
+	return &OIDCProvider{
+		Name: cfg.Name,
+		OAuthConfig: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  issuerURL + "/login/oauth/authorize",
+				TokenURL: issuerURL + "/login/oauth/access_token",
+			},
+		},
+		APIURL: strings.TrimSuffix(cfg.APIURL, "/"),
+	}
+}
+
+func (p *OIDCProvider) AuthCodeURL(state, nonce string) string {
+	if p.Verifier == nil {
+		return p.OAuthConfig.AuthCodeURL(state)
+	}
+	return p.OAuthConfig.AuthCodeURL(state, oidc.Nonce(nonce))
+}
+
+// Exchange trades the authorization code for tokens and verifies the ID token's
+// signature, issuer, audience, expiry and nonce.
+// For GitHub the profile is read from its API with the access token instead.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce string) (*OIDCUser, error) {
+	token, err := p.OAuthConfig.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Verifier == nil {
+		return p.fetchGitHubUser(ctx, token)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("missing id token")
+	}
+
+	idToken, err := p.Verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errors.New("invalid nonce")
+	}
+
+	var user OIDCUser
+	if err := idToken.Claims(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+type gitHubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Image string `json:"avatar_url"`
+}
+
+type gitHubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// fetchGitHubUser reads the profile and the primary email, which is only
+// reported as verified when GitHub has verified it
+func (p *OIDCProvider) fetchGitHubUser(ctx context.Context, token *oauth2.Token) (*OIDCUser, error) {
+	client := p.OAuthConfig.Client(ctx, token)
+
+	var profile gitHubUser
+	if err := getGitHubJSON(ctx, client, p.APIURL+"/user", &profile); err != nil {
+		return nil, err
+	}
+	if profile.ID == 0 {
+		return nil, errors.New("missing github user id")
+	}
+
+	var emails []gitHubEmail
+	if err := getGitHubJSON(ctx, client, p.APIURL+"/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	user := OIDCUser{
+		Subject: strconv.FormatInt(profile.ID, 10),
+		Name:    profile.Name,
+		Picture: profile.Image,
+	}
+	if user.Name == "" {
+		user.Name = profile.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			user.Email = email.Email
+			user.EmailVerified = email.Verified
+			break
+		}
+	}
+
+	return &user, nil
+}
+
+func getGitHubJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("github api returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/tests"
+)
+
+type OIDCServiceTestSuite struct {
+	suite.Suite
+	ctx          context.Context
+	mockServer   *tests.MockOIDCServer
+	githubServer *tests.MockGitHubServer
+
+	oidcService *OIDCService
+}
+
+func TestOIDCServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(OIDCServiceTestSuite))
+}
+
+func (s *OIDCServiceTestSuite) SetupTest() {
+	var err error
+	s.ctx = context.Background()
+	s.mockServer, err = tests.NewMockOIDCServer("justjio")
+	assert.NoError(s.T(), err)
+	s.githubServer = tests.NewMockGitHubServer()
+
+	s.oidcService = NewOIDCService(map[string]config.OIDCProviderConfig{
+		"mock": {
+			Name:         "mock",
+			IssuerURL:    s.mockServer.URL,
+			ClientID:     "justjio",
+			ClientSecret: "secret",
+			RedirectURL:  "http://localhost:5173/oidc/callback",
+			Scopes:       []string{"openid", "email", "profile"},
+		},
+		"github": {
+			Name:         "github",
+			Type:         config.OIDC_PROVIDER_TYPE_GITHUB,
+			IssuerURL:    s.githubServer.URL,
+			APIURL:       s.githubServer.URL,
+			ClientID:     "justjio",
+			ClientSecret: "secret",
+			RedirectURL:  "http://localhost:5173/oidc/callback",
+			Scopes:       []string{"read:user", "user:email"},
+		},
+	})
+}
+
+func (s *OIDCServiceTestSuite) TearDownTest() {
+	s.mockServer.Close()
+	s.githubServer.Close()
+}
+
+func (s *OIDCServiceTestSuite) TestGetProvider_UnknownProvider() {
+	// act
+	provider, err := s.oidcService.GetProvider(s.ctx, "unknown")
+
+	// assert
+	assert.Nil(s.T(), provider)
+	assert.EqualError(s.T(), err, "unknown provider")
+}
+
+func (s *OIDCServiceTestSuite) TestAuthCodeURL() {
+	// arrange
+	provider, err := s.oidcService.GetProvider(s.ctx, "mock")
+	assert.NoError(s.T(), err)
+
+	// act
+	authURL, err := url.Parse(provider.AuthCodeURL("state", "nonce"))
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), s.mockServer.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	assert.Equal(s.T(), "state", authURL.Query().Get("state"))
+	assert.Equal(s.T(), "nonce", authURL.Query().Get("nonce"))
+	assert.Equal(s.T(), "openid email profile", authURL.Query().Get("scope"))
+}
+
+func (s *OIDCServiceTestSuite) TestExchange_Success() {
+	// arrange
+	provider, err := s.oidcService.GetProvider(s.ctx, "mock")
+	assert.NoError(s.T(), err)
+
+	s.mockServer.IssueCode("code", jwt.MapClaims{
+		"sub":            "subject-1",
+		"email":          "john@example.com",
+		"email_verified": true,
+		"name":           "John Doe",
+		"nonce":          "nonce",
+	})
+
+	// act
+	user, err := provider.Exchange(s.ctx, "code", "nonce")
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "subject-1", user.Subject)
+	assert.Equal(s.T(), "john@example.com", user.Email)
+	assert.True(s.T(), user.EmailVerified)
+	assert.Equal(s.T(), "John Doe", user.Name)
+}
+
+func (s *OIDCServiceTestSuite) TestExchange_InvalidNonce() {
+	// arrange
+	provider, err := s.oidcService.GetProvider(s.ctx, "mock")
+	assert.NoError(s.T(), err)
+
+	s.mockServer.IssueCode("code", jwt.MapClaims{"sub": "subject-1", "nonce": "other"})
+
+	// act
+	user, err := provider.Exchange(s.ctx, "code", "nonce")
+
+	// assert
+	assert.Nil(s.T(), user)
+	assert.EqualError(s.T(), err, "invalid nonce")
+}
+
+func (s *OIDCServiceTestSuite) TestExchange_WrongAudience() {
+	// arrange
+	provider, err := s.oidcService.GetProvider(s.ctx, "mock")
+	assert.NoError(s.T(), err)
+
+	s.mockServer.IssueCode("code", jwt.MapClaims{"sub": "subject-1", "nonce": "nonce", "aud": "another-client"})
+
+	// act
+	user, err := provider.Exchange(s.ctx, "code", "nonce")
+
+	// assert
+	assert.Nil(s.T(), user)
+	assert.Error(s.T(), err)
+}
+
+func (s *OIDCServiceTestSuite) TestExchange_InvalidCode() {
+	// arrange
+	provider, err := s.oidcService.GetProvider(s.ctx, "mock")
+	assert.NoError(s.T(), err)
+
+	// act
+	user, err := provider.Exchange(s.ctx, "unknown-code", "nonce")
+
+	// assert
+	assert.Nil(s.T(), user)
+	assert.Error(s.T(), err)
+}
+
+func (s *OIDCServiceTestSuite) TestAuthCodeURL_GitHub() {
+	// arrange
+	provider, err := s.oidcService.GetProvider(s.ctx, "github")
+	assert.NoError(s.T(), err)
+
+	// act
+	authURL, err := url.Parse(provider.AuthCodeURL("state", "nonce"))
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), s.githubServer.URL+"/login/oauth/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	assert.Equal(s.T(), "state", authURL.Query().Get("state"))
+	assert.Empty(s.T(), authURL.Query().Get("nonce"))
+}
+
+func (s *OIDCServiceTestSuite) TestExchange_GitHub() {
+	// arrange
+	provider, err := s.oidcService.GetProvider(s.ctx, "github")
+	assert.NoError(s.T(), err)
+
+	s.githubServer.IssueCode("code", tests.MockGitHubUser{
+		ID:    42,
+		Login: "johndoe",
+		Emails: []map[string]any{
+			{"email": "old@example.com", "primary": false, "verified": true},
+			{"email": "john@example.com", "primary": true, "verified": false},
+		},
+	})
+
+	// act
+	user, err := provider.Exchange(s.ctx, "code", "")
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "42", user.Subject)
+	assert.Equal(s.T(), "johndoe", user.Name)
+	assert.Equal(s.T(), "john@example.com", user.Email)
+	assert.False(s.T(), user.EmailVerified)
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+)
+
+type OTPServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	otpService *OTPService
+
+	email   string
+	purpose string
+}
+
+func TestOTPServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(OTPServiceTestSuite))
+}
+
+func (s *OTPServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.otpService = NewOTPService(s.DB)
+
+	s.email = "john@example.com"
+	s.purpose = "verify-email"
+}
+
+func (s *OTPServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *OTPServiceTestSuite) otpRows(code string, attempts int, expiresAt, createdAt time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"id", "email", "purpose", "code_hash", "attempts", "expires_at", "verified_at", "created_at"}).
+		AddRow(1, s.email, s.purpose, hashOTP(s.email, s.purpose, code), attempts, expiresAt, nil, createdAt)
+}
+
+func (s *OTPServiceTestSuite) TestCreateOTP_Success() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "otps" WHERE email = \$1 AND purpose = \$2 ORDER BY "otps"."id" LIMIT \$3`).
+		WithArgs(s.email, s.purpose, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "otps" (.+) ON CONFLICT \("email","purpose"\) DO UPDATE SET`).
+		WithArgs(s.email, s.purpose, sqlmock.AnyArg(), 0, sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	// act
+	code, err := s.otpService.CreateOTP(s.email, s.purpose)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Regexp(s.T(), `^\d{6}$`, code)
+}
+
+func (s *OTPServiceTestSuite) TestCreateOTP_Cooldown() {
+	// arrange
+	now := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "otps" WHERE email = \$1 AND purpose = \$2`).
+		WithArgs(s.email, s.purpose, 1).
+		WillReturnRows(s.otpRows("123456", 0, now.Add(OTP_EXPIRY_DURATION), now.Add(-10*time.Second)))
+
+	// act
+	code, err := s.otpService.CreateOTP(s.email, s.purpose)
+
+	// assert
+	assert.EqualError(s.T(), err, "otp recently sent")
+	assert.Empty(s.T(), code)
+}
+
+func (s *OTPServiceTestSuite) TestVerifyOTP_Success() {
+	// arrange
+	now := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "otps" WHERE email = \$1 AND purpose = \$2`).
+		WithArgs(s.email, s.purpose, 1).
+		WillReturnRows(s.otpRows("123456", 0, now.Add(OTP_EXPIRY_DURATION), now))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "otps" SET "attempts"=attempts \+ 1 WHERE id = \$1 AND attempts < \$2`).
+		WithArgs(1, OTP_MAX_ATTEMPTS).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "otps" SET "verified_at"=\$1 WHERE "id" = \$2`).
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.otpService.VerifyOTP(s.email, s.purpose, "123456")
+
+	// assert
+	assert.NoError(s.T(), err)
+}
+
+func (s *OTPServiceTestSuite) TestVerifyOTP_InvalidCodeCountsAttempt() {
+	// arrange
+	now := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "otps" WHERE email = \$1 AND purpose = \$2`).
+		WithArgs(s.email, s.purpose, 1).
+		WillReturnRows(s.otpRows("123456", 0, now.Add(OTP_EXPIRY_DURATION), now))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "otps" SET "attempts"=attempts \+ 1 WHERE id = \$1 AND attempts < \$2`).
+		WithArgs(1, OTP_MAX_ATTEMPTS).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.otpService.VerifyOTP(s.email, s.purpose, "654321")
+
+	// assert
+	assert.EqualError(s.T(), err, "invalid otp")
+}
+
+func (s *OTPServiceTestSuite) TestVerifyOTP_Expired() {
+	// arrange
+	now := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "otps" WHERE email = \$1 AND purpose = \$2`).
+		WithArgs(s.email, s.purpose, 1).
+		WillReturnRows(s.otpRows("123456", 0, now.Add(-time.Minute), now.Add(-OTP_EXPIRY_DURATION)))
+
+	// act
+	err := s.otpService.VerifyOTP(s.email, s.purpose, "123456")
+
+	// assert
+	assert.EqualError(s.T(), err, "otp expired")
+}
+
+func (s *OTPServiceTestSuite) TestVerifyOTP_TooManyAttempts() {
+	// arrange
+	now := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "otps" WHERE email = \$1 AND purpose = \$2`).
+		WithArgs(s.email, s.purpose, 1).
+		WillReturnRows(s.otpRows("123456", OTP_MAX_ATTEMPTS, now.Add(OTP_EXPIRY_DURATION), now))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "otps" SET "attempts"=attempts \+ 1 WHERE id = \$1 AND attempts < \$2`).
+		WithArgs(1, OTP_MAX_ATTEMPTS).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.otpService.VerifyOTP(s.email, s.purpose, "123456")
+
+	// assert
+	assert.EqualError(s.T(), err, "too many attempts")
+}
+
+func (s *OTPServiceTestSuite) TestVerifyOTP_NotFound() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "otps" WHERE email = \$1 AND purpose = \$2`).
+		WithArgs(s.email, s.purpose, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	// act
+	err := s.otpService.VerifyOTP(s.email, s.purpose, "123456")
+
+	// assert
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *OTPServiceTestSuite) TestConsumeVerifiedOTP_Success() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "otps" WHERE \(email = \$1 AND purpose = \$2\) AND \(verified_at IS NOT NULL AND verified_at > \$3\)`).
+		WithArgs(s.email, "reset-password", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.otpService.ConsumeVerifiedOTP(s.email, "reset-password")
+
+	// assert
+	assert.NoError(s.T(), err)
+}
+
+func (s *OTPServiceTestSuite) TestConsumeVerifiedOTP_NotVerified() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "otps"`).
+		WithArgs(s.email, "reset-password", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.otpService.ConsumeVerifiedOTP(s.email, "reset-password")
+
+	// assert
+	assert.EqualError(s.T(), err, "otp not verified")
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+const (
+	WEBAUTHN_RP_NAME           = "JustJio"
+	WEBAUTHN_SESSION_EXPIRY    = time.Minute * 5
+	WEBAUTHN_CEREMONY_REGISTER = "registration"
+	WEBAUTHN_CEREMONY_LOGIN    = "login"
+	DEFAULT_PASSKEY_NAME       = "Passkey"
+)
+
+type PasskeyService struct {
+	DB        *gorm.DB
+	RPID      string
+	RPOrigins []string
+	Logger    *log.Entry
+}
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewPasskeyService = func(db *gorm.DB) *PasskeyService {
+	return &PasskeyService{
+		DB:        db,
+		RPID:      config.Config("WEBAUTHN_RP_ID"),
+		RPOrigins: strings.Split(config.Config("WEBAUTHN_RP_ORIGINS"), ","),
+		Logger:    log.WithFields(log.Fields{"service": "PasskeyService"}),
+	}
+}
+
+// passkeyUser adapts a user and their passkeys to the webauthn.User interface
+type passkeyUser struct {
+	user     *model.User
+	passkeys []model.Passkey
+}
+
+// WebAuthnID is the user handle stored on the authenticator, which identifies the user on login
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatUint(uint64(u.user.ID), 10))
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.passkeys))
+	for i, passkey := range u.passkeys {
+		credentials[i] = passkeyCredential(&passkey)
+	}
+	return credentials
+}
+
+func passkeyCredential(passkey *model.Passkey) webauthn.Credential {
+	var transports []protocol.AuthenticatorTransport
+	if passkey.Transports != "" {
+		for _, transport := range strings.Split(passkey.Transports, ",") {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+	}
+
+	return webauthn.Credential{
+		ID:              passkey.CredentialID,
+		PublicKey:       passkey.PublicKey,
+		AttestationType: passkey.AttestationType,
+		Transport:       transports,
+		Flags:           webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(passkey.Flags)),
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    passkey.AAGUID,
+			SignCount: passkey.SignCount,
+		},
+	}
+}
+
+func (s *PasskeyService) webAuthn() (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          s.RPID,
+		RPDisplayName: WEBAUTHN_RP_NAME,
+		RPOrigins:     s.RPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+}
+
+func (s *PasskeyService) GetPasskeysByUser(userId uint) (*[]model.Passkey, error) {
+	var passkeys []model.Passkey
+	if err := s.DB.Where("user_id = ?", userId).
+		Order("created_at ASC").
+		Find(&passkeys).Error; err != nil {
+		return nil, err
+	}
+	return &passkeys, nil
+}
+
+func (s *PasskeyService) CountPasskeys(userId uint) (int64, error) {
+	var count int64
+	if err := s.DB.Model(&model.Passkey{}).
+		Where("user_id = ?", userId).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// BeginRegistration starts registering a passkey for the user and returns the options for
+// navigator.credentials.create() along with the ID of the session to finish it with
+func (s *PasskeyService) BeginRegistration(user *model.User) (*protocol.CredentialCreation, string, error) {
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, "", err
+	}
+
+	passkeys, err := s.GetPasskeysByUser(user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	webAuthnUser := &passkeyUser{user: user, passkeys: *passkeys}
+
+	// Stop the same authenticator from being registered twice
+	creation, session, err := wa.BeginRegistration(webAuthnUser,
+		webauthn.WithExclusions(webauthn.Credentials(webAuthnUser.WebAuthnCredentials()).CredentialDescriptors()))
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessionId, err := s.createSession(&user.ID, WEBAUTHN_CEREMONY_REGISTER, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, sessionId, nil
+}
+
+// FinishRegistration verifies the authenticator's response and stores the new passkey
+func (s *PasskeyService) FinishRegistration(
+	user *model.User,
+	sessionId, name string,
+	response []byte,
+) (*model.Passkey, error) {
+	session, err := s.consumeSession(sessionId, &user.ID, WEBAUTHN_CEREMONY_REGISTER)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedResponse, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, errors.New("invalid passkey response")
+	}
+
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := s.GetPasskeysByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := wa.CreateCredential(&passkeyUser{user: user, passkeys: *passkeys}, *session, parsedResponse)
+	if err != nil {
+		s.Logger.Warn("Passkey registration failed: ", err)
+		return nil, errors.New("invalid passkey response")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DEFAULT_PASSKEY_NAME
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+
+	passkey := model.Passkey{
+		UserID:          user.ID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		Transports:      strings.Join(transports, ","),
+		Flags:           uint8(credential.Flags.ProtocolValue()),
+		SignCount:       credential.Authenticator.SignCount,
+		BackedUp:        credential.Flags.BackupState,
+	}
+
+	if err := s.DB.Omit("User").Create(&passkey).Error; err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+// BeginLogin starts a passkey login and returns the options for navigator.credentials.get().
+// The user isn't known yet, the authenticator lets them pick one of their passkeys.
+func (s *PasskeyService) BeginLogin() (*protocol.CredentialAssertion, string, error) {
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, "", err
+	}
+
+	assertion, session, err := wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessionId, err := s.createSession(nil, WEBAUTHN_CEREMONY_LOGIN, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, sessionId, nil
+}
+
+// FinishLogin verifies the authenticator's assertion and returns the passkey used, with its user
+func (s *PasskeyService) FinishLogin(sessionId string, response []byte) (*model.Passkey, error) {
+	session, err := s.consumeSession(sessionId, nil, WEBAUTHN_CEREMONY_LOGIN)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedResponse, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, errors.New("invalid passkey response")
+	}
+
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	var webAuthnUser *passkeyUser
+	credential, err := wa.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+		userId, err := strconv.ParseUint(string(userHandle), 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		var user model.User
+		if err := s.DB.First(&user, userId).Error; err != nil {
+			return nil, err
+		}
+
+		passkeys, err := s.GetPasskeysByUser(user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		webAuthnUser = &passkeyUser{user: &user, passkeys: *passkeys}
+		return webAuthnUser, nil
+	}, *session, parsedResponse)
+	if err != nil {
+		s.Logger.Warn("Passkey login failed: ", err)
+		return nil, errors.New("invalid passkey response")
+	}
+
+	// The counter went backwards, so the private key may have been copied
+	if credential.Authenticator.CloneWarning {
+		return nil, errors.New("passkey may be cloned")
+	}
+
+	var passkey *model.Passkey
+	for i := range webAuthnUser.passkeys {
+		if bytes.Equal(webAuthnUser.passkeys[i].CredentialID, credential.ID) {
+			passkey = &webAuthnUser.passkeys[i]
+		}
+	}
+
+	now := time.Now()
+	passkey.SignCount = credential.Authenticator.SignCount
+	passkey.BackedUp = credential.Flags.BackupState
+	passkey.LastUsedAt = &now
+	if err := s.DB.Model(&model.Passkey{}).Where("id = ?", passkey.ID).UpdateColumns(map[string]any{
+		"sign_count":   passkey.SignCount,
+		"backed_up":    passkey.BackedUp,
+		"last_used_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	passkey.User = *webAuthnUser.user
+	return passkey, nil
+}
+
+func (s *PasskeyService) RenamePasskey(userId uint, passkeyId, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name is required")
+	}
+
+	result := s.DB.Model(&model.Passkey{}).
+		Where("id = ? AND user_id = ?", passkeyId, userId).
+		Update("name", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *PasskeyService) DeletePasskey(userId uint, passkeyId string) error {
+	result := s.DB.Where("id = ? AND user_id = ?", passkeyId, userId).Delete(&model.Passkey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *PasskeyService) DeleteExpiredSessions() error {
+	return s.DB.Where("expires_at < ?", time.Now()).Delete(&model.WebAuthnSession{}).Error
+}
+
+func (s *PasskeyService) createSession(userId *uint, ceremony string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	webAuthnSession := model.WebAuthnSession{
+		ID:        utils.CreateULID().String(),
+		UserID:    userId,
+		Ceremony:  ceremony,
+		Data:      data,
+		ExpiresAt: time.Now().Add(WEBAUTHN_SESSION_EXPIRY),
+	}
+	if err := s.DB.Create(&webAuthnSession).Error; err != nil {
+		return "", err
+	}
+	return webAuthnSession.ID, nil
+}
+
+// consumeSession deletes the ceremony's session and returns its data, as long as it was
+// started by the same user for the same ceremony and hasn't expired
+func (s *PasskeyService) consumeSession(sessionId string, userId *uint, ceremony string) (*webauthn.SessionData, error) {
+	var webAuthnSession model.WebAuthnSession
+	if err := s.DB.Where("id = ? AND ceremony = ?", sessionId, ceremony).
+		First(&webAuthnSession).Error; err != nil {
+		return nil, err
+	}
+	if (userId == nil) != (webAuthnSession.UserID == nil) ||
+		(userId != nil && *userId != *webAuthnSession.UserID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	// Only succeeds for one of any concurrent responses to the same challenge
+	result := s.DB.Where("id = ?", webAuthnSession.ID).Delete(&model.WebAuthnSession{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if time.Now().After(webAuthnSession.ExpiresAt) {
+		return nil, errors.New("passkey session expired")
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(webAuthnSession.Data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+)
+
+const (
+	testRPID   = "justjio.test"
+	testOrigin = "https://justjio.test"
+)
+
+type PasskeyServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	passkeyService *PasskeyService
+	authenticator  *tests.SoftwareAuthenticator
+}
+
+func TestPasskeyServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(PasskeyServiceTestSuite))
+}
+
+func (s *PasskeyServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.passkeyService = NewPasskeyService(s.DB)
+	s.passkeyService.RPID = testRPID
+	s.passkeyService.RPOrigins = []string{testOrigin}
+
+	s.authenticator, err = tests.NewSoftwareAuthenticator(testRPID, testOrigin)
+	assert.NoError(s.T(), err)
+}
+
+func (s *PasskeyServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+// capture matches any argument and remembers it, so a stored session can be read back
+type capture struct {
+	value driver.Value
+}
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func passkeyRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "name", "credential_id", "public_key", "flags", "sign_count"})
+}
+
+func (s *PasskeyServiceTestSuite) expectCreateSession(userId driver.Value, ceremony string, data *capture) {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`INSERT INTO "web_authn_sessions" \("id","user_id","ceremony","data","expires_at"\)`).
+		WithArgs(sqlmock.AnyArg(), userId, ceremony, data, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+}
+
+func (s *PasskeyServiceTestSuite) expectConsumeSession(sessionId string, userId driver.Value, ceremony string, data *capture) {
+	s.mock.ExpectQuery(`SELECT \* FROM "web_authn_sessions" WHERE id = \$1 AND ceremony = \$2`).
+		WithArgs(sessionId, ceremony, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "ceremony", "data", "expires_at"}).
+			AddRow(sessionId, userId, ceremony, data.value, time.Now().Add(time.Minute)))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "web_authn_sessions" WHERE id = \$1`).
+		WithArgs(sessionId).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+}
+
+func (s *PasskeyServiceTestSuite) TestRegistration_Success() {
+	// arrange
+	user := tests.CreateTestUser(1, "John", "john@example.com")
+	sessionData := &capture{}
+
+	s.mock.ExpectQuery(`SELECT \* FROM "passkeys" WHERE user_id = \$1 ORDER BY created_at ASC`).
+		WithArgs(user.ID).
+		WillReturnRows(passkeyRows())
+	s.expectCreateSession(user.ID, WEBAUTHN_CEREMONY_REGISTER, sessionData)
+
+	// act
+	creation, sessionId, err := s.passkeyService.BeginRegistration(user)
+	assert.NoError(s.T(), err)
+
+	response, err := s.authenticator.Register(creation.Response.Challenge.String(),
+		creation.Response.User.ID.(protocol.URLEncodedBase64).String())
+	assert.NoError(s.T(), err)
+
+	s.expectConsumeSession(sessionId, user.ID, WEBAUTHN_CEREMONY_REGISTER, sessionData)
+	s.mock.ExpectQuery(`SELECT \* FROM "passkeys" WHERE user_id = \$1`).
+		WithArgs(user.ID).
+		WillReturnRows(passkeyRows())
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "passkeys"`).
+		WithArgs(user.ID, "Laptop", s.authenticator.CredentialID, sqlmock.AnyArg(), "none", sqlmock.AnyArg(),
+			"internal", sqlmock.AnyArg(), 0, false, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	passkey, err := s.passkeyService.FinishRegistration(user, sessionId, " Laptop ", response)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "Laptop", passkey.Name)
+	assert.Equal(s.T(), s.authenticator.CredentialID, passkey.CredentialID)
+}
+
+func (s *PasskeyServiceTestSuite) TestRegistration_WrongOrigin() {
+	// arrange
+	user := tests.CreateTestUser(1, "John", "john@example.com")
+	sessionData := &capture{}
+	s.authenticator.Origin = "https://evil.test"
+
+	s.mock.ExpectQuery(`SELECT \* FROM "passkeys" WHERE user_id = \$1`).
+		WithArgs(user.ID).
+		WillReturnRows(passkeyRows())
+	s.expectCreateSession(user.ID, WEBAUTHN_CEREMONY_REGISTER, sessionData)
+
+	creation, sessionId, err := s.passkeyService.BeginRegistration(user)
+	assert.NoError(s.T(), err)
+
+	response, err := s.authenticator.Register(creation.Response.Challenge.String(),
+		creation.Response.User.ID.(protocol.URLEncodedBase64).String())
+	assert.NoError(s.T(), err)
+
+	s.expectConsumeSession(sessionId, user.ID, WEBAUTHN_CEREMONY_REGISTER, sessionData)
+	s.mock.ExpectQuery(`SELECT \* FROM "passkeys" WHERE user_id = \$1`).
+		WithArgs(user.ID).
+		WillReturnRows(passkeyRows())
+
+	// act
+	passkey, err := s.passkeyService.FinishRegistration(user, sessionId, "", response)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, passkey)
+	assert.EqualError(s.T(), err, "invalid passkey response")
+}
+
+func (s *PasskeyServiceTestSuite) TestLogin_Success() {
+	// arrange
+	sessionData := &capture{}
+	s.authenticator.UserHandle = []byte("1")
+	s.authenticator.SignCount = 4
+	publicKey, err := s.authenticator.PublicKey()
+	assert.NoError(s.T(), err)
+
+	s.expectCreateSession(nil, WEBAUTHN_CEREMONY_LOGIN, sessionData)
+
+	// act
+	assertion, sessionId, err := s.passkeyService.BeginLogin()
+	assert.NoError(s.T(), err)
+
+	response, err := s.authenticator.Login(assertion.Response.Challenge.String())
+	assert.NoError(s.T(), err)
+
+	s.expectConsumeSession(sessionId, nil, WEBAUTHN_CEREMONY_LOGIN, sessionData)
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(1, "John"))
+	s.mock.ExpectQuery(`SELECT \* FROM "passkeys" WHERE user_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(passkeyRows().AddRow(7, 1, "Laptop", s.authenticator.CredentialID, publicKey, 0x05, 4))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "passkeys" SET "backed_up"=\$1,"last_used_at"=\$2,"sign_count"=\$3 WHERE id = \$4`).
+		WithArgs(false, sqlmock.AnyArg(), 5, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	passkey, err := s.passkeyService.FinishLogin(sessionId, response)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), uint(7), passkey.ID)
+	assert.Equal(s.T(), "John", passkey.User.Username)
+	assert.Equal(s.T(), uint32(5), passkey.SignCount)
+}
+
+func (s *PasskeyServiceTestSuite) TestLogin_ClonedAuthenticator() {
+	// arrange
+	sessionData := &capture{}
+	s.authenticator.UserHandle = []byte("1")
+	publicKey, err := s.authenticator.PublicKey()
+	assert.NoError(s.T(), err)
+
+	s.expectCreateSession(nil, WEBAUTHN_CEREMONY_LOGIN, sessionData)
+
+	assertion, sessionId, err := s.passkeyService.BeginLogin()
+	assert.NoError(s.T(), err)
+
+	response, err := s.authenticator.Login(assertion.Response.Challenge.String())
+	assert.NoError(s.T(), err)
+
+	// The server has already seen a higher counter than the authenticator's
+	s.expectConsumeSession(sessionId, nil, WEBAUTHN_CEREMONY_LOGIN, sessionData)
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(1, "John"))
+	s.mock.ExpectQuery(`SELECT \* FROM "passkeys" WHERE user_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(passkeyRows().AddRow(7, 1, "Laptop", s.authenticator.CredentialID, publicKey, 0x05, 10))
+
+	// act
+	passkey, err := s.passkeyService.FinishLogin(sessionId, response)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, passkey)
+	assert.EqualError(s.T(), err, "passkey may be cloned")
+}
+
+func (s *PasskeyServiceTestSuite) TestFinishLogin_SessionNotFound() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "web_authn_sessions" WHERE id = \$1 AND ceremony = \$2`).
+		WithArgs("session", WEBAUTHN_CEREMONY_LOGIN, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	// act
+	passkey, err := s.passkeyService.FinishLogin("session", []byte("{}"))
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, passkey)
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *PasskeyServiceTestSuite) TestRenamePasskey_NameRequired() {
+	// act
+	err := s.passkeyService.RenamePasskey(1, "1", " ")
+
+	// assert
+	assert.EqualError(s.T(), err, "name is required")
+}
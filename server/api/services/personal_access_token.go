@@ -0,0 +1,176 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Lets the auth middleware tell personal access tokens apart from JWTs
+	PERSONAL_ACCESS_TOKEN_PREFIX = "jjpat_"
+	MAX_PERSONAL_ACCESS_TOKENS   = 20
+	// Last use is only written once per interval so busy scripts don't write on every request
+	PERSONAL_ACCESS_TOKEN_TOUCH_INTERVAL = time.Minute
+)
+
+// Scopes a personal access token can be granted
+const (
+	SCOPE_ROOMS_READ         = "rooms:read"
+	SCOPE_ROOMS_WRITE        = "rooms:write"
+	SCOPE_MESSAGES_READ      = "messages:read"
+	SCOPE_MESSAGES_WRITE     = "messages:write"
+	SCOPE_BILLS_READ         = "bills:read"
+	SCOPE_BILLS_WRITE        = "bills:write"
+	SCOPE_TRANSACTIONS_READ  = "transactions:read"
+	SCOPE_TRANSACTIONS_WRITE = "transactions:write"
+	SCOPE_USERS_READ         = "users:read"
+	SCOPE_USERS_WRITE        = "users:write"
+)
+
+var PERSONAL_ACCESS_TOKEN_SCOPES = []string{
+	SCOPE_ROOMS_READ,
+	SCOPE_ROOMS_WRITE,
+	SCOPE_MESSAGES_READ,
+	SCOPE_MESSAGES_WRITE,
+	SCOPE_BILLS_READ,
+	SCOPE_BILLS_WRITE,
+	SCOPE_TRANSACTIONS_READ,
+	SCOPE_TRANSACTIONS_WRITE,
+	SCOPE_USERS_READ,
+	SCOPE_USERS_WRITE,
+}
+
+type PersonalAccessTokenService struct {
+	DB     *gorm.DB
+	Logger *log.Entry
+}
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewPersonalAccessTokenService = func(db *gorm.DB) *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{
+		DB:     db,
+		Logger: log.WithFields(log.Fields{"service": "PersonalAccessTokenService"}),
+	}
+}
+
+func IsPersonalAccessToken(rawToken string) bool {
+	return strings.HasPrefix(rawToken, PERSONAL_ACCESS_TOKEN_PREFIX)
+}
+
+// CreateToken stores a new personal access token and returns the raw value, only its hash is persisted
+func (s *PersonalAccessTokenService) CreateToken(
+	userId uint,
+	name string,
+	scopes []string,
+	expiresAt *time.Time,
+) (string, *model.PersonalAccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, errors.New("name is required")
+	}
+
+	if len(scopes) == 0 {
+		return "", nil, errors.New("invalid scope")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(PERSONAL_ACCESS_TOKEN_SCOPES, scope) {
+			return "", nil, errors.New("invalid scope")
+		}
+	}
+	slices.Sort(scopes)
+	scopesJSON, err := json.Marshal(slices.Compact(scopes))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var count int64
+	if err := s.DB.Model(&model.PersonalAccessToken{}).
+		Where("user_id = ?", userId).
+		Count(&count).Error; err != nil {
+		return "", nil, err
+	}
+	if count >= MAX_PERSONAL_ACCESS_TOKENS {
+		return "", nil, errors.New("too many tokens")
+	}
+
+	rawToken := PERSONAL_ACCESS_TOKEN_PREFIX + utils.GenerateRandomString(40)
+	token := model.PersonalAccessToken{
+		UserID:    userId,
+		Name:      name,
+		TokenHash: utils.HashToken(rawToken),
+		Scopes:    scopesJSON,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := s.DB.Omit("User").Create(&token).Error; err != nil {
+		return "", nil, err
+	}
+	return rawToken, &token, nil
+}
+
+func (s *PersonalAccessTokenService) GetTokensByUser(userId uint) (*[]model.PersonalAccessToken, error) {
+	var tokens []model.PersonalAccessToken
+	if err := s.DB.Where("user_id = ?", userId).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return &tokens, nil
+}
+
+// DeleteToken revokes a personal access token, it stops working immediately
+func (s *PersonalAccessTokenService) DeleteToken(userId uint, tokenId string) error {
+	result := s.DB.Where("id = ? AND user_id = ?", tokenId, userId).Delete(&model.PersonalAccessToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Authenticate looks up the token along with its user and records that it was used
+func (s *PersonalAccessTokenService) Authenticate(rawToken, ipAddress string) (*model.PersonalAccessToken, error) {
+	var token model.PersonalAccessToken
+	if err := s.DB.Preload("User").
+		Where("token_hash = ?", utils.HashToken(rawToken)).
+		First(&token).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, errors.New("token expired")
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= PERSONAL_ACCESS_TOKEN_TOUCH_INTERVAL {
+		if err := s.DB.Model(&model.PersonalAccessToken{}).Where("id = ?", token.ID).UpdateColumns(map[string]any{
+			"last_used_at": now,
+			"last_used_ip": ipAddress,
+		}).Error; err != nil {
+			// Not worth failing the request over
+			s.Logger.Error("Error recording use of token ", token.ID, ": ", err)
+		}
+	}
+
+	return &token, nil
+}
+
+func (s *PersonalAccessTokenService) GetScopes(token *model.PersonalAccessToken) ([]string, error) {
+	var scopes []string
+	if err := json.Unmarshal(token.Scopes, &scopes); err != nil {
+		return nil, err
+	}
+	return scopes, nil
+}
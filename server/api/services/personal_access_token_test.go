@@ -0,0 +1,154 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+	"github.com/RowenTey/JustJio/server/api/utils"
+)
+
+type PersonalAccessTokenServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	patService *PersonalAccessTokenService
+}
+
+func TestPersonalAccessTokenServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(PersonalAccessTokenServiceTestSuite))
+}
+
+func (s *PersonalAccessTokenServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.patService = NewPersonalAccessTokenService(s.DB)
+}
+
+func (s *PersonalAccessTokenServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func patRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "name", "token_hash", "scopes", "last_used_at", "expires_at"})
+}
+
+func (s *PersonalAccessTokenServiceTestSuite) TestCreateToken_Success() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "personal_access_tokens" WHERE user_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "personal_access_tokens" \("user_id","name","token_hash","scopes","last_used_at","last_used_ip","expires_at","created_at"\)`).
+		WithArgs(1, "bill bot", sqlmock.AnyArg(), `["bills:write","messages:write"]`,
+			nil, "", nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	// act
+	rawToken, token, err := s.patService.CreateToken(1, " bill bot ",
+		[]string{SCOPE_MESSAGES_WRITE, SCOPE_BILLS_WRITE, SCOPE_BILLS_WRITE}, nil)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), IsPersonalAccessToken(rawToken))
+	assert.Equal(s.T(), utils.HashToken(rawToken), token.TokenHash)
+	assert.Equal(s.T(), uint(1), token.ID)
+}
+
+func (s *PersonalAccessTokenServiceTestSuite) TestCreateToken_InvalidScope() {
+	// act
+	rawToken, token, err := s.patService.CreateToken(1, "bot", []string{"admin"}, nil)
+
+	// assert
+	assert.Empty(s.T(), rawToken)
+	tests.AssertErrAndNil(s.T(), err, token)
+	assert.EqualError(s.T(), err, "invalid scope")
+}
+
+func (s *PersonalAccessTokenServiceTestSuite) TestCreateToken_TooManyTokens() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "personal_access_tokens" WHERE user_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(MAX_PERSONAL_ACCESS_TOKENS))
+
+	// act
+	_, token, err := s.patService.CreateToken(1, "bot", []string{SCOPE_BILLS_READ}, nil)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, token)
+	assert.EqualError(s.T(), err, "too many tokens")
+}
+
+func (s *PersonalAccessTokenServiceTestSuite) TestAuthenticate_RecordsLastUse() {
+	// arrange
+	rawToken := PERSONAL_ACCESS_TOKEN_PREFIX + "token"
+
+	s.mock.ExpectQuery(`SELECT \* FROM "personal_access_tokens" WHERE token_hash = \$1`).
+		WithArgs(utils.HashToken(rawToken), 1).
+		WillReturnRows(patRows().AddRow(1, 1, "bot", utils.HashToken(rawToken), `["bills:read"]`, nil, nil))
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(1, "John"))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "personal_access_tokens" SET "last_used_at"=\$1,"last_used_ip"=\$2 WHERE id = \$3`).
+		WithArgs(sqlmock.AnyArg(), "127.0.0.1", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	token, err := s.patService.Authenticate(rawToken, "127.0.0.1")
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "John", token.User.Username)
+
+	scopes, err := s.patService.GetScopes(token)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{SCOPE_BILLS_READ}, scopes)
+}
+
+func (s *PersonalAccessTokenServiceTestSuite) TestAuthenticate_Expired() {
+	// arrange
+	rawToken := PERSONAL_ACCESS_TOKEN_PREFIX + "token"
+
+	s.mock.ExpectQuery(`SELECT \* FROM "personal_access_tokens" WHERE token_hash = \$1`).
+		WithArgs(utils.HashToken(rawToken), 1).
+		WillReturnRows(patRows().AddRow(1, 1, "bot", utils.HashToken(rawToken), `["bills:read"]`,
+			nil, time.Now().Add(-time.Minute)))
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	// act
+	token, err := s.patService.Authenticate(rawToken, "127.0.0.1")
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, token)
+	assert.EqualError(s.T(), err, "token expired")
+}
+
+func (s *PersonalAccessTokenServiceTestSuite) TestDeleteToken_NotFound() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "personal_access_tokens" WHERE id = \$1 AND user_id = \$2`).
+		WithArgs("1", 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.patService.DeleteToken(1, "1")
+
+	// assert
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
@@ -63,6 +63,23 @@ func (rs *RoomService) GetRooms(userId string, page int) (*[]model.Room, error)
 	return &rooms, nil
 }
 
+// GetAllRooms returns every room the user attends or attended, including closed ones
+func (rs *RoomService) GetAllRooms(userId string) (*[]model.Room, error) {
+	db := rs.DB
+	var rooms []model.Room
+
+	if err := db.
+		Model(&model.Room{}).
+		Joins("JOIN room_users ON rooms.id = room_users.room_id").
+		Where("room_users.user_id = ?", userId).
+		Order("rooms.created_at DESC").
+		Find(&rooms).Error; err != nil {
+		return nil, err
+	}
+
+	return &rooms, nil
+}
+
 func (rs *RoomService) GetNumRooms(userId string) (int64, error) {
 	db := rs.DB
 	var count int64
@@ -103,6 +120,21 @@ func (rs *RoomService) GetRoomInvites(userId string) (*[]model.RoomInvite, error
 	return &invites, nil
 }
 
+// GetAllRoomInvites returns every invite the user sent or received, in any status
+func (rs *RoomService) GetAllRoomInvites(userId string) (*[]model.RoomInvite, error) {
+	db := rs.DB.Table("room_invites")
+	var invites []model.RoomInvite
+
+	if err := db.
+		Preload("Room").
+		Where("user_id = ? OR inviter_id = ?", userId, userId).
+		Order("created_at DESC").
+		Find(&invites).Error; err != nil {
+		return nil, err
+	}
+	return &invites, nil
+}
+
 func (rs *RoomService) GetNumRoomInvites(userId string) (int64, error) {
 	db := rs.DB.Table("room_invites")
 	var count int64
@@ -295,6 +327,17 @@ func (rs *RoomService) InviteUserToRoom(
 		if count > 0 {
 			return nil, errors.New("user already has pending invite")
 		}
+
+		// Check if either user has blocked the other
+		if err := rs.DB.Model(&model.UserBlock{}).
+			Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)",
+				user.ID, inviter.ID, inviter.ID, user.ID).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, errors.New("user cannot be invited")
+		}
 	}
 
 	for _, user := range *users {
@@ -326,20 +369,27 @@ func (rs *RoomService) RemoveUserFromRoom(roomId string, userId string) error {
 	return nil
 }
 
-func (rs *RoomService) GetUninvitedFriendsForRoom(roomId string, userId string) (*[]model.User, error) {
+// GetUninvitedFriendsForRoom returns the user's friends who aren't in the room and don't have a pending invite.
+// With circleIds, only members of those circles of the user are returned.
+func (rs *RoomService) GetUninvitedFriendsForRoom(roomId string, userId string, circleIds []uint) (*[]model.User, error) {
 	db := rs.DB
 	var friends []model.User
 
 	// Get friends who are not in the room and don't have pending invites
-	if err := db.
+	query := db.
 		Distinct("users.*").
 		Table("users").
 		Joins("JOIN user_friends ON (user_friends.friend_id = ? AND user_friends.user_id = users.id)", userId).
 		// Exclude users already in room
 		Where("users.id NOT IN (SELECT user_id FROM room_users WHERE room_id = ?)", roomId).
 		// Exclude users with pending invites
-		Where("users.id NOT IN (SELECT user_id FROM room_invites WHERE room_id = ? AND status = 'pending')", roomId).
-		Find(&friends).Error; err != nil {
+		Where("users.id NOT IN (SELECT user_id FROM room_invites WHERE room_id = ? AND status = 'pending')", roomId)
+	if len(circleIds) > 0 {
+		query = query.Where(`users.id IN (SELECT friend_circle_members.user_id FROM friend_circle_members
+			JOIN friend_circles ON friend_circles.id = friend_circle_members.friend_circle_id
+			WHERE friend_circles.owner_id = ? AND friend_circles.id IN ?)`, userId, circleIds)
+	}
+	if err := query.Find(&friends).Error; err != nil {
 		return nil, err
 	}
 
@@ -681,6 +681,11 @@ func (s *RoomServiceTestSuite) TestInviteUserToRoom_Success() {
 		WithArgs(roomID, uint(2), "pending").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 
+	// Check if user2 and the host have blocked each other
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks" WHERE \(blocker_id = \$1 AND blocked_id = \$2\) OR \(blocker_id = \$3 AND blocked_id = \$4\)`).
+		WithArgs(uint(2), uint(1), uint(1), uint(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
 	// Check if user3 is already in room
 	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "rooms" JOIN room_users ON rooms.id = room_users.room_id WHERE rooms.id = \$1 AND room_users.user_id = \$2`).
 		WithArgs(roomID, uint(3)).
@@ -691,6 +696,11 @@ func (s *RoomServiceTestSuite) TestInviteUserToRoom_Success() {
 		WithArgs(roomID, uint(3), "pending").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 
+	// Check if user3 and the host have blocked each other
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks" WHERE \(blocker_id = \$1 AND blocked_id = \$2\) OR \(blocker_id = \$3 AND blocked_id = \$4\)`).
+		WithArgs(uint(3), uint(1), uint(1), uint(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
 	// Create room invites
 	s.mock.ExpectBegin()
 	s.mock.ExpectQuery(`INSERT INTO "room_invites"`).
@@ -794,6 +804,51 @@ func (s *RoomServiceTestSuite) TestInviteUserToRoom_UserAlreadyInvited() {
 	assert.Contains(s.T(), err.Error(), "user already has pending invite")
 }
 
+func (s *RoomServiceTestSuite) TestInviteUserToRoom_Blocked() {
+	// arrange
+	roomID := "1"
+	now := time.Now()
+	inviter := tests.CreateTestUser(1, "hostuser", "host@test.com")
+	users := []model.User{
+		*tests.CreateTestUser(2, "user2", "user2@test.com"),
+	}
+	message := "Please join my room!"
+
+	// Find room
+	roomRows := sqlmock.NewRows([]string{
+		"id", "name", "time", "venue", "date", "host_id",
+		"attendees_count", "created_at", "updated_at", "is_closed",
+	}).AddRow(
+		roomID, "Test Room", "2:00 PM", "Test Venue", now, inviter.ID,
+		1, now, now, false,
+	)
+
+	s.mock.ExpectQuery(`SELECT \* FROM "rooms" WHERE id = \$1 ORDER BY "rooms"."id" LIMIT \$2`).
+		WithArgs(roomID, 1).
+		WillReturnRows(roomRows)
+
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "rooms" JOIN room_users ON rooms.id = room_users.room_id WHERE rooms.id = \$1 AND room_users.user_id = \$2`).
+		WithArgs(roomID, uint(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "room_invites" WHERE room_id = \$1 AND user_id = \$2 AND status = \$3`).
+		WithArgs(roomID, uint(2), "pending").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	// user2 has blocked the host
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks" WHERE \(blocker_id = \$1 AND blocked_id = \$2\) OR \(blocker_id = \$3 AND blocked_id = \$4\)`).
+		WithArgs(uint(2), uint(1), uint(1), uint(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	// act
+	invites, err := s.roomService.InviteUserToRoom(roomID, inviter, &users, message)
+
+	// assert
+	assert.Error(s.T(), err)
+	assert.Nil(s.T(), invites)
+	assert.Equal(s.T(), "user cannot be invited", err.Error())
+}
+
 func (s *RoomServiceTestSuite) TestInviteUserToRoom_NotHost() {
 	// arrange
 	roomID := "1"
@@ -891,7 +946,7 @@ func (s *RoomServiceTestSuite) TestGetUninvitedFriendsForRoom_Success() {
 		WillReturnRows(friendRows)
 
 	// act
-	friends, err := s.roomService.GetUninvitedFriendsForRoom(roomID, userID)
+	friends, err := s.roomService.GetUninvitedFriendsForRoom(roomID, userID, nil)
 
 	// assert
 	assert.NoError(s.T(), err)
@@ -901,6 +956,24 @@ func (s *RoomServiceTestSuite) TestGetUninvitedFriendsForRoom_Success() {
 	assert.Equal(s.T(), expectedFriends[1].ID, (*friends)[1].ID)
 }
 
+func (s *RoomServiceTestSuite) TestGetUninvitedFriendsForRoom_InCircles() {
+	// arrange
+	roomID := "1"
+	userID := "1"
+
+	s.mock.ExpectQuery(`SELECT DISTINCT users.\* FROM "users" JOIN user_friends .* WHERE .* AND \(users.id IN \(SELECT friend_circle_members.user_id FROM friend_circle_members\s+JOIN friend_circles ON friend_circles.id = friend_circle_members.friend_circle_id\s+WHERE friend_circles.owner_id = \$4 AND friend_circles.id IN \(\$5,\$6\)\)\)`).
+		WithArgs(userID, roomID, roomID, userID, 4, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(2, "friend1"))
+
+	// act
+	friends, err := s.roomService.GetUninvitedFriendsForRoom(roomID, userID, []uint{4, 5})
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), *friends, 1)
+	assert.Equal(s.T(), "friend1", (*friends)[0].Username)
+}
+
 func (s *RoomServiceTestSuite) TestGetUninvitedFriendsForRoom_NoFriends() {
 	// arrange
 	roomID := "1"
@@ -920,7 +993,7 @@ func (s *RoomServiceTestSuite) TestGetUninvitedFriendsForRoom_NoFriends() {
 		WillReturnRows(friendRows)
 
 	// act
-	friends, err := s.roomService.GetUninvitedFriendsForRoom(roomID, userID)
+	friends, err := s.roomService.GetUninvitedFriendsForRoom(roomID, userID, nil)
 
 	// assert
 	assert.NoError(s.T(), err)
@@ -46,6 +46,7 @@ func SeedDB(db *gorm.DB) error {
 			return err
 		}
 		u.Password = hashedPassword
+		u.HasPassword = true
 
 		createdUser, err := userService.CreateOrUpdateUser(&u, true)
 		if err != nil {
@@ -65,7 +66,7 @@ func SeedDB(db *gorm.DB) error {
 				continue
 			}
 
-			err := userService.SendFriendRequest(u.ID, f.ID)
+			_, err := userService.SendFriendRequest(u.ID, f.ID)
 			if err != nil {
 				logger.Warn("Error sending friend request: ", err)
 				continue
@@ -80,7 +81,7 @@ func SeedDB(db *gorm.DB) error {
 		}
 
 		for _, r := range *requests {
-			err := userService.AcceptFriendRequest(r.ID)
+			_, err := userService.AcceptFriendRequest(u.ID, r.ID)
 			if err != nil {
 				logger.Warn("Error accepting friend request: ", err)
 				continue
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SIGNING_KEY_ALGORITHM         = "RS256"
+	SIGNING_KEY_BITS              = 2048
+	SIGNING_KEY_ROTATION_INTERVAL = time.Hour * 24 * 30
+	// Keys stay published until every token they signed has expired
+	SIGNING_KEY_GRACE_PERIOD = ACCESS_TOKEN_EXPIRY_DURATION + time.Minute*5
+	// How long loaded keys are reused before checking the database for rotations
+	SIGNING_KEY_CACHE_TTL = time.Minute
+	// Minimum gap between reloads triggered by an unknown key ID
+	SIGNING_KEY_MIN_RELOAD_INTERVAL = time.Second * 10
+)
+
+type SigningKeyPair struct {
+	ID         string
+	PrivateKey *rsa.PrivateKey
+}
+
+type PublicSigningKey struct {
+	ID        string
+	PublicKey *rsa.PublicKey
+	ExpiresAt time.Time
+}
+
+// JWK is the JSON Web Key representation of a public signing key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type SigningKeyService struct {
+	DB            *gorm.DB
+	EncryptionKey string
+	Logger        *log.Entry
+}
+
+type signingKeyCache struct {
+	current    *SigningKeyPair
+	rotatesAt  time.Time
+	publicKeys map[string]*PublicSigningKey
+	loadedAt   time.Time
+}
+
+// Keys are shared by all replicas through the database and cached in memory
+// so verifying a token doesn't need a query
+var (
+	signingKeys   signingKeyCache
+	signingKeysMu sync.Mutex
+)
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewSigningKeyService = func(db *gorm.DB) *SigningKeyService {
+	return &SigningKeyService{
+		DB:            db,
+		EncryptionKey: config.Config("JWT_SECRET"),
+		Logger:        log.WithFields(log.Fields{"service": "SigningKeyService"}),
+	}
+}
+
+// GetSigningKey returns the key new access tokens should be signed with,
+// creating a new one when the current key is due for rotation
+func (s *SigningKeyService) GetSigningKey() (*SigningKeyPair, error) {
+	signingKeysMu.Lock()
+	defer signingKeysMu.Unlock()
+
+	now := time.Now()
+	if signingKeys.current != nil && now.Before(signingKeys.rotatesAt) &&
+		now.Sub(signingKeys.loadedAt) < SIGNING_KEY_CACHE_TTL {
+		return signingKeys.current, nil
+	}
+
+	if err := s.loadKeys(); err != nil {
+		return nil, err
+	}
+
+	if signingKeys.current == nil {
+		key, pair, err := s.createKey()
+		if err != nil {
+			return nil, err
+		}
+
+		signingKeys.current = pair
+		signingKeys.rotatesAt = key.RotatesAt
+		signingKeys.publicKeys[key.ID] = &PublicSigningKey{
+			ID:        key.ID,
+			PublicKey: &pair.PrivateKey.PublicKey,
+			ExpiresAt: key.ExpiresAt,
+		}
+	}
+
+	return signingKeys.current, nil
+}
+
+// GetPublicKey returns the public key for a key ID, reloading from the database when the
+// ID is unknown in case another replica has rotated
+func (s *SigningKeyService) GetPublicKey(kid string) (*rsa.PublicKey, error) {
+	signingKeysMu.Lock()
+	defer signingKeysMu.Unlock()
+
+	now := time.Now()
+	if key, ok := signingKeys.publicKeys[kid]; ok &&
+		now.Before(key.ExpiresAt) && now.Sub(signingKeys.loadedAt) < SIGNING_KEY_CACHE_TTL {
+		return key.PublicKey, nil
+	}
+
+	if now.Sub(signingKeys.loadedAt) >= SIGNING_KEY_MIN_RELOAD_INTERVAL {
+		if err := s.loadKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	key, ok := signingKeys.publicKeys[kid]
+	if !ok || now.After(key.ExpiresAt) {
+		return nil, errors.New("unknown signing key")
+	}
+	return key.PublicKey, nil
+}
+
+// GetJWKS returns all public keys that may still have valid tokens signed with them
+func (s *SigningKeyService) GetJWKS() ([]JWK, error) {
+	// Make sure there is a key to publish before the first token is issued
+	if _, err := s.GetSigningKey(); err != nil {
+		return nil, err
+	}
+
+	signingKeysMu.Lock()
+	defer signingKeysMu.Unlock()
+
+	jwks := make([]JWK, 0, len(signingKeys.publicKeys))
+	for _, key := range signingKeys.publicKeys {
+		jwks = append(jwks, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: SIGNING_KEY_ALGORITHM,
+			Kid: key.ID,
+			N:   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		})
+	}
+	return jwks, nil
+}
+
+// DeleteExpiredKeys removes keys that can no longer have valid tokens signed with them
+func (s *SigningKeyService) DeleteExpiredKeys() error {
+	return s.DB.Where("expires_at < ?", time.Now()).Delete(&model.SigningKey{}).Error
+}
+
+// loadKeys refreshes the cache from the database. Must be called with signingKeysMu held.
+func (s *SigningKeyService) loadKeys() error {
+	now := time.Now()
+
+	var keys []model.SigningKey
+	if err := s.DB.Where("expires_at > ?", now).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		return err
+	}
+
+	cache := signingKeyCache{
+		publicKeys: make(map[string]*PublicSigningKey, len(keys)),
+		loadedAt:   now,
+	}
+
+	for _, key := range keys {
+		publicKey, err := parsePublicKey(key.PublicKey)
+		if err != nil {
+			s.Logger.Error("Error parsing public key ", key.ID, ": ", err)
+			continue
+		}
+		cache.publicKeys[key.ID] = &PublicSigningKey{
+			ID:        key.ID,
+			PublicKey: publicKey,
+			ExpiresAt: key.ExpiresAt,
+		}
+
+		// Keys are ordered newest first
+		if cache.current == nil && now.Before(key.RotatesAt) {
+			privateKey, err := s.decryptPrivateKey(key.PrivateKey)
+			if err != nil {
+				s.Logger.Error("Error decrypting private key ", key.ID, ": ", err)
+				continue
+			}
+			cache.current = &SigningKeyPair{ID: key.ID, PrivateKey: privateKey}
+			cache.rotatesAt = key.RotatesAt
+		}
+	}
+
+	signingKeys = cache
+	return nil
+}
+
+func (s *SigningKeyService) createKey() (*model.SigningKey, *SigningKeyPair, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, SIGNING_KEY_BITS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedPrivateKey, err := utils.Encrypt(privateDER, s.EncryptionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	rotatesAt := now.Add(SIGNING_KEY_ROTATION_INTERVAL)
+	key := model.SigningKey{
+		ID:         utils.CreateULID().String(),
+		Algorithm:  SIGNING_KEY_ALGORITHM,
+		PrivateKey: encryptedPrivateKey,
+		PublicKey:  base64.StdEncoding.EncodeToString(publicDER),
+		CreatedAt:  now,
+		RotatesAt:  rotatesAt,
+		ExpiresAt:  rotatesAt.Add(SIGNING_KEY_GRACE_PERIOD),
+	}
+
+	if err := s.DB.Create(&key).Error; err != nil {
+		return nil, nil, err
+	}
+
+	s.Logger.Info("Created signing key ", key.ID)
+
+	if err := s.DeleteExpiredKeys(); err != nil {
+		s.Logger.Error("Error deleting expired signing keys: ", err)
+	}
+	return &key, &SigningKeyPair{ID: key.ID, PrivateKey: privateKey}, nil
+}
+
+func (s *SigningKeyService) decryptPrivateKey(encrypted string) (*rsa.PrivateKey, error) {
+	der, err := utils.Decrypt(encrypted, s.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func parsePublicKey(encoded string) (*rsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("signing key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+	"github.com/RowenTey/JustJio/server/api/utils"
+)
+
+type SigningKeyServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	signingKeyService *SigningKeyService
+}
+
+func TestSigningKeyServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(SigningKeyServiceTestSuite))
+}
+
+func (s *SigningKeyServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.signingKeyService = NewSigningKeyService(s.DB)
+	s.signingKeyService.EncryptionKey = "test-secret"
+
+	// Start every test with an empty key cache
+	signingKeys = signingKeyCache{}
+}
+
+func (s *SigningKeyServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+// keyRow builds a stored signing key row along with its private key
+func (s *SigningKeyServiceTestSuite) keyRow(rows *sqlmock.Rows, id string, rotatesAt time.Time) *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(s.T(), err)
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(s.T(), err)
+	encryptedPrivateKey, err := utils.Encrypt(privateDER, s.signingKeyService.EncryptionKey)
+	assert.NoError(s.T(), err)
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.NoError(s.T(), err)
+
+	rows.AddRow(id, SIGNING_KEY_ALGORITHM, encryptedPrivateKey, base64.StdEncoding.EncodeToString(publicDER),
+		time.Now(), rotatesAt, rotatesAt.Add(SIGNING_KEY_GRACE_PERIOD))
+	return privateKey
+}
+
+func keyRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "algorithm", "private_key", "public_key", "created_at", "rotates_at", "expires_at"})
+}
+
+func (s *SigningKeyServiceTestSuite) TestGetSigningKey_UsesNewestActiveKey() {
+	// arrange
+	rows := keyRows()
+	privateKey := s.keyRow(rows, "new-key", time.Now().Add(time.Hour))
+	s.keyRow(rows, "old-key", time.Now().Add(-time.Minute))
+
+	s.mock.ExpectQuery(`SELECT \* FROM "signing_keys" WHERE expires_at > \$1 ORDER BY created_at DESC`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(rows)
+
+	// act
+	key, err := s.signingKeyService.GetSigningKey()
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "new-key", key.ID)
+	assert.True(s.T(), privateKey.Equal(key.PrivateKey))
+
+	// Both keys are still published for verification, without another query
+	publicKey, err := s.signingKeyService.GetPublicKey("old-key")
+	assert.NoError(s.T(), err)
+	assert.NotNil(s.T(), publicKey)
+}
+
+func (s *SigningKeyServiceTestSuite) TestGetSigningKey_CreatesKeyWhenRotationDue() {
+	// arrange
+	rows := keyRows()
+	s.keyRow(rows, "old-key", time.Now().Add(-time.Minute))
+
+	s.mock.ExpectQuery(`SELECT \* FROM "signing_keys" WHERE expires_at > \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(rows)
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`INSERT INTO "signing_keys" \("id","algorithm","private_key","public_key","created_at","rotates_at","expires_at"\)`).
+		WithArgs(sqlmock.AnyArg(), SIGNING_KEY_ALGORITHM, sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "signing_keys" WHERE expires_at < \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	key, err := s.signingKeyService.GetSigningKey()
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.NotEqual(s.T(), "old-key", key.ID)
+
+	jwks, err := s.signingKeyService.GetJWKS()
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), jwks, 2)
+}
+
+func (s *SigningKeyServiceTestSuite) TestGetPublicKey_UnknownKey() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "signing_keys" WHERE expires_at > \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(keyRows())
+
+	// act
+	publicKey, err := s.signingKeyService.GetPublicKey("unknown")
+
+	// assert
+	assert.Nil(s.T(), publicKey)
+	assert.EqualError(s.T(), err, "unknown signing key")
+
+	// Unknown key IDs don't trigger another reload straight away
+	_, err = s.signingKeyService.GetPublicKey("unknown")
+	assert.EqualError(s.T(), err, "unknown signing key")
+}
+
+func (s *SigningKeyServiceTestSuite) TestGetJWKS_Success() {
+	// arrange
+	rows := keyRows()
+	privateKey := s.keyRow(rows, "key", time.Now().Add(time.Hour))
+
+	s.mock.ExpectQuery(`SELECT \* FROM "signing_keys" WHERE expires_at > \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(rows)
+
+	// act
+	jwks, err := s.signingKeyService.GetJWKS()
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), jwks, 1)
+	assert.Equal(s.T(), "key", jwks[0].Kid)
+	assert.Equal(s.T(), "RS256", jwks[0].Alg)
+	assert.Equal(s.T(), base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()), jwks[0].N)
+	assert.Equal(s.T(), "AQAB", jwks[0].E)
+}
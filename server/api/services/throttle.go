@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	THROTTLE_BASE_DELAY = time.Second
+	THROTTLE_MAX_DELAY  = time.Minute * 15
+	// Failures older than this are forgotten
+	THROTTLE_WINDOW  = time.Hour
+	LOCKOUT_DURATION = time.Minute * 30
+)
+
+// ThrottlePolicy decides how many failures are allowed before attempts are delayed
+// with exponential backoff, and after how many the account is locked out
+type ThrottlePolicy struct {
+	FreeAttempts     int
+	LockoutThreshold int // 0 disables lockout
+}
+
+var (
+	// Accounts are locked out, as spraying passwords from many IPs gets past the IP limit
+	ACCOUNT_THROTTLE_POLICY = ThrottlePolicy{FreeAttempts: 5, LockoutThreshold: 10}
+	// OTPs are already invalidated after OTP_MAX_ATTEMPTS, so emails are only backed off
+	EMAIL_THROTTLE_POLICY = ThrottlePolicy{FreeAttempts: 5}
+	// Many users can share an IP, so it gets more leeway and is never locked out
+	IP_THROTTLE_POLICY = ThrottlePolicy{FreeAttempts: 20}
+)
+
+type ThrottleService struct {
+	DB     *gorm.DB
+	Logger *log.Entry
+}
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewThrottleService = func(db *gorm.DB) *ThrottleService {
+	return &ThrottleService{
+		DB:     db,
+		Logger: log.WithFields(log.Fields{"service": "ThrottleService"}),
+	}
+}
+
+// ThrottleKey identifies what attempts are counted against, e.g. ThrottleKey("login", "ip", c.IP())
+func ThrottleKey(action, kind, value string) string {
+	return action + ":" + kind + ":" + strings.ToLower(value)
+}
+
+// Check returns how long the caller has to wait if any of the keys is blocked.
+// The error is "account locked" if any of them is locked out, otherwise "too many attempts".
+func (s *ThrottleService) Check(keys ...string) (time.Duration, error) {
+	now := time.Now()
+	var throttles []model.AuthThrottle
+
+	if err := s.DB.Where("id IN ? AND blocked_until > ?", keys, now).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+	if len(throttles) == 0 {
+		return 0, nil
+	}
+
+	var retryAfter time.Duration
+	locked := false
+	for _, throttle := range throttles {
+		retryAfter = max(retryAfter, throttle.BlockedUntil.Sub(now))
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+			locked = true
+		}
+	}
+
+	if locked {
+		return retryAfter, errors.New("account locked")
+	}
+	return retryAfter, errors.New("too many attempts")
+}
+
+// RecordFailure counts a failed attempt against the key.
+// Returns true if this failure locked the account out.
+func (s *ThrottleService) RecordFailure(key string, policy ThrottlePolicy) (bool, error) {
+	db := s.DB
+	now := time.Now()
+
+	// Counted in one statement so concurrent failures can't overwrite each other's count
+	throttle := model.AuthThrottle{ID: key, Failures: 1, LastFailureAt: now}
+	if err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures": gorm.Expr(
+				"CASE WHEN auth_throttles.last_failure_at < ? THEN 1 ELSE auth_throttles.failures + 1 END",
+				now.Add(-THROTTLE_WINDOW)),
+			"last_failure_at": now,
+		}),
+	}, clause.Returning{Columns: []clause.Column{{Name: "failures"}}}).Create(&throttle).Error; err != nil {
+		return false, err
+	}
+
+	if policy.LockoutThreshold > 0 && throttle.Failures >= policy.LockoutThreshold {
+		// Only one of the concurrent failures past the threshold gets to lock the account
+		lockedUntil := now.Add(LOCKOUT_DURATION)
+		result := db.Model(&model.AuthThrottle{}).
+			Where("id = ? AND (locked_until IS NULL OR locked_until <= ?)", key, now).
+			Updates(map[string]interface{}{"locked_until": lockedUntil, "blocked_until": lockedUntil})
+		if result.Error != nil {
+			return false, result.Error
+		}
+
+		locked := result.RowsAffected > 0
+		if locked {
+			s.Logger.Warnf("Locked out %s after %d failed attempts", key, throttle.Failures)
+		}
+		return locked, nil
+	}
+
+	if throttle.Failures > policy.FreeAttempts {
+		blockedUntil := now.Add(backoffDelay(throttle.Failures - policy.FreeAttempts))
+		if err := db.Model(&model.AuthThrottle{}).
+			Where("id = ? AND (locked_until IS NULL OR locked_until <= ?)", key, now).
+			Update("blocked_until", blockedUntil).Error; err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// Reset clears the failures counted against the keys, e.g. after a successful attempt
+func (s *ThrottleService) Reset(keys ...string) error {
+	return s.DB.Where("id IN ?", keys).Delete(&model.AuthThrottle{}).Error
+}
+
+// DeleteStaleThrottles removes throttles whose failures have all been forgotten
+func (s *ThrottleService) DeleteStaleThrottles() error {
+	return s.DB.
+		Where("last_failure_at < ?", time.Now().Add(-THROTTLE_WINDOW)).
+		Where("blocked_until IS NULL OR blocked_until < ?", time.Now()).
+		Delete(&model.AuthThrottle{}).Error
+}
+
+// backoffDelay doubles the delay with every failure past the free attempts
+func backoffDelay(excessFailures int) time.Duration {
+	delay := float64(THROTTLE_BASE_DELAY) * math.Pow(2, float64(excessFailures-1))
+	return time.Duration(min(delay, float64(THROTTLE_MAX_DELAY)))
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+)
+
+type ThrottleServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	throttleService *ThrottleService
+
+	key string
+}
+
+func TestThrottleServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ThrottleServiceTestSuite))
+}
+
+func (s *ThrottleServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.throttleService = NewThrottleService(s.DB)
+	s.key = ThrottleKey("login", "user", "John")
+}
+
+func (s *ThrottleServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func throttleRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "failures", "blocked_until", "locked_until", "last_failure_at"})
+}
+
+// expectUpsert counts a failure, the database returns the updated count
+func (s *ThrottleServiceTestSuite) expectUpsert(failures int) {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "auth_throttles" (.+) ON CONFLICT \("id"\) DO UPDATE SET `+
+		`"failures"=CASE WHEN auth_throttles.last_failure_at < \$6 THEN 1 ELSE auth_throttles.failures \+ 1 END,`+
+		`"last_failure_at"=\$7 RETURNING "failures"`).
+		WithArgs(s.key, 1, nil, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(failures))
+	s.mock.ExpectCommit()
+}
+
+func (s *ThrottleServiceTestSuite) expectBackoff() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "auth_throttles" SET "blocked_until"=\$1 `+
+		`WHERE id = \$2 AND \(locked_until IS NULL OR locked_until <= \$3\)`).
+		WithArgs(sqlmock.AnyArg(), s.key, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+}
+
+func (s *ThrottleServiceTestSuite) TestThrottleKey_IsCaseInsensitive() {
+	assert.Equal(s.T(), "login:user:john", s.key)
+}
+
+func (s *ThrottleServiceTestSuite) TestCheck_NotBlocked() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "auth_throttles" WHERE id IN \(\$1,\$2\) AND blocked_until > \$3`).
+		WithArgs(s.key, "login:ip:1.1.1.1", sqlmock.AnyArg()).
+		WillReturnRows(throttleRows())
+
+	// act
+	retryAfter, err := s.throttleService.Check(s.key, "login:ip:1.1.1.1")
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Zero(s.T(), retryAfter)
+}
+
+func (s *ThrottleServiceTestSuite) TestCheck_Locked() {
+	// arrange
+	now := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "auth_throttles" WHERE id IN \(\$1,\$2\) AND blocked_until > \$3`).
+		WithArgs(s.key, "login:ip:1.1.1.1", sqlmock.AnyArg()).
+		WillReturnRows(throttleRows().
+			AddRow(s.key, 10, now.Add(LOCKOUT_DURATION), now.Add(LOCKOUT_DURATION), now).
+			AddRow("login:ip:1.1.1.1", 21, now.Add(time.Second), nil, now))
+
+	// act
+	retryAfter, err := s.throttleService.Check(s.key, "login:ip:1.1.1.1")
+
+	// assert
+	assert.EqualError(s.T(), err, "account locked")
+	assert.InDelta(s.T(), LOCKOUT_DURATION.Seconds(), retryAfter.Seconds(), 1)
+}
+
+func (s *ThrottleServiceTestSuite) TestRecordFailure_FirstFailure() {
+	// arrange
+	s.expectUpsert(1)
+
+	// act
+	locked, err := s.throttleService.RecordFailure(s.key, ACCOUNT_THROTTLE_POLICY)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), locked)
+}
+
+func (s *ThrottleServiceTestSuite) TestRecordFailure_LocksAtThreshold() {
+	// arrange
+	s.expectUpsert(ACCOUNT_THROTTLE_POLICY.LockoutThreshold)
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "auth_throttles" SET "blocked_until"=\$1,"locked_until"=\$2 `+
+		`WHERE id = \$3 AND \(locked_until IS NULL OR locked_until <= \$4\)`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), s.key, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	locked, err := s.throttleService.RecordFailure(s.key, ACCOUNT_THROTTLE_POLICY)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), locked)
+}
+
+func (s *ThrottleServiceTestSuite) TestRecordFailure_IPNeverLocks() {
+	// arrange
+	s.expectUpsert(100)
+	s.expectBackoff()
+
+	// act
+	locked, err := s.throttleService.RecordFailure(s.key, IP_THROTTLE_POLICY)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), locked)
+}
+
+func (s *ThrottleServiceTestSuite) TestRecordFailure_AlreadyLocked() {
+	// arrange
+	s.expectUpsert(ACCOUNT_THROTTLE_POLICY.LockoutThreshold + 1)
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "auth_throttles" SET "blocked_until"=\$1,"locked_until"=\$2`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), s.key, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	locked, err := s.throttleService.RecordFailure(s.key, ACCOUNT_THROTTLE_POLICY)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), locked)
+}
+
+func (s *ThrottleServiceTestSuite) TestRecordFailure_BacksOffPastFreeAttempts() {
+	// arrange
+	s.expectUpsert(ACCOUNT_THROTTLE_POLICY.FreeAttempts + 1)
+	s.expectBackoff()
+
+	// act
+	locked, err := s.throttleService.RecordFailure(s.key, ACCOUNT_THROTTLE_POLICY)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), locked)
+}
+
+func (s *ThrottleServiceTestSuite) TestBackoffDelay() {
+	assert.Equal(s.T(), THROTTLE_BASE_DELAY, backoffDelay(1))
+	assert.Equal(s.T(), 8*THROTTLE_BASE_DELAY, backoffDelay(4))
+	assert.Equal(s.T(), THROTTLE_MAX_DELAY, backoffDelay(100))
+}
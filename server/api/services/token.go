@@ -0,0 +1,277 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const REFRESH_TOKEN_EXPIRY_DURATION = time.Hour * 24 * 30 // 30 days
+
+// Session is a login on one device, made up of the refresh tokens in a family
+type Session struct {
+	ID         string    `json:"id"` // the family ID, also the sid claim of its access tokens
+	IPAddress  string    `json:"ipAddress"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"` // when the session was last refreshed
+	Current    bool      `json:"current"`
+}
+
+type TokenService struct {
+	DB     *gorm.DB
+	Logger *log.Entry
+}
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewTokenService = func(db *gorm.DB) *TokenService {
+	return &TokenService{
+		DB:     db,
+		Logger: log.WithFields(log.Fields{"service": "TokenService"}),
+	}
+}
+
+func (s *TokenService) NewFamilyID() string {
+	return utils.ULIDToUUID(utils.CreateULID()).String()
+}
+
+// CreateRefreshToken stores a new refresh token and returns the raw value, only its hash is persisted
+func (s *TokenService) CreateRefreshToken(
+	userId uint,
+	familyId, accessTokenId, ipAddress, userAgent string,
+) (string, error) {
+	rawToken := utils.GenerateRandomString(64)
+
+	refreshToken := model.RefreshToken{
+		UserID:        userId,
+		TokenHash:     utils.HashToken(rawToken),
+		FamilyID:      familyId,
+		AccessTokenID: accessTokenId,
+		IPAddress:     ipAddress,
+		UserAgent:     userAgent,
+		ExpiresAt:     time.Now().Add(REFRESH_TOKEN_EXPIRY_DURATION),
+	}
+
+	if err := s.DB.Omit("User").Create(&refreshToken).Error; err != nil {
+		return "", err
+	}
+
+	return rawToken, nil
+}
+
+// ConsumeRefreshToken marks a refresh token as used so that it can only be rotated once.
+// Presenting a token that was already used means it has leaked, so the whole family is revoked.
+func (s *TokenService) ConsumeRefreshToken(rawToken string) (*model.RefreshToken, error) {
+	db := s.DB
+	var refreshToken model.RefreshToken
+
+	if err := db.Where("token_hash = ?", utils.HashToken(rawToken)).First(&refreshToken).Error; err != nil {
+		return nil, err
+	}
+
+	if refreshToken.RevokedAt != nil {
+		return nil, s.handleReuse(&refreshToken)
+	}
+
+	if time.Now().After(refreshToken.ExpiresAt) {
+		return nil, errors.New("refresh token expired")
+	}
+
+	// Only succeeds for one of any concurrent rotations of the same token
+	now := time.Now()
+	result := db.Model(&model.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", refreshToken.ID).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, s.handleReuse(&refreshToken)
+	}
+
+	refreshToken.RevokedAt = &now
+	return &refreshToken, nil
+}
+
+// GetRefreshToken looks up a refresh token without using it
+func (s *TokenService) GetRefreshToken(rawToken string) (*model.RefreshToken, error) {
+	var refreshToken model.RefreshToken
+
+	if err := s.DB.Where("token_hash = ?", utils.HashToken(rawToken)).First(&refreshToken).Error; err != nil {
+		return nil, err
+	}
+
+	return &refreshToken, nil
+}
+
+// RevokeRefreshToken ends the session the refresh token belongs to and returns the token
+func (s *TokenService) RevokeRefreshToken(rawToken string) (*model.RefreshToken, error) {
+	refreshToken, err := s.GetRefreshToken(rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.RevokeFamily(refreshToken.FamilyID); err != nil {
+		return nil, err
+	}
+	return refreshToken, nil
+}
+
+// RevokeFamily revokes every refresh token in a family along with the access tokens issued with them
+func (s *TokenService) RevokeFamily(familyId string) error {
+	var refreshTokens []model.RefreshToken
+
+	if err := s.DB.Where("family_id = ?", familyId).Find(&refreshTokens).Error; err != nil {
+		return err
+	}
+
+	return s.revokeTokens(refreshTokens)
+}
+
+// GetSessions returns the user's active sessions, most recently used first.
+// currentSessionId marks the session the request was made from.
+func (s *TokenService) GetSessions(userId uint, currentSessionId string) (*[]Session, error) {
+	// Only the latest refresh token of an active session is unrevoked
+	var refreshTokens []model.RefreshToken
+	if err := s.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userId, time.Now()).
+		Order("created_at DESC").
+		Find(&refreshTokens).Error; err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(refreshTokens))
+	if len(refreshTokens) == 0 {
+		return &sessions, nil
+	}
+
+	familyIds := make([]string, len(refreshTokens))
+	for i, refreshToken := range refreshTokens {
+		familyIds[i] = refreshToken.FamilyID
+	}
+
+	var families []struct {
+		FamilyID  string
+		CreatedAt time.Time
+	}
+	if err := s.DB.Model(&model.RefreshToken{}).
+		Select("family_id, MIN(created_at) AS created_at").
+		Where("family_id IN ?", familyIds).
+		Group("family_id").
+		Scan(&families).Error; err != nil {
+		return nil, err
+	}
+	createdAt := make(map[string]time.Time, len(families))
+	for _, family := range families {
+		createdAt[family.FamilyID] = family.CreatedAt
+	}
+
+	for _, refreshToken := range refreshTokens {
+		sessions = append(sessions, Session{
+			ID:         refreshToken.FamilyID,
+			IPAddress:  refreshToken.IPAddress,
+			UserAgent:  refreshToken.UserAgent,
+			CreatedAt:  createdAt[refreshToken.FamilyID],
+			LastSeenAt: refreshToken.CreatedAt,
+			Current:    refreshToken.FamilyID == currentSessionId,
+		})
+	}
+	return &sessions, nil
+}
+
+// RevokeSession logs out one of the user's sessions
+func (s *TokenService) RevokeSession(userId uint, sessionId string) error {
+	var refreshTokens []model.RefreshToken
+
+	if err := s.DB.Where("family_id = ? AND user_id = ?", sessionId, userId).
+		Find(&refreshTokens).Error; err != nil {
+		return err
+	}
+	if len(refreshTokens) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return s.revokeTokens(refreshTokens)
+}
+
+// RevokeOtherSessions logs out every session of the user except the current one,
+// or all of them if currentSessionId is empty
+func (s *TokenService) RevokeOtherSessions(userId uint, currentSessionId string) error {
+	var refreshTokens []model.RefreshToken
+
+	// Tokens rotated out earlier than this can't have a live access token
+	query := s.DB.Where("user_id = ?", userId).
+		Where("revoked_at IS NULL OR created_at > ?", time.Now().Add(-ACCESS_TOKEN_EXPIRY_DURATION))
+	if currentSessionId != "" {
+		query = query.Where("family_id != ?", currentSessionId)
+	}
+	if err := query.Find(&refreshTokens).Error; err != nil {
+		return err
+	}
+
+	return s.revokeTokens(refreshTokens)
+}
+
+func (s *TokenService) IsTokenRevoked(tokenId string) (bool, error) {
+	var count int64
+
+	if err := s.DB.Model(&model.RevokedToken{}).
+		Where("id = ?", tokenId).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (s *TokenService) handleReuse(refreshToken *model.RefreshToken) error {
+	s.Logger.Warnf("Refresh token reuse detected for user %d, revoking family %s",
+		refreshToken.UserID, refreshToken.FamilyID)
+
+	if err := s.RevokeFamily(refreshToken.FamilyID); err != nil {
+		return err
+	}
+	return errors.New("refresh token reused")
+}
+
+func (s *TokenService) revokeTokens(refreshTokens []model.RefreshToken) error {
+	if len(refreshTokens) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var refreshTokenIds []uint
+	var revokedTokens []model.RevokedToken
+
+	for _, refreshToken := range refreshTokens {
+		refreshTokenIds = append(refreshTokenIds, refreshToken.ID)
+
+		// Access tokens issued before this window have expired on their own
+		accessTokenExpiry := refreshToken.CreatedAt.Add(ACCESS_TOKEN_EXPIRY_DURATION)
+		if accessTokenExpiry.After(now) {
+			revokedTokens = append(revokedTokens, model.RevokedToken{
+				ID:        refreshToken.AccessTokenID,
+				UserID:    refreshToken.UserID,
+				ExpiresAt: accessTokenExpiry,
+			})
+		}
+	}
+
+	if err := s.DB.Model(&model.RefreshToken{}).
+		Where("id IN ? AND revoked_at IS NULL", refreshTokenIds).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	if len(revokedTokens) == 0 {
+		return nil
+	}
+
+	return s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&revokedTokens).Error
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+	"github.com/RowenTey/JustJio/server/api/utils"
+)
+
+type TokenServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	tokenService *TokenService
+
+	userId   uint
+	familyId string
+}
+
+func TestTokenServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(TokenServiceTestSuite))
+}
+
+func (s *TokenServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.tokenService = NewTokenService(s.DB)
+
+	s.userId = 1
+	s.familyId = "0190d6b4-7c1e-7a2b-9c3d-4e5f6a7b8c9d"
+}
+
+func (s *TokenServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *TokenServiceTestSuite) refreshTokenRows(
+	id uint, accessTokenId string, expiresAt time.Time, revokedAt *time.Time, createdAt time.Time,
+) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"id", "user_id", "token_hash", "family_id", "access_token_id",
+		"expires_at", "revoked_at", "created_at"}).
+		AddRow(id, s.userId, "hash", s.familyId, accessTokenId, expiresAt, revokedAt, createdAt)
+}
+
+func (s *TokenServiceTestSuite) TestCreateRefreshToken_Success() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "refresh_tokens"`).
+		WithArgs(
+			s.userId,
+			sqlmock.AnyArg(), // token_hash
+			s.familyId,
+			"access-token-id",
+			"127.0.0.1",
+			"test-agent",
+			sqlmock.AnyArg(), // expires_at
+			nil,              // revoked_at
+			sqlmock.AnyArg(), // created_at
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	// act
+	rawToken, err := s.tokenService.CreateRefreshToken(
+		s.userId, s.familyId, "access-token-id", "127.0.0.1", "test-agent")
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), rawToken, 64)
+}
+
+func (s *TokenServiceTestSuite) TestConsumeRefreshToken_Success() {
+	// arrange
+	rawToken := "raw-refresh-token"
+	now := time.Now()
+
+	s.mock.ExpectQuery(`SELECT \* FROM "refresh_tokens" WHERE token_hash = \$1 ORDER BY "refresh_tokens"."id" LIMIT \$2`).
+		WithArgs(utils.HashToken(rawToken), 1).
+		WillReturnRows(s.refreshTokenRows(1, "access-token-id", now.Add(time.Hour), nil, now))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "refresh_tokens" SET "revoked_at"=\$1 WHERE id = \$2 AND revoked_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	refreshToken, err := s.tokenService.ConsumeRefreshToken(rawToken)
+
+	// assert
+	tests.AssertNoErrAndNotNil(s.T(), err, refreshToken)
+	assert.Equal(s.T(), s.userId, refreshToken.UserID)
+	assert.Equal(s.T(), s.familyId, refreshToken.FamilyID)
+	assert.NotNil(s.T(), refreshToken.RevokedAt)
+}
+
+func (s *TokenServiceTestSuite) TestConsumeRefreshToken_NotFound() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "refresh_tokens" WHERE token_hash = \$1`).
+		WithArgs(utils.HashToken("unknown"), 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	// act
+	refreshToken, err := s.tokenService.ConsumeRefreshToken("unknown")
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, refreshToken)
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *TokenServiceTestSuite) TestConsumeRefreshToken_Expired() {
+	// arrange
+	rawToken := "raw-refresh-token"
+	now := time.Now()
+
+	s.mock.ExpectQuery(`SELECT \* FROM "refresh_tokens" WHERE token_hash = \$1`).
+		WithArgs(utils.HashToken(rawToken), 1).
+		WillReturnRows(s.refreshTokenRows(1, "access-token-id", now.Add(-time.Hour), nil, now.Add(-48*time.Hour)))
+
+	// act
+	refreshToken, err := s.tokenService.ConsumeRefreshToken(rawToken)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, refreshToken)
+	assert.EqualError(s.T(), err, "refresh token expired")
+}
+
+func (s *TokenServiceTestSuite) TestConsumeRefreshToken_ReuseRevokesFamily() {
+	// arrange
+	rawToken := "raw-refresh-token"
+	now := time.Now()
+	usedAt := now.Add(-time.Minute)
+
+	s.mock.ExpectQuery(`SELECT \* FROM "refresh_tokens" WHERE token_hash = \$1`).
+		WithArgs(utils.HashToken(rawToken), 1).
+		WillReturnRows(s.refreshTokenRows(1, "old-access-token-id", now.Add(time.Hour), &usedAt, now.Add(-time.Hour)))
+
+	// family contains the reused token and the token it was rotated into
+	s.mock.ExpectQuery(`SELECT \* FROM "refresh_tokens" WHERE family_id = \$1`).
+		WithArgs(s.familyId).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "user_id", "family_id", "access_token_id", "expires_at", "revoked_at", "created_at"}).
+			AddRow(1, s.userId, s.familyId, "old-access-token-id", now.Add(time.Hour), usedAt, now.Add(-time.Hour)).
+			AddRow(2, s.userId, s.familyId, "new-access-token-id", now.Add(time.Hour), nil, usedAt))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "refresh_tokens" SET "revoked_at"=\$1 WHERE id IN \(\$2,\$3\) AND revoked_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// only the access token that has not expired yet is added to the deny list
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`INSERT INTO "revoked_tokens" (.+) ON CONFLICT DO NOTHING`).
+		WithArgs("new-access-token-id", s.userId, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	refreshToken, err := s.tokenService.ConsumeRefreshToken(rawToken)
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, refreshToken)
+	assert.EqualError(s.T(), err, "refresh token reused")
+}
+
+func (s *TokenServiceTestSuite) TestRevokeRefreshToken_NotFound() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "refresh_tokens" WHERE token_hash = \$1`).
+		WithArgs(utils.HashToken("unknown"), 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	// act
+	refreshToken, err := s.tokenService.RevokeRefreshToken("unknown")
+
+	// assert
+	tests.AssertErrAndNil(s.T(), err, refreshToken)
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *TokenServiceTestSuite) TestIsTokenRevoked_True() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "revoked_tokens" WHERE id = \$1`).
+		WithArgs("access-token-id").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	// act
+	revoked, err := s.tokenService.IsTokenRevoked("access-token-id")
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), revoked)
+}
+
+func (s *TokenServiceTestSuite) TestIsTokenRevoked_False() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "revoked_tokens" WHERE id = \$1`).
+		WithArgs("access-token-id").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	// act
+	revoked, err := s.tokenService.IsTokenRevoked("access-token-id")
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), revoked)
+}
+
+func (s *TokenServiceTestSuite) TestGetSessions_Success() {
+	// arrange
+	now := time.Now()
+	otherFamilyId := "0190d6b4-7c1e-7a2b-9c3d-4e5f6a7b8c9e"
+
+	s.mock.ExpectQuery(`SELECT \* FROM "refresh_tokens" WHERE user_id = \$1 AND revoked_at IS NULL AND expires_at > \$2 ORDER BY created_at DESC`).
+		WithArgs(s.userId, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "user_id", "family_id", "ip_address", "user_agent", "expires_at", "created_at"}).
+			AddRow(3, s.userId, s.familyId, "10.0.0.1", "phone", now.Add(time.Hour), now.Add(-time.Minute)).
+			AddRow(2, s.userId, otherFamilyId, "10.0.0.2", "laptop", now.Add(time.Hour), now.Add(-time.Hour)))
+	s.mock.ExpectQuery(`SELECT family_id, MIN\(created_at\) AS created_at FROM "refresh_tokens" WHERE family_id IN \(\$1,\$2\) GROUP BY "family_id"`).
+		WithArgs(s.familyId, otherFamilyId).
+		WillReturnRows(sqlmock.NewRows([]string{"family_id", "created_at"}).
+			AddRow(s.familyId, now.Add(-24*time.Hour)).
+			AddRow(otherFamilyId, now.Add(-time.Hour)))
+
+	// act
+	sessions, err := s.tokenService.GetSessions(s.userId, s.familyId)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), *sessions, 2)
+	assert.Equal(s.T(), s.familyId, (*sessions)[0].ID)
+	assert.True(s.T(), (*sessions)[0].Current)
+	assert.Equal(s.T(), "phone", (*sessions)[0].UserAgent)
+	assert.WithinDuration(s.T(), now.Add(-24*time.Hour), (*sessions)[0].CreatedAt, time.Second)
+	assert.WithinDuration(s.T(), now.Add(-time.Minute), (*sessions)[0].LastSeenAt, time.Second)
+	assert.False(s.T(), (*sessions)[1].Current)
+}
+
+func (s *TokenServiceTestSuite) TestRevokeSession_NotFound() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "refresh_tokens" WHERE family_id = \$1 AND user_id = \$2`).
+		WithArgs(s.familyId, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// act
+	err := s.tokenService.RevokeSession(2, s.familyId)
+
+	// assert
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *TokenServiceTestSuite) TestRevokeOtherSessions_KeepsCurrent() {
+	// arrange
+	now := time.Now()
+	otherFamilyId := "0190d6b4-7c1e-7a2b-9c3d-4e5f6a7b8c9e"
+
+	s.mock.ExpectQuery(`SELECT \* FROM "refresh_tokens" WHERE user_id = \$1 AND \(revoked_at IS NULL OR created_at > \$2\) AND family_id != \$3`).
+		WithArgs(s.userId, sqlmock.AnyArg(), s.familyId).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "user_id", "family_id", "access_token_id", "expires_at", "revoked_at", "created_at"}).
+			AddRow(2, s.userId, otherFamilyId, "other-access-token-id", now.Add(time.Hour), nil, now.Add(-time.Minute)))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "refresh_tokens" SET "revoked_at"=\$1 WHERE id IN \(\$2\) AND revoked_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`INSERT INTO "revoked_tokens" (.+) ON CONFLICT DO NOTHING`).
+		WithArgs("other-access-token-id", s.userId, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.tokenService.RevokeOtherSessions(s.userId, s.familyId)
+
+	// assert
+	assert.NoError(s.T(), err)
+}
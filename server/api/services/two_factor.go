@@ -0,0 +1,262 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TOTP_ISSUER                       = "JustJio"
+	RECOVERY_CODE_COUNT               = 10
+	TWO_FACTOR_CHALLENGE_MAX_ATTEMPTS = 5
+)
+
+type TwoFactorService struct {
+	DB            *gorm.DB
+	EncryptionKey string
+	Logger        *log.Entry
+}
+
+// NOTE: used var instead of func to enable mocking in tests
+var NewTwoFactorService = func(db *gorm.DB) *TwoFactorService {
+	return &TwoFactorService{
+		DB:            db,
+		EncryptionKey: config.Config("JWT_SECRET"),
+		Logger:        log.WithFields(log.Fields{"service": "TwoFactorService"}),
+	}
+}
+
+func (s *TwoFactorService) IsEnabled(userId uint) (bool, error) {
+	var count int64
+
+	if err := s.DB.Model(&model.UserTOTP{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userId).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// BeginEnrollment generates a new TOTP secret for the user and returns its provisioning URI.
+// The secret is not enforced until ConfirmEnrollment is called with a valid code.
+func (s *TwoFactorService) BeginEnrollment(user *model.User) (string, string, error) {
+	enabled, err := s.IsEnabled(user.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", errors.New("2fa already enabled")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	// Stored encrypted so a database leak doesn't expose the seeds
+	encryptedSecret, err := utils.Encrypt([]byte(secret), s.EncryptionKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	totp := model.UserTOTP{
+		UserID:    user.ID,
+		Secret:    encryptedSecret,
+		CreatedAt: time.Now(),
+	}
+
+	// Restarting enrolment replaces any unconfirmed secret
+	if err := s.DB.Omit("User").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "confirmed_at", "created_at"}),
+	}).Create(&totp).Error; err != nil {
+		return "", "", err
+	}
+
+	return secret, utils.TOTPProvisioningURI(TOTP_ISSUER, user.Email, secret), nil
+}
+
+// ConfirmEnrollment enables 2FA once the user proves their authenticator works,
+// returning a fresh set of recovery codes that are only ever shown once
+func (s *TwoFactorService) ConfirmEnrollment(userId uint, code string) ([]string, error) {
+	db := s.DB
+	var totp model.UserTOTP
+
+	if err := db.Where("user_id = ?", userId).First(&totp).Error; err != nil {
+		return nil, err
+	}
+
+	if totp.ConfirmedAt != nil {
+		return nil, errors.New("2fa already enabled")
+	}
+
+	secret, err := s.decryptSecret(&totp)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := utils.ValidateTOTPCode(secret, code, time.Now())
+	if !ok {
+		return nil, errors.New("invalid code")
+	}
+
+	if err := db.Model(&totp).Updates(map[string]interface{}{
+		"confirmed_at":   time.Now(),
+		"last_used_step": step,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return s.RegenerateRecoveryCodes(userId)
+}
+
+// CreateChallenge stores a login challenge and returns its ID, which becomes the jti of the challenge token
+func (s *TwoFactorService) CreateChallenge(userId uint, expiresAt time.Time) (string, error) {
+	challenge := model.TwoFactorChallenge{
+		ID:        utils.CreateULID().String(),
+		UserID:    userId,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := s.DB.Omit("User").Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return challenge.ID, nil
+}
+
+// BeginChallengeAttempt counts a code submitted for the challenge before it is checked,
+// so concurrent guesses can't exceed TWO_FACTOR_CHALLENGE_MAX_ATTEMPTS
+func (s *TwoFactorService) BeginChallengeAttempt(challengeId string, userId uint) error {
+	result := s.DB.Model(&model.TwoFactorChallenge{}).
+		Where("id = ? AND user_id = ? AND attempts < ? AND expires_at > ?",
+			challengeId, userId, TWO_FACTOR_CHALLENGE_MAX_ATTEMPTS, time.Now()).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("invalid challenge")
+	}
+	return nil
+}
+
+// ConsumeChallenge redeems the challenge once its code was accepted, which can only succeed once
+func (s *TwoFactorService) ConsumeChallenge(challengeId string) error {
+	result := s.DB.Where("id = ?", challengeId).Delete(&model.TwoFactorChallenge{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("invalid challenge")
+	}
+	return nil
+}
+
+func (s *TwoFactorService) DeleteExpiredChallenges() error {
+	return s.DB.Where("expires_at < ?", time.Now()).Delete(&model.TwoFactorChallenge{}).Error
+}
+
+// VerifyCode accepts either a TOTP code or an unused recovery code
+func (s *TwoFactorService) VerifyCode(userId uint, code string) error {
+	db := s.DB
+	var totp model.UserTOTP
+
+	if err := db.Where("user_id = ? AND confirmed_at IS NOT NULL", userId).First(&totp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("2fa not enabled")
+		}
+		return err
+	}
+
+	secret, err := s.decryptSecret(&totp)
+	if err != nil {
+		return err
+	}
+
+	code = strings.TrimSpace(code)
+
+	if step, ok := utils.ValidateTOTPCode(secret, code, time.Now()); ok {
+		// Only accept steps after the last one used so codes can't be replayed
+		result := db.Model(&model.UserTOTP{}).
+			Where("user_id = ? AND last_used_step < ?", userId, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("invalid code")
+		}
+		return nil
+	}
+
+	result := db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, utils.HashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("invalid code")
+	}
+
+	s.Logger.Infof("User %d logged in with a recovery code", userId)
+	return nil
+}
+
+// Disable turns off 2FA after checking a current code, removing the secret and recovery codes
+func (s *TwoFactorService) Disable(userId uint, code string) error {
+	if err := s.VerifyCode(userId, code); err != nil {
+		return err
+	}
+
+	if err := s.DB.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	return s.DB.Where("user_id = ?", userId).Delete(&model.UserTOTP{}).Error
+}
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes
+func (s *TwoFactorService) RegenerateRecoveryCodes(userId uint) ([]string, error) {
+	db := s.DB
+
+	if err := db.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RECOVERY_CODE_COUNT)
+	recoveryCodes := make([]model.RecoveryCode, RECOVERY_CODE_COUNT)
+	for i := range codes {
+		codes[i] = utils.GenerateRandomString(16)
+		recoveryCodes[i] = model.RecoveryCode{
+			UserID:   userId,
+			CodeHash: utils.HashToken(codes[i]),
+		}
+	}
+
+	if err := db.Omit("User").Create(&recoveryCodes).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *TwoFactorService) decryptSecret(totp *model.UserTOTP) (string, error) {
+	secret, err := utils.Decrypt(totp.Secret, s.EncryptionKey)
+	if err != nil {
+		s.Logger.Error("Error decrypting TOTP secret of user ", totp.UserID, ": ", err)
+		return "", err
+	}
+	return string(secret), nil
+}
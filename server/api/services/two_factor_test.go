@@ -0,0 +1,269 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/tests"
+	"github.com/RowenTey/JustJio/server/api/utils"
+)
+
+type TwoFactorServiceTestSuite struct {
+	suite.Suite
+	DB   *gorm.DB
+	mock sqlmock.Sqlmock
+
+	twoFactorService *TwoFactorService
+
+	userId          uint
+	secret          string
+	encryptedSecret string
+}
+
+func TestTwoFactorServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(TwoFactorServiceTestSuite))
+}
+
+func (s *TwoFactorServiceTestSuite) SetupTest() {
+	var err error
+	s.DB, s.mock, err = tests.SetupTestDB()
+	assert.NoError(s.T(), err)
+
+	s.twoFactorService = NewTwoFactorService(s.DB)
+	s.twoFactorService.EncryptionKey = "test-secret"
+
+	s.userId = 1
+	s.secret, err = utils.GenerateTOTPSecret()
+	assert.NoError(s.T(), err)
+	s.encryptedSecret, err = utils.Encrypt([]byte(s.secret), s.twoFactorService.EncryptionKey)
+	assert.NoError(s.T(), err)
+}
+
+func (s *TwoFactorServiceTestSuite) AfterTest(_, _ string) {
+	assert.NoError(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *TwoFactorServiceTestSuite) currentCode() string {
+	code, err := utils.GenerateTOTPCode(s.secret, utils.TOTPStep(time.Now()))
+	assert.NoError(s.T(), err)
+	return code
+}
+
+func (s *TwoFactorServiceTestSuite) totpRows(lastUsedStep int64, confirmedAt *time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"user_id", "secret", "last_used_step", "confirmed_at", "created_at"}).
+		AddRow(s.userId, s.encryptedSecret, lastUsedStep, confirmedAt, time.Now())
+}
+
+func (s *TwoFactorServiceTestSuite) TestIsEnabled_True() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "user_totps" WHERE user_id = \$1 AND confirmed_at IS NOT NULL`).
+		WithArgs(s.userId).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	// act
+	enabled, err := s.twoFactorService.IsEnabled(s.userId)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), enabled)
+}
+
+func (s *TwoFactorServiceTestSuite) TestBeginEnrollment_Success() {
+	// arrange
+	user := tests.CreateTestUser(s.userId, "johndoe", "john@example.com")
+
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "user_totps"`).
+		WithArgs(s.userId).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	storedSecret := &capture{}
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`INSERT INTO "user_totps" (.+) ON CONFLICT \("user_id"\) DO UPDATE SET`).
+		WithArgs(s.userId, storedSecret, 0, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	secret, uri, err := s.twoFactorService.BeginEnrollment(user)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.NotEmpty(s.T(), secret)
+	assert.Contains(s.T(), uri, "otpauth://totp/JustJio:john@example.com?")
+	assert.Contains(s.T(), uri, "secret="+secret)
+
+	// Only the encrypted secret is stored
+	assert.NotEqual(s.T(), secret, storedSecret.value)
+	decrypted, err := utils.Decrypt(storedSecret.value.(string), s.twoFactorService.EncryptionKey)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), secret, string(decrypted))
+}
+
+func (s *TwoFactorServiceTestSuite) TestBeginEnrollment_AlreadyEnabled() {
+	// arrange
+	user := tests.CreateTestUser(s.userId, "johndoe", "john@example.com")
+
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "user_totps"`).
+		WithArgs(s.userId).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	// act
+	_, _, err := s.twoFactorService.BeginEnrollment(user)
+
+	// assert
+	assert.EqualError(s.T(), err, "2fa already enabled")
+}
+
+func (s *TwoFactorServiceTestSuite) TestConfirmEnrollment_Success() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "user_totps" WHERE user_id = \$1 ORDER BY "user_totps"."user_id" LIMIT \$2`).
+		WithArgs(s.userId, 1).
+		WillReturnRows(s.totpRows(0, nil))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "user_totps" SET "confirmed_at"=\$1,"last_used_step"=\$2 WHERE "user_id" = \$3`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), s.userId).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "recovery_codes" WHERE user_id = \$1`).
+		WithArgs(s.userId).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`INSERT INTO "recovery_codes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	// act
+	codes, err := s.twoFactorService.ConfirmEnrollment(s.userId, s.currentCode())
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), codes, RECOVERY_CODE_COUNT)
+}
+
+func (s *TwoFactorServiceTestSuite) TestConfirmEnrollment_InvalidCode() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "user_totps" WHERE user_id = \$1`).
+		WithArgs(s.userId, 1).
+		WillReturnRows(s.totpRows(0, nil))
+
+	// act
+	codes, err := s.twoFactorService.ConfirmEnrollment(s.userId, "abcdef")
+
+	// assert
+	assert.EqualError(s.T(), err, "invalid code")
+	assert.Nil(s.T(), codes)
+}
+
+func (s *TwoFactorServiceTestSuite) TestVerifyCode_TOTP() {
+	// arrange
+	confirmedAt := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "user_totps" WHERE user_id = \$1 AND confirmed_at IS NOT NULL`).
+		WithArgs(s.userId, 1).
+		WillReturnRows(s.totpRows(0, &confirmedAt))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "user_totps" SET "last_used_step"=\$1 WHERE user_id = \$2 AND last_used_step < \$3`).
+		WithArgs(sqlmock.AnyArg(), s.userId, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.twoFactorService.VerifyCode(s.userId, s.currentCode())
+
+	// assert
+	assert.NoError(s.T(), err)
+}
+
+func (s *TwoFactorServiceTestSuite) TestVerifyCode_ReplayedTOTP() {
+	// arrange
+	confirmedAt := time.Now()
+	s.mock.ExpectQuery(`SELECT \* FROM "user_totps" WHERE user_id = \$1 AND confirmed_at IS NOT NULL`).
+		WithArgs(s.userId, 1).
+		WillReturnRows(s.totpRows(utils.TOTPStep(time.Now())+1, &confirmedAt))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "user_totps" SET "last_used_step"`).
+		WithArgs(sqlmock.AnyArg(), s.userId, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.twoFactorService.VerifyCode(s.userId, s.currentCode())
+
+	// assert
+	assert.EqualError(s.T(), err, "invalid code")
+}
+
+func (s *TwoFactorServiceTestSuite) TestVerifyCode_RecoveryCode() {
+	// arrange
+	confirmedAt := time.Now()
+	recoveryCode := "recovery-code-01"
+	s.mock.ExpectQuery(`SELECT \* FROM "user_totps" WHERE user_id = \$1 AND confirmed_at IS NOT NULL`).
+		WithArgs(s.userId, 1).
+		WillReturnRows(s.totpRows(0, &confirmedAt))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "recovery_codes" SET "used_at"=\$1 WHERE user_id = \$2 AND code_hash = \$3 AND used_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), s.userId, utils.HashToken(recoveryCode)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.twoFactorService.VerifyCode(s.userId, recoveryCode)
+
+	// assert
+	assert.NoError(s.T(), err)
+}
+
+func (s *TwoFactorServiceTestSuite) TestVerifyCode_NotEnabled() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "user_totps" WHERE user_id = \$1 AND confirmed_at IS NOT NULL`).
+		WithArgs(s.userId, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	// act
+	err := s.twoFactorService.VerifyCode(s.userId, "123456")
+
+	// assert
+	assert.EqualError(s.T(), err, "2fa not enabled")
+}
+
+func (s *TwoFactorServiceTestSuite) TestBeginChallengeAttempt_Exhausted() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "two_factor_challenges" SET "attempts"=attempts \+ 1 WHERE id = \$1 AND user_id = \$2 AND attempts < \$3 AND expires_at > \$4`).
+		WithArgs("challenge-1", s.userId, TWO_FACTOR_CHALLENGE_MAX_ATTEMPTS, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.twoFactorService.BeginChallengeAttempt("challenge-1", s.userId)
+
+	// assert
+	assert.EqualError(s.T(), err, "invalid challenge")
+}
+
+func (s *TwoFactorServiceTestSuite) TestConsumeChallenge_Replayed() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "two_factor_challenges" WHERE id = \$1`).
+		WithArgs("challenge-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.twoFactorService.ConsumeChallenge("challenge-1")
+
+	// assert
+	assert.EqualError(s.T(), err, "invalid challenge")
+}
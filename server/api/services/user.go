@@ -1,17 +1,88 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	// Time zones are validated against the embedded database, not the host's
+	_ "time/tzdata"
 
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/language"
 
+	"github.com/RowenTey/JustJio/server/api/config"
+	"github.com/RowenTey/JustJio/server/api/database"
 	"github.com/RowenTey/JustJio/server/api/model"
+	model_kafka "github.com/RowenTey/JustJio/server/api/model/kafka"
+	"github.com/RowenTey/JustJio/server/api/utils"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+const DEFAULT_FRIEND_REQUEST_EXPIRY_DAYS = 30
+
+var validFriendRequestStatuses = map[string]bool{
+	"pending":   true,
+	"accepted":  true,
+	"rejected":  true,
+	"cancelled": true, // withdrawn by the sender
+	"expired":   true,
+}
+
+// FriendRequestExpiry returns how long a request stays pending,
+// overridden by FRIEND_REQUEST_EXPIRY_DAYS where set
+func FriendRequestExpiry() time.Duration {
+	days := DEFAULT_FRIEND_REQUEST_EXPIRY_DAYS
+	if v, err := strconv.Atoi(config.Config("FRIEND_REQUEST_EXPIRY_DAYS")); err == nil && v > 0 {
+		days = v
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+const FRIEND_SUGGESTIONS_LIMIT = 10
+const USER_SEARCH_PAGE_SIZE = 10
+
+// FriendSuggestion is a user the current user may know
+type FriendSuggestion struct {
+	User          model.User `json:"user"`
+	MutualFriends int64      `json:"mutualFriends"`
+	SharedRooms   int64      `json:"sharedRooms"`
+	Reason        string     `json:"reason"` // e.g. "3 mutual friends, 2 rooms together"
+}
+
+const PRESENCE_MESSAGE_TYPE = "PRESENCE"
+
+// Presence is whether a user is connected, as their friends see it
+type Presence struct {
+	UserID   uint       `json:"userId"`
+	IsOnline bool       `json:"isOnline"`
+	LastSeen *time.Time `json:"lastSeen"` // nil when hidden or never seen
+}
+
+func presenceOf(user *model.User) Presence {
+	presence := Presence{UserID: user.ID}
+	if user.HidePresence {
+		return presence
+	}
+
+	presence.IsOnline = user.IsOnline
+	if !user.LastSeen.IsZero() {
+		lastSeen := user.LastSeen
+		presence.LastSeen = &lastSeen
+	}
+	return presence
+}
+
 type UserService struct {
 	DB     *gorm.DB
 	Logger *log.Entry
@@ -64,6 +135,8 @@ func (s *UserService) GetUsersByID(userIds []uint) (*[]model.User, error) {
 	return &users, nil
 }
 
+// UpdateUserField sets fields the server manages, e.g. password or isOnline.
+// Client edits go through UpdateProfile.
 func (s *UserService) UpdateUserField(userid string, field string, value interface{}) error {
 	db := s.DB
 	var user model.User
@@ -79,6 +152,10 @@ func (s *UserService) UpdateUserField(userid string, field string, value interfa
 	// 	user.PhoneNum = value.(string)
 	case "username":
 		user.Username = value.(string)
+	case "password":
+		user.Password = value.(string)
+	case "hasPassword":
+		user.HasPassword = value.(bool)
 	case "isEmailValid":
 		user.IsEmailValid = value.(bool)
 	case "isOnline":
@@ -96,6 +173,188 @@ func (s *UserService) UpdateUserField(userid string, field string, value interfa
 	return nil
 }
 
+var (
+	ErrUsernameTaken = errors.New("username already taken")
+	ErrPhoneNumTaken = errors.New("phone number already in use")
+)
+
+// ProfileFieldError is returned when a profile update sets a field that isn't writable or an invalid value
+type ProfileFieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ProfileFieldError) Error() string {
+	return e.Field + " " + e.Reason
+}
+
+type profileField struct {
+	column    string
+	required  bool // can't be removed with null
+	normalize func(value string) (string, error)
+}
+
+// profileFields are the only fields clients can write, keyed by their JSON name.
+// Everything else on the user, e.g. email or isEmailValid, is managed by the server.
+var profileFields = map[string]profileField{
+	"username":    {column: "username", required: true, normalize: normalizeUsername},
+	"displayName": {column: "display_name", normalize: normalizeDisplayName},
+	"bio":         {column: "bio", normalize: normalizeBio},
+	"phoneNum":    {column: "phone_num", normalize: normalizePhoneNum},
+	"timeZone":    {column: "time_zone", normalize: normalizeTimeZone},
+	"locale":      {column: "locale", normalize: normalizeLocale},
+}
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.]{3,32}$`)
+	phoneNumPattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+)
+
+const (
+	MAX_DISPLAY_NAME_LENGTH = 50
+	MAX_BIO_LENGTH          = 160
+)
+
+// UpdateProfile applies a JSON Merge Patch (RFC 7396) to the user's profile.
+// A null value removes a field, and fields missing from the patch are left as they are.
+func (s *UserService) UpdateProfile(userID uint, patch map[string]json.RawMessage) (*model.User, error) {
+	updates := make(map[string]interface{}, len(patch))
+
+	// Sorted so the same bad patch always reports the same field
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field, ok := profileFields[key]
+		if !ok {
+			return nil, &ProfileFieldError{Field: key, Reason: "cannot be updated"}
+		}
+
+		var value *string
+		if err := json.Unmarshal(patch[key], &value); err != nil {
+			return nil, &ProfileFieldError{Field: key, Reason: "must be a string or null"}
+		}
+
+		normalized := ""
+		if value != nil {
+			var err error
+			if normalized, err = field.normalize(*value); err != nil {
+				return nil, &ProfileFieldError{Field: key, Reason: err.Error()}
+			}
+		}
+		if normalized == "" && field.required {
+			return nil, &ProfileFieldError{Field: key, Reason: "is required"}
+		}
+		updates[field.column] = normalized
+	}
+
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if len(updates) == 0 {
+		return &user, nil
+	}
+
+	if username, ok := updates["username"]; ok {
+		if err := s.checkProfileUnique(userID, "username", username, ErrUsernameTaken); err != nil {
+			return nil, err
+		}
+	}
+	if phoneNum, ok := updates["phone_num"]; ok && phoneNum != "" {
+		if err := s.checkProfileUnique(userID, "phone_num", phoneNum, ErrPhoneNumTaken); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.DB.Model(&user).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// checkProfileUnique gives a friendlier error than the unique index for the common case
+func (s *UserService) checkProfileUnique(userID uint, column string, value interface{}, errTaken error) error {
+	var count int64
+	if err := s.DB.Model(&model.User{}).
+		Where(column+" = ? AND id <> ?", value, userID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errTaken
+	}
+	return nil
+}
+
+func normalizeUsername(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value != "" && !usernamePattern.MatchString(value) {
+		return "", errors.New("must be 3-32 letters, digits, underscores or dots")
+	}
+	return value, nil
+}
+
+func normalizeDisplayName(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if utf8.RuneCountInString(value) > MAX_DISPLAY_NAME_LENGTH {
+		return "", fmt.Errorf("must be at most %d characters", MAX_DISPLAY_NAME_LENGTH)
+	}
+	if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return "", errors.New("must not contain control characters")
+	}
+	return value, nil
+}
+
+func normalizeBio(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if utf8.RuneCountInString(value) > MAX_BIO_LENGTH {
+		return "", fmt.Errorf("must be at most %d characters", MAX_BIO_LENGTH)
+	}
+	return value, nil
+}
+
+// normalizePhoneNum accepts common separators but stores E.164, e.g. "+65 9123-4567" becomes "+6591234567"
+func normalizePhoneNum(value string) (string, error) {
+	value = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '(' || r == ')' {
+			return -1
+		}
+		return r
+	}, value)
+	if value != "" && !phoneNumPattern.MatchString(value) {
+		return "", errors.New("must be in international format, e.g. +6591234567")
+	}
+	return value, nil
+}
+
+func normalizeTimeZone(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	// "Local" is the server's zone, which means nothing to the client
+	if _, err := time.LoadLocation(value); err != nil || value == "Local" {
+		return "", errors.New("must be an IANA time zone, e.g. Asia/Singapore")
+	}
+	return value, nil
+}
+
+func normalizeLocale(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	tag, err := language.Parse(value)
+	if err != nil {
+		return "", errors.New("must be a language tag, e.g. en-SG")
+	}
+	return tag.String(), nil
+}
+
 func (s *UserService) CreateOrUpdateUser(user *model.User, isCreate bool) (*model.User, error) {
 	db := s.DB.Table("users")
 
@@ -110,21 +369,46 @@ func (s *UserService) CreateOrUpdateUser(user *model.User, isCreate bool) (*mode
 	return user, nil
 }
 
-func (s *UserService) DeleteUser(userId string) error {
-	db := s.DB.Table("users")
+// SetProfilePicture stores the resized pictures under a new key and points the user at the medium one.
+// The previous uploaded picture is deleted afterwards. Returns the URL of every size.
+func (s *UserService) SetProfilePicture(
+	ctx context.Context,
+	store utils.BlobStore,
+	userID uint,
+	resized map[string][]byte,
+) (map[string]string, error) {
 	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
 
-	userIDUint, err := strconv.ParseUint(userId, 10, 64)
-	if err != nil {
-		return err
+	prefix := fmt.Sprintf("avatars/%d/%s", userID, utils.CreateULID())
+	urls := make(map[string]string, len(resized))
+	for name, data := range resized {
+		key := prefix + "/" + name + ".jpg"
+		if err := store.Put(ctx, key, data, "image/jpeg"); err != nil {
+			return nil, err
+		}
+		urls[name] = store.URL(key)
 	}
-	user.ID = uint(userIDUint)
 
-	if err := db.Delete(&user).Error; err != nil {
-		return err
+	oldPrefix := user.PictureKey
+	if err := s.DB.Model(&user).Updates(map[string]interface{}{
+		"picture_url": urls["medium"],
+		"picture_key": prefix,
+	}).Error; err != nil {
+		return nil, err
 	}
 
-	return nil
+	if oldPrefix != "" {
+		for name := range utils.AvatarSizes {
+			if err := store.Delete(ctx, oldPrefix+"/"+name+".jpg"); err != nil {
+				s.Logger.Warn("Error deleting old profile picture: ", err)
+			}
+		}
+	}
+
+	return urls, nil
 }
 
 func (s *UserService) ValidateUsers(userIds []string) (*[]model.User, error) {
@@ -142,36 +426,101 @@ func (s *UserService) ValidateUsers(userIds []string) (*[]model.User, error) {
 	return &users, nil
 }
 
-func (s *UserService) MarkOnline(userId string) error {
-	if err := s.UpdateUserField(userId, "isOnline", true); err != nil {
-		return err
+// MarkOnline records that the user's first connection opened at the given time.
+// It reports whether friends should be told, i.e. the user was offline and doesn't hide their presence.
+func (s *UserService) MarkOnline(userId string, at time.Time) (bool, error) {
+	return s.setPresence(userId, true, at)
+}
+
+// MarkOffline records that the user's last connection closed at the given time.
+// It reports whether friends should be told, i.e. the user was online and doesn't hide their presence.
+func (s *UserService) MarkOffline(userId string, at time.Time) (bool, error) {
+	return s.setPresence(userId, false, at)
+}
+
+// setPresence ignores events older than the last change, so replayed or late events can't undo newer ones
+func (s *UserService) setPresence(userId string, isOnline bool, at time.Time) (bool, error) {
+	var user model.User
+
+	// UpdateColumns as presence isn't a profile change
+	result := s.DB.Model(&user).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "hide_presence"}}}).
+		Where("id = ? AND is_online <> ? AND (last_seen IS NULL OR last_seen <= ?)", userId, isOnline, at).
+		UpdateColumns(map[string]interface{}{
+			"is_online": isOnline,
+			"last_seen": at,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0 && !user.HidePresence, nil
+}
+
+// SetPresenceHidden lets a user appear offline to everyone while still connected
+func (s *UserService) SetPresenceHidden(userID uint, hidden bool) (*model.User, error) {
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		return nil, err
 	}
-	return nil
+
+	if err := s.DB.Model(&user).Update("hide_presence", hidden).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-func (s *UserService) MarkOffline(userId string) error {
-	updates := map[string]interface{}{
-		"isOnline": false,
-		"lastSeen": time.Now(),
+// BroadcastPresence sends the user's presence, as their friends see it, to each friend
+func (s *UserService) BroadcastPresence(kafkaSvc *KafkaService, userID uint) error {
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	var friendIDs []string
+	if err := s.DB.Table("user_friends").
+		Where("user_id = ?", userID).
+		Pluck("friend_id", &friendIDs).Error; err != nil {
+		return err
+	}
+	if len(friendIDs) == 0 {
+		return nil
 	}
 
-	err := s.DB.Model(&model.User{}).
-		Where("id = ?", userId).Updates(updates).Error
-	return err
+	return kafkaSvc.BroadcastMessage(&friendIDs, model_kafka.KafkaMessage{
+		MsgType: PRESENCE_MESSAGE_TYPE,
+		Data:    presenceOf(&user),
+	})
 }
 
-func (s *UserService) SearchUsers(currentUserID, query string) (*[]model.User, error) {
+// SearchUsers fuzzy matches the query against usernames and display names with pg_trgm,
+// and against the start of emails. Best matches come first.
+func (s *UserService) SearchUsers(currentUserID, query string, page int) (*[]model.User, error) {
 	db := s.DB
 	var users []model.User
 
+	query = strings.ToLower(strings.TrimSpace(query))
+	// Substring and prefix matches catch queries too short for trigram similarity
+	pattern := "%" + escapeLike(query) + "%"
+	prefix := escapeLike(query) + "%"
+
 	// Use LEFT JOIN to exclude friends
 	if err := db.
 		Table("users").
 		Joins("LEFT JOIN user_friends ON users.id = user_friends.friend_id AND user_friends.user_id = ?", currentUserID).
-		Where("users.username LIKE ?", "%"+query+"%").
+		Where("users.username % ? OR users.display_name % ? OR users.username ILIKE ? OR users.display_name ILIKE ? OR lower(users.email) LIKE ?",
+			query, query, pattern, pattern, prefix).
+		// Unverified accounts can't be found until they verify their email
+		Where("users.is_email_valid = ?", true).
 		Where("user_friends.friend_id IS NULL").
 		Where("users.id != ?", currentUserID).
-		Limit(10).
+		// Hide users on either side of a block
+		Where("NOT EXISTS (SELECT 1 FROM user_blocks WHERE (blocker_id = ? AND blocked_id = users.id) OR (blocker_id = users.id AND blocked_id = ?))",
+			currentUserID, currentUserID).
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "GREATEST(similarity(users.username, ?), similarity(users.display_name, ?), CASE WHEN lower(users.email) LIKE ? THEN 1 ELSE 0 END) DESC, users.username",
+			Vars: []interface{}{query, query, prefix},
+		}}).
+		Scopes(database.Paginate(page, USER_SEARCH_PAGE_SIZE)).
 		Find(&users).Error; err != nil {
 		return nil, err
 	}
@@ -179,28 +528,42 @@ func (s *UserService) SearchUsers(currentUserID, query string) (*[]model.User, e
 	return &users, nil
 }
 
-func (s *UserService) SendFriendRequest(senderID, receiverID uint) error {
+// escapeLike escapes the LIKE wildcards in user input
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (s *UserService) SendFriendRequest(senderID, receiverID uint) (*model.FriendRequest, error) {
 	db := s.DB
 
 	if senderID == receiverID {
-		return errors.New("cannot send friend request to yourself")
+		return nil, errors.New("cannot send friend request to yourself")
 	}
 
 	// Check if they are already friends
 	var sender model.User
 	if err := db.Preload("Friends").First(&sender, senderID).Error; err != nil {
-		return errors.New("sender not found")
+		return nil, errors.New("sender not found")
 	}
 	for _, friend := range sender.Friends {
 		if friend.ID == receiverID {
-			return errors.New("already friends")
+			return nil, errors.New("already friends")
 		}
 	}
 
 	// Check if a friend request already exists (either sent by userA or userB)
 	var existing model.FriendRequest
-	if err := db.Where("((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)) AND status = ?", senderID, receiverID, receiverID, senderID, "pending").First(&existing).Error; err == nil {
-		return errors.New("friend request already sent")
+	if err := db.Where("((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)) AND status = ? AND sent_at > ?",
+		senderID, receiverID, receiverID, senderID, "pending", time.Now().Add(-FriendRequestExpiry())).First(&existing).Error; err == nil {
+		return nil, errors.New("friend request already sent")
+	}
+
+	blocked, err := s.IsBlocked(senderID, receiverID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, errors.New("cannot send friend request to this user")
 	}
 
 	// Create new friend request
@@ -209,61 +572,73 @@ func (s *UserService) SendFriendRequest(senderID, receiverID uint) error {
 		ReceiverID: receiverID,
 		Status:     "pending",
 	}
-	return db.Create(&request).Error
+	if err := db.Create(&request).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
 }
 
-func (s *UserService) AcceptFriendRequest(requestID uint) error {
+func (s *UserService) AcceptFriendRequest(receiverID, requestID uint) (*model.FriendRequest, error) {
 	db := s.DB
 	var request model.FriendRequest
 
-	if err := db.First(&request, requestID).Error; err != nil {
-		return err
+	if err := db.Where("id = ? AND receiver_id = ?", requestID, receiverID).First(&request).Error; err != nil {
+		return nil, err
 	}
 
 	if request.Status != "pending" {
-		return errors.New("friend request already processed")
+		return nil, errors.New("friend request already processed")
+	}
+	if request.SentAt.Before(time.Now().Add(-FriendRequestExpiry())) {
+		return nil, errors.New("friend request expired")
 	}
 
 	request.Status = "accepted"
 	request.RespondedAt = time.Now()
 	if err := db.Save(&request).Error; err != nil {
-		return err
+		return nil, err
 	}
 
 	// Add each user to the other's friend list
 	var sender, receiver model.User
 	if err := db.First(&sender, request.SenderID).Error; err != nil {
-		return err
+		return nil, err
 	}
 	if err := db.First(&receiver, request.ReceiverID).Error; err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := db.Model(&sender).Association("Friends").Append(&receiver); err != nil {
-		return err
+		return nil, err
 	}
 	if err := db.Model(&receiver).Association("Friends").Append(&sender); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &request, nil
 }
 
-func (s *UserService) RejectFriendRequest(requestID uint) error {
+func (s *UserService) RejectFriendRequest(receiverID, requestID uint) (*model.FriendRequest, error) {
 	db := s.DB
 	var request model.FriendRequest
 
-	if err := db.First(&request, requestID).Error; err != nil {
-		return err
+	if err := db.Where("id = ? AND receiver_id = ?", requestID, receiverID).First(&request).Error; err != nil {
+		return nil, err
 	}
 
 	if request.Status != "pending" {
-		return errors.New("friend request already processed")
+		return nil, errors.New("friend request already processed")
+	}
+	if request.SentAt.Before(time.Now().Add(-FriendRequestExpiry())) {
+		return nil, errors.New("friend request expired")
 	}
 
 	request.Status = "rejected"
 	request.RespondedAt = time.Now()
-	return db.Save(&request).Error
+	if err := db.Save(&request).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
 }
 
 func (s *UserService) RemoveFriend(userID, friendID uint) error {
@@ -286,7 +661,7 @@ func (s *UserService) RemoveFriend(userID, friendID uint) error {
 		return err
 	}
 
-	return nil
+	return removeFromEachOthersCircles(db, userID, friendID)
 }
 
 func (s *UserService) GetFriends(userID string) ([]model.User, error) {
@@ -306,13 +681,105 @@ func (s *UserService) GetFriends(userID string) ([]model.User, error) {
 	return friends, nil
 }
 
+// GetFriendSuggestions ranks verified non-friends by mutual friends, then by rooms attended together.
+// Blocked users and users with a pending request either way are left out.
+func (s *UserService) GetFriendSuggestions(userID uint, limit int) (*[]FriendSuggestion, error) {
+	db := s.DB
+
+	var ranked []struct {
+		UserID        uint
+		MutualFriends int64
+		SharedRooms   int64
+	}
+	if err := db.Raw(`
+		WITH mutual AS (
+			SELECT f2.friend_id AS user_id, COUNT(*) AS mutual_friends
+			FROM user_friends f1
+			JOIN user_friends f2 ON f2.user_id = f1.friend_id
+			WHERE f1.user_id = @user
+			GROUP BY f2.friend_id
+		), shared AS (
+			SELECT r2.user_id, COUNT(*) AS shared_rooms
+			FROM room_users r1
+			JOIN room_users r2 ON r2.room_id = r1.room_id
+			WHERE r1.user_id = @user
+			GROUP BY r2.user_id
+		), candidates AS (
+			SELECT user_id FROM mutual UNION SELECT user_id FROM shared
+		)
+		SELECT c.user_id, COALESCE(m.mutual_friends, 0) AS mutual_friends, COALESCE(s.shared_rooms, 0) AS shared_rooms
+		FROM candidates c
+		JOIN users u ON u.id = c.user_id AND u.is_email_valid = true
+		LEFT JOIN mutual m ON m.user_id = c.user_id
+		LEFT JOIN shared s ON s.user_id = c.user_id
+		WHERE c.user_id != @user
+			AND NOT EXISTS (SELECT 1 FROM user_friends WHERE user_id = @user AND friend_id = c.user_id)
+			AND NOT EXISTS (SELECT 1 FROM user_blocks WHERE (blocker_id = @user AND blocked_id = c.user_id) OR (blocker_id = c.user_id AND blocked_id = @user))
+			AND NOT EXISTS (SELECT 1 FROM friend_requests WHERE ((sender_id = @user AND receiver_id = c.user_id) OR (sender_id = c.user_id AND receiver_id = @user)) AND status = 'pending' AND sent_at > @expiry)
+		ORDER BY mutual_friends DESC, shared_rooms DESC, c.user_id
+		LIMIT @limit`,
+		map[string]interface{}{
+			"user":   userID,
+			"expiry": time.Now().Add(-FriendRequestExpiry()),
+			"limit":  limit,
+		}).Scan(&ranked).Error; err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]FriendSuggestion, 0, len(ranked))
+	if len(ranked) == 0 {
+		return &suggestions, nil
+	}
+
+	userIds := make([]uint, len(ranked))
+	for i, r := range ranked {
+		userIds[i] = r.UserID
+	}
+	var users []model.User
+	if err := db.Where("id IN ?", userIds).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	usersById := make(map[uint]model.User, len(users))
+	for _, user := range users {
+		usersById[user.ID] = user
+	}
+
+	for _, r := range ranked {
+		user, ok := usersById[r.UserID]
+		if !ok {
+			continue
+		}
+		suggestions = append(suggestions, FriendSuggestion{
+			User:          user,
+			MutualFriends: r.MutualFriends,
+			SharedRooms:   r.SharedRooms,
+			Reason:        suggestionReason(r.MutualFriends, r.SharedRooms),
+		})
+	}
+	return &suggestions, nil
+}
+
+func suggestionReason(mutualFriends, sharedRooms int64) string {
+	var reasons []string
+	if mutualFriends == 1 {
+		reasons = append(reasons, "1 mutual friend")
+	} else if mutualFriends > 1 {
+		reasons = append(reasons, fmt.Sprintf("%d mutual friends", mutualFriends))
+	}
+	if sharedRooms == 1 {
+		reasons = append(reasons, "1 room together")
+	} else if sharedRooms > 1 {
+		reasons = append(reasons, fmt.Sprintf("%d rooms together", sharedRooms))
+	}
+	return strings.Join(reasons, ", ")
+}
+
 func (s *UserService) GetFriendRequestsByStatus(userID uint, status string) (*[]model.FriendRequest, error) {
 	db := s.DB
 	var requests []model.FriendRequest
 
 	// Validate status
-	validStatuses := map[string]bool{"pending": true, "accepted": true, "rejected": true}
-	if !validStatuses[status] {
+	if !validFriendRequestStatuses[status] {
 		return nil, errors.New("invalid status")
 	}
 
@@ -327,6 +794,68 @@ func (s *UserService) GetFriendRequestsByStatus(userID uint, status string) (*[]
 	return &requests, nil
 }
 
+// GetSentFriendRequestsByStatus returns the requests the user sent, newest first
+func (s *UserService) GetSentFriendRequestsByStatus(userID uint, status string) (*[]model.FriendRequest, error) {
+	var requests []model.FriendRequest
+
+	if !validFriendRequestStatuses[status] {
+		return nil, errors.New("invalid status")
+	}
+
+	if err := s.DB.Where("sender_id = ? AND status = ?", userID, status).
+		Preload("Sender").
+		Preload("Receiver").
+		Order("sent_at DESC").
+		Find(&requests).Error; err != nil {
+		return nil, err
+	}
+
+	return &requests, nil
+}
+
+// GetAllFriendRequests returns every request the user sent or received, in any status
+func (s *UserService) GetAllFriendRequests(userID uint) (*[]model.FriendRequest, error) {
+	var requests []model.FriendRequest
+
+	if err := s.DB.Where("sender_id = ? OR receiver_id = ?", userID, userID).
+		Preload("Sender").
+		Preload("Receiver").
+		Order("sent_at DESC").
+		Find(&requests).Error; err != nil {
+		return nil, err
+	}
+
+	return &requests, nil
+}
+
+// CancelFriendRequest withdraws a pending request sent by the user
+func (s *UserService) CancelFriendRequest(senderID, requestID uint) (*model.FriendRequest, error) {
+	db := s.DB
+	var request model.FriendRequest
+
+	if err := db.Where("id = ? AND sender_id = ?", requestID, senderID).First(&request).Error; err != nil {
+		return nil, err
+	}
+
+	if request.Status != "pending" {
+		return nil, errors.New("friend request already processed")
+	}
+
+	request.Status = "cancelled"
+	request.RespondedAt = time.Now()
+	if err := db.Save(&request).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// ExpireFriendRequests marks pending requests older than the expiry period as expired
+func (s *UserService) ExpireFriendRequests() error {
+	return s.DB.Model(&model.FriendRequest{}).
+		Where("status = ? AND sent_at < ?", "pending", time.Now().Add(-FriendRequestExpiry())).
+		Updates(map[string]interface{}{"status": "expired", "responded_at": time.Now()}).Error
+}
+
 func (s *UserService) CountPendingFriendRequests(userID uint) (int64, error) {
 	db := s.DB
 	var count int64
@@ -341,6 +870,29 @@ func (s *UserService) CountPendingFriendRequests(userID uint) (int64, error) {
 	return count, nil
 }
 
+// GetFriendsPresence returns whether each friend is online, online friends first.
+// Friends who hide their presence always appear offline.
+func (s *UserService) GetFriendsPresence(userID uint) (*[]Presence, error) {
+	var friends []model.User
+	if err := s.DB.Model(&model.User{}).
+		Select("users.id, users.is_online, users.last_seen, users.hide_presence").
+		Joins("JOIN user_friends ON user_friends.friend_id = users.id").
+		Where("user_friends.user_id = ?", userID).
+		Order("users.id").
+		Find(&friends).Error; err != nil {
+		return nil, err
+	}
+
+	presences := make([]Presence, 0, len(friends))
+	for i := range friends {
+		presences = append(presences, presenceOf(&friends[i]))
+	}
+	sort.SliceStable(presences, func(i, j int) bool {
+		return presences[i].IsOnline && !presences[j].IsOnline
+	})
+	return &presences, nil
+}
+
 func (s *UserService) GetNumFriends(userID string) (int64, error) {
 	db := s.DB
 	var user model.User
@@ -374,3 +926,73 @@ func (s *UserService) IsFriend(userID uint, friendID uint) bool {
 
 	return true
 }
+
+// IsBlocked reports whether either user has blocked the other
+func (s *UserService) IsBlocked(userID, otherID uint) (bool, error) {
+	var count int64
+	if err := s.DB.Model(&model.UserBlock{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", userID, otherID, otherID, userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BlockUser blocks a user, ending any friendship and pending friend requests between them
+func (s *UserService) BlockUser(blockerID, blockedID uint) error {
+	db := s.DB
+
+	if blockerID == blockedID {
+		return errors.New("cannot block yourself")
+	}
+
+	var blocked model.User
+	if err := db.First(&blocked, blockedID).Error; err != nil {
+		return err
+	}
+
+	block := model.UserBlock{
+		BlockerID: blockerID,
+		BlockedID: blockedID,
+	}
+	if err := db.Omit("Blocker", "Blocked").
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&block).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec("DELETE FROM user_friends WHERE (user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)",
+		blockerID, blockedID, blockedID, blockerID).Error; err != nil {
+		return err
+	}
+	if err := removeFromEachOthersCircles(db, blockerID, blockedID); err != nil {
+		return err
+	}
+
+	return db.Model(&model.FriendRequest{}).
+		Where("((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)) AND status = ?",
+			blockerID, blockedID, blockedID, blockerID, "pending").
+		Updates(map[string]interface{}{"status": "rejected", "responded_at": time.Now()}).Error
+}
+
+func (s *UserService) UnblockUser(blockerID, blockedID uint) error {
+	result := s.DB.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&model.UserBlock{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *UserService) GetBlockedUsers(blockerID uint) (*[]model.UserBlock, error) {
+	var blocks []model.UserBlock
+	if err := s.DB.Where("blocker_id = ?", blockerID).
+		Preload("Blocked").
+		Order("created_at DESC").
+		Find(&blocks).Error; err != nil {
+		return nil, err
+	}
+	return &blocks, nil
+}
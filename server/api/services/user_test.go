@@ -1,7 +1,11 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -13,6 +17,7 @@ import (
 
 	"github.com/RowenTey/JustJio/server/api/model"
 	"github.com/RowenTey/JustJio/server/api/tests"
+	"github.com/RowenTey/JustJio/server/api/utils"
 )
 
 type UserServiceTestSuite struct {
@@ -105,8 +110,8 @@ func (s *UserServiceTestSuite) TestUpdateUserField_Username() {
 
 	s.mock.ExpectBegin()
 	s.mock.ExpectExec(`UPDATE "users" SET`).
-		WithArgs("newjohndoe", "john@example.com", "hashedpassword",
-			"https://default-image.jpg", true, false, sqlmock.AnyArg(),
+		WithArgs("newjohndoe", "", "", "", "", "", "john@example.com", "hashedpassword", false,
+			"https://default-image.jpg", "", true, false, sqlmock.AnyArg(), false,
 			sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectCommit()
@@ -132,8 +137,8 @@ func (s *UserServiceTestSuite) TestUpdateUserField_IsEmailValid() {
 
 	s.mock.ExpectBegin()
 	s.mock.ExpectExec(`UPDATE "users" SET`).
-		WithArgs("oldjohndoe", "john@example.com", "hashedpassword",
-			"https://default-image.jpg", true, false, sqlmock.AnyArg(),
+		WithArgs("oldjohndoe", "", "", "", "", "", "john@example.com", "hashedpassword", false,
+			"https://default-image.jpg", "", true, false, sqlmock.AnyArg(), false,
 			sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectCommit()
@@ -159,8 +164,8 @@ func (s *UserServiceTestSuite) TestUpdateUserField_IsOnline() {
 
 	s.mock.ExpectBegin()
 	s.mock.ExpectExec(`UPDATE "users" SET`).
-		WithArgs("oldjohndoe", "john@example.com", "hashedpassword",
-			"https://default-image.jpg", true, true, sqlmock.AnyArg(),
+		WithArgs("oldjohndoe", "", "", "", "", "", "john@example.com", "hashedpassword", false,
+			"https://default-image.jpg", "", true, true, sqlmock.AnyArg(), false,
 			sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectCommit()
@@ -188,8 +193,8 @@ func (s *UserServiceTestSuite) TestUpdateUserField_LastSeen() {
 
 	s.mock.ExpectBegin()
 	s.mock.ExpectExec(`UPDATE "users" SET`).
-		WithArgs("oldjohndoe", "john@example.com", "hashedpassword",
-			"https://default-image.jpg", true, false, sqlmock.AnyArg(),
+		WithArgs("oldjohndoe", "", "", "", "", "", "john@example.com", "hashedpassword", false,
+			"https://default-image.jpg", "", true, false, sqlmock.AnyArg(), false,
 			sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectCommit()
@@ -215,6 +220,119 @@ func (s *UserServiceTestSuite) TestUpdateUserField_UserNotFound() {
 	assert.Equal(s.T(), gorm.ErrRecordNotFound, err)
 }
 
+func (s *UserServiceTestSuite) TestUpdateProfile_Success() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1 ORDER BY "users"."id" LIMIT \$2`).
+		WithArgs(s.userId, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "bio"}).
+			AddRow(s.userId, s.username, "old bio"))
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE phone_num = \$1 AND id <> \$2`).
+		WithArgs("+6591234567", s.userId).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "users" SET "bio"=\$1,"locale"=\$2,"phone_num"=\$3,"updated_at"=\$4 WHERE "id" = \$5`).
+		WithArgs("", "en-SG", "+6591234567", sqlmock.AnyArg(), s.userId).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit()
+
+	patch := map[string]json.RawMessage{
+		"bio":      json.RawMessage(`null`),
+		"phoneNum": json.RawMessage(`"+65 9123-4567"`),
+		"locale":   json.RawMessage(`"en-sg"`),
+	}
+
+	// act
+	user, err := s.userService.UpdateProfile(s.userId, patch)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "", user.Bio)
+	assert.Equal(s.T(), "+6591234567", user.PhoneNum)
+	assert.Equal(s.T(), "en-SG", user.Locale)
+}
+
+func (s *UserServiceTestSuite) TestUpdateProfile_RejectsSystemField() {
+	// arrange
+	patch := map[string]json.RawMessage{
+		"bio":          json.RawMessage(`"hi"`),
+		"isEmailValid": json.RawMessage(`true`),
+	}
+
+	// act
+	_, err := s.userService.UpdateProfile(s.userId, patch)
+
+	// assert
+	var fieldErr *ProfileFieldError
+	assert.ErrorAs(s.T(), err, &fieldErr)
+	assert.Equal(s.T(), "isEmailValid", fieldErr.Field)
+}
+
+func (s *UserServiceTestSuite) TestUpdateProfile_InvalidValues() {
+	tests := map[string]string{
+		"username": `"a b"`,
+		"bio":      `42`,
+		"phoneNum": `"91234567"`,
+		"timeZone": `"Local"`,
+		"locale":   `"not a locale"`,
+	}
+
+	for field, value := range tests {
+		// act
+		_, err := s.userService.UpdateProfile(s.userId, map[string]json.RawMessage{field: json.RawMessage(value)})
+
+		// assert
+		var fieldErr *ProfileFieldError
+		assert.ErrorAs(s.T(), err, &fieldErr, field)
+	}
+}
+
+func (s *UserServiceTestSuite) TestUpdateProfile_UsernameTaken() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1 ORDER BY "users"."id" LIMIT \$2`).
+		WithArgs(s.userId, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(s.userId, s.username))
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE username = \$1 AND id <> \$2`).
+		WithArgs("janedoe", s.userId).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	// act
+	_, err := s.userService.UpdateProfile(s.userId, map[string]json.RawMessage{"username": json.RawMessage(`"janedoe"`)})
+
+	// assert
+	assert.ErrorIs(s.T(), err, ErrUsernameTaken)
+}
+
+func (s *UserServiceTestSuite) TestSetProfilePicture_ReplacesOldPicture() {
+	// arrange
+	store := &utils.LocalBlobStore{Dir: s.T().TempDir()}
+	ctx := context.Background()
+	for name := range utils.AvatarSizes {
+		assert.NoError(s.T(), store.Put(ctx, "avatars/1/old/"+name+".jpg", []byte("old"), "image/jpeg"))
+	}
+
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1 ORDER BY "users"."id" LIMIT \$2`).
+		WithArgs(s.userId, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "picture_key"}).
+			AddRow(s.userId, s.username, "avatars/1/old"))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "users" SET "picture_key"=\$1,"picture_url"=\$2,"updated_at"=\$3 WHERE "id" = \$4`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), s.userId).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit()
+
+	resized := map[string][]byte{"small": []byte("s"), "medium": []byte("m"), "large": []byte("l")}
+
+	// act
+	urls, err := s.userService.SetProfilePicture(ctx, store, s.userId, resized)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), urls, 3)
+	assert.Regexp(s.T(), `^/blobs/avatars/1/[0-9A-Z]+/medium\.jpg$`, urls["medium"])
+	_, err = os.Stat(filepath.Join(store.Dir, "avatars", "1", "old", "medium.jpg"))
+	assert.True(s.T(), os.IsNotExist(err))
+}
+
 func (s *UserServiceTestSuite) TestUpdateUserField_UnsupportedField() {
 	// arrange
 	now := time.Now()
@@ -249,8 +367,8 @@ func (s *UserServiceTestSuite) TestUpdateUserField_DatabaseError() {
 
 	s.mock.ExpectBegin()
 	s.mock.ExpectExec(`UPDATE "users" SET`).
-		WithArgs("newjohndoe", "john@example.com", "hashedpassword",
-			"https://default-image.jpg", true, false, sqlmock.AnyArg(),
+		WithArgs("newjohndoe", "", "", "", "", "", "john@example.com", "hashedpassword", false,
+			"https://default-image.jpg", "", true, false, sqlmock.AnyArg(), false,
 			sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
 		WillReturnError(errors.New("database error"))
 	s.mock.ExpectRollback()
@@ -263,18 +381,6 @@ func (s *UserServiceTestSuite) TestUpdateUserField_DatabaseError() {
 	assert.Contains(s.T(), err.Error(), "database error")
 }
 
-func (s *UserServiceTestSuite) TestDeleteUser_Success() {
-	s.mock.ExpectBegin()
-	s.mock.ExpectExec(`DELETE FROM "users" WHERE "users"."id" = \$1`).
-		WithArgs(1).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-	s.mock.ExpectCommit()
-
-	err := s.userService.DeleteUser("1")
-
-	assert.NoError(s.T(), err)
-}
-
 func (s *UserServiceTestSuite) TestSendFriendRequest_Success() {
 	// arrange
 	senderID := uint(1)
@@ -296,10 +402,15 @@ func (s *UserServiceTestSuite) TestSendFriendRequest_Success() {
 		WillReturnRows(sqlmock.NewRows([]string{"user_id", "friend_id"}))
 
 	// Mock checking for existing friend requests
-	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE \(\(sender_id = \$1 AND receiver_id = \$2\) OR \(sender_id = \$3 AND receiver_id = \$4\)\) AND status = \$5 ORDER BY "friend_requests"."id" LIMIT \$6`).
-		WithArgs(senderID, receiverID, receiverID, senderID, "pending", 1).
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE \(\(sender_id = \$1 AND receiver_id = \$2\) OR \(sender_id = \$3 AND receiver_id = \$4\)\) AND status = \$5 AND sent_at > \$6 ORDER BY "friend_requests"."id" LIMIT \$7`).
+		WithArgs(senderID, receiverID, receiverID, senderID, "pending", sqlmock.AnyArg(), 1).
 		WillReturnError(gorm.ErrRecordNotFound)
 
+	// Mock checking for blocks between the users
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks" WHERE \(blocker_id = \$1 AND blocked_id = \$2\) OR \(blocker_id = \$3 AND blocked_id = \$4\)`).
+		WithArgs(senderID, receiverID, receiverID, senderID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
 	// Mock creating the friend request
 	s.mock.ExpectBegin()
 	s.mock.ExpectQuery(`INSERT INTO "friend_requests" .*`).
@@ -308,7 +419,7 @@ func (s *UserServiceTestSuite) TestSendFriendRequest_Success() {
 	s.mock.ExpectCommit()
 
 	// act
-	err := s.userService.SendFriendRequest(senderID, receiverID)
+	_, err := s.userService.SendFriendRequest(senderID, receiverID)
 
 	// assert
 	assert.NoError(s.T(), err)
@@ -319,7 +430,7 @@ func (s *UserServiceTestSuite) TestSendFriendRequest_SameUser() {
 	senderID := uint(1)
 
 	// act
-	err := s.userService.SendFriendRequest(senderID, senderID)
+	_, err := s.userService.SendFriendRequest(senderID, senderID)
 
 	// assert
 	assert.Error(s.T(), err)
@@ -337,7 +448,7 @@ func (s *UserServiceTestSuite) TestSendFriendRequest_SenderNotFound() {
 		WillReturnError(gorm.ErrRecordNotFound)
 
 	// act
-	err := s.userService.SendFriendRequest(senderID, receiverID)
+	_, err := s.userService.SendFriendRequest(senderID, receiverID)
 
 	// assert
 	assert.Error(s.T(), err)
@@ -376,7 +487,7 @@ func (s *UserServiceTestSuite) TestSendFriendRequest_AlreadyFriends() {
 				"", true, false, time.Now(), time.Now(), time.Now()))
 
 	// act
-	err := s.userService.SendFriendRequest(senderID, receiverID)
+	_, err := s.userService.SendFriendRequest(senderID, receiverID)
 
 	// assert
 	assert.Error(s.T(), err)
@@ -404,13 +515,13 @@ func (s *UserServiceTestSuite) TestSendFriendRequest_RequestAlreadySent() {
 		WillReturnRows(sqlmock.NewRows([]string{"user_id", "friend_id"}))
 
 	// Mock finding an existing friend request
-	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE \(\(sender_id = \$1 AND receiver_id = \$2\) OR \(sender_id = \$3 AND receiver_id = \$4\)\) AND status = \$5 ORDER BY "friend_requests"."id" LIMIT \$6`).
-		WithArgs(senderID, receiverID, receiverID, senderID, "pending", 1).
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE \(\(sender_id = \$1 AND receiver_id = \$2\) OR \(sender_id = \$3 AND receiver_id = \$4\)\) AND status = \$5 AND sent_at > \$6 ORDER BY "friend_requests"."id" LIMIT \$7`).
+		WithArgs(senderID, receiverID, receiverID, senderID, "pending", sqlmock.AnyArg(), 1).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "receiver_id", "status"}).
 			AddRow(1, senderID, receiverID, "pending"))
 
 	// act
-	err := s.userService.SendFriendRequest(senderID, receiverID)
+	_, err := s.userService.SendFriendRequest(senderID, receiverID)
 
 	// assert
 	assert.Error(s.T(), err)
@@ -438,10 +549,15 @@ func (s *UserServiceTestSuite) TestSendFriendRequest_DatabaseError() {
 		WillReturnRows(sqlmock.NewRows([]string{"user_id", "friend_id"}))
 
 	// Mock checking for existing friend requests
-	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE \(\(sender_id = \$1 AND receiver_id = \$2\) OR \(sender_id = \$3 AND receiver_id = \$4\)\) AND status = \$5 ORDER BY "friend_requests"."id" LIMIT \$6`).
-		WithArgs(senderID, receiverID, receiverID, senderID, "pending", 1).
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE \(\(sender_id = \$1 AND receiver_id = \$2\) OR \(sender_id = \$3 AND receiver_id = \$4\)\) AND status = \$5 AND sent_at > \$6 ORDER BY "friend_requests"."id" LIMIT \$7`).
+		WithArgs(senderID, receiverID, receiverID, senderID, "pending", sqlmock.AnyArg(), 1).
 		WillReturnError(gorm.ErrRecordNotFound)
 
+	// Mock checking for blocks between the users
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks" WHERE \(blocker_id = \$1 AND blocked_id = \$2\) OR \(blocker_id = \$3 AND blocked_id = \$4\)`).
+		WithArgs(senderID, receiverID, receiverID, senderID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
 	// Mock database error when creating request
 	s.mock.ExpectBegin()
 	s.mock.ExpectQuery(`INSERT INTO "friend_requests" .*`).
@@ -450,13 +566,104 @@ func (s *UserServiceTestSuite) TestSendFriendRequest_DatabaseError() {
 	s.mock.ExpectRollback()
 
 	// act
-	err := s.userService.SendFriendRequest(senderID, receiverID)
+	_, err := s.userService.SendFriendRequest(senderID, receiverID)
 
 	// assert
 	assert.Error(s.T(), err)
 	assert.Contains(s.T(), err.Error(), "database connection error")
 }
 
+func (s *UserServiceTestSuite) TestSendFriendRequest_Blocked() {
+	// arrange
+	senderID := uint(1)
+	receiverID := uint(2)
+
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1 ORDER BY "users"."id" LIMIT \$2`).
+		WithArgs(senderID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(senderID, "sender"))
+	s.mock.ExpectQuery(`SELECT \* FROM "user_friends" WHERE "user_friends"."user_id" = \$1`).
+		WithArgs(senderID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "friend_id"}))
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE .+ LIMIT \$7`).
+		WithArgs(senderID, receiverID, receiverID, senderID, "pending", sqlmock.AnyArg(), 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	// The receiver has blocked the sender
+	s.mock.ExpectQuery(`SELECT count\(\*\) FROM "user_blocks" WHERE \(blocker_id = \$1 AND blocked_id = \$2\) OR \(blocker_id = \$3 AND blocked_id = \$4\)`).
+		WithArgs(senderID, receiverID, receiverID, senderID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	// act
+	_, err := s.userService.SendFriendRequest(senderID, receiverID)
+
+	// assert
+	assert.Error(s.T(), err)
+	assert.Equal(s.T(), "cannot send friend request to this user", err.Error())
+}
+
+func (s *UserServiceTestSuite) TestBlockUser_Success() {
+	// arrange
+	blockerID := uint(1)
+	blockedID := uint(2)
+
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1 ORDER BY "users"."id" LIMIT \$2`).
+		WithArgs(blockedID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(blockedID, "blocked"))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`INSERT INTO "user_blocks" \("blocker_id","blocked_id","created_at"\) VALUES \(\$1,\$2,\$3\) ON CONFLICT DO NOTHING`).
+		WithArgs(blockerID, blockedID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// Remove the friendship in both directions
+	s.mock.ExpectExec(`DELETE FROM user_friends WHERE \(user_id = \$1 AND friend_id = \$2\) OR \(user_id = \$3 AND friend_id = \$4\)`).
+		WithArgs(blockerID, blockedID, blockedID, blockerID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	// Take them out of each other's circles
+	s.mock.ExpectExec(`DELETE FROM friend_circle_members WHERE`).
+		WithArgs(blockedID, blockerID, blockerID, blockedID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// Reject pending friend requests
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "friend_requests" SET "responded_at"=\$1,"status"=\$2 WHERE \(\(sender_id = \$3 AND receiver_id = \$4\) OR \(sender_id = \$5 AND receiver_id = \$6\)\) AND status = \$7`).
+		WithArgs(sqlmock.AnyArg(), "rejected", blockerID, blockedID, blockedID, blockerID, "pending").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.userService.BlockUser(blockerID, blockedID)
+
+	// assert
+	assert.NoError(s.T(), err)
+}
+
+func (s *UserServiceTestSuite) TestBlockUser_Self() {
+	// act
+	err := s.userService.BlockUser(1, 1)
+
+	// assert
+	assert.Error(s.T(), err)
+	assert.Equal(s.T(), "cannot block yourself", err.Error())
+}
+
+func (s *UserServiceTestSuite) TestUnblockUser_NotBlocked() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`DELETE FROM "user_blocks" WHERE blocker_id = \$1 AND blocked_id = \$2`).
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.userService.UnblockUser(1, 2)
+
+	// assert
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
 func (s *UserServiceTestSuite) TestGetUserByUsername_Success() {
 	// arrange
 	expectedUser := tests.CreateTestUser(s.userId, s.username, s.email)
@@ -564,12 +771,20 @@ func (s *UserServiceTestSuite) TestCreateOrUpdateUser_Create() {
 	s.mock.ExpectQuery(`INSERT INTO "users"`).
 		WithArgs(
 			user.Username,
+			user.DisplayName,
+			user.Bio,
+			user.PhoneNum,
+			user.TimeZone,
+			user.Locale,
 			user.Email,
 			user.Password,
+			user.HasPassword,
 			user.PictureUrl,
+			user.PictureKey,
 			user.IsEmailValid,
 			user.IsOnline,
 			sqlmock.AnyArg(), // LastSeen
+			user.HidePresence,
 			sqlmock.AnyArg(), // RegisteredAt
 			sqlmock.AnyArg(), // UpdatedAt
 		).
@@ -604,12 +819,20 @@ func (s *UserServiceTestSuite) TestCreateOrUpdateUser_Update() {
 	s.mock.ExpectExec(`UPDATE "users" SET`).
 		WithArgs(
 			user.Username,
+			user.DisplayName,
+			user.Bio,
+			user.PhoneNum,
+			user.TimeZone,
+			user.Locale,
 			user.Email,
 			user.Password,
+			user.HasPassword,
 			user.PictureUrl,
+			user.PictureKey,
 			user.IsEmailValid,
 			user.IsOnline,
 			sqlmock.AnyArg(), // LastSeen
+			user.HidePresence,
 			sqlmock.AnyArg(), // RegisteredAt (not updated)
 			sqlmock.AnyArg(), // UpdatedAt (updated)
 			user.ID,
@@ -641,12 +864,20 @@ func (s *UserServiceTestSuite) TestCreateOrUpdateUser_Error() {
 	s.mock.ExpectQuery(`INSERT INTO "users"`).
 		WithArgs(
 			user.Username,
+			user.DisplayName,
+			user.Bio,
+			user.PhoneNum,
+			user.TimeZone,
+			user.Locale,
 			user.Email,
 			user.Password,
+			user.HasPassword,
 			user.PictureUrl,
+			user.PictureKey,
 			user.IsEmailValid,
 			user.IsOnline,
 			sqlmock.AnyArg(), // LastSeen
+			user.HidePresence,
 			sqlmock.AnyArg(), // RegisteredAt
 			sqlmock.AnyArg(), // UpdatedAt
 		).
@@ -740,64 +971,80 @@ func (s *UserServiceTestSuite) TestMarkOnline_Success() {
 	userId := "1"
 	now := time.Now()
 
-	// First, the user is fetched
-	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1 ORDER BY "users"."id" LIMIT \$2`).
-		WithArgs(userId, 1).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"id", "username", "email", "password", "picture_url",
-			"is_email_valid", "is_online", "last_seen",
-			"registered_at", "updated_at"}).
-			AddRow(1, "johndoe", "john@example.com", "hashedpassword",
-				"https://default-image.jpg", true, false, now, now, now))
-
-	// Then, the user is updated
 	s.mock.ExpectBegin()
-	s.mock.ExpectExec(`UPDATE "users" SET`).
-		WithArgs("johndoe", "john@example.com", "hashedpassword",
-			"https://default-image.jpg", true, true, sqlmock.AnyArg(),
-			sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectQuery(`UPDATE "users" SET "is_online"=\$1,"last_seen"=\$2 WHERE id = \$3 AND is_online <> \$4 AND \(last_seen IS NULL OR last_seen <= \$5\) RETURNING "hide_presence"`).
+		WithArgs(true, now, userId, true, now).
+		WillReturnRows(sqlmock.NewRows([]string{"hide_presence"}).AddRow(false))
 	s.mock.ExpectCommit()
 
 	// act
-	err := s.userService.MarkOnline(userId)
+	changed, err := s.userService.MarkOnline(userId, now)
 
 	// assert
 	assert.NoError(s.T(), err)
+	assert.True(s.T(), changed)
 }
 
-func (s *UserServiceTestSuite) TestMarkOnline_UserNotFound() {
+func (s *UserServiceTestSuite) TestMarkOnline_Hidden() {
 	// arrange
-	userId := "999"
+	userId := "1"
+	now := time.Now()
 
-	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE "users"."id" = \$1 ORDER BY "users"."id" LIMIT \$2`).
-		WithArgs(userId, 1).
-		WillReturnError(gorm.ErrRecordNotFound)
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(`UPDATE "users" SET "is_online"=\$1,"last_seen"=\$2 WHERE .* RETURNING "hide_presence"`).
+		WithArgs(true, now, userId, true, now).
+		WillReturnRows(sqlmock.NewRows([]string{"hide_presence"}).AddRow(true))
+	s.mock.ExpectCommit()
 
 	// act
-	err := s.userService.MarkOnline(userId)
+	changed, err := s.userService.MarkOnline(userId, now)
 
 	// assert
-	assert.Error(s.T(), err)
-	assert.Equal(s.T(), gorm.ErrRecordNotFound, err)
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), changed)
 }
 
-func (s *UserServiceTestSuite) TestMarkOffline_Success() {
+func (s *UserServiceTestSuite) TestMarkOffline_StaleEvent() {
 	// arrange
 	userId := "1"
+	at := time.Now().Add(-time.Minute)
 
+	// No row matches when the user already went online again after this event
 	s.mock.ExpectBegin()
-	s.mock.ExpectExec(`UPDATE "users" SET`).
-		WithArgs(false, sqlmock.AnyArg(),
-			sqlmock.AnyArg(), userId).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectQuery(`UPDATE "users" SET "is_online"=\$1,"last_seen"=\$2 WHERE .* RETURNING "hide_presence"`).
+		WithArgs(false, at, userId, false, at).
+		WillReturnRows(sqlmock.NewRows([]string{"hide_presence"}))
 	s.mock.ExpectCommit()
 
 	// act
-	err := s.userService.MarkOffline(userId)
+	changed, err := s.userService.MarkOffline(userId, at)
 
 	// assert
 	assert.NoError(s.T(), err)
+	assert.False(s.T(), changed)
+}
+
+func (s *UserServiceTestSuite) TestGetFriendsPresence_Success() {
+	// arrange
+	lastSeen := time.Now().Add(-time.Hour)
+
+	s.mock.ExpectQuery(`SELECT users.id, users.is_online, users.last_seen, users.hide_presence FROM "users" JOIN user_friends ON user_friends.friend_id = users.id WHERE user_friends.user_id = \$1 ORDER BY users.id`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_online", "last_seen", "hide_presence"}).
+			AddRow(2, false, lastSeen, false).
+			AddRow(3, true, time.Now(), true).
+			AddRow(4, true, time.Now(), false))
+
+	// act
+	presences, err := s.userService.GetFriendsPresence(1)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), *presences, 3)
+	assert.Equal(s.T(), Presence{UserID: 4, IsOnline: true, LastSeen: (*presences)[0].LastSeen}, (*presences)[0])
+	assert.Equal(s.T(), Presence{UserID: 2, LastSeen: &lastSeen}, (*presences)[1])
+	// Friends hiding their presence look like they were never online
+	assert.Equal(s.T(), Presence{UserID: 3}, (*presences)[2])
 }
 
 func (s *UserServiceTestSuite) TestSearchUsers_Success() {
@@ -816,12 +1063,13 @@ func (s *UserServiceTestSuite) TestSearchUsers_Success() {
 	rows.AddRow(3, "johnsmith", "johnsmith@example.com", "hashedpassword",
 		"https://default-image.jpg", true, true, now, now, now)
 
-	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."email","users"."password","users"."picture_url","users"."is_email_valid","users"."is_online","users"."last_seen","users"."registered_at","users"."updated_at" FROM "users" LEFT JOIN user_friends ON users.id = user_friends.friend_id AND user_friends.user_id = \$1 WHERE users.username LIKE \$2 AND user_friends.friend_id IS NULL AND users.id != \$3 LIMIT \$4`).
-		WithArgs(currentUserID, "%"+query+"%", currentUserID, 10).
+	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."display_name","users"."bio","users"."phone_num","users"."time_zone","users"."locale","users"."email","users"."password","users"."has_password","users"."picture_url","users"."picture_key","users"."is_email_valid","users"."is_online","users"."last_seen","users"."hide_presence","users"."registered_at","users"."updated_at" FROM "users" LEFT JOIN user_friends ON users.id = user_friends.friend_id AND user_friends.user_id = \$1 WHERE \(users.username % \$2 OR users.display_name % \$3 OR users.username ILIKE \$4 OR users.display_name ILIKE \$5 OR lower\(users.email\) LIKE \$6\) AND users.is_email_valid = \$7 AND user_friends.friend_id IS NULL AND users.id != \$8 AND \(NOT EXISTS \(SELECT 1 FROM user_blocks WHERE \(blocker_id = \$9 AND blocked_id = users.id\) OR \(blocker_id = users.id AND blocked_id = \$10\)\)\) ORDER BY GREATEST\(similarity\(users.username, \$11\), similarity\(users.display_name, \$12\), CASE WHEN lower\(users.email\) LIKE \$13 THEN 1 ELSE 0 END\) DESC, users.username LIMIT \$14`).
+		WithArgs(currentUserID, query, query, "%"+query+"%", "%"+query+"%", query+"%", true, currentUserID, currentUserID, currentUserID,
+			query, query, query+"%", USER_SEARCH_PAGE_SIZE).
 		WillReturnRows(rows)
 
 	// act
-	users, err := s.userService.SearchUsers(currentUserID, query)
+	users, err := s.userService.SearchUsers(currentUserID, query, 1)
 
 	// assert
 	assert.NoError(s.T(), err)
@@ -840,12 +1088,13 @@ func (s *UserServiceTestSuite) TestSearchUsers_NoResults() {
 		"id", "username", "email", "password", "picture_url",
 		"is_email_valid", "is_online", "last_seen", "registered_at", "updated_at"})
 
-	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."email","users"."password","users"."picture_url","users"."is_email_valid","users"."is_online","users"."last_seen","users"."registered_at","users"."updated_at" FROM "users" LEFT JOIN user_friends ON users.id = user_friends.friend_id AND user_friends.user_id = \$1 WHERE users.username LIKE \$2 AND user_friends.friend_id IS NULL AND users.id != \$3 LIMIT \$4`).
-		WithArgs(currentUserID, "%"+query+"%", currentUserID, 10).
+	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."display_name","users"."bio","users"."phone_num","users"."time_zone","users"."locale","users"."email","users"."password","users"."has_password","users"."picture_url","users"."picture_key","users"."is_email_valid","users"."is_online","users"."last_seen","users"."hide_presence","users"."registered_at","users"."updated_at" FROM "users" LEFT JOIN user_friends ON users.id = user_friends.friend_id AND user_friends.user_id = \$1 WHERE \(users.username % \$2 OR users.display_name % \$3 OR users.username ILIKE \$4 OR users.display_name ILIKE \$5 OR lower\(users.email\) LIKE \$6\) AND users.is_email_valid = \$7 AND user_friends.friend_id IS NULL AND users.id != \$8 AND \(NOT EXISTS \(SELECT 1 FROM user_blocks WHERE \(blocker_id = \$9 AND blocked_id = users.id\) OR \(blocker_id = users.id AND blocked_id = \$10\)\)\) ORDER BY GREATEST\(similarity\(users.username, \$11\), similarity\(users.display_name, \$12\), CASE WHEN lower\(users.email\) LIKE \$13 THEN 1 ELSE 0 END\) DESC, users.username LIMIT \$14`).
+		WithArgs(currentUserID, query, query, "%"+query+"%", "%"+query+"%", query+"%", true, currentUserID, currentUserID, currentUserID,
+			query, query, query+"%", USER_SEARCH_PAGE_SIZE).
 		WillReturnRows(rows)
 
 	// act
-	users, err := s.userService.SearchUsers(currentUserID, query)
+	users, err := s.userService.SearchUsers(currentUserID, query, 1)
 
 	// assert
 	assert.NoError(s.T(), err)
@@ -858,12 +1107,13 @@ func (s *UserServiceTestSuite) TestSearchUsers_DatabaseError() {
 	currentUserID := "1"
 	query := "john"
 
-	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."email","users"."password","users"."picture_url","users"."is_email_valid","users"."is_online","users"."last_seen","users"."registered_at","users"."updated_at" FROM "users" LEFT JOIN user_friends ON users.id = user_friends.friend_id AND user_friends.user_id = \$1 WHERE users.username LIKE \$2 AND user_friends.friend_id IS NULL AND users.id != \$3 LIMIT \$4`).
-		WithArgs(currentUserID, "%"+query+"%", currentUserID, 10).
+	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."display_name","users"."bio","users"."phone_num","users"."time_zone","users"."locale","users"."email","users"."password","users"."has_password","users"."picture_url","users"."picture_key","users"."is_email_valid","users"."is_online","users"."last_seen","users"."hide_presence","users"."registered_at","users"."updated_at" FROM "users" LEFT JOIN user_friends ON users.id = user_friends.friend_id AND user_friends.user_id = \$1 WHERE \(users.username % \$2 OR users.display_name % \$3 OR users.username ILIKE \$4 OR users.display_name ILIKE \$5 OR lower\(users.email\) LIKE \$6\) AND users.is_email_valid = \$7 AND user_friends.friend_id IS NULL AND users.id != \$8 AND \(NOT EXISTS \(SELECT 1 FROM user_blocks WHERE \(blocker_id = \$9 AND blocked_id = users.id\) OR \(blocker_id = users.id AND blocked_id = \$10\)\)\) ORDER BY GREATEST\(similarity\(users.username, \$11\), similarity\(users.display_name, \$12\), CASE WHEN lower\(users.email\) LIKE \$13 THEN 1 ELSE 0 END\) DESC, users.username LIMIT \$14`).
+		WithArgs(currentUserID, query, query, "%"+query+"%", "%"+query+"%", query+"%", true, currentUserID, currentUserID, currentUserID,
+			query, query, query+"%", USER_SEARCH_PAGE_SIZE).
 		WillReturnError(errors.New("database error"))
 
 	// act
-	users, err := s.userService.SearchUsers(currentUserID, query)
+	users, err := s.userService.SearchUsers(currentUserID, query, 1)
 
 	// assert
 	assert.Error(s.T(), err)
@@ -879,8 +1129,8 @@ func (s *UserServiceTestSuite) TestAcceptFriendRequest_Success() {
 	now := time.Now()
 
 	// Fetch the friend request
-	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE "friend_requests"."id" = \$1 ORDER BY "friend_requests"."id" LIMIT \$2`).
-		WithArgs(requestID, 1).
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE id = \$1 AND receiver_id = \$2 ORDER BY "friend_requests"."id" LIMIT \$3`).
+		WithArgs(requestID, receiverID, 1).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "receiver_id", "status", "sent_at"}).
 			AddRow(requestID, senderID, receiverID, "pending", now))
 
@@ -919,8 +1169,8 @@ func (s *UserServiceTestSuite) TestAcceptFriendRequest_Success() {
 
 	// GORM may try to insert/check the user record
 	s.mock.ExpectQuery(`INSERT INTO "users".* ON CONFLICT.*RETURNING "id"`).
-		WithArgs("receiver", "receiver@example.com", "hashedpw", "https://default-image.jpg",
-			true, false, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), receiverID).
+		WithArgs("receiver", "", "", "", "", "", "receiver@example.com", "hashedpw", false, "https://default-image.jpg", "",
+			true, false, sqlmock.AnyArg(), false, sqlmock.AnyArg(), sqlmock.AnyArg(), receiverID).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(receiverID))
 
 	s.mock.ExpectExec(`INSERT INTO "user_friends".*`).
@@ -937,8 +1187,8 @@ func (s *UserServiceTestSuite) TestAcceptFriendRequest_Success() {
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	s.mock.ExpectQuery(`INSERT INTO "users".*ON CONFLICT.*RETURNING "id"`).
-		WithArgs("sender", "sender@example.com", "hashedpw", "https://default-image.jpg",
-			true, false, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), senderID).
+		WithArgs("sender", "", "", "", "", "", "sender@example.com", "hashedpw", false, "https://default-image.jpg", "",
+			true, false, sqlmock.AnyArg(), false, sqlmock.AnyArg(), sqlmock.AnyArg(), senderID).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(senderID))
 
 	s.mock.ExpectExec(`INSERT INTO "user_friends" .*`).
@@ -948,7 +1198,7 @@ func (s *UserServiceTestSuite) TestAcceptFriendRequest_Success() {
 	s.mock.ExpectCommit()
 
 	// act
-	err := s.userService.AcceptFriendRequest(requestID)
+	_, err := s.userService.AcceptFriendRequest(receiverID, requestID)
 
 	// assert
 	assert.NoError(s.T(), err)
@@ -957,13 +1207,14 @@ func (s *UserServiceTestSuite) TestAcceptFriendRequest_Success() {
 func (s *UserServiceTestSuite) TestAcceptFriendRequest_NotFound() {
 	// arrange
 	requestID := uint(99)
+	receiverID := uint(3)
 
-	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE "friend_requests"."id" = \$1 ORDER BY "friend_requests"."id" LIMIT \$2`).
-		WithArgs(requestID, 1).
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE id = \$1 AND receiver_id = \$2 ORDER BY "friend_requests"."id" LIMIT \$3`).
+		WithArgs(requestID, receiverID, 1).
 		WillReturnError(gorm.ErrRecordNotFound)
 
 	// act
-	err := s.userService.AcceptFriendRequest(requestID)
+	_, err := s.userService.AcceptFriendRequest(receiverID, requestID)
 
 	// assert
 	assert.Error(s.T(), err)
@@ -977,13 +1228,13 @@ func (s *UserServiceTestSuite) TestAcceptFriendRequest_AlreadyProcessed() {
 	receiverID := uint(3)
 	now := time.Now()
 
-	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE "friend_requests"."id" = \$1 ORDER BY "friend_requests"."id" LIMIT \$2`).
-		WithArgs(requestID, 1).
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE id = \$1 AND receiver_id = \$2 ORDER BY "friend_requests"."id" LIMIT \$3`).
+		WithArgs(requestID, receiverID, 1).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "receiver_id", "status", "sent_at", "responded_at"}).
 			AddRow(requestID, senderID, receiverID, "accepted", now, now))
 
 	// act
-	err := s.userService.AcceptFriendRequest(requestID)
+	_, err := s.userService.AcceptFriendRequest(receiverID, requestID)
 
 	// assert
 	assert.Error(s.T(), err)
@@ -998,8 +1249,8 @@ func (s *UserServiceTestSuite) TestRejectFriendRequest_Success() {
 	now := time.Now()
 
 	// Fetch the friend request
-	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE "friend_requests"."id" = \$1 ORDER BY "friend_requests"."id" LIMIT \$2`).
-		WithArgs(requestID, 1).
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE id = \$1 AND receiver_id = \$2 ORDER BY "friend_requests"."id" LIMIT \$3`).
+		WithArgs(requestID, receiverID, 1).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "receiver_id", "status", "sent_at"}).
 			AddRow(requestID, senderID, receiverID, "pending", now))
 
@@ -1011,7 +1262,7 @@ func (s *UserServiceTestSuite) TestRejectFriendRequest_Success() {
 	s.mock.ExpectCommit()
 
 	// act
-	err := s.userService.RejectFriendRequest(requestID)
+	_, err := s.userService.RejectFriendRequest(receiverID, requestID)
 
 	// assert
 	assert.NoError(s.T(), err)
@@ -1020,13 +1271,14 @@ func (s *UserServiceTestSuite) TestRejectFriendRequest_Success() {
 func (s *UserServiceTestSuite) TestRejectFriendRequest_NotFound() {
 	// arrange
 	requestID := uint(99)
+	receiverID := uint(3)
 
-	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE "friend_requests"."id" = \$1 ORDER BY "friend_requests"."id" LIMIT \$2`).
-		WithArgs(requestID, 1).
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE id = \$1 AND receiver_id = \$2 ORDER BY "friend_requests"."id" LIMIT \$3`).
+		WithArgs(requestID, receiverID, 1).
 		WillReturnError(gorm.ErrRecordNotFound)
 
 	// act
-	err := s.userService.RejectFriendRequest(requestID)
+	_, err := s.userService.RejectFriendRequest(receiverID, requestID)
 
 	// assert
 	assert.Error(s.T(), err)
@@ -1040,13 +1292,13 @@ func (s *UserServiceTestSuite) TestRejectFriendRequest_AlreadyProcessed() {
 	receiverID := uint(3)
 	now := time.Now()
 
-	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE "friend_requests"."id" = \$1 ORDER BY "friend_requests"."id" LIMIT \$2`).
-		WithArgs(requestID, 1).
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE id = \$1 AND receiver_id = \$2 ORDER BY "friend_requests"."id" LIMIT \$3`).
+		WithArgs(requestID, receiverID, 1).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "receiver_id", "status", "sent_at", "responded_at"}).
 			AddRow(requestID, senderID, receiverID, "rejected", now, now))
 
 	// act
-	err := s.userService.RejectFriendRequest(requestID)
+	_, err := s.userService.RejectFriendRequest(receiverID, requestID)
 
 	// assert
 	assert.Error(s.T(), err)
@@ -1091,6 +1343,11 @@ func (s *UserServiceTestSuite) TestRemoveFriend_Success() {
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectCommit()
 
+	// Take them out of each other's circles
+	s.mock.ExpectExec(`DELETE FROM friend_circle_members WHERE`).
+		WithArgs(friendID, userID, userID, friendID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
 	// act
 	err := s.userService.RemoveFriend(userID, friendID)
 
@@ -1156,9 +1413,9 @@ func (s *UserServiceTestSuite) TestGetFriends_Success() {
 				"https://default-image.jpg", true, false, now, now, now))
 
 	// Get friends from association
-	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."email","users"."password",` +
-		`"users"."picture_url","users"."is_email_valid","users"."is_online","users"."last_seen",` +
-		`"users"."registered_at","users"."updated_at" FROM "users" JOIN "user_friends" ON ` +
+	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."display_name","users"."bio","users"."phone_num","users"."time_zone","users"."locale","users"."email","users"."password","users"."has_password",` +
+		`"users"."picture_url","users"."picture_key","users"."is_email_valid","users"."is_online","users"."last_seen",` +
+		`"users"."hide_presence","users"."registered_at","users"."updated_at" FROM "users" JOIN "user_friends" ON ` +
 		`"user_friends"."friend_id" = "users"."id" AND "user_friends"."user_id" = \$1`).
 		WithArgs(1).
 		WillReturnRows(sqlmock.NewRows([]string{
@@ -1196,6 +1453,120 @@ func (s *UserServiceTestSuite) TestGetFriends_UserNotFound() {
 	assert.Nil(s.T(), friends)
 }
 
+func (s *UserServiceTestSuite) TestAcceptFriendRequest_Expired() {
+	// arrange
+	requestID := uint(1)
+	receiverID := uint(3)
+	sentAt := time.Now().Add(-FriendRequestExpiry() - time.Hour)
+
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE id = \$1 AND receiver_id = \$2 ORDER BY "friend_requests"."id" LIMIT \$3`).
+		WithArgs(requestID, receiverID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "receiver_id", "status", "sent_at"}).
+			AddRow(requestID, 2, receiverID, "pending", sentAt))
+
+	// act
+	_, err := s.userService.AcceptFriendRequest(receiverID, requestID)
+
+	// assert
+	assert.Error(s.T(), err)
+	assert.Equal(s.T(), "friend request expired", err.Error())
+}
+
+func (s *UserServiceTestSuite) TestCancelFriendRequest_Success() {
+	// arrange
+	requestID := uint(1)
+	senderID := uint(2)
+	receiverID := uint(3)
+	now := time.Now()
+
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE id = \$1 AND sender_id = \$2 ORDER BY "friend_requests"."id" LIMIT \$3`).
+		WithArgs(requestID, senderID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "receiver_id", "status", "sent_at"}).
+			AddRow(requestID, senderID, receiverID, "pending", now))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "friend_requests" SET "sender_id"=\$1,"receiver_id"=\$2,"status"=\$3,"sent_at"=\$4,"responded_at"=\$5 WHERE "id" = \$6`).
+		WithArgs(senderID, receiverID, "cancelled", now, sqlmock.AnyArg(), requestID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit()
+
+	// act
+	request, err := s.userService.CancelFriendRequest(senderID, requestID)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "cancelled", request.Status)
+}
+
+func (s *UserServiceTestSuite) TestCancelFriendRequest_NotSender() {
+	// arrange
+	s.mock.ExpectQuery(`SELECT \* FROM "friend_requests" WHERE id = \$1 AND sender_id = \$2 ORDER BY "friend_requests"."id" LIMIT \$3`).
+		WithArgs(1, 3, 1).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	// act
+	_, err := s.userService.CancelFriendRequest(3, 1)
+
+	// assert
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *UserServiceTestSuite) TestExpireFriendRequests_Success() {
+	// arrange
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(`UPDATE "friend_requests" SET "responded_at"=\$1,"status"=\$2 WHERE status = \$3 AND sent_at < \$4`).
+		WithArgs(sqlmock.AnyArg(), "expired", "pending", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.mock.ExpectCommit()
+
+	// act
+	err := s.userService.ExpireFriendRequests()
+
+	// assert
+	assert.NoError(s.T(), err)
+}
+
+func (s *UserServiceTestSuite) TestGetFriendSuggestions_Success() {
+	// arrange
+	now := time.Now()
+
+	s.mock.ExpectQuery(`WITH mutual AS \(.+\) SELECT c.user_id, .+ ORDER BY mutual_friends DESC, shared_rooms DESC, c.user_id LIMIT \$\d+`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "mutual_friends", "shared_rooms"}).
+			AddRow(3, 3, 2).
+			AddRow(4, 0, 1))
+	s.mock.ExpectQuery(`SELECT \* FROM "users" WHERE id IN \(\$1,\$2\)`).
+		WithArgs(3, 4).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "username", "email", "password", "picture_url",
+			"is_email_valid", "is_online", "last_seen", "registered_at", "updated_at"}).
+			AddRow(4, "roommate", "roommate@example.com", "hashedpw", "", true, false, now, now, now).
+			AddRow(3, "mutual", "mutual@example.com", "hashedpw", "", true, false, now, now, now))
+
+	// act
+	suggestions, err := s.userService.GetFriendSuggestions(s.userId, FRIEND_SUGGESTIONS_LIMIT)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), *suggestions, 2)
+	assert.Equal(s.T(), "mutual", (*suggestions)[0].User.Username)
+	assert.Equal(s.T(), "3 mutual friends, 2 rooms together", (*suggestions)[0].Reason)
+	assert.Equal(s.T(), "roommate", (*suggestions)[1].User.Username)
+	assert.Equal(s.T(), "1 room together", (*suggestions)[1].Reason)
+}
+
+func (s *UserServiceTestSuite) TestGetFriendSuggestions_NoCandidates() {
+	// arrange
+	s.mock.ExpectQuery(`WITH mutual AS`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "mutual_friends", "shared_rooms"}))
+
+	// act
+	suggestions, err := s.userService.GetFriendSuggestions(s.userId, FRIEND_SUGGESTIONS_LIMIT)
+
+	// assert
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), *suggestions)
+}
+
 func (s *UserServiceTestSuite) TestGetFriendRequestsByStatus_Success() {
 	// arrange
 	userID := uint(1)
@@ -1377,7 +1748,7 @@ func (s *UserServiceTestSuite) TestIsFriend_True() {
 				"https://default-image.jpg", true, false, now, now, now))
 
 	// Check association
-	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."email","users"."password","users"."picture_url","users"."is_email_valid","users"."is_online","users"."last_seen","users"."registered_at","users"."updated_at" FROM "users" JOIN "user_friends" ON "user_friends"."friend_id" = "users"."id" AND "user_friends"."user_id" = \$1 WHERE id = \$2 AND "users"."id" = \$3`).
+	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."display_name","users"."bio","users"."phone_num","users"."time_zone","users"."locale","users"."email","users"."password","users"."has_password","users"."picture_url","users"."picture_key","users"."is_email_valid","users"."is_online","users"."last_seen","users"."hide_presence","users"."registered_at","users"."updated_at" FROM "users" JOIN "user_friends" ON "user_friends"."friend_id" = "users"."id" AND "user_friends"."user_id" = \$1 WHERE id = \$2 AND "users"."id" = \$3`).
 		WithArgs(userID, friendID, friendID).
 		WillReturnRows(sqlmock.NewRows([]string{
 			"id", "username", "email", "password", "picture_url",
@@ -1417,7 +1788,7 @@ func (s *UserServiceTestSuite) TestIsFriend_False() {
 				"https://default-image.jpg", true, false, now, now, now))
 
 	// Check association (returns no rows)
-	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."email","users"."password","users"."picture_url","users"."is_email_valid","users"."is_online","users"."last_seen","users"."registered_at","users"."updated_at" FROM "users" JOIN "user_friends" ON "user_friends"."friend_id" = "users"."id" AND "user_friends"."user_id" = \$1 WHERE id = \$2 AND "users"."id" = \$3`).
+	s.mock.ExpectQuery(`SELECT "users"."id","users"."username","users"."display_name","users"."bio","users"."phone_num","users"."time_zone","users"."locale","users"."email","users"."password","users"."has_password","users"."picture_url","users"."picture_key","users"."is_email_valid","users"."is_online","users"."last_seen","users"."hide_presence","users"."registered_at","users"."updated_at" FROM "users" JOIN "user_friends" ON "user_friends"."friend_id" = "users"."id" AND "user_friends"."user_id" = \$1 WHERE id = \$2 AND "users"."id" = \$3`).
 		WithArgs(userID, friendID, friendID).
 		WillReturnError(gorm.ErrRecordNotFound)
 
@@ -0,0 +1,11 @@
+// Package templates embeds the templates for content the server renders, such as emails,
+// so they are versioned with the code and shipped inside the binary.
+package templates
+
+import "embed"
+
+// Email templates are named <name>.<locale>.txt and <name>.<locale>.html. The text template
+// also defines the subject, and the HTML template the "content" block of layout.html.
+//
+//go:embed email
+var Email embed.FS
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// MockGitHubUser is the profile and emails returned for an authorization code
+type MockGitHubUser struct {
+	ID     int64
+	Login  string
+	Name   string
+	Emails []map[string]any // e.g. {"email": "john@example.com", "primary": true, "verified": true}
+}
+
+// MockGitHubServer serves GitHub's OAuth2 token endpoint and the user API.
+// Register an authorization code with IssueCode before exchanging it.
+type MockGitHubServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	codes  map[string]MockGitHubUser
+	tokens map[string]MockGitHubUser
+}
+
+func NewMockGitHubServer() *MockGitHubServer {
+	s := &MockGitHubServer{
+		codes:  make(map[string]MockGitHubUser),
+		tokens: make(map[string]MockGitHubUser),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", s.handleToken)
+	mux.HandleFunc("/user", s.handleUser)
+	mux.HandleFunc("/user/emails", s.handleEmails)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+func (s *MockGitHubServer) IssueCode(code string, user MockGitHubUser) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code] = user
+}
+
+func (s *MockGitHubServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	code := r.FormValue("code")
+
+	s.mu.Lock()
+	user, ok := s.codes[code]
+	delete(s.codes, code)
+	if ok {
+		s.tokens["token-"+code] = user
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "bad_verification_code"})
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"access_token": "token-" + code,
+		"token_type":   "bearer",
+		"scope":        "read:user,user:email",
+	})
+}
+
+func (s *MockGitHubServer) authorize(w http.ResponseWriter, r *http.Request) (MockGitHubUser, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]string{"message": "Bad credentials"})
+	}
+	return user, ok
+}
+
+func (s *MockGitHubServer) handleUser(w http.ResponseWriter, r *http.Request) {
+	if user, ok := s.authorize(w, r); ok {
+		writeJSON(w, map[string]any{"id": user.ID, "login": user.Login, "name": user.Name})
+	}
+}
+
+func (s *MockGitHubServer) handleEmails(w http.ResponseWriter, r *http.Request) {
+	if user, ok := s.authorize(w, r); ok {
+		writeJSON(w, user.Emails)
+	}
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ReadLastEmail returns the subject and decoded text body of the newest email
+// written by a utils.FileMailer to dir
+func ReadLastEmail(dir string) (string, string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		return "", "", err
+	}
+	if len(files) == 0 {
+		return "", "", errors.New("no emails sent")
+	}
+	sort.Strings(files)
+
+	file, err := os.Open(files[len(files)-1])
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	message, err := mail.ReadMessage(file)
+	if err != nil {
+		return "", "", err
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		return "", "", err
+	}
+
+	_, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		return "", "", err
+	}
+
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return "", "", errors.New("no text body")
+		}
+		if err != nil {
+			return "", "", err
+		}
+
+		// Quoted-printable parts are decoded by the reader
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			body, err := io.ReadAll(part)
+			return subject, string(body), err
+		}
+	}
+}
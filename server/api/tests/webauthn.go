@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// Authenticator data flags (WebAuthn §6.1)
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+// SoftwareAuthenticator is a passkey authenticator for tests. It holds a single
+// ES256 credential and answers ceremonies the way a browser would.
+type SoftwareAuthenticator struct {
+	RPID   string
+	Origin string
+
+	CredentialID []byte
+	PrivateKey   *ecdsa.PrivateKey
+	UserHandle   []byte
+	SignCount    uint32
+}
+
+func NewSoftwareAuthenticator(rpId, origin string) (*SoftwareAuthenticator, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialId := make([]byte, 32)
+	if _, err := rand.Read(credentialId); err != nil {
+		return nil, err
+	}
+
+	return &SoftwareAuthenticator{
+		RPID:         rpId,
+		Origin:       origin,
+		CredentialID: credentialId,
+		PrivateKey:   privateKey,
+	}, nil
+}
+
+// Register answers navigator.credentials.create() for the base64url challenge and user ID
+// in the creation options, returning the JSON the client would send back
+func (a *SoftwareAuthenticator) Register(challenge, userId string) ([]byte, error) {
+	userHandle, err := base64.RawURLEncoding.DecodeString(userId)
+	if err != nil {
+		return nil, err
+	}
+	a.UserHandle = userHandle
+
+	publicKey, err := a.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// AAGUID, then the length prefixed credential ID, then its public key
+	attestedCredentialData := make([]byte, 16, 18+len(a.CredentialID)+len(publicKey))
+	attestedCredentialData = binary.BigEndian.AppendUint16(attestedCredentialData, uint16(len(a.CredentialID)))
+	attestedCredentialData = append(attestedCredentialData, a.CredentialID...)
+	attestedCredentialData = append(attestedCredentialData, publicKey...)
+
+	authData := a.authenticatorData(flagUserPresent|flagUserVerified|flagAttestedCredentialData, attestedCredentialData)
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataJSON, err := a.clientData("webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	})
+}
+
+// PublicKey returns the COSE encoded public key of the credential, as the server stores it
+func (a *SoftwareAuthenticator) PublicKey() ([]byte, error) {
+	return webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.PrivateKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.PrivateKey.Y.FillBytes(make([]byte, 32)),
+	})
+}
+
+// Login answers navigator.credentials.get() for the base64url challenge in the request options,
+// returning the JSON the client would send back
+func (a *SoftwareAuthenticator) Login(challenge string) ([]byte, error) {
+	a.SignCount++
+	authData := a.authenticatorData(flagUserPresent|flagUserVerified, nil)
+
+	clientDataJSON, err := a.clientData("webauthn.get", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.PrivateKey, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.UserHandle),
+		},
+	})
+}
+
+func (a *SoftwareAuthenticator) authenticatorData(flags byte, attestedCredentialData []byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(a.RPID))
+
+	authData := append(rpIdHash[:], flags)
+	authData = binary.BigEndian.AppendUint32(authData, a.SignCount)
+	return append(authData, attestedCredentialData...)
+}
+
+func (a *SoftwareAuthenticator) clientData(ceremony, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+)
+
+// BLOB_ROUTE is where the API serves blobs kept on local disk.
+// Only keys under BLOB_PUBLIC_PREFIXES are served, private blobs such as data exports are not.
+const BLOB_ROUTE = "/blobs"
+
+var BLOB_PUBLIC_PREFIXES = []string{"avatars"}
+
+// BlobStore keeps uploaded files such as profile pictures.
+// Keys are never reused, so the URL of a blob is stable and can be cached forever.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// NewBlobStore returns the backend selected by BLOB_STORE: local (default) or s3
+func NewBlobStore() (BlobStore, error) {
+	switch config.Config("BLOB_STORE") {
+	case "s3":
+		return NewS3BlobStore(
+			config.Config("S3_ENDPOINT"),
+			config.Config("S3_ACCESS_KEY"),
+			config.Config("S3_SECRET_KEY"),
+			config.Config("S3_BUCKET"),
+			config.Config("S3_USE_SSL") == "true",
+			config.Config("BLOB_PUBLIC_URL"),
+		)
+	default:
+		return &LocalBlobStore{Dir: BlobDir(), PublicURL: config.Config("BLOB_PUBLIC_URL")}, nil
+	}
+}
+
+// BlobDir is where the local blob store keeps files, set by BLOB_DIR
+func BlobDir() string {
+	if dir := config.Config("BLOB_DIR"); dir != "" {
+		return dir
+	}
+	return "blobs"
+}
+
+// LocalBlobStore writes blobs to a directory served by the API under BLOB_ROUTE
+type LocalBlobStore struct {
+	Dir       string
+	PublicURL string // e.g. https://api.example.com, empty for root-relative URLs
+}
+
+func (s *LocalBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) URL(key string) string {
+	return strings.TrimSuffix(s.PublicURL, "/") + BLOB_ROUTE + "/" + key
+}
+
+// path keeps keys from escaping the blob directory
+func (s *LocalBlobStore) path(key string) (string, error) {
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.Dir)+string(filepath.Separator)) {
+		return "", os.ErrInvalid
+	}
+	return path, nil
+}
+
+// S3BlobStore keeps blobs in a bucket of any S3-compatible service, e.g. MinIO
+type S3BlobStore struct {
+	Client    *minio.Client
+	Bucket    string
+	PublicURL string // e.g. a CDN in front of the bucket, defaults to the bucket's own URL
+}
+
+func NewS3BlobStore(endpoint, accessKey, secretKey, bucket string, useSSL bool, publicURL string) (*S3BlobStore, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if publicURL == "" {
+		scheme := "http"
+		if useSSL {
+			scheme = "https"
+		}
+		publicURL = (&url.URL{Scheme: scheme, Host: endpoint, Path: "/" + bucket}).String()
+	}
+
+	return &S3BlobStore{Client: client, Bucket: bucket, PublicURL: publicURL}, nil
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.Client.PutObject(ctx, s.Bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:  contentType,
+		CacheControl: "public, max-age=31536000, immutable",
+	})
+	return err
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.Client.GetObject(ctx, s.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(object)
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	return s.Client.RemoveObject(ctx, s.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3BlobStore) URL(key string) string {
+	return strings.TrimSuffix(s.PublicURL, "/") + "/" + key
+}
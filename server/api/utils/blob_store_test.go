@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalBlobStore_PutAndDelete(t *testing.T) {
+	store := &LocalBlobStore{Dir: t.TempDir(), PublicURL: "https://api.example.com/"}
+	ctx := context.Background()
+
+	assert.NoError(t, store.Put(ctx, "avatars/1/abc/small.jpg", []byte("data"), "image/jpeg"))
+	data, err := os.ReadFile(filepath.Join(store.Dir, "avatars", "1", "abc", "small.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	assert.Equal(t, "https://api.example.com/blobs/avatars/1/abc/small.jpg", store.URL("avatars/1/abc/small.jpg"))
+
+	assert.NoError(t, store.Delete(ctx, "avatars/1/abc/small.jpg"))
+	_, err = os.Stat(filepath.Join(store.Dir, "avatars", "1", "abc", "small.jpg"))
+	assert.True(t, os.IsNotExist(err))
+	// deleting a missing blob is not an error
+	assert.NoError(t, store.Delete(ctx, "avatars/1/abc/small.jpg"))
+}
+
+func TestLocalBlobStore_RejectsTraversal(t *testing.T) {
+	store := &LocalBlobStore{Dir: t.TempDir()}
+
+	err := store.Put(context.Background(), "../escape.jpg", []byte("data"), "image/jpeg")
+
+	assert.ErrorIs(t, err, os.ErrInvalid)
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"bytes"
+	htmlTemplate "html/template"
+	"io/fs"
+	"strings"
+	"sync"
+	textTemplate "text/template"
+
+	"github.com/RowenTey/JustJio/server/api/templates"
+)
+
+const DEFAULT_EMAIL_LOCALE = "en"
+
+type EmailContent struct {
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+type emailTemplate struct {
+	text *textTemplate.Template
+	html *htmlTemplate.Template
+}
+
+// EmailRenderer renders emails from <name>.<locale>.txt / .html templates in FS,
+// falling back to DEFAULT_EMAIL_LOCALE when there's no variant for the requested locale
+type EmailRenderer struct {
+	FS    fs.FS
+	cache sync.Map
+}
+
+var defaultEmailRenderer = &EmailRenderer{FS: templates.Email}
+
+// RenderEmail renders one of the embedded email templates.
+// locale can be a language tag or an Accept-Language header value.
+func RenderEmail(name, locale string, data any) (*EmailContent, error) {
+	return defaultEmailRenderer.Render(name, locale, data)
+}
+
+func (r *EmailRenderer) Render(name, locale string, data any) (*EmailContent, error) {
+	tmpl, err := r.load(name, r.resolveLocale(name, locale))
+	if err != nil {
+		return nil, err
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if tmpl.html != nil {
+		if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+			return nil, err
+		}
+	}
+
+	return &EmailContent{
+		Subject:  strings.TrimSpace(subject.String()),
+		TextBody: text.String(),
+		HTMLBody: html.String(),
+	}, nil
+}
+
+func (r *EmailRenderer) load(name, locale string) (*emailTemplate, error) {
+	key := name + "." + locale
+	if tmpl, ok := r.cache.Load(key); ok {
+		return tmpl.(*emailTemplate), nil
+	}
+
+	text, err := textTemplate.ParseFS(r.FS, "email/"+key+".txt")
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &emailTemplate{text: text}
+
+	// The HTML variant is optional
+	if _, err := fs.Stat(r.FS, "email/"+key+".html"); err == nil {
+		tmpl.html, err = htmlTemplate.ParseFS(r.FS, "email/layout.html", "email/"+key+".html")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.cache.Store(key, tmpl)
+	return tmpl, nil
+}
+
+// resolveLocale picks the first locale in the list with a variant of the template,
+// trying each tag (e.g. zh-sg) before its base language (zh)
+func (r *EmailRenderer) resolveLocale(name, locale string) string {
+	for _, tag := range strings.Split(locale, ",") {
+		// Drop any quality value, e.g. "en;q=0.8"
+		tag = strings.ToLower(strings.TrimSpace(strings.Split(tag, ";")[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		candidates := []string{tag}
+		if base, _, found := strings.Cut(tag, "-"); found {
+			candidates = append(candidates, base)
+		}
+		for _, candidate := range candidates {
+			if _, err := fs.Stat(r.FS, "email/"+name+"."+candidate+".txt"); err == nil {
+				return candidate
+			}
+		}
+	}
+	return DEFAULT_EMAIL_LOCALE
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testEmailRenderer() *EmailRenderer {
+	return &EmailRenderer{FS: fstest.MapFS{
+		"email/layout.html": {Data: []byte(`{{define "layout"}}<html>{{template "content" .}}</html>{{end}}`)},
+		"email/greeting.en.txt": {Data: []byte(
+			`{{- define "subject"}}Hello {{.Name}}{{end -}}` + "\nHi {{.Name}}")},
+		"email/greeting.en.html": {Data: []byte(`{{define "content"}}<p>Hi {{.Name}}</p>{{end}}`)},
+		"email/greeting.zh.txt": {Data: []byte(
+			`{{- define "subject"}}你好 {{.Name}}{{end -}}` + "\n嗨 {{.Name}}")},
+	}}
+}
+
+func TestRenderEmail_DefaultLocale(t *testing.T) {
+	content, err := testEmailRenderer().Render("greeting", "", map[string]any{"Name": "<Bob>"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello <Bob>", content.Subject)
+	assert.Equal(t, "Hi <Bob>", content.TextBody)
+	// HTML bodies are escaped
+	assert.Equal(t, "<html><p>Hi &lt;Bob&gt;</p></html>", content.HTMLBody)
+}
+
+func TestRenderEmail_LocaleFallback(t *testing.T) {
+	renderer := testEmailRenderer()
+
+	tests := map[string]string{
+		"zh":                  "你好 Bob",
+		"zh-SG,zh;q=0.9":      "你好 Bob",
+		"fr-FR,fr;q=0.9,zh":   "你好 Bob",
+		"fr":                  "Hello Bob",
+		"en-GB,en;q=0.9,zh":   "Hello Bob",
+		"../greeting.zh.txt/": "Hello Bob",
+	}
+	for locale, subject := range tests {
+		content, err := renderer.Render("greeting", locale, map[string]any{"Name": "Bob"})
+
+		assert.NoError(t, err, locale)
+		assert.Equal(t, subject, content.Subject, locale)
+	}
+
+	// Variants without HTML only have a text body
+	content, err := renderer.Render("greeting", "zh", map[string]any{"Name": "Bob"})
+	assert.NoError(t, err)
+	assert.Empty(t, content.HTMLBody)
+}
+
+func TestRenderEmail_AcceptLanguage(t *testing.T) {
+	// Render through RenderEmail, with the fixtures in testdata standing in for the embedded templates
+	original := defaultEmailRenderer
+	defaultEmailRenderer = &EmailRenderer{FS: os.DirFS("testdata")}
+	t.Cleanup(func() { defaultEmailRenderer = original })
+
+	data := map[string]any{"Username": "bob", "OTP": "123456"}
+
+	content, err := RenderEmail("welcome", "zh-CN,zh;q=0.9,en;q=0.8", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "JustJio 邮箱验证", content.Subject)
+	assert.Contains(t, content.TextBody, "你的验证码是：123456")
+	assert.Contains(t, content.HTMLBody, "<p>欢迎 bob，</p>")
+
+	content, err = RenderEmail("welcome", "en-US,en;q=0.9,zh;q=0.8", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "JustJio Email Verification", content.Subject)
+	assert.Contains(t, content.HTMLBody, "<p>Welcome bob,</p>")
+}
+
+func TestRenderEmail_UnknownTemplate(t *testing.T) {
+	_, err := testEmailRenderer().Render("unknown", "en", nil)
+
+	assert.Error(t, err)
+}
+
+func TestRenderEmail_EmbeddedTemplates(t *testing.T) {
+	for _, name := range []string{"verify-email", "reset-password", "link-account", "magic-link", "account-locked"} {
+		content, err := RenderEmail(name, "en", map[string]any{
+			"Username":      "bob",
+			"OTP":           "123456",
+			"Link":          "https://example.com?token=abc",
+			"ExpiryMinutes": 15,
+			"LockMinutes":   30,
+		})
+
+		assert.NoError(t, err, name)
+		assert.NotEmpty(t, content.Subject, name)
+		assert.Contains(t, content.TextBody, "bob", name)
+		assert.Contains(t, content.HTMLBody, "bob", name)
+	}
+}
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &FileMailer{Dir: dir}
+
+	err := mailer.Send(&Email{
+		From:     "from@example.com",
+		To:       "to@example.com",
+		Subject:  "Subject",
+		TextBody: "Text",
+		HTMLBody: "<p>HTML</p>",
+	})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	message, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(message), "To: to@example.com")
+	assert.Contains(t, string(message), "Content-Type: multipart/alternative")
+	assert.Contains(t, string(message), "<p>HTML</p>")
+}
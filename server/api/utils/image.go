@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"net/http"
+
+	// Register the decoders for the formats we accept
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	AVATAR_MAX_BYTES     = 5 << 20 // 5 MiB
+	AVATAR_MAX_DIMENSION = 4096    // per side, so small files can't decode into huge bitmaps
+	AVATAR_JPEG_QUALITY  = 85
+)
+
+// Square sizes every profile picture is stored in, by name
+var AvatarSizes = map[string]int{
+	"small":  64,
+	"medium": 256,
+	"large":  512,
+}
+
+var allowedAvatarTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var (
+	ErrAvatarTooLarge        = errors.New("image is too large")
+	ErrAvatarUnsupportedType = errors.New("unsupported image type")
+)
+
+// ResizeAvatar checks an uploaded image by its content rather than its file name,
+// then crops it to a square and re-encodes it as JPEG in every size in AvatarSizes.
+// Re-encoding drops all metadata, including EXIF location data.
+func ResizeAvatar(data []byte) (map[string][]byte, error) {
+	if len(data) > AVATAR_MAX_BYTES {
+		return nil, ErrAvatarTooLarge
+	}
+	if !allowedAvatarTypes[http.DetectContentType(data)] {
+		return nil, ErrAvatarUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrAvatarUnsupportedType
+	}
+	if config.Width > AVATAR_MAX_DIMENSION || config.Height > AVATAR_MAX_DIMENSION {
+		return nil, ErrAvatarTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrAvatarUnsupportedType
+	}
+	src = cropSquare(src)
+
+	resized := make(map[string][]byte, len(AvatarSizes))
+	for name, size := range AvatarSizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		// JPEG has no transparency, so transparent pixels become white
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: AVATAR_JPEG_QUALITY}); err != nil {
+			return nil, err
+		}
+		resized[name] = buf.Bytes()
+	}
+	return resized, nil
+}
+
+// cropSquare keeps the centre square of the image
+func cropSquare(img image.Image) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x, y, x+side, y+side)
+
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(crop)
+	}
+	return img
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestResizeAvatar_AllSizes(t *testing.T) {
+	resized, err := ResizeAvatar(testPNG(t, 300, 200))
+
+	assert.NoError(t, err)
+	assert.Len(t, resized, len(AvatarSizes))
+	for name, size := range AvatarSizes {
+		img, err := jpeg.Decode(bytes.NewReader(resized[name]))
+		assert.NoError(t, err)
+		// cropped to a square before scaling
+		assert.Equal(t, size, img.Bounds().Dx(), name)
+		assert.Equal(t, size, img.Bounds().Dy(), name)
+	}
+}
+
+func TestResizeAvatar_UnsupportedType(t *testing.T) {
+	_, err := ResizeAvatar([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"))
+
+	assert.ErrorIs(t, err, ErrAvatarUnsupportedType)
+}
+
+func TestResizeAvatar_TooLarge(t *testing.T) {
+	_, err := ResizeAvatar(make([]byte, AVATAR_MAX_BYTES+1))
+	assert.ErrorIs(t, err, ErrAvatarTooLarge)
+
+	_, err = ResizeAvatar(testPNG(t, AVATAR_MAX_DIMENSION+1, 1))
+	assert.ErrorIs(t, err, ErrAvatarTooLarge)
+}
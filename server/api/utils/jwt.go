@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/golang-jwt/jwt/v4"
 )
@@ -13,3 +14,11 @@ func GetUserInfoFromToken(t *jwt.Token, field string) string {
 	}
 	return claims[field].(string)
 }
+
+func GetUserIdFromToken(t *jwt.Token) (uint, error) {
+	userId, err := strconv.ParseUint(GetUserInfoFromToken(t, "user_id"), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(userId), nil
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/smtp2go-oss/smtp2go-go"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+)
+
+type Email struct {
+	From     string
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+// Mailer delivers emails. Every email the server sends goes through one.
+type Mailer interface {
+	Send(email *Email) error
+}
+
+// NewMailer returns the backend selected by MAILER: smtp2go (default), smtp or file
+func NewMailer() Mailer {
+	switch config.Config("MAILER") {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     config.Config("SMTP_HOST"),
+			Port:     config.Config("SMTP_PORT"),
+			Username: config.Config("SMTP_USERNAME"),
+			Password: config.Config("SMTP_PASSWORD"),
+		}
+	case "file":
+		dir := config.Config("MAILER_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return &FileMailer{Dir: dir}
+	default:
+		return &SMTP2GoMailer{}
+	}
+}
+
+// SMTP2GoMailer sends emails through the smtp2go API, configured with SMTP2GO_API_KEY
+type SMTP2GoMailer struct{}
+
+func (m *SMTP2GoMailer) Send(email *Email) error {
+	_, err := smtp2go.Send(&smtp2go.Email{
+		From:     email.From,
+		To:       []string{email.To},
+		Subject:  email.Subject,
+		TextBody: email.TextBody,
+		HtmlBody: email.HTMLBody,
+	})
+	return err
+}
+
+// SMTPMailer sends emails through a plain SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+func (m *SMTPMailer) Send(email *Email) error {
+	if m.Host == "" {
+		return errors.New("smtp host not configured")
+	}
+
+	message, err := BuildMIMEMessage(email)
+	if err != nil {
+		return err
+	}
+
+	port := m.Port
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+port, auth, email.From, []string{email.To}, message)
+}
+
+// FileMailer writes emails as .eml files to a directory instead of sending them,
+// for local development and tests
+type FileMailer struct {
+	Dir string
+}
+
+func (m *FileMailer) Send(email *Email) error {
+	message, err := BuildMIMEMessage(email)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	// ULIDs sort by time, so the newest email is listed last
+	path := filepath.Join(m.Dir, CreateULID().String()+".eml")
+	return os.WriteFile(path, message, 0o644)
+}
+
+// BuildMIMEMessage encodes an email as a multipart/alternative message with text and HTML parts
+func BuildMIMEMessage(email *Email) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", email.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", email.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", email.TextBody},
+		{"text/html", email.HTMLBody},
+	}
+	for _, part := range parts {
+		if part.body == "" {
+			continue
+		}
+
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/RowenTey/JustJio/server/api/config"
+)
+
+// Argon2Params are the argon2id cost parameters. They are stored in every hash
+// so changing them doesn't break existing hashes, which get upgraded on the next login.
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Defaults from the OWASP password storage cheat sheet
+var DefaultArgon2Params = Argon2Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+const argon2idPrefix = "$argon2id$"
+
+var errInvalidHash = errors.New("invalid password hash")
+
+// CurrentArgon2Params returns the default parameters, overridden by ARGON2_MEMORY_KIB,
+// ARGON2_ITERATIONS and ARGON2_PARALLELISM where set
+func CurrentArgon2Params() Argon2Params {
+	params := DefaultArgon2Params
+	if v, err := strconv.ParseUint(config.Config("ARGON2_MEMORY_KIB"), 10, 32); err == nil && v > 0 {
+		params.Memory = uint32(v)
+	}
+	if v, err := strconv.ParseUint(config.Config("ARGON2_ITERATIONS"), 10, 32); err == nil && v > 0 {
+		params.Iterations = uint32(v)
+	}
+	if v, err := strconv.ParseUint(config.Config("ARGON2_PARALLELISM"), 10, 8); err == nil && v > 0 {
+		params.Parallelism = uint8(v)
+	}
+	return params
+}
+
+// HashPassword hashes a password with argon2id using the current parameters
+func HashPassword(password string) (string, error) {
+	return HashPasswordWithParams(password, CurrentArgon2Params())
+}
+
+// HashPasswordWithParams returns the hash in the PHC string format,
+// e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+func HashPasswordWithParams(password string, params Argon2Params) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPasswordHash compares a password with an argon2id hash, or a bcrypt hash from before argon2id
+func CheckPasswordHash(password string, hash string) bool {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		return err == nil
+	}
+
+	params, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return false
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, otherKey) == 1
+}
+
+// PasswordNeedsRehash reports whether the hash was made with bcrypt or with
+// parameters other than the current ones, so it should be replaced after a successful login
+func PasswordNeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return true
+	}
+
+	params, salt, _, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+
+	current := CurrentArgon2Params()
+	return params.Memory != current.Memory ||
+		params.Iterations != current.Iterations ||
+		params.Parallelism != current.Parallelism ||
+		params.KeyLength != current.KeyLength ||
+		uint32(len(salt)) != current.SaltLength
+}
+
+func decodeArgon2Hash(hash string) (*Argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, nil, nil, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, errInvalidHash
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, errInvalidHash
+	}
+
+	var params Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, errInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, errInvalidHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return &params, salt, key, nil
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword_Argon2id(t *testing.T) {
+	hash, err := HashPassword("password123")
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"))
+	assert.True(t, CheckPasswordHash("password123", hash))
+	assert.False(t, CheckPasswordHash("password124", hash))
+	assert.False(t, PasswordNeedsRehash(hash))
+}
+
+func TestHashPassword_SaltedPerHash(t *testing.T) {
+	first, err := HashPassword("password123")
+	assert.NoError(t, err)
+	second, err := HashPassword("password123")
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+}
+
+func TestCheckPasswordHash_Bcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	assert.True(t, CheckPasswordHash("password123", string(hash)))
+	assert.False(t, CheckPasswordHash("password124", string(hash)))
+	// bcrypt hashes are upgraded on the next login
+	assert.True(t, PasswordNeedsRehash(string(hash)))
+}
+
+func TestPasswordNeedsRehash_ParamsChanged(t *testing.T) {
+	hash, err := HashPassword("password123")
+	assert.NoError(t, err)
+
+	t.Setenv("ARGON2_ITERATIONS", "3")
+
+	// Old hashes still verify with the parameters they were made with
+	assert.True(t, CheckPasswordHash("password123", hash))
+	assert.True(t, PasswordNeedsRehash(hash))
+
+	rehashed, err := HashPassword("password123")
+	assert.NoError(t, err)
+	assert.Contains(t, rehashed, "t=3")
+	assert.False(t, PasswordNeedsRehash(rehashed))
+}
+
+func TestCheckPasswordHash_Malformed(t *testing.T) {
+	assert.False(t, CheckPasswordHash("password123", "$argon2id$v=19$m=19456,t=2,p=1$bad"))
+	assert.False(t, CheckPasswordHash("password123", ""))
+	assert.True(t, PasswordNeedsRehash("$argon2id$v=19$m=19456,t=2,p=1$bad"))
+}
@@ -47,11 +47,12 @@ func HandleSuccess(c *fiber.Ctx, message string, data any) error {
 	})
 }
 
-func HandleLoginSuccess(c *fiber.Ctx, message string, token string, data any) error {
+func HandleLoginSuccess(c *fiber.Ctx, message string, token string, refreshToken string, data any) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"status":  "success",
-		"message": message,
-		"token":   token,
-		"data":    data,
+		"status":       "success",
+		"message":      message,
+		"token":        token,
+		"refreshToken": refreshToken,
+		"data":         data,
 	})
 }
@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/model"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+)
+
+const ACCOUNT_DELETION_INTERVAL = time.Hour
+
+// RunAccountDeletion deletes accounts whose grace period is over. Deletions that
+// can't go ahead because of new debts are cancelled and the user is told why.
+func RunAccountDeletion(kafkaSvc *services.KafkaService, notificationsChan chan<- NotificationData) {
+	logger := log.WithFields(log.Fields{"service": "AccountDeletionWorker"})
+
+	go func() {
+		ticker := time.NewTicker(ACCOUNT_DELETION_INTERVAL)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			deletionService := services.NewAccountDeletionService(database.DB)
+			deletions, err := deletionService.GetDueDeletions()
+			if err != nil {
+				logger.Error("Error getting due account deletions: ", err)
+				continue
+			}
+
+			for _, deletion := range *deletions {
+				deleteAccount(deletionService, deletion.UserID, kafkaSvc, notificationsChan, logger)
+			}
+		}
+	}()
+}
+
+func deleteAccount(
+	deletionService *services.AccountDeletionService,
+	userId uint,
+	kafkaSvc *services.KafkaService,
+	notificationsChan chan<- NotificationData,
+	logger *log.Entry,
+) {
+	deleted, err := deletionService.DeleteAccount(userId)
+	if errors.Is(err, services.ErrUnsettledDebts) {
+		if err := deletionService.CancelDeletion(userId); err != nil {
+			logger.Error("Error cancelling account deletion: ", err)
+			return
+		}
+		recordAuditEvent(userId, services.AUDIT_EVENT_ACCOUNT_DELETION_CANCELLED,
+			map[string]any{"reason": "unsettled debts"}, logger)
+		services.NewNotificationService(database.DB).NotifyUser(userId, "Account Deletion Cancelled",
+			"Your account wasn't deleted because you have unsettled bills or transactions. "+
+				"Settle them and request the deletion again.", notificationsChan)
+		return
+	}
+	if err != nil {
+		logger.Errorf("Error deleting account of user %d: %v", userId, err)
+		return
+	}
+	recordAuditEvent(userId, services.AUDIT_EVENT_ACCOUNT_DELETED, nil, logger)
+
+	notificationService := services.NewNotificationService(database.DB)
+	for _, handoff := range deleted.Handoffs {
+		notificationService.NotifyUser(handoff.NewHostID, "You're the Host Now",
+			fmt.Sprintf("The host of %s deleted their account, so you're now hosting it.", handoff.RoomName),
+			notificationsChan)
+	}
+
+	if store, err := utils.NewBlobStore(); err != nil {
+		logger.Error("Error creating blob store: ", err)
+	} else {
+		keys := deleted.ExportBlobKeys
+		if deleted.PictureKey != "" {
+			for name := range utils.AvatarSizes {
+				keys = append(keys, deleted.PictureKey+"/"+name+".jpg")
+			}
+		}
+		for _, key := range keys {
+			if err := store.Delete(context.Background(), key); err != nil {
+				logger.Warn("Error deleting blob of deleted account: ", err)
+			}
+		}
+	}
+
+	if err := kafkaSvc.DeleteTopic(fmt.Sprintf("user-%d", userId)); err != nil {
+		logger.Error("Error deleting topic: ", err)
+	}
+}
+
+func recordAuditEvent(userId uint, event string, details map[string]any, logger *log.Entry) {
+	entry := &model.AuditLog{UserID: &userId, Event: event, Success: true, Details: details}
+	if err := services.NewAuditService(database.DB).Record(entry); err != nil {
+		logger.Error("Error recording audit event ", event, ": ", err)
+	}
+}
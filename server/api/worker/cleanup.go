@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+)
+
+const CLEANUP_INTERVAL = time.Hour
+
+// RunCleanup periodically deletes auth records that are no longer needed,
+// expires stale friend requests and deletes old data exports
+func RunCleanup() {
+	logger := log.WithFields(log.Fields{"service": "CleanupWorker"})
+
+	go func() {
+		ticker := time.NewTicker(CLEANUP_INTERVAL)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := services.NewThrottleService(database.DB).DeleteStaleThrottles(); err != nil {
+				logger.Error("Error deleting stale throttles: ", err)
+			}
+			if err := services.NewPasskeyService(database.DB).DeleteExpiredSessions(); err != nil {
+				logger.Error("Error deleting expired passkey sessions: ", err)
+			}
+			if err := services.NewTwoFactorService(database.DB).DeleteExpiredChallenges(); err != nil {
+				logger.Error("Error deleting expired 2FA challenges: ", err)
+			}
+			if err := services.NewUserService(database.DB).ExpireFriendRequests(); err != nil {
+				logger.Error("Error expiring friend requests: ", err)
+			}
+			if store, err := utils.NewBlobStore(); err != nil {
+				logger.Error("Error creating blob store: ", err)
+			} else if err := services.NewDataExportService(database.DB).
+				DeleteExpiredExports(context.Background(), store); err != nil {
+				logger.Error("Error deleting expired data exports: ", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	"github.com/RowenTey/JustJio/server/api/services"
+	"github.com/RowenTey/JustJio/server/api/utils"
+)
+
+const DATA_EXPORT_POLL_INTERVAL = 30 * time.Second
+
+// RunDataExport builds requested data exports and notifies each user once theirs is ready
+func RunDataExport(notificationsChan chan<- NotificationData) {
+	logger := log.WithFields(log.Fields{"service": "DataExportWorker"})
+
+	go func() {
+		exportService := services.NewDataExportService(database.DB)
+		if err := exportService.RequeueInterruptedExports(); err != nil {
+			logger.Error("Error requeueing interrupted data exports: ", err)
+		}
+
+		ticker := time.NewTicker(DATA_EXPORT_POLL_INTERVAL)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			store, err := utils.NewBlobStore()
+			if err != nil {
+				logger.Error("Error creating blob store: ", err)
+				continue
+			}
+
+			for {
+				export, err := exportService.ClaimNextExport()
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					break
+				}
+				if err != nil {
+					logger.Error("Error claiming data export: ", err)
+					break
+				}
+
+				notificationService := services.NewNotificationService(database.DB)
+				if err := exportService.BuildExport(context.Background(), store, export); err != nil {
+					logger.Errorf("Error building data export %d: %v", export.ID, err)
+					notificationService.NotifyUser(export.UserID, "Data Export Failed",
+						"We couldn't prepare your data export. Please request it again.", notificationsChan)
+					continue
+				}
+				notificationService.NotifyUser(export.UserID, "Data Export Ready",
+					fmt.Sprintf("Your data export is ready to download for the next %d days.",
+						int(services.DATA_EXPORT_RETENTION/(24*time.Hour))), notificationsChan)
+			}
+		}
+	}()
+}
@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/api/database"
+	model_kafka "github.com/RowenTey/JustJio/server/api/model/kafka"
+	"github.com/RowenTey/JustJio/server/api/services"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+const PRESENCE_CONSUMER_GROUP = "api-presence"
+
+// RunPresence keeps each user's online status in sync with their WS connections
+// and tells their friends when it changes
+func RunPresence(kafkaSvc *services.KafkaService) {
+	logger := log.WithFields(log.Fields{"service": "PresenceWorker"})
+
+	go func() {
+		if err := kafkaSvc.CreateTopic(services.PRESENCE_TOPIC); err != nil {
+			logger.Warn("Error creating presence topic: ", err)
+		}
+
+		err := kafkaSvc.Consume(context.Background(), services.PRESENCE_TOPIC, PRESENCE_CONSUMER_GROUP,
+			func(msg *kafka.Message) {
+				var event model_kafka.PresenceEvent
+				if err := json.Unmarshal(msg.Value, &event); err != nil {
+					logger.Error("Error parsing presence event: ", err)
+					return
+				}
+				updatePresence(kafkaSvc, event, logger)
+			})
+		if err != nil {
+			logger.Error("Error consuming presence events: ", err)
+		}
+	}()
+}
+
+func updatePresence(kafkaSvc *services.KafkaService, event model_kafka.PresenceEvent, logger *log.Entry) {
+	userId, err := strconv.ParseUint(event.UserID, 10, 64)
+	if err != nil {
+		logger.Error("Invalid user ID in presence event: ", event.UserID)
+		return
+	}
+
+	userService := services.NewUserService(database.DB)
+
+	var changed bool
+	if event.IsOnline {
+		changed, err = userService.MarkOnline(event.UserID, event.At)
+	} else {
+		changed, err = userService.MarkOffline(event.UserID, event.At)
+	}
+	if err != nil {
+		logger.Errorf("Error updating presence of user %s: %v", event.UserID, err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	if err := userService.BroadcastPresence(kafkaSvc, uint(userId)); err != nil {
+		logger.Errorf("Error broadcasting presence of user %s: %v", event.UserID, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -78,6 +79,12 @@ func main() {
 	app := fiber.New()
 	connMap := utils.NewConnMap()
 
+	presenceService, err := services.NewPresenceService(utils.Config("KAFKA_URL"), env)
+	if err != nil {
+		log.WithField("service", "Kafka").Fatal(err)
+	}
+	defer presenceService.Close()
+
 	// healthcheck endpoint
 	app.Get("/ping", func(c *fiber.Ctx) error {
 		return c.Status(200).SendString("pong")
@@ -117,6 +124,8 @@ func main() {
 
 		// if the user is connecting for the first time, create a new Kafka client
 		if isInit {
+			presenceService.Publish(user.ID, true)
+
 			kafkaClient, err = services.NewKafkaService(utils.Config("KAFKA_URL"), consumerName)
 			if err != nil {
 				log.WithField("service", "Kafka").Fatal(err)
@@ -137,16 +146,26 @@ func main() {
 			kafkaClient = userKafkaClients[user.ID].client
 		}
 
-		onClose := func(code int, text string) error {
-			log.WithField("service", "WebSocket").Infof("User %s disconnected\n", user.ID)
-			// only runs when the last connection is removed
-			remove(func() {
-				if err := kafkaClient.Unsubscribe(); err != nil {
-					log.WithField("service", "Kafka").Error(err)
-				}
-				kafkaClient.Close()
-				delete(userKafkaClients, user.ID)
+		// runs once, whether the client closed the connection or it broke
+		var closeOnce sync.Once
+		cleanup := func() {
+			closeOnce.Do(func() {
+				log.WithField("service", "WebSocket").Infof("User %s disconnected\n", user.ID)
+				// only runs when the last connection is removed
+				remove(func() {
+					if err := kafkaClient.Unsubscribe(); err != nil {
+						log.WithField("service", "Kafka").Error(err)
+					}
+					kafkaClient.Close()
+					delete(userKafkaClients, user.ID)
+					presenceService.Publish(user.ID, false)
+				})
 			})
+		}
+		defer cleanup()
+
+		onClose := func(code int, text string) error {
+			cleanup()
 			return nil
 		}
 		c.SetCloseHandler(onClose)
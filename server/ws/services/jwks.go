@@ -0,0 +1,132 @@
+package services
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/ws/utils"
+)
+
+const (
+	// How long fetched keys are reused before asking the API again
+	JWKS_CACHE_TTL = time.Minute * 5
+	// Minimum gap between fetches triggered by an unknown key ID
+	JWKS_MIN_REFETCH_INTERVAL = time.Second * 10
+	JWKS_REQUEST_TIMEOUT      = time.Second * 5
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwksCache struct {
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// Public keys the API signs access tokens with, fetched from its JWKS endpoint
+var (
+	publicKeys   jwksCache
+	publicKeysMu sync.Mutex
+	jwksClient   = &http.Client{Timeout: JWKS_REQUEST_TIMEOUT}
+	jwksLogger   = log.WithFields(log.Fields{"service": "JWKS"})
+)
+
+// GetPublicKey returns the API's public key for a key ID, refetching the key set
+// when the ID is unknown in case the API has rotated its signing key
+func GetPublicKey(kid string) (*rsa.PublicKey, error) {
+	publicKeysMu.Lock()
+	defer publicKeysMu.Unlock()
+
+	sinceFetch := time.Since(publicKeys.fetchedAt)
+	if key, ok := publicKeys.keys[kid]; ok && sinceFetch < JWKS_CACHE_TTL {
+		return key, nil
+	}
+
+	if sinceFetch >= JWKS_MIN_REFETCH_INTERVAL || publicKeys.keys == nil {
+		if err := fetchPublicKeys(); err != nil {
+			jwksLogger.Error("Error fetching JWKS: ", err)
+		}
+	}
+
+	key, ok := publicKeys.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	return key, nil
+}
+
+// fetchPublicKeys refreshes the cache from JWKS_URL. Must be called with publicKeysMu held.
+func fetchPublicKeys() error {
+	// Count failed attempts too, so an unreachable API isn't hammered on every connection
+	publicKeys.fetchedAt = time.Now()
+
+	resp, err := jwksClient.Get(utils.Config("JWKS_URL"))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(body.Keys))
+	for _, key := range body.Keys {
+		if key.Kty != "RSA" || key.Alg != "RS256" {
+			continue
+		}
+
+		publicKey, err := parseRSAPublicKey(key.N, key.E)
+		if err != nil {
+			jwksLogger.Error("Error parsing key ", key.Kid, ": ", err)
+			continue
+		}
+		keys[key.Kid] = publicKey
+	}
+
+	publicKeys.keys = keys
+	jwksLogger.Debugf("Fetched %d public keys", len(keys))
+	return nil
+}
+
+func parseRSAPublicKey(encodedN, encodedE string) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(encodedN)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(encodedE)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
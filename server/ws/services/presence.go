@@ -0,0 +1,89 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/RowenTey/JustJio/server/ws/utils"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// PresenceEvent tells the API that a user's first connection opened or their last one closed
+type PresenceEvent struct {
+	UserID   string    `json:"userId"`
+	IsOnline bool      `json:"isOnline"`
+	At       time.Time `json:"at"`
+}
+
+type PresenceService struct {
+	Producer *kafka.Producer
+	topic    string
+	logger   *log.Entry
+}
+
+func GetPresenceTopic(env string) string {
+	topic := "presence"
+	if env == "dev" || env == "staging" {
+		topic = fmt.Sprintf("%s-%s", env, topic)
+	}
+	topic = fmt.Sprintf("%s-%s", utils.Config("KAFKA_TOPIC_PREFIX"), topic)
+	return topic
+}
+
+// Creates a new PresenceService instance
+func NewPresenceService(brokers, env string) (*PresenceService, error) {
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": brokers})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &PresenceService{
+		Producer: producer,
+		topic:    GetPresenceTopic(env),
+		logger:   log.WithField("service", "Presence"),
+	}
+
+	// report failed deliveries, as Publish doesn't wait for them
+	go func() {
+		for e := range producer.Events() {
+			if m, ok := e.(*kafka.Message); ok && m.TopicPartition.Error != nil {
+				s.logger.Error("Failed to deliver presence event: ", m.TopicPartition.Error)
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+// Publishes a presence change without blocking the connection.
+// Events are keyed by user so each user's events stay in order.
+func (s *PresenceService) Publish(userId string, isOnline bool) {
+	value, err := json.Marshal(PresenceEvent{
+		UserID:   userId,
+		IsOnline: isOnline,
+		At:       time.Now(),
+	})
+	if err != nil {
+		s.logger.Error("Failed to encode presence event: ", err)
+		return
+	}
+
+	if err := s.Producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &s.topic, Partition: kafka.PartitionAny},
+		Key:            []byte(userId),
+		Value:          value,
+	}, nil); err != nil {
+		s.logger.Error("Failed to publish presence event: ", err)
+		return
+	}
+	s.logger.Debugf("Published presence of %s: online=%t", userId, isOnline)
+}
+
+func (s *PresenceService) Close() {
+	s.logger.Info("Closing presence producer")
+	s.Producer.Flush(5000)
+	s.Producer.Close()
+}
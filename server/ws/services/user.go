@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/RowenTey/JustJio/server/ws/utils"
 	"github.com/gofiber/websocket/v2"
 	"github.com/golang-jwt/jwt"
 )
@@ -19,9 +18,17 @@ func GetCurrentUser(c *websocket.Conn) (*User, error) {
 		return nil, errors.New("no token provided")
 	}
 
-	// Decode the JWT token
+	// Decode the JWT token, verifying it with the API's public key it names
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return []byte(utils.Config("JWT_SECRET")), nil
+		if token.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+
+		kid, ok := token.Header["kid"].(string)
+		if !ok || kid == "" {
+			return nil, errors.New("missing key ID")
+		}
+		return GetPublicKey(kid)
 	})
 	if err != nil {
 		return nil, err